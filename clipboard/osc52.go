@@ -0,0 +1,19 @@
+package clipboard
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/juju/errors"
+)
+
+// WriteOSC52 writes the OSC 52 escape sequence to the given writer (which is
+// normally the terminal), asking the terminal to put the value to the system
+// clipboard. It works even when nerdlog runs on a remote host over ssh, as
+// long as the terminal emulator supports OSC 52; but there's no way to know
+// whether it does.
+func WriteOSC52(w io.Writer, value []byte) error {
+	_, err := fmt.Fprintf(w, "\x1b]52;c;%s\x07", base64.StdEncoding.EncodeToString(value))
+	return errors.Trace(err)
+}
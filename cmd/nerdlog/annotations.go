@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// annotationMarker is shown before the time of the annotated messages in the
+// logs table.
+const annotationMarker = "[black:yellow]*[-:-]"
+
+// ConfigAnnotations is the file with the notes attached to log lines, usually
+// ~/.config/nerdlog/annotations.yaml. It's maintained with the :annotate
+// command (or "m" in the logs table), but can be edited manually too.
+type ConfigAnnotations struct {
+	Annotations []Annotation `yaml:"annotations"`
+}
+
+// Annotation is a free-text note attached to a log line. The line is
+// identified by the logstream, file and line number; for the lines without
+// line numbers (like journalctl ones), by the time and the message instead.
+type Annotation struct {
+	LStream    string    `yaml:"lstream"`
+	Filename   string    `yaml:"filename,omitempty"`
+	Linenumber int       `yaml:"linenumber,omitempty"`
+	Time       time.Time `yaml:"time"`
+	Msg        string    `yaml:"msg"`
+
+	Note string `yaml:"note"`
+}
+
+// Annotations is the set of annotations, persisted to disk.
+type Annotations struct {
+	path string
+
+	mtx   sync.Mutex
+	items map[string]Annotation
+}
+
+// getAnnotationKey returns the key which identifies the log line the
+// annotation is attached to.
+func getAnnotationKey(lstream, filename string, linenumber int, t time.Time, msg string) string {
+	if linenumber != 0 {
+		return fmt.Sprintf("%s\x00%s:%d", lstream, filename, linenumber)
+	}
+
+	return fmt.Sprintf("%s\x00%s\x00%s", lstream, t.UTC().Format(time.RFC3339Nano), msg)
+}
+
+func getLogMsgAnnotationKey(msg *core.LogMsg) string {
+	return getAnnotationKey(msg.Context["lstream"], msg.LogFilename, msg.LogLinenumber, msg.Time, msg.Msg)
+}
+
+func (a *Annotation) key() string {
+	return getAnnotationKey(a.LStream, a.Filename, a.Linenumber, a.Time, a.Msg)
+}
+
+// loadAnnotationsIfExists loads the annotations from the given path; if the
+// file doesn't exist, it's not an error, and there are just no annotations.
+func loadAnnotationsIfExists(path string) (*Annotations, error) {
+	ann := &Annotations{
+		path:  path,
+		items: map[string]Annotation{},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ann, nil
+		}
+
+		return nil, errors.Annotatef(err, "reading annotations from %s", path)
+	}
+
+	var cfg ConfigAnnotations
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Annotatef(err, "unmarshaling yaml from %s", path)
+	}
+
+	for _, a := range cfg.Annotations {
+		ann.items[a.key()] = a
+	}
+
+	return ann, nil
+}
+
+// loadAnnotationsOrSetAside is like loadAnnotationsIfExists, but if the file
+// can't be loaded (e.g. it's corrupted), it's not fatal: the file is renamed
+// to have a suffix like ".bad-20250312-100000", so that it's not overwritten
+// once some annotation is saved, and can be fixed manually; the returned
+// annotations are empty then, and the returned warning tells about it. If the
+// file can't even be renamed, an error is returned.
+func loadAnnotationsOrSetAside(path string, now time.Time) (ann *Annotations, warning string, err error) {
+	ann, loadErr := loadAnnotationsIfExists(path)
+	if loadErr == nil {
+		return ann, "", nil
+	}
+
+	badPath := fmt.Sprintf("%s.bad-%s", path, now.Format("20060102-150405"))
+	if err := os.Rename(path, badPath); err != nil {
+		return nil, "", errors.Annotatef(loadErr, "also failed to move it aside: %s", err)
+	}
+
+	ann = &Annotations{
+		path:  path,
+		items: map[string]Annotation{},
+	}
+
+	return ann, fmt.Sprintf(
+		"%s; moved it to %s, starting without annotations", loadErr, badPath,
+	), nil
+}
+
+// Get returns the note attached to the given log message, if any.
+func (ann *Annotations) Get(msg *core.LogMsg) (string, bool) {
+	ann.mtx.Lock()
+	defer ann.mtx.Unlock()
+
+	a, ok := ann.items[getLogMsgAnnotationKey(msg)]
+	return a.Note, ok
+}
+
+// GetAll returns all the annotations, sorted by time.
+func (ann *Annotations) GetAll() []Annotation {
+	ann.mtx.Lock()
+	defer ann.mtx.Unlock()
+
+	ret := make([]Annotation, 0, len(ann.items))
+	for _, a := range ann.items {
+		ret = append(ret, a)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if !ret[i].Time.Equal(ret[j].Time) {
+			return ret[i].Time.Before(ret[j].Time)
+		}
+
+		return ret[i].key() < ret[j].key()
+	})
+
+	return ret
+}
+
+// Set attaches the note to the given log message, replacing the existing one
+// if any; an empty note removes it. The annotations are then saved.
+func (ann *Annotations) Set(msg *core.LogMsg, note string) error {
+	ann.mtx.Lock()
+	defer ann.mtx.Unlock()
+
+	key := getLogMsgAnnotationKey(msg)
+	if note == "" {
+		delete(ann.items, key)
+	} else {
+		ann.items[key] = Annotation{
+			LStream:    msg.Context["lstream"],
+			Filename:   msg.LogFilename,
+			Linenumber: msg.LogLinenumber,
+			Time:       msg.Time,
+			Msg:        msg.Msg,
+			Note:       note,
+		}
+	}
+
+	return ann.save()
+}
+
+func (ann *Annotations) save() error {
+	cfg := ConfigAnnotations{
+		Annotations: make([]Annotation, 0, len(ann.items)),
+	}
+
+	keys := make([]string, 0, len(ann.items))
+	for k := range ann.items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		cfg.Annotations = append(cfg.Annotations, ann.items[k])
+	}
+
+	data, err := yaml.Marshal(&cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ann.path), 0755); err != nil {
+		return errors.Annotatef(err, "creating dir for %s", ann.path)
+	}
+
+	if err := ioutil.WriteFile(ann.path, data, 0644); err != nil {
+		return errors.Annotatef(err, "writing annotations to %s", ann.path)
+	}
+
+	return nil
+}
+
+// getAnnotatedMsgIdxs returns the indices of the given messages which have
+// annotations, or nil if there are none.
+func (ann *Annotations) getAnnotatedMsgIdxs(logs []core.LogMsg) map[int]struct{} {
+	if ann == nil {
+		return nil
+	}
+
+	ann.mtx.Lock()
+	defer ann.mtx.Unlock()
+
+	if len(ann.items) == 0 {
+		return nil
+	}
+
+	var ret map[int]struct{}
+	for i := range logs {
+		if _, ok := ann.items[getLogMsgAnnotationKey(&logs[i])]; ok {
+			if ret == nil {
+				ret = map[int]struct{}{}
+			}
+			ret[i] = struct{}{}
+		}
+	}
+
+	return ret
+}
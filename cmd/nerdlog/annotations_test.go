@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotationsPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nerdlog", "annotations.yaml")
+
+	t1 := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+
+	logs := []core.LogMsg{
+		{
+			Time: t1, Msg: "foo", LogFilename: "/var/log/syslog", LogLinenumber: 10,
+			Context: map[string]string{"lstream": "host1"},
+		},
+		{
+			// No line number, like journalctl messages.
+			Time: t2, Msg: "bar",
+			Context: map[string]string{"lstream": "host2"},
+		},
+		{
+			Time: t2, Msg: "baz", LogFilename: "/var/log/syslog", LogLinenumber: 11,
+			Context: map[string]string{"lstream": "host1"},
+		},
+	}
+
+	ann, err := loadAnnotationsIfExists(path)
+	assert.NoError(t, err)
+	assert.Nil(t, ann.getAnnotatedMsgIdxs(logs))
+
+	assert.NoError(t, ann.Set(&logs[1], "second note"))
+	assert.NoError(t, ann.Set(&logs[0], "first note"))
+
+	note, ok := ann.Get(&logs[0])
+	assert.True(t, ok)
+	assert.Equal(t, "first note", note)
+
+	_, ok = ann.Get(&logs[2])
+	assert.False(t, ok)
+
+	ann2, err := loadAnnotationsIfExists(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]struct{}{0: {}, 1: {}}, ann2.getAnnotatedMsgIdxs(logs))
+
+	all := ann2.GetAll()
+	if assert.Len(t, all, 2) {
+		assert.Equal(t, "first note", all[0].Note)
+		assert.Equal(t, "/var/log/syslog", all[0].Filename)
+		assert.Equal(t, 10, all[0].Linenumber)
+		assert.Equal(t, "second note", all[1].Note)
+		assert.Equal(t, "host2", all[1].LStream)
+	}
+
+	// The line is identified by its file and line number, so the note stays
+	// even if the message was parsed differently.
+	changed := logs[0]
+	changed.Msg = "foo changed"
+	note, ok = ann2.Get(&changed)
+	assert.True(t, ok)
+	assert.Equal(t, "first note", note)
+
+	// An empty note removes the annotation.
+	assert.NoError(t, ann2.Set(&logs[0], ""))
+
+	ann3, err := loadAnnotationsIfExists(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]struct{}{1: {}}, ann3.getAnnotatedMsgIdxs(logs))
+}
+
+func TestAnnotationsNil(t *testing.T) {
+	var ann *Annotations
+	assert.Nil(t, ann.getAnnotatedMsgIdxs([]core.LogMsg{{Msg: "foo"}}))
+}
+
+func TestLoadAnnotationsOrSetAside(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "annotations.yaml")
+	now := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+
+	// No file yet.
+	ann, warning, err := loadAnnotationsOrSetAside(path, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "", warning)
+	assert.Empty(t, ann.GetAll())
+
+	// A corrupted file is moved aside, so that saving a new annotation doesn't
+	// overwrite it.
+	assert.NoError(t, ioutil.WriteFile(path, []byte("annotations: [oops"), 0644))
+
+	ann, warning, err = loadAnnotationsOrSetAside(path, now)
+	assert.NoError(t, err)
+	assert.Contains(t, warning, "moved it to "+path+".bad-20250312-100000")
+	assert.Empty(t, ann.GetAll())
+
+	data, err := ioutil.ReadFile(path + ".bad-20250312-100000")
+	assert.NoError(t, err)
+	assert.Equal(t, "annotations: [oops", string(data))
+
+	msg := core.LogMsg{
+		Time: now, Msg: "foo", LogFilename: "/var/log/syslog", LogLinenumber: 10,
+		Context: map[string]string{"lstream": "host1"},
+	}
+	assert.NoError(t, ann.Set(&msg, "note"))
+
+	ann, warning, err = loadAnnotationsOrSetAside(path, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "", warning)
+	assert.Len(t, ann.GetAll(), 1)
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
 	"strings"
 	"time"
@@ -46,6 +47,34 @@ type nerdlogApp struct {
 
 	// lastLogResp contains the last response from LStreamsManager.
 	lastLogResp *core.LogRespTotal
+
+	// logstreamsCfgPath is the path to the nerdlog's logstreams config, like
+	// ~/.config/nerdlog/logstreams.yaml. The file doesn't have to exist.
+	logstreamsCfgPath string
+	// logstreamsCfg is the logstreams config currently in effect.
+	logstreamsCfg *ConfigLogStreams
+	// sshConfig is the ssh config, or nil if it's not available.
+	sshConfig *ssh_config.Config
+
+	// queryTemplatesPath is the path to the file with saved query templates,
+	// like ~/.config/nerdlog/query_templates.yaml. The file doesn't have to
+	// exist.
+	queryTemplatesPath string
+	// queryTemplates is a map from the template name to the awk pattern with
+	// placeholders; see the :run command.
+	queryTemplates map[string]string
+
+	// recentLStreams is the MRU list of the logstreams filters, persisted in
+	// ~/.config/nerdlog/recent_lstreams.yaml.
+	recentLStreams *RecentLStreams
+
+	// snapshotsDir is the dir with the saved result sets, like
+	// ~/.config/nerdlog/snapshots; see the :snapshot command.
+	snapshotsDir string
+
+	// annotations are the notes attached to log lines, persisted in
+	// ~/.config/nerdlog/annotations.yaml; see the :annotate command.
+	annotations *Annotations
 }
 
 type nerdlogAppParams struct {
@@ -85,8 +114,26 @@ func newNerdlogApp(
 		params: params,
 
 		options: NewOptionsShared(Options{
-			Timezone:    time.Local,
-			MaxNumLines: 250,
+			Timezone:      time.Local,
+			MaxNumLines:   250,
+			MaxRows:       50000,
+			MaxLineLength: 10000,
+			QueryTimeout:  5 * time.Minute,
+			GapThreshold:  10 * time.Minute,
+			AroundDur:     5 * time.Minute,
+
+			QuietThreshold: 100,
+
+			TimeRound:            timeRoundCeil,
+			TimeRoundGranularity: 1 * time.Minute,
+
+			HistogramRange: histRangeQuery,
+			ViewMode:       viewModeTable,
+
+			DefaultQueries: true,
+			ShowMinimap:    true,
+			ShowHistogram:  true,
+			LinkCursor:     true,
 		}),
 
 		tviewApp: tview.NewApplication(),
@@ -96,6 +143,35 @@ func newNerdlogApp(
 		queryCLHistory: queryCLHistory,
 	}
 
+	app.snapshotsDir = filepath.Join(homeDir, ".config", "nerdlog", "snapshots")
+	app.queryTemplatesPath = filepath.Join(homeDir, ".config", "nerdlog", "query_templates.yaml")
+	app.queryTemplates, err = loadQueryTemplatesIfExists(app.queryTemplatesPath)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	// startupWarnings are the non-fatal issues found during the startup; they
+	// are shown once the UI is ready.
+	var startupWarnings []string
+
+	var warning string
+	app.recentLStreams, warning = loadRecentLStreamsOrEmpty(
+		filepath.Join(homeDir, ".config", "nerdlog", "recent_lstreams.yaml"),
+	)
+	if warning != "" {
+		startupWarnings = append(startupWarnings, warning)
+	}
+
+	app.annotations, warning, err = loadAnnotationsOrSetAside(
+		filepath.Join(homeDir, ".config", "nerdlog", "annotations.yaml"), time.Now(),
+	)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if warning != "" {
+		startupWarnings = append(startupWarnings, warning)
+	}
+
 	cmdCh := make(chan cmdWithOpts, 8)
 
 	app.mainView = NewMainView(&MainViewParams{
@@ -103,6 +179,10 @@ func newNerdlogApp(
 		Options: app.options,
 		OnLogQuery: func(params core.QueryLogsParams) {
 			params.MaxNumLines = app.options.GetMaxNumLines()
+			params.MaxRetainedLines = app.options.GetMaxRows()
+			params.Timeout = app.options.GetQueryTimeout()
+			params.DefaultIdleTimeout = app.options.GetIdleTimeout()
+			params.NoDefaultQueries = !app.options.GetDefaultQueries()
 
 			// Get the current QueryFull and marshal it to a shell command.
 			qf := app.mainView.getQueryFull()
@@ -129,6 +209,17 @@ func newNerdlogApp(
 
 			return nil
 		},
+		OnMutedLStreamsChange: func(names []string) error {
+			err := app.lsman.SetMutedLStreams(names)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			return nil
+		},
+		OnFetchLines: func(lstreamName string, lineRange core.LineRange) {
+			app.lsman.FetchLines(lstreamName, lineRange)
+		},
 		OnDisconnectRequest: func() {
 			app.lsman.Disconnect()
 		},
@@ -141,6 +232,13 @@ func newNerdlogApp(
 				opts: opts,
 			}
 		},
+		OnCmdComplete: app.completeCmd,
+
+		GetLStreamSudoMode: app.getLStreamSudoMode,
+		IsLStreamLocal:     app.isLStreamLocal,
+
+		RecentLStreams: app.recentLStreams,
+		Annotations:    app.annotations,
 
 		CmdHistory:   app.cmdLineHistory,
 		QueryHistory: app.queryCLHistory,
@@ -162,13 +260,27 @@ func newNerdlogApp(
 		}
 	}
 
+	if len(startupWarnings) > 0 {
+		for _, warning := range startupWarnings {
+			logger.Warnf("%s", warning)
+		}
+
+		app.mainView.showStartupWarnings(startupWarnings)
+	}
+
 	go app.handleCmdLine(cmdCh)
 
 	return app, nil
 }
 
 func (app *nerdlogApp) runTViewApp() error {
-	err := app.tviewApp.SetRoot(app.mainView.GetUIPrimitive(), true).Run()
+	// Use our own screen to handle the bracketed paste properly.
+	screen, err := newPasteScreen()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = app.tviewApp.SetScreen(screen).SetRoot(app.mainView.GetUIPrimitive(), true).Run()
 
 	// Now that TUI app has finished, remember that by resetting it to nil.
 	app.tviewApp = nil
@@ -194,6 +306,21 @@ func (app *nerdlogApp) initLStreamsManager(
 		var bootstrapErrors []error
 		var bootstrapWarnings []error
 		var dataRequests []*core.ShellConnDataRequest
+		var fetchedLines []*core.FetchedLines
+
+		// The post-query hook (see the posthook option) runs in the background,
+		// and its results come back via postQueryHookCh; logRespSeq is
+		// incremented on every new response, so that the hook results which are
+		// already superseded are dropped.
+		postQueryHookCh := make(chan postQueryHookResult)
+		var logRespSeq int
+		var hookedLogResps []*core.LogRespTotal
+		var postQueryHookErr error
+
+		// To avoid redrawing the logs too often (see the redrawinterval option),
+		// the new logs might be held back until throttleTimer fires.
+		var lastLogsApplied time.Time
+		var throttleCh <-chan time.Time
 
 		handleUpdate := func(upd core.LStreamsManagerUpdate) {
 			switch {
@@ -201,6 +328,7 @@ func (app *nerdlogApp) initLStreamsManager(
 				lastState = upd.State
 			case upd.LogResp != nil:
 				logResps = append(logResps, upd.LogResp)
+				logRespSeq++
 			case upd.BootstrapIssue != nil:
 				if upd.BootstrapIssue.Err != "" {
 					bootstrapErrors = append(
@@ -219,17 +347,76 @@ func (app *nerdlogApp) initLStreamsManager(
 			case upd.DataRequest != nil:
 				dataRequests = append(dataRequests, upd.DataRequest)
 
+			case upd.FetchedLines != nil:
+				fetchedLines = append(fetchedLines, upd.FetchedLines)
+
 			default:
 				panic("empty lstreams manager update")
 			}
 		}
 
+		handlePostQueryHookResult := func(res postQueryHookResult) {
+			if res.seq != logRespSeq {
+				return
+			}
+
+			if res.err != nil {
+				postQueryHookErr = res.err
+				hookedLogResps = append(hookedLogResps, res.orig)
+				return
+			}
+
+			hookedLogResps = append(hookedLogResps, res.hooked)
+		}
+
 		for {
 			select {
 			case upd := <-updatesCh:
 				handleUpdate(upd)
 
+			case res := <-postQueryHookCh:
+				handlePostQueryHookResult(res)
+
 			default:
+				// Hold back the new logs if they'd be redrawn too soon; the timer will
+				// get us here again when it's time.
+				applyLogResps := logResps
+				if len(logResps) > 0 {
+					delay := getRedrawThrottleDelay(
+						app.options.GetRedrawInterval(), lastLogsApplied, time.Now(), logResps,
+					)
+					if delay > 0 {
+						applyLogResps = nil
+						if throttleCh == nil {
+							throttleCh = time.After(delay)
+						}
+					}
+				}
+
+				// Let the post-query hook transform the logs which are going to be
+				// shown: instead of being shown right away, the last response is
+				// passed to the hook in the background, and shown once the hook is
+				// done (see handlePostQueryHookResult); if it fails, the response is
+				// shown as is. The earlier ones are superseded by it anyway.
+				if command := app.options.GetPostQueryHook(); command != "" && len(applyLogResps) > 0 {
+					logResp := applyLogResps[len(applyLogResps)-1]
+					if len(logResp.Errs) == 0 {
+						go func(seq int) {
+							hooked, err := runPostQueryHook(command, logResp, postQueryHookTimeout)
+							postQueryHookCh <- postQueryHookResult{
+								seq: seq, orig: logResp, hooked: hooked, err: err,
+							}
+						}(logRespSeq)
+
+						applyLogResps = nil
+						logResps = nil
+					}
+				}
+
+				if len(hookedLogResps) > 0 {
+					applyLogResps = append(append([]*core.LogRespTotal(nil), applyLogResps...), hookedLogResps...)
+				}
+
 				// If anything has changed, update the UI.
 				//
 				// The tviewApp might be nil here if the TUI app has finished, but we're
@@ -237,24 +424,38 @@ func (app *nerdlogApp) initLStreamsManager(
 				// just don't update the TUI.
 				if app.tviewApp != nil &&
 					(lastState != nil ||
-						len(logResps) > 0 ||
+						len(applyLogResps) > 0 ||
 						len(bootstrapErrors) > 0 ||
 						len(bootstrapWarnings) > 0 ||
-						len(dataRequests) > 0) {
+						len(dataRequests) > 0 ||
+						len(fetchedLines) > 0) {
 
+					hookErr := postQueryHookErr
 					app.tviewApp.QueueUpdateDraw(func() {
 						if lastState != nil {
 							app.mainView.applyHMState(lastState)
 						}
 
-						for _, logResp := range logResps {
+						for i, logResp := range applyLogResps {
 							if len(logResp.Errs) > 0 {
 								app.mainView.handleQueryError(combineErrors(logResp.Errs))
 								return
 							}
 
-							app.mainView.applyLogs(logResp)
-							app.lastLogResp = logResp
+							// Partial responses are only useful to populate the UI while the
+							// query is in progress, so if there's anything newer, skip them.
+							if logResp.Partial && i < len(applyLogResps)-1 {
+								continue
+							}
+
+							app.applyLogs(logResp)
+						}
+
+						if hookErr != nil {
+							app.mainView.printMsg(
+								fmt.Sprintf("Post-query hook failed, showing the results as is: %s", hookErr),
+								nlMsgLevelWarn,
+							)
 						}
 
 						if len(bootstrapErrors) > 0 {
@@ -268,19 +469,34 @@ func (app *nerdlogApp) initLStreamsManager(
 						for _, dataReq := range dataRequests {
 							app.mainView.handleDataRequest(dataReq)
 						}
+
+						for _, fetched := range fetchedLines {
+							app.mainView.handleFetchedLines(fetched)
+						}
 					})
 
+					if len(applyLogResps) > 0 {
+						lastLogsApplied = time.Now()
+						logResps = nil
+					}
+
+					hookedLogResps = nil
+					postQueryHookErr = nil
 					lastState = nil
-					logResps = nil
 					bootstrapErrors = nil
 					bootstrapWarnings = nil
 					dataRequests = nil
+					fetchedLines = nil
 				}
 
 				// The same select again, but without the default case.
 				select {
 				case upd := <-updatesCh:
 					handleUpdate(upd)
+				case res := <-postQueryHookCh:
+					handlePostQueryHookResult(res)
+				case <-throttleCh:
+					throttleCh = nil
 				}
 			}
 		}
@@ -288,17 +504,17 @@ func (app *nerdlogApp) initLStreamsManager(
 
 	envUser := os.Getenv("USER")
 
-	var logstreamsCfg core.ConfigLogStreams
-	logstreamsCfgPath := filepath.Join(homeDir, ".config", "nerdlog", "logstreams.yaml")
-	_, statErr := os.Stat(logstreamsCfgPath)
-	if statErr == nil {
-		appLogstreamsCfg, err := LoadLogstreamsConfigFromFile(logstreamsCfgPath)
-		if err != nil {
-			return errors.Trace(err)
-		}
-
-		logstreamsCfg = appLogstreamsCfg.LogStreams
+	app.logstreamsCfgPath = os.Getenv("NERDLOG_LOGSTREAMS_CONFIG")
+	if app.logstreamsCfgPath == "" {
+		app.logstreamsCfgPath = filepath.Join(homeDir, ".config", "nerdlog", "logstreams.yaml")
 	}
+	logstreamsCfg, err := loadLogstreamsConfigIfExists(app.logstreamsCfgPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	app.logstreamsCfg = logstreamsCfg
+	app.mainView.setLStreamGroups(logstreamsCfg.Groups)
 
 	var sshConfig *ssh_config.Config
 	if params.sshConfigPath != "" {
@@ -342,12 +558,15 @@ func (app *nerdlogApp) initLStreamsManager(
 		}
 	}
 
+	app.sshConfig = sshConfig
+
 	app.lsman = core.NewLStreamsManager(core.LStreamsManagerParams{
 		Logger: logger,
 
-		ConfigLogStreams: logstreamsCfg,
-		SSHConfig:        sshConfig,
-		SSHKeys:          params.sshKeys,
+		ConfigLogStreams:    logstreamsCfg.LogStreams,
+		ConfigLStreamGroups: logstreamsCfg.Groups,
+		SSHConfig:           sshConfig,
+		SSHKeys:             params.sshKeys,
 
 		InitialLStreams: initialLStreams,
 
@@ -361,6 +580,119 @@ func (app *nerdlogApp) initLStreamsManager(
 	return nil
 }
 
+// loadLogstreamsConfigIfExists loads the logstreams config from the given
+// path; if the file doesn't exist, it's not an error, and an empty config is
+// returned.
+func loadLogstreamsConfigIfExists(path string) (*ConfigLogStreams, error) {
+	if _, err := os.Stat(path); err != nil {
+		return &ConfigLogStreams{}, nil
+	}
+
+	appLogstreamsCfg, err := LoadLogstreamsConfigFromFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return appLogstreamsCfg, nil
+}
+
+// reloadConfig reads the logstreams config again and applies it. If the
+// config fails to load or apply, the old one remains in effect, and the
+// error is returned.
+func (app *nerdlogApp) reloadConfig() error {
+	return errors.Trace(app.reloadConfigFrom(app.logstreamsCfgPath))
+}
+
+// reloadConfigFrom is like reloadConfig, but reads the config from the given
+// path; if it's applied successfully, the path is used for all further
+// reloads (and :config) as well.
+func (app *nerdlogApp) reloadConfigFrom(cfgPath string) error {
+	logstreamsCfg, err := loadLogstreamsConfigIfExists(cfgPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := app.lsman.SetConfigLogStreams(logstreamsCfg.LogStreams, logstreamsCfg.Groups); err != nil {
+		return errors.Annotatef(err, "applying config from %s", cfgPath)
+	}
+
+	app.logstreamsCfgPath = cfgPath
+	app.logstreamsCfg = logstreamsCfg
+	app.mainView.setLStreamGroups(logstreamsCfg.Groups)
+
+	// Some logstreams might be reconnecting now, so repeat the query once we're
+	// connected.
+	app.mainView.doQueryParamsOnceConnected = &doQueryParams{}
+
+	return nil
+}
+
+// getKnownLStreams returns the names of all logstreams and groups which are
+// known from the configs.
+func (app *nerdlogApp) getKnownLStreams() ([]string, error) {
+	resolver := core.NewLStreamsResolver(core.LStreamsResolverParams{
+		ConfigLogStreams:    app.logstreamsCfg.LogStreams,
+		ConfigLStreamGroups: app.logstreamsCfg.Groups,
+		SSHConfig:           app.sshConfig,
+	})
+
+	names, err := resolver.KnownLStreams()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return names, nil
+}
+
+// resolveLStream resolves the given logstream name (as present in the
+// "lstream" context field of log messages) using the current configs; returns
+// false if it can't be resolved.
+func (app *nerdlogApp) resolveLStream(lstream string) (core.LogStream, bool) {
+	var curOSUser string
+	if u, err := user.Current(); err == nil {
+		curOSUser = u.Username
+	}
+
+	resolver := core.NewLStreamsResolver(core.LStreamsResolverParams{
+		CurOSUser: curOSUser,
+
+		ConfigLogStreams:    app.logstreamsCfg.LogStreams,
+		ConfigLStreamGroups: app.logstreamsCfg.Groups,
+		SSHConfig:           app.sshConfig,
+	})
+
+	lstreams, err := resolver.Resolve(lstream)
+	if err != nil {
+		return core.LogStream{}, false
+	}
+
+	ls, ok := lstreams[lstream]
+	return ls, ok
+}
+
+// getLStreamSudoMode returns the sudo mode for the given logstream name (as
+// present in the "lstream" context field of log messages). If the logstream
+// can't be resolved, SudoModeNone is returned.
+func (app *nerdlogApp) getLStreamSudoMode(lstream string) core.SudoMode {
+	ls, ok := app.resolveLStream(lstream)
+	if !ok {
+		return core.SudoModeNone
+	}
+
+	return ls.Options.SudoMode
+}
+
+// isLStreamLocal returns whether the given logstream is on the local host, so
+// its log files can be accessed directly.
+func (app *nerdlogApp) isLStreamLocal(lstream string) bool {
+	ls, ok := app.resolveLStream(lstream)
+	if !ok {
+		return false
+	}
+
+	return ls.Transport.Localhost != nil
+}
+
 func (app *nerdlogApp) handleCmdLine(cmdCh <-chan cmdWithOpts) {
 	for {
 		cwo := <-cmdCh
@@ -369,12 +701,46 @@ func (app *nerdlogApp) handleCmdLine(cmdCh <-chan cmdWithOpts) {
 				app.cmdLineHistory.Add(cwo.cmd)
 			}
 			app.handleCmd(cwo.cmd)
+			app.applyFrozenLogs()
 			app.mainView.formatTimeRange()
 			app.mainView.formatLogs()
 		})
 	}
 }
 
+// applyLogs shows the query result, unless the freeze option is on and the
+// query was rerun by the autorefresh: then it's held back until the option is
+// off, see applyFrozenLogs. The results of the queries initiated by the user,
+// like an edited query or a histogram selection, are always shown, and they
+// supersede the held back ones.
+func (app *nerdlogApp) applyLogs(resp *core.LogRespTotal) {
+	if app.options.GetFreeze() {
+		if app.mainView.isCurQueryAutoRefresh() {
+			app.mainView.setFrozenLogResp(resp)
+			return
+		}
+
+		app.mainView.takeFrozenLogResp()
+	}
+
+	app.mainView.applyLogs(resp)
+	if !resp.Partial {
+		app.lastLogResp = resp
+	}
+}
+
+// applyFrozenLogs shows the latest query result held back while the freeze
+// option was on, if it's off now.
+func (app *nerdlogApp) applyFrozenLogs() {
+	if app.options.GetFreeze() {
+		return
+	}
+
+	if resp := app.mainView.takeFrozenLogResp(); resp != nil {
+		app.applyLogs(resp)
+	}
+}
+
 // printError lets user know that there is an error by printing a simple error
 // message over the command line, sort of like in Vim.
 // Note that if command line is focused atm, the message will not be printed
@@ -3,12 +3,18 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dimonomid/nerdlog/clipboard"
+	"github.com/dimonomid/nerdlog/core"
 	"github.com/dimonomid/nerdlog/version"
 	"github.com/gdamore/tcell/v2"
 	"github.com/juju/errors"
+	"github.com/rivo/tview"
 )
 
 // NOTE: handleCmd is always called from the tview's event loop, so it's safe
@@ -20,62 +26,579 @@ func (app *nerdlogApp) handleCmd(cmd string) {
 	}
 
 	switch parts[0] {
-	case "h", "help":
+	case "h", "help", "commands":
+		app.mainView.showCommandPalette()
+
+	case "time":
+		args, force := cutForceFlag(parts[1:])
+		ftr, err := ParseFromToRange(app.options.GetTimezone(), strings.Join(args, " "))
+		if err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		app.mainView.setTimeRange(ftr.From, ftr.To)
+		app.mainView.doQuery(doQueryParams{force: force})
+
+	case "from":
+		args, force := cutForceFlag(parts[1:])
+		if err := app.mainView.setTimeRangeFrom(strings.Join(args, " ")); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		app.mainView.doQuery(doQueryParams{force: force})
+
+	case "to":
+		args, force := cutForceFlag(parts[1:])
+		if err := app.mainView.setTimeRangeTo(strings.Join(args, " ")); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		app.mainView.doQuery(doQueryParams{force: force})
+
+	case "extract":
+		if len(parts) < 2 {
+			app.printError(":extract requires arguments: the field name and the regexp")
+			return
+		}
+
+		name := parts[1]
+
+		// The regexp might contain spaces, so take the rest of the command as is.
+		rest := strings.TrimSpace(cmd)
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, parts[0]))
+		pattern := strings.TrimSpace(strings.TrimPrefix(rest, name))
+
+		if pattern == "" {
+			if !app.mainView.removeLogExtractor(name) {
+				app.printError(fmt.Sprintf("no extracted field %q", name))
+				return
+			}
+
+			app.printMsg(fmt.Sprintf("Field %q is not extracted anymore", name))
+			return
+		}
+
+		le, err := newLogExtractor(name, pattern)
+		if err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		app.mainView.addLogExtractor(le)
+
+	case "split":
+		// The delimiter might be a space, so take the rest of the command as is;
+		// it can also be quoted, like "\t".
+		delim := strings.TrimSpace(strings.TrimSpace(cmd)[len(parts[0]):])
+		if strings.HasPrefix(delim, `"`) {
+			var err error
+			delim, err = strconv.Unquote(delim)
+			if err != nil {
+				app.printError(fmt.Sprintf("invalid quoted delimiter: %s", err.Error()))
+				return
+			}
+		}
+
+		app.mainView.setMsgSplitDelim(delim)
+		if delim == "" {
+			app.printMsg("Messages are not split anymore")
+			return
+		}
+
+		app.printMsg(fmt.Sprintf("Splitting messages by %q", delim))
+
+	case "tail":
+		var interval time.Duration
+		if len(parts) >= 2 {
+			var err error
+			interval, err = time.ParseDuration(parts[1])
+			if err != nil {
+				app.printError(fmt.Sprintf("invalid interval: %s", err.Error()))
+				return
+			}
+
+			if interval < 1*time.Second {
+				app.printError("interval must be at least 1s")
+				return
+			}
+		}
+
+		app.mainView.tail(interval)
+
+	case "time-histogram":
+		app.mainView.setTimeRangeFromHistogram()
+
+	case "around":
+		dur := app.options.GetAroundDur()
+		if len(parts) >= 2 {
+			var err error
+			dur, err = time.ParseDuration(parts[1])
+			if err != nil {
+				app.printError(fmt.Sprintf("invalid duration: %s", err.Error()))
+				return
+			}
+
+			if dur <= 0 {
+				app.printError("duration must be positive")
+				return
+			}
+		}
+
+		app.mainView.queryAround(dur)
+
+	case "focus":
+		if len(parts) != 2 {
+			app.printError(fmt.Sprintf("focus requires one argument: %s", strings.Join(focusTargets, ", ")))
+			return
+		}
+
+		if err := app.mainView.focusByName(parts[1]); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+	case "run":
+		if len(parts) < 2 {
+			app.printError(":run requires an argument: the template name")
+			return
+		}
+
+		tmpl, ok := app.queryTemplates[parts[1]]
+		if !ok {
+			app.printError(fmt.Sprintf("No such template: %q", parts[1]))
+			return
+		}
+
+		args, err := parseQueryTemplateArgs(parts[2:])
+		if err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		query, err := expandQueryTemplate(tmpl, args)
+		if err != nil {
+			app.printError(fmt.Sprintf("Template %s: %s", parts[1], err.Error()))
+			return
+		}
+
+		app.mainView.setQuery(query)
+		app.mainView.queryInputApplyStyle()
+		app.mainView.bumpTimeRange(false)
+		app.mainView.doQuery(doQueryParams{})
+
+	case "template-save":
+		if len(parts) < 2 {
+			app.printError(":template-save requires an argument: the template name")
+			return
+		}
+
+		// If the pattern is not given, use the current query.
+		tmpl := app.mainView.query
+		if len(parts) > 2 {
+			tmpl = cmdArgsFrom(cmd, 2)
+		}
+
+		if tmpl == "" {
+			app.printError("Template pattern is empty")
+			return
+		}
+
+		app.queryTemplates[parts[1]] = tmpl
+		if err := saveQueryTemplates(app.queryTemplatesPath, app.queryTemplates); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		app.printMsg(fmt.Sprintf("Saved template %s: %s", parts[1], tmpl))
+
+	case "template-delete":
+		if len(parts) < 2 {
+			app.printError(":template-delete requires an argument: the template name")
+			return
+		}
+
+		if _, ok := app.queryTemplates[parts[1]]; !ok {
+			app.printError(fmt.Sprintf("No such template: %q", parts[1]))
+			return
+		}
+
+		delete(app.queryTemplates, parts[1])
+		if err := saveQueryTemplates(app.queryTemplatesPath, app.queryTemplates); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		app.printMsg(fmt.Sprintf("Deleted template %s", parts[1]))
+
+	case "templates":
+		if len(app.queryTemplates) == 0 {
+			app.printMsg("No templates yet, use :template-save to add one")
+			return
+		}
+
 		var sb strings.Builder
-		sb.WriteString("There is no built-in help yet, but check out these resources:\n")
-		sb.WriteString("\n")
-		sb.WriteString("README.md in the repo:\n    https://github.com/dimonomid/nerdlog\n")
-		sb.WriteString("Documentation:\n    https://github.com/dimonomid/nerdlog/blob/master/docs/index.md")
+		for _, name := range getQueryTemplateNames(app.queryTemplates) {
+			sb.WriteString(fmt.Sprintf("%s: %s\n", name, app.queryTemplates[name]))
+		}
 
-		app.mainView.showMessagebox("err", "Help", sb.String(), &MessageboxParams{
+		app.mainView.showMessagebox("templates", "Query templates", sb.String(), &MessageboxParams{
 			BackgroundColor: tcell.ColorDarkBlue,
 			CopyButton:      true,
 		})
 
-	case "time":
-		ftr, err := ParseFromToRange(app.options.GetTimezone(), strings.Join(parts[1:], " "))
+	case "warnings":
+		app.mainView.showLastQueryWarnings()
+
+	case "formats":
+		app.mainView.showLogFormats()
+
+	case "freeze":
+		app.options.Call(func(o *Options) {
+			o.Freeze = true
+		})
+
+		app.printMsg("Frozen; new results are held back until :unfreeze")
+
+	case "unfreeze":
+		// The held back results, if any, are applied right after the command;
+		// see applyFrozenLogs.
+		app.options.Call(func(o *Options) {
+			o.Freeze = false
+		})
+
+		app.printMsg("Unfrozen")
+
+	case "anchor":
+		app.mainView.anchorNow()
+
+	case "unanchor":
+		if !app.mainView.unanchorNow() {
+			app.printError("The time isn't anchored")
+			return
+		}
+
+		app.printMsg("Unanchored the time; relative time ranges end at the current time again")
+
+	case "watch":
+		if len(parts) < 2 {
+			app.mainView.showWatches()
+			return
+		}
+
+		if err := app.mainView.addWatch(cmdArgsFrom(cmd, 1)); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		app.printMsg(fmt.Sprintf("Added watch %d (see :watches)", len(app.mainView.watches)))
+
+	case "watches":
+		app.mainView.showWatches()
+
+	case "unwatch":
+		n := 0
+		if len(parts) >= 2 {
+			var err error
+			n, err = strconv.Atoi(parts[1])
+			if err != nil {
+				app.printError(fmt.Sprintf("invalid watch number %q", parts[1]))
+				return
+			}
+
+			if n < 1 {
+				app.printError("watch numbers start from 1")
+				return
+			}
+		}
+
+		if err := app.mainView.removeWatch(n); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+	case "gaps":
+		app.mainView.showGaps()
+
+	case "lines":
+		if len(parts) != 4 {
+			app.printError(":lines requires 3 arguments: the file, the first and the last line numbers")
+			return
+		}
+
+		lr, err := parseLineRange(parts[1], parts[2], parts[3])
 		if err != nil {
 			app.printError(err.Error())
 			return
 		}
 
-		app.mainView.setTimeRange(ftr.From, ftr.To)
+		app.mainView.doQuery(doQueryParams{
+			lineRange: lr,
+		})
+
+	case "recent-lstreams":
+		app.mainView.showRecentLStreams()
+
+	case "mute":
+		if len(parts) < 2 {
+			app.printError(":mute requires at least one argument: the logstream(s) to mute")
+			return
+		}
+
+		if err := app.mainView.muteLStreams(parts[1:]); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+	case "unmute":
+		if err := app.mainView.unmuteLStreams(parts[1:]); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+	case "only":
+		if len(parts) != 2 {
+			app.printError(":only requires exactly one argument: the logstream to query")
+			return
+		}
+
+		if err := app.mainView.onlyLStream(parts[1]); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+	case "all":
+		names := app.logstreamsCfg.LogStreams.Keys()
+		if len(names) == 0 {
+			app.printError(fmt.Sprintf("No logstreams in the config %s", app.logstreamsCfgPath))
+			return
+		}
+
+		if err := app.mainView.allLStreams(names); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+	case "union":
+		if len(parts) == 1 {
+			if len(app.mainView.namedQueries) == 0 {
+				app.printMsg("No named queries yet, use :union name pattern to add one")
+				return
+			}
+
+			var sb strings.Builder
+			for _, nq := range app.mainView.namedQueries {
+				sb.WriteString(fmt.Sprintf("%s: %s\n", nq.Name, nq.Query))
+			}
+
+			app.mainView.showMessagebox("union", "Named queries", sb.String(), &MessageboxParams{
+				BackgroundColor: tcell.ColorDarkBlue,
+				CopyButton:      true,
+			})
+			return
+		}
+
+		if len(parts) < 3 {
+			app.printError(":union requires 2 arguments: the name and the pattern, like :union errors /error/")
+			return
+		}
+
+		if strings.Contains(parts[1], ",") {
+			app.printError("Named query name can't contain commas")
+			return
+		}
+
+		if err := app.mainView.setNamedQuery(core.NamedQuery{
+			Name:  parts[1],
+			Query: cmdArgsFrom(cmd, 2),
+		}); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+	case "union-delete":
+		if err := app.mainView.removeNamedQueries(parts[1:]); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+	case "tabnew":
+		app.mainView.newTab()
+		app.printMsg(fmt.Sprintf("Opened tab %d", app.mainView.tabs.cur+1))
+
+	case "tabclose", "tabc":
+		if err := app.mainView.closeTab(); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+	case "tabnext", "tabn", "tabprevious", "tabprev", "tabp":
+		delta := 1
+		if strings.HasPrefix(parts[0], "tabp") {
+			delta = -1
+		}
+
+		var err error
+		if len(parts) >= 2 && delta == 1 {
+			// Like in Vim, ":tabnext N" goes to the tab N.
+			var n int
+			n, err = strconv.Atoi(parts[1])
+			if err != nil {
+				app.printError(fmt.Sprintf("invalid tab number %q", parts[1]))
+				return
+			}
+
+			err = app.mainView.switchTabTo(n - 1)
+		} else {
+			err = app.mainView.switchTabBy(delta)
+		}
+
+		if err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+	case "lstreams", "hosts":
+		names, err := app.getKnownLStreams()
+		if err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		var sb strings.Builder
+		if len(names) == 0 {
+			sb.WriteString("No logstreams are configured in either ")
+			sb.WriteString(app.logstreamsCfgPath)
+			sb.WriteString(" or the ssh config. ")
+			sb.WriteString("You can still use any host directly, like user@myserver.com.")
+		} else {
+			sb.WriteString("Logstreams and groups known from the configs:\n\n")
+			sb.WriteString(strings.Join(names, "\n"))
+		}
+
+		app.mainView.showLStreams(tview.Escape(sb.String()))
+
+	case "lstream", "host":
+		if len(parts) != 3 || parts[1] != "info" {
+			app.printError(fmt.Sprintf("Usage: :%s info <name>", parts[0]))
+			return
+		}
+
+		app.mainView.showLStreamInfo(parts[2], getSSHAuthInfo(app.params.sshKeys))
+
+	case "time-presets":
+		app.mainView.showTimeRangePresets()
+
+	case "filter-out":
+		// Without arguments, clear the exclude pattern; otherwise, add the given
+		// substring to it.
+		if len(parts) < 2 {
+			app.mainView.setExclude("")
+			app.printMsg("Cleared the exclude pattern")
+		} else {
+			substr := cmdArgsFrom(cmd, 1)
+			app.mainView.setExclude(
+				addToAwkExclude(app.mainView.exclude, fmt.Sprintf("/%s/", awkEscape(substr))),
+			)
+		}
+
 		app.mainView.doQuery(doQueryParams{})
 
 	case "w", "write":
-		//if len(parts) < 2 {
-		//app.printError(":write requires an argument: the filename to write")
-		//return
-		//}
+		if len(parts) >= 2 && parts[1] == "hist" {
+			if len(parts) < 3 {
+				app.printError(":write hist requires an argument: the filename to write")
+				return
+			}
 
-		//fname := parts[1]
+			app.writeHistogramCmd(parts[2:])
+			return
+		}
 
-		fname := "/tmp/last_nerdlog"
+		fname := defaultWriteFilename
 		if len(parts) >= 2 {
 			fname = parts[1]
 		}
 
-		if app.lastLogResp == nil {
-			app.printError("No logs yet")
+		if err := app.writeLogs(fname); err != nil {
+			app.printError(err.Error())
 			return
 		}
 
-		lfile, err := os.Create(fname)
+		app.printMsg(fmt.Sprintf("Saved to %s", fname))
+
+	case "write-html":
+		fname := defaultWriteHTMLFilename
+		if len(parts) >= 2 {
+			fname = expandHomeDir(parts[1])
+		}
+
+		if err := app.writeHTMLReport(fname); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		app.printMsg(fmt.Sprintf("Saved the HTML report to %s", fname))
+
+	case "wq", "x":
+		// Like in vim, but since there is nothing to save by default, only write
+		// the logs if the filename is given.
+		if len(parts) >= 2 {
+			if err := app.writeLogs(parts[1]); err != nil {
+				app.printError(err.Error())
+				return
+			}
+		}
+
+		app.tviewApp.Stop()
+
+	case "snapshot":
+		if len(parts) != 3 || (parts[1] != "save" && parts[1] != "diff") {
+			app.printError(":snapshot requires a subcommand and a name: save <name> or diff <name>")
+			return
+		}
+
+		path, err := getLogSnapshotPath(app.snapshotsDir, parts[2])
 		if err != nil {
-			app.printError(fmt.Sprintf("Failed to open %s for writing: %s", fname, err))
+			app.printError(err.Error())
 			return
 		}
 
-		for _, logMsg := range app.lastLogResp.Logs {
-			fmt.Fprintf(lfile, "%s <ssh -t %s vim +%d %s>\n",
-				logMsg.OrigLine,
-				logMsg.Context["lstream"], logMsg.LogLinenumber, logMsg.LogFilename,
-			)
+		switch parts[1] {
+		case "save":
+			if app.lastLogResp == nil {
+				app.printError("No logs yet")
+				return
+			}
+
+			qf := app.mainView.getQueryFull()
+			snap := newLogSnapshot(qf.MarshalShellCmd(), app.lastLogResp.Logs, time.Now())
+			if err := saveLogSnapshot(path, snap); err != nil {
+				app.printError(err.Error())
+				return
+			}
+
+			app.printMsg(fmt.Sprintf("Saved %d lines to snapshot %s", len(snap.Lines), parts[2]))
+
+		case "diff":
+			snap, err := loadLogSnapshot(path)
+			if err != nil {
+				app.printError(err.Error())
+				return
+			}
+
+			app.mainView.diffWithSnapshot(parts[2], snap)
 		}
 
-		lfile.Close()
+	case "write-histogram":
+		if len(parts) < 2 {
+			app.printError(":write-histogram requires an argument: the filename to write")
+			return
+		}
 
-		app.printMsg(fmt.Sprintf("Saved to %s", fname))
+		app.writeHistogramCmd(parts[1:])
 
 	case "set":
 		if len(parts) < 2 || len(parts[1]) == 0 {
@@ -85,20 +608,21 @@ func (app *nerdlogApp) handleCmd(cmd string) {
 
 		// TODO: implement in a generic way
 
-		setParts := strings.SplitN(parts[1], "=", 2)
+		// The value may contain spaces (e.g. status line templates), so take
+		// the whole rest of the command, not just the first field.
+		setArg := strings.TrimSpace(strings.TrimSpace(cmd)[len(parts[0]):])
+		setParts := strings.SplitN(setArg, "=", 2)
 		if len(setParts) == 2 {
 			optName := setParts[0]
 			optValue := setParts[1]
 
 			if opt := OptionMetaByName(optName); opt != nil {
-				var setErr error
-				app.options.Call(func(o *Options) {
-					setErr = opt.Set(o, optValue)
-				})
+				if opt.Bool {
+					optValue = normalizeBoolOptionValue(optValue)
+				}
 
-				if setErr != nil {
-					app.printError(setErr.Error())
-					return
+				if err := app.setOption(opt, optValue, false); err != nil {
+					app.printError(err.Error())
 				}
 
 				return
@@ -125,6 +649,37 @@ func (app *nerdlogApp) handleCmd(cmd string) {
 			return
 		}
 
+		// Vim-style boolean options: ":set foo", ":set nofoo", ":set foo!"; and
+		// also ":set foo on" or ":set foo off".
+		optName := strings.TrimSuffix(parts[1], "!")
+		toggle := optName != parts[1]
+		optValue := "true"
+		opt := OptionMetaByName(optName)
+		if opt == nil && !toggle && strings.HasPrefix(optName, "no") {
+			optName = strings.TrimPrefix(optName, "no")
+			optValue = "false"
+			opt = OptionMetaByName(optName)
+		} else if opt != nil && !toggle && len(parts) == 3 {
+			optValue = normalizeBoolOptionValue(parts[2])
+		}
+
+		// Non-boolean options can also be set like ":set timeout 60s".
+		if opt != nil && !opt.Bool && !toggle && len(parts) == 3 {
+			if err := app.setOption(opt, parts[2], false); err != nil {
+				app.printError(err.Error())
+			}
+
+			return
+		}
+
+		if opt != nil && opt.Bool {
+			if err := app.setOption(opt, optValue, toggle); err != nil {
+				app.printError(err.Error())
+			}
+
+			return
+		}
+
 		app.printError("Invalid set command")
 
 	case "xc", "xclip":
@@ -137,6 +692,40 @@ func (app *nerdlogApp) handleCmd(cmd string) {
 			app.printError(fmt.Sprintf("Clipboard is not available: %s", app.params.clipboardInitErr.Error()))
 		}
 
+	case "yank-all":
+		if app.lastLogResp == nil {
+			app.printError("No logs yet")
+			return
+		}
+
+		tsv := app.mainView.getLogsTSV()
+		app.copyToClipboard(tsv, fmt.Sprintf("%d lines", len(app.lastLogResp.Logs)))
+
+	case "share":
+		qf := app.mainView.getQueryFull()
+		app.copyToClipboard(qf.MarshalToken(), "query token")
+
+	case "open":
+		if len(parts) != 2 {
+			app.printError(":open requires an argument: the query token, as copied with :share")
+			return
+		}
+
+		var qf QueryFull
+		if err := qf.UnmarshalToken(parts[1]); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		if err := app.mainView.confirmOpenQuery(qf); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+	case "yank-args":
+		qf := app.mainView.getQueryFull()
+		app.copyToClipboard(qf.MarshalCLIArgs(), "query args")
+
 	case "nerdlog":
 		// Mimic as if it was called from a shell
 
@@ -182,7 +771,26 @@ func (app *nerdlogApp) handleCmd(cmd string) {
 	case "e", "edit":
 		app.mainView.openQueryEditView()
 
-	case "q", "quit":
+	case "annotate":
+		note := strings.TrimSpace(strings.TrimSpace(cmd)[len(parts[0]):])
+		if err := app.mainView.annotateSelectedMsg(note); err != nil {
+			app.printError(err.Error())
+			return
+		}
+
+		if note == "" {
+			app.printMsg("Annotation removed")
+		} else {
+			app.printMsg("Annotation saved")
+		}
+
+	case "annotations":
+		app.mainView.showAnnotations()
+
+	case "noh", "nohlsearch":
+		app.mainView.clearSearch()
+
+	case "q", "quit", "q!", "quit!", "qa", "qall", "qa!", "qall!":
 		app.tviewApp.Stop()
 
 	case "reconnect":
@@ -191,16 +799,56 @@ func (app *nerdlogApp) handleCmd(cmd string) {
 	case "disconnect":
 		app.mainView.disconnect()
 
-	case "refresh":
-		app.mainView.doQuery(doQueryParams{})
-
-	case "refresh!":
+	case "refresh", "refresh!":
+		_, force := cutForceFlag(parts[1:])
 		app.mainView.doQuery(doQueryParams{
-			refreshIndex: true,
+			refreshIndex: parts[0] == "refresh!",
+			force:        force,
 		})
 
 	case "debug":
-		app.mainView.showLastQueryDebugInfo()
+		if len(parts) == 1 {
+			app.mainView.showLastQueryDebugInfo()
+			return
+		}
+
+		switch parts[1] {
+		case "lstreams", "hosts":
+			app.mainView.showLStreamsStateDebugInfo()
+		default:
+			app.printError(fmt.Sprintf("Unknown debug subject %q, try :debug lstreams", parts[1]))
+		}
+
+	case "config":
+		if err := app.editConfig(); err != nil {
+			app.mainView.showMessagebox("err", "Config error", fmt.Sprintf(
+				"%s\n\nThe old config remains in effect.", err.Error(),
+			), &MessageboxParams{
+				BackgroundColor: tcell.ColorDarkRed,
+				CopyButton:      true,
+			})
+			return
+		}
+
+		app.printMsg(fmt.Sprintf("Reloaded config from %s", app.logstreamsCfgPath))
+
+	case "reload-config":
+		cfgPath := app.logstreamsCfgPath
+		if len(parts) >= 2 {
+			cfgPath = expandHomeDir(strings.TrimSpace(strings.TrimSpace(cmd)[len(parts[0]):]))
+		}
+
+		if err := app.reloadConfigFrom(cfgPath); err != nil {
+			app.mainView.showMessagebox("err", "Config error", fmt.Sprintf(
+				"%s\n\nThe old config remains in effect.", err.Error(),
+			), &MessageboxParams{
+				BackgroundColor: tcell.ColorDarkRed,
+				CopyButton:      true,
+			})
+			return
+		}
+
+		app.printMsg(fmt.Sprintf("Reloaded config from %s", app.logstreamsCfgPath))
 
 	case "version", "about":
 		app.mainView.showMessagebox("version", "Version", version.VersionFullDescr(), &MessageboxParams{
@@ -213,6 +861,141 @@ func (app *nerdlogApp) handleCmd(cmd string) {
 	}
 }
 
+// completeCmd returns all possible completions of the given command. For now,
+// only template names are completed, for the commands which take them.
+func (app *nerdlogApp) completeCmd(cmd string) []string {
+	parts := strings.SplitN(cmd, " ", 2)
+	if len(parts) != 2 || strings.Contains(parts[1], " ") {
+		return nil
+	}
+
+	switch parts[0] {
+	case "run", "template-save", "template-delete":
+		var ret []string
+		for _, name := range getQueryTemplateNames(app.queryTemplates) {
+			if strings.HasPrefix(name, parts[1]) {
+				ret = append(ret, parts[0]+" "+name)
+			}
+		}
+
+		return ret
+
+	case "mute", "unmute", "only":
+		names := app.mainView.getCurLStreamNames()
+		if parts[0] == "unmute" {
+			names = app.mainView.mutedLStreams
+		}
+
+		var ret []string
+		for _, name := range names {
+			if strings.HasPrefix(name, parts[1]) {
+				ret = append(ret, parts[0]+" "+name)
+			}
+		}
+
+		return ret
+
+	case "union", "union-delete":
+		var ret []string
+		for _, name := range app.mainView.getNamedQueryNames() {
+			if strings.HasPrefix(name, parts[1]) {
+				ret = append(ret, parts[0]+" "+name)
+			}
+		}
+
+		return ret
+
+	case "snapshot":
+		var ret []string
+		for _, subcmd := range []string{"save", "diff"} {
+			if strings.HasPrefix(subcmd, parts[1]) {
+				ret = append(ret, parts[0]+" "+subcmd)
+			}
+		}
+
+		return ret
+
+	case "lstream", "host":
+		if strings.HasPrefix("info", parts[1]) {
+			return []string{parts[0] + " info"}
+		}
+
+		return nil
+
+	case "debug":
+		if strings.HasPrefix("lstreams", parts[1]) {
+			return []string{parts[0] + " lstreams"}
+		}
+
+		return nil
+
+	case "focus":
+		var ret []string
+		for _, name := range focusTargets {
+			if strings.HasPrefix(name, parts[1]) {
+				ret = append(ret, parts[0]+" "+name)
+			}
+		}
+
+		return ret
+	}
+
+	return nil
+}
+
+// getCompletedCmd returns the command completed as much as possible using the
+// given completions: if there is just one, it's used (with a trailing space
+// added), otherwise their longest common prefix is used.
+func getCompletedCmd(cmd string, completions []string) string {
+	switch len(completions) {
+	case 0:
+		return cmd
+	case 1:
+		return completions[0] + " "
+	}
+
+	prefix := completions[0]
+	for _, c := range completions[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	if len(prefix) < len(cmd) {
+		return cmd
+	}
+
+	return prefix
+}
+
+// setOption sets the given option to the given value; if toggle is true, the
+// boolean option which is currently on is turned off instead. If the option
+// affects the query results (see OptionMeta.Requery) and its value has
+// actually changed, the query is rerun.
+func (app *nerdlogApp) setOption(opt *OptionMeta, value string, toggle bool) error {
+	var setErr error
+	var changed bool
+	app.options.Call(func(o *Options) {
+		oldValue := opt.Get(o)
+		if toggle && oldValue == "true" {
+			value = "false"
+		}
+
+		setErr = opt.Set(o, value)
+		changed = opt.Get(o) != oldValue
+	})
+
+	if setErr != nil {
+		return errors.Trace(setErr)
+	}
+
+	if opt.Requery && changed {
+		app.mainView.doQuery(doQueryParams{})
+	}
+
+	return nil
+}
+
 func (app *nerdlogApp) unmarshalAndApplyQuery(cmd string, dqp doQueryParams) error {
 	var qf QueryFull
 	if err := qf.UnmarshalShellCmd(cmd); err != nil {
@@ -225,3 +1008,267 @@ func (app *nerdlogApp) unmarshalAndApplyQuery(cmd string, dqp doQueryParams) err
 
 	return nil
 }
+
+// getEditorCmd returns the editor command from $EDITOR, split into the
+// executable and args; if $EDITOR is empty, vi is used.
+func getEditorCmd() []string {
+	editorCmd := strings.Fields(os.Getenv("EDITOR"))
+	if len(editorCmd) == 0 {
+		editorCmd = []string{"vi"}
+	}
+
+	return editorCmd
+}
+
+// editConfig suspends the TUI, opens the logstreams config in $EDITOR, and
+// once the editor exits, reloads the config.
+func (app *nerdlogApp) editConfig() error {
+	editorCmd := getEditorCmd()
+
+	if err := os.MkdirAll(filepath.Dir(app.logstreamsCfgPath), 0755); err != nil {
+		return errors.Annotatef(err, "creating config dir")
+	}
+
+	var editorErr error
+	app.tviewApp.Suspend(func() {
+		cmd := exec.Command(editorCmd[0], append(editorCmd[1:], app.logstreamsCfgPath)...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		editorErr = cmd.Run()
+	})
+
+	if editorErr != nil {
+		return errors.Annotatef(editorErr, "running editor %q", editorCmd[0])
+	}
+
+	return errors.Trace(app.reloadConfig())
+}
+
+// parseLineRange parses the arguments of the :lines command.
+func parseLineRange(file, fromStr, toStr string) (*core.LineRange, error) {
+	from, err := strconv.Atoi(fromStr)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing the first line number")
+	}
+
+	to, err := strconv.Atoi(toStr)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing the last line number")
+	}
+
+	if from < 1 {
+		return nil, errors.Errorf("line numbers start from 1, got %d", from)
+	}
+
+	if to < from {
+		return nil, errors.Errorf("the last line %d is before the first one %d", to, from)
+	}
+
+	return &core.LineRange{
+		File: file,
+		From: from,
+		To:   to,
+	}, nil
+}
+
+// normalizeBoolOptionValue converts "on" and "off" to "true" and "false", so
+// that boolean options can be set like ":set foo on"; any other value is
+// returned as is.
+func normalizeBoolOptionValue(value string) string {
+	switch value {
+	case "on":
+		return "true"
+	case "off":
+		return "false"
+	}
+
+	return value
+}
+
+// copyToClipboard copies the text to clipboard, and lets the user know; what
+// is a short description of the text, like "12 lines". If the regular
+// clipboard isn't available (e.g. we're on a remote host without X), it asks
+// the terminal to do it, via the OSC 52 escape sequence.
+func (app *nerdlogApp) copyToClipboard(text, what string) {
+	if app.params.clipboardInitErr == nil {
+		clipboard.WriteText([]byte(text))
+		app.printMsg(fmt.Sprintf("Copied %s to clipboard", what))
+		return
+	}
+
+	// The screen is owned by tcell, so writing the escape sequence to the
+	// terminal directly could interleave with its output; so suspend the UI
+	// while writing it. If the UI isn't running yet, just write it right away.
+	var oscErr error
+	writeOSC52 := func() {
+		oscErr = clipboard.WriteOSC52(os.Stdout, []byte(text))
+	}
+	if !app.tviewApp.Suspend(writeOSC52) {
+		writeOSC52()
+	}
+
+	if oscErr != nil {
+		app.printError(fmt.Sprintf("Clipboard is not available: %s", oscErr.Error()))
+		return
+	}
+
+	app.printMsg(fmt.Sprintf("Sent %s to the terminal clipboard (OSC 52)", what))
+}
+
+// cmdArgsFrom returns the command string starting from the field with the
+// given index, as is: unlike joining the fields back, it keeps the whitespace
+// inside intact, which matters for the patterns like /foo  bar/.
+func cmdArgsFrom(cmd string, idx int) string {
+	rest := strings.TrimLeft(cmd, " \t")
+	for i := 0; i < idx; i++ {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			return ""
+		}
+
+		rest = strings.TrimLeft(rest[end:], " \t")
+	}
+
+	return strings.TrimRight(rest, " \t")
+}
+
+// cutForceFlag removes the "--force" flag (which makes a query skip the
+// confirmlarge check) from the command args, and returns whether it was there.
+func cutForceFlag(args []string) ([]string, bool) {
+	ret := make([]string, 0, len(args))
+	force := false
+	for _, arg := range args {
+		if arg == "--force" {
+			force = true
+			continue
+		}
+
+		ret = append(ret, arg)
+	}
+
+	return ret, force
+}
+
+// expandHomeDir replaces the leading "~/" in the path with the home dir of
+// the current user; if the home dir is unknown, the path is returned as is.
+func expandHomeDir(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(homeDir, path[2:])
+}
+
+// defaultWriteFilename is where :write writes the logs if the filename isn't
+// given.
+const defaultWriteFilename = "/tmp/last_nerdlog"
+
+// writeHTMLReport writes the standalone HTML report about the current query
+// results to the given file; see htmlReportData.
+func (app *nerdlogApp) writeHTMLReport(fname string) error {
+	data, err := app.mainView.getHTMLReportData()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	f, err := os.Create(fname)
+	if err != nil {
+		return errors.Errorf("Failed to open %s for writing: %s", fname, err)
+	}
+
+	if err := writeHTMLReport(f, data); err != nil {
+		f.Close()
+		return errors.Annotatef(err, "writing %s", fname)
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Annotatef(err, "writing %s", fname)
+	}
+
+	return nil
+}
+
+// writeHistogramCmd handles the args of :write-histogram (or :write hist):
+// the filename and, optionally, the format.
+func (app *nerdlogApp) writeHistogramCmd(args []string) {
+	fname := expandHomeDir(args[0])
+
+	var formatStr string
+	if len(args) >= 2 {
+		formatStr = args[1]
+	}
+
+	format, err := parseHistogramExportFormat(formatStr)
+	if err != nil {
+		app.printError(err.Error())
+		return
+	}
+
+	if app.lastLogResp == nil {
+		app.printError("No logs yet")
+		return
+	}
+
+	hfile, err := os.Create(fname)
+	if err != nil {
+		app.printError(fmt.Sprintf("Failed to open %s for writing: %s", fname, err))
+		return
+	}
+
+	err = app.mainView.writeHistogram(hfile, format)
+	if closeErr := hfile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		app.printError(fmt.Sprintf("Failed to write histogram to %s: %s", fname, err))
+		return
+	}
+
+	app.printMsg(fmt.Sprintf("Histogram saved to %s", fname))
+}
+
+// writeLogs writes all the currently loaded log lines to the given file, each
+// one followed by the command to open it in vim on the remote host, and by the
+// annotation on a separate line, if any. An error is returned unless the
+// file was written completely, so that e.g. :wq doesn't quit otherwise.
+func (app *nerdlogApp) writeLogs(fname string) error {
+	if app.lastLogResp == nil {
+		return errors.Errorf("No logs yet")
+	}
+
+	lfile, err := os.Create(fname)
+	if err != nil {
+		return errors.Errorf("Failed to open %s for writing: %s", fname, err)
+	}
+
+	for _, logMsg := range app.lastLogResp.Logs {
+		lstream := logMsg.Context["lstream"]
+		_, err := fmt.Fprintf(lfile, "%s <ssh -t %s %svim +%d %s>\n",
+			logMsg.OrigLine,
+			lstream, app.mainView.getSudoPrefix(lstream), logMsg.LogLinenumber, logMsg.LogFilename,
+		)
+
+		if note, ok := app.annotations.Get(&logMsg); ok && err == nil {
+			_, err = fmt.Fprintf(lfile, "  NOTE: %s\n", note)
+		}
+
+		if err != nil {
+			lfile.Close()
+			return errors.Errorf("Failed to write to %s: %s", fname, err)
+		}
+	}
+
+	// Closing can fail too, e.g. if the disk is full, and then the file is
+	// incomplete.
+	if err := lfile.Close(); err != nil {
+		return errors.Errorf("Failed to write to %s: %s", fname, err)
+	}
+
+	return nil
+}
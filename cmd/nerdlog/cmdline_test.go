@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLineRange(t *testing.T) {
+	testCases := []struct {
+		file, from, to string
+		want           *core.LineRange
+		wantErr        string
+	}{
+		{
+			file: "/var/log/syslog", from: "1000", to: "2000",
+			want: &core.LineRange{File: "/var/log/syslog", From: 1000, To: 2000},
+		},
+		{
+			file: "/var/log/syslog", from: "5", to: "5",
+			want: &core.LineRange{File: "/var/log/syslog", From: 5, To: 5},
+		},
+		{
+			file: "/var/log/syslog", from: "foo", to: "5",
+			wantErr: "parsing the first line number",
+		},
+		{
+			file: "/var/log/syslog", from: "1", to: "bar",
+			wantErr: "parsing the last line number",
+		},
+		{
+			file: "/var/log/syslog", from: "0", to: "5",
+			wantErr: "line numbers start from 1, got 0",
+		},
+		{
+			file: "/var/log/syslog", from: "10", to: "5",
+			wantErr: "the last line 5 is before the first one 10",
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := parseLineRange(tc.file, tc.from, tc.to)
+		if tc.wantErr != "" {
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), tc.wantErr)
+			}
+			continue
+		}
+
+		assert.Nil(t, err)
+		assert.Equal(t, tc.want, got)
+	}
+}
+
+func TestCmdArgsFrom(t *testing.T) {
+	assert.Equal(t, "/foo  bar/", cmdArgsFrom("union errs /foo  bar/", 2))
+	assert.Equal(t, "errs /foo  bar/", cmdArgsFrom("  union \terrs /foo  bar/  ", 1))
+	assert.Equal(t, "", cmdArgsFrom("union errs", 2))
+	assert.Equal(t, "", cmdArgsFrom("union", 2))
+}
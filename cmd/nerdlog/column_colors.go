@@ -0,0 +1,203 @@
+package main
+
+import (
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/juju/errors"
+)
+
+// colorNameHash is the special color name in the column color rules, which
+// means that the color is derived from the value itself (see hashColor).
+const colorNameHash = "hash"
+
+// hashColorPalette contains the colors used by hashColor; they're all
+// reasonably distinct from each other and readable on a dark background.
+var hashColorPalette = []tcell.Color{
+	tcell.ColorLightSkyBlue,
+	tcell.ColorLightGreen,
+	tcell.ColorYellow,
+	tcell.ColorOrange,
+	tcell.ColorViolet,
+	tcell.ColorAqua,
+	tcell.ColorPink,
+	tcell.ColorKhaki,
+	tcell.ColorLightSalmon,
+	tcell.ColorPaleGreen,
+	tcell.ColorPlum,
+	tcell.ColorTurquoise,
+	tcell.ColorGold,
+	tcell.ColorLightCoral,
+	tcell.ColorCornflowerBlue,
+	tcell.ColorGreenYellow,
+}
+
+// hashColor returns a color for the given value, picked from
+// hashColorPalette. The same value always gets the same color, so e.g. every
+// host keeps its color across queries and app restarts.
+func hashColor(value string) tcell.Color {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return hashColorPalette[h.Sum32()%uint32(len(hashColorPalette))]
+}
+
+// columnColorRule colors the cells of a single column in the logs table.
+type columnColorRule struct {
+	colName string
+
+	// re, if not nil, is what the value has to match for the rule to apply;
+	// if nil, the rule applies to every value.
+	re *regexp.Regexp
+
+	// color is the color to use; ignored if hash is true.
+	color tcell.Color
+	// hash is whether the color should be derived from the value using
+	// hashColor.
+	hash bool
+}
+
+// columnColorRules is a parsed set of column colorization rules, as set by
+// the "colorcols" option; see parseColumnColorRules for the syntax.
+type columnColorRules struct {
+	src   string
+	rules []columnColorRule
+}
+
+// parseColumnColorRules parses the comma-separated list of rules, every rule
+// being in the format "column[=regexp]:color", where the color is either a
+// color name like "red" or "#ff8000", or "hash" to derive the color from the
+// value. An empty string results in nil rules, meaning no colorization.
+//
+// Commas inside the regexp groups, bracket expressions and repetitions like
+// "{1,3}" don't separate the rules, and any other comma in the regexp can be
+// escaped as "\,"; see splitColumnColorRules.
+func parseColumnColorRules(src string) (*columnColorRules, error) {
+	src = strings.TrimSpace(src)
+	if src == "" {
+		return nil, nil
+	}
+
+	ret := &columnColorRules{src: src}
+	for _, ruleStr := range splitColumnColorRules(src) {
+		ruleStr = strings.TrimSpace(ruleStr)
+
+		// Color names never contain colons, so the last one is the separator,
+		// and the regexp is free to contain them.
+		idx := strings.LastIndex(ruleStr, ":")
+		if idx < 0 {
+			return nil, errors.Errorf("invalid rule %q: no color, should be column[=regexp]:color", ruleStr)
+		}
+
+		target, colorName := ruleStr[:idx], strings.ToLower(strings.TrimSpace(ruleStr[idx+1:]))
+
+		var rule columnColorRule
+		targetParts := strings.SplitN(target, "=", 2)
+		rule.colName = strings.TrimSpace(targetParts[0])
+		if rule.colName == "" {
+			return nil, errors.Errorf("invalid rule %q: no column name", ruleStr)
+		}
+
+		if len(targetParts) == 2 {
+			re, err := regexp.Compile(targetParts[1])
+			if err != nil {
+				return nil, errors.Annotatef(err, "invalid rule %q", ruleStr)
+			}
+
+			rule.re = re
+		}
+
+		if colorName == colorNameHash {
+			rule.hash = true
+		} else {
+			rule.color = tcell.GetColor(colorName)
+			if rule.color == tcell.ColorDefault {
+				return nil, errors.Errorf("invalid rule %q: unknown color %q", ruleStr, colorName)
+			}
+		}
+
+		ret.rules = append(ret.rules, rule)
+	}
+
+	return ret, nil
+}
+
+// splitColumnColorRules splits the rules on commas, except the ones escaped
+// with a backslash and the ones inside parens, braces or a bracket
+// expression, so that regexps like "^a{1,3}$" or "[,;]" can be used as is.
+// The escapes are kept as they are, since "\," is a valid regexp matching a
+// literal comma.
+func splitColumnColorRules(src string) []string {
+	var ret []string
+
+	depth := 0
+	inBracket := false
+	start := 0
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '\\':
+			// Skip the escaped char, whatever it is.
+			i++
+		case inBracket:
+			if c == ']' {
+				inBracket = false
+			}
+		case c == '[':
+			inBracket = true
+			// A closing bracket right after the opening one (or after the
+			// negation) is a literal one.
+			if i+1 < len(src) && src[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(src) && src[i+1] == ']' {
+				i++
+			}
+		case c == '(' || c == '{':
+			depth++
+		case c == ')' || c == '}':
+			if depth > 0 {
+				depth--
+			}
+		case c == ',' && depth == 0:
+			ret = append(ret, src[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(ret, src[start:])
+}
+
+func (r *columnColorRules) String() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.src
+}
+
+// getColor returns the color for the given value of the given column, as
+// defined by the first matching rule. If no rule matches, returns false.
+func (r *columnColorRules) getColor(colName, value string) (tcell.Color, bool) {
+	if r == nil {
+		return tcell.ColorDefault, false
+	}
+
+	for _, rule := range r.rules {
+		if rule.colName != colName {
+			continue
+		}
+
+		if rule.re != nil && !rule.re.MatchString(value) {
+			continue
+		}
+
+		if rule.hash {
+			return hashColor(value), true
+		}
+
+		return rule.color, true
+	}
+
+	return tcell.ColorDefault, false
+}
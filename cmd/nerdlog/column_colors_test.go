@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnColorRules(t *testing.T) {
+	rules, err := parseColumnColorRules("lstream:hash, status=^5:red,status=^4:#ffff00,url=https?://:blue")
+	assert.NoError(t, err)
+	assert.Equal(t, "lstream:hash, status=^5:red,status=^4:#ffff00,url=https?://:blue", rules.String())
+
+	color, ok := rules.getColor("lstream", "host-1")
+	assert.True(t, ok)
+	assert.Equal(t, hashColor("host-1"), color)
+
+	color, ok = rules.getColor("status", "503")
+	assert.True(t, ok)
+	assert.Equal(t, tcell.ColorRed, color)
+
+	color, ok = rules.getColor("status", "404")
+	assert.True(t, ok)
+	assert.Equal(t, tcell.NewHexColor(0xffff00), color)
+
+	color, ok = rules.getColor("url", "http://foo")
+	assert.True(t, ok)
+	assert.Equal(t, tcell.ColorBlue, color)
+
+	_, ok = rules.getColor("status", "200")
+	assert.False(t, ok)
+
+	_, ok = rules.getColor("other", "foo")
+	assert.False(t, ok)
+
+	// Nil rules never match.
+	rules, err = parseColumnColorRules("")
+	assert.NoError(t, err)
+	_, ok = rules.getColor("lstream", "host-1")
+	assert.False(t, ok)
+}
+
+func TestColumnColorRulesCommas(t *testing.T) {
+	rules, err := parseColumnColorRules(`status=^5\d{1,2}$:red,msg=[,;]:blue,msg=(a|b,c):green,tag=x\,y:yellow`)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(rules.rules))
+
+	color, ok := rules.getColor("status", "503")
+	assert.True(t, ok)
+	assert.Equal(t, tcell.ColorRed, color)
+
+	color, ok = rules.getColor("msg", "foo;bar")
+	assert.True(t, ok)
+	assert.Equal(t, tcell.ColorBlue, color)
+
+	color, ok = rules.getColor("msg", "a")
+	assert.True(t, ok)
+	assert.Equal(t, tcell.ColorGreen, color)
+
+	color, ok = rules.getColor("tag", "x,y")
+	assert.True(t, ok)
+	assert.Equal(t, tcell.ColorYellow, color)
+
+	_, ok = rules.getColor("msg", "xzy")
+	assert.False(t, ok)
+}
+
+func TestSplitColumnColorRules(t *testing.T) {
+	assert.Equal(t, []string{"a:red", " b:blue"}, splitColumnColorRules("a:red, b:blue"))
+	assert.Equal(t, []string{"a=x{1,2}:red", "b:blue"}, splitColumnColorRules("a=x{1,2}:red,b:blue"))
+	assert.Equal(t, []string{"a=[],]:red", "b:blue"}, splitColumnColorRules("a=[],]:red,b:blue"))
+	assert.Equal(t, []string{"a=[^],]:red", "b:blue"}, splitColumnColorRules("a=[^],]:red,b:blue"))
+	assert.Equal(t, []string{`a=x\,y:red`, "b:blue"}, splitColumnColorRules(`a=x\,y:red,b:blue`))
+	assert.Equal(t, []string{`a=\(:red`, "b:blue"}, splitColumnColorRules(`a=\(:red,b:blue`))
+}
+
+func TestParseColumnColorRulesErrors(t *testing.T) {
+	for _, src := range []string{
+		"lstream",
+		":red",
+		"lstream:nosuchcolor",
+		"status=(:red",
+	} {
+		_, err := parseColumnColorRules(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestHashColor(t *testing.T) {
+	// The colors must be stable, and different values should mostly get
+	// different colors.
+	assert.Equal(t, hashColor("host-1"), hashColor("host-1"))
+
+	colors := map[tcell.Color]struct{}{}
+	for _, v := range []string{"host-1", "host-2", "host-3", "host-4", "host-5"} {
+		colors[hashColor(v)] = struct{}{}
+	}
+	assert.Greater(t, len(colors), 1)
+}
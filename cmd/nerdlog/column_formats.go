@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// columnFormatter is how the values of a column are formatted in the logs
+// table; see the colformats option.
+type columnFormatter string
+
+const (
+	// columnFormatterBytes formats a number of bytes like "1.0 MiB".
+	columnFormatterBytes columnFormatter = "bytes"
+	// columnFormatterDuration formats a number of nanoseconds like "1.5s".
+	columnFormatterDuration columnFormatter = "duration"
+	// columnFormatterEpoch formats a unix timestamp in seconds as a time in the
+	// current timezone.
+	columnFormatterEpoch columnFormatter = "epoch"
+	// columnFormatterEpochMs is like columnFormatterEpoch, but the timestamp is
+	// in milliseconds.
+	columnFormatterEpochMs columnFormatter = "epoch_ms"
+)
+
+var validColumnFormatters = []columnFormatter{
+	columnFormatterBytes,
+	columnFormatterDuration,
+	columnFormatterEpoch,
+	columnFormatterEpochMs,
+}
+
+// columnFormatRules is a parsed set of column formatters, as set by the
+// "colformats" option; see parseColumnFormatRules for the syntax.
+type columnFormatRules struct {
+	src         string
+	formatByCol map[string]columnFormatter
+}
+
+// parseColumnFormatRules parses the comma-separated list of rules, every rule
+// being in the format "column:formatter". An empty string results in nil
+// rules, meaning all values are shown as is.
+func parseColumnFormatRules(src string) (*columnFormatRules, error) {
+	src = strings.TrimSpace(src)
+	if src == "" {
+		return nil, nil
+	}
+
+	ret := &columnFormatRules{
+		src:         src,
+		formatByCol: map[string]columnFormatter{},
+	}
+
+	for _, ruleStr := range strings.Split(src, ",") {
+		ruleStr = strings.TrimSpace(ruleStr)
+
+		parts := strings.Split(ruleStr, ":")
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid rule %q, should be column:formatter", ruleStr)
+		}
+
+		colName := strings.TrimSpace(parts[0])
+		if colName == "" {
+			return nil, errors.Errorf("invalid rule %q: no column name", ruleStr)
+		}
+
+		formatter := columnFormatter(strings.TrimSpace(parts[1]))
+		if !isValidColumnFormatter(formatter) {
+			validNames := make([]string, 0, len(validColumnFormatters))
+			for _, f := range validColumnFormatters {
+				validNames = append(validNames, string(f))
+			}
+
+			return nil, errors.Errorf(
+				"invalid rule %q: unknown formatter %q, valid values are: %s",
+				ruleStr, formatter, strings.Join(validNames, ", "),
+			)
+		}
+
+		ret.formatByCol[colName] = formatter
+	}
+
+	return ret, nil
+}
+
+func isValidColumnFormatter(formatter columnFormatter) bool {
+	for _, f := range validColumnFormatters {
+		if f == formatter {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *columnFormatRules) String() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.src
+}
+
+// format returns the given value of the given column formatted as per the
+// rules, with the epoch times in the given timezone. If there's no rule for
+// the column, or the value can't be formatted (e.g. it's not a number),
+// returns false.
+func (r *columnFormatRules) format(colName, value string, tz *time.Location) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+
+	formatter, ok := r.formatByCol[colName]
+	if !ok {
+		return "", false
+	}
+
+	num, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(num) || math.IsInf(num, 0) {
+		return "", false
+	}
+
+	switch formatter {
+	case columnFormatterBytes:
+		return formatBytes(num), true
+	case columnFormatterDuration:
+		return time.Duration(num).String(), true
+	case columnFormatterEpoch:
+		return formatEpoch(num*1e9, tz), true
+	case columnFormatterEpochMs:
+		return formatEpoch(num*1e6, tz), true
+	}
+
+	return "", false
+}
+
+// formatBytes formats the number of bytes using the binary units, like
+// "512 B" or "1.5 MiB".
+func formatBytes(num float64) string {
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+
+	if math.Abs(num) < 1024 {
+		return fmt.Sprintf("%d B", int64(num))
+	}
+
+	unitIdx := -1
+	for math.Abs(num) >= 1024 && unitIdx < len(units)-1 {
+		num /= 1024
+		unitIdx++
+	}
+
+	return fmt.Sprintf("%.1f %s", num, units[unitIdx])
+}
+
+func formatEpoch(nanos float64, tz *time.Location) string {
+	return time.Unix(0, int64(nanos)).In(tz).Format(logsTableTimeLayout)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnFormatRules(t *testing.T) {
+	rules, err := parseColumnFormatRules("size_bytes:bytes, took:duration,ts:epoch,ts_ms:epoch_ms")
+	assert.NoError(t, err)
+	assert.Equal(t, "size_bytes:bytes, took:duration,ts:epoch,ts_ms:epoch_ms", rules.String())
+
+	tz := time.UTC
+
+	testCases := []struct {
+		colName, value string
+		want           string
+		wantOK         bool
+	}{
+		{colName: "size_bytes", value: "1048576", want: "1.0 MiB", wantOK: true},
+		{colName: "size_bytes", value: "1536", want: "1.5 KiB", wantOK: true},
+		{colName: "size_bytes", value: "512", want: "512 B", wantOK: true},
+		{colName: "size_bytes", value: "3221225472", want: "3.0 GiB", wantOK: true},
+		{colName: "size_bytes", value: "lots", wantOK: false},
+		{colName: "took", value: "1500000000", want: "1.5s", wantOK: true},
+		{colName: "took", value: "250", want: "250ns", wantOK: true},
+		{colName: "ts", value: "1741600800", want: "Mar10 10:00:00.000", wantOK: true},
+		{colName: "ts_ms", value: "1741600800123", want: "Mar10 10:00:00.123", wantOK: true},
+		{colName: "other", value: "1048576", wantOK: false},
+	}
+
+	for _, tc := range testCases {
+		got, ok := rules.format(tc.colName, tc.value, tz)
+		assert.Equal(t, tc.wantOK, ok, "%s=%s", tc.colName, tc.value)
+		if tc.wantOK {
+			assert.Equal(t, tc.want, got, "%s=%s", tc.colName, tc.value)
+		}
+	}
+
+	// Nil rules never format anything.
+	rules, err = parseColumnFormatRules("")
+	assert.NoError(t, err)
+	_, ok := rules.format("size_bytes", "1048576", tz)
+	assert.False(t, ok)
+}
+
+func TestParseColumnFormatRulesErrors(t *testing.T) {
+	for _, src := range []string{
+		"size",
+		":bytes",
+		"size:nosuchformatter",
+		"size:bytes:foo",
+	} {
+		_, err := parseColumnFormatRules(src)
+		assert.Error(t, err, src)
+	}
+}
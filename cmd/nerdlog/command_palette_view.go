@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type CommandPaletteViewParams struct {
+	// Commands is the list of all commands to choose from.
+	Commands []cmdInfo
+
+	// OnSelected is called when the user picks a command; the palette is
+	// already hidden at that point.
+	OnSelected func(ci cmdInfo)
+}
+
+// CommandPaletteView is a modal with all the commands and their short
+// descriptions, filterable by typing.
+type CommandPaletteView struct {
+	params   CommandPaletteViewParams
+	mainView *MainView
+
+	filterInput *tview.InputField
+	table       *tview.Table
+	frame       *tview.Frame
+
+	// filtered contains the commands currently shown in the table.
+	filtered []cmdInfo
+}
+
+func NewCommandPaletteView(
+	mainView *MainView, params *CommandPaletteViewParams,
+) *CommandPaletteView {
+	cpv := &CommandPaletteView{
+		params:   *params,
+		mainView: mainView,
+	}
+
+	cpv.table = tview.NewTable()
+	cpv.table.SetSelectable(true, false)
+
+	cpv.filterInput = tview.NewInputField()
+	cpv.filterInput.SetLabel("Filter: ")
+	cpv.filterInput.SetChangedFunc(func(text string) {
+		cpv.applyFilter(text)
+	})
+	cpv.filterInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		row, _ := cpv.table.GetSelection()
+
+		switch event.Key() {
+		case tcell.KeyCtrlP, tcell.KeyUp, tcell.KeyBacktab:
+			if row > 0 {
+				cpv.table.Select(row-1, 0)
+			}
+			return nil
+
+		case tcell.KeyCtrlN, tcell.KeyDown, tcell.KeyTab:
+			if row < len(cpv.filtered)-1 {
+				cpv.table.Select(row+1, 0)
+			}
+			return nil
+
+		case tcell.KeyEnter:
+			if row >= 0 && row < len(cpv.filtered) {
+				ci := cpv.filtered[row]
+				cpv.Hide()
+				cpv.params.OnSelected(ci)
+			}
+			return nil
+
+		case tcell.KeyEsc:
+			cpv.Hide()
+			return nil
+		}
+
+		return event
+	})
+
+	flex := tview.NewFlex().SetDirection(tview.FlexRow)
+	flex.AddItem(cpv.filterInput, 1, 0, true)
+	flex.AddItem(nil, 1, 0, false)
+	flex.AddItem(cpv.table, 0, 1, false)
+
+	cpv.frame = tview.NewFrame(flex).SetBorders(0, 0, 0, 0, 0, 0)
+	cpv.frame.SetBorder(true).SetBorderPadding(0, 0, 1, 1)
+	cpv.frame.SetTitle("Commands")
+	cpv.frame.AddText(
+		"Enter: run (or type args)   Esc: close   Docs: https://github.com/dimonomid/nerdlog",
+		false, tview.AlignLeft, tcell.ColorGray,
+	)
+
+	return cpv
+}
+
+func (cpv *CommandPaletteView) Show() {
+	cpv.filterInput.SetText("")
+	cpv.applyFilter("")
+
+	cpv.mainView.showModal(
+		pageNameCommandPalette, cpv.frame,
+		90,
+		24,
+		true,
+	)
+}
+
+func (cpv *CommandPaletteView) Hide() {
+	cpv.mainView.hideModal(pageNameCommandPalette, true)
+}
+
+func (cpv *CommandPaletteView) applyFilter(filter string) {
+	cpv.filtered = filterCommands(cpv.params.Commands, filter)
+
+	cpv.table.Clear()
+	for i, ci := range cpv.filtered {
+		name := ":" + ci.Name
+		if ci.Args != "" {
+			name += " " + ci.Args
+		}
+
+		cpv.table.SetCell(i, 0, tview.NewTableCell(tview.Escape(name)).SetTextColor(tcell.ColorYellow))
+		cpv.table.SetCell(i, 1, tview.NewTableCell(" "+ci.Descr).SetExpansion(1))
+	}
+
+	if len(cpv.filtered) == 0 {
+		cpv.table.SetCell(0, 0, tview.NewTableCell(
+			fmt.Sprintf("No commands matching %q", filter),
+		).SetSelectable(false).SetTextColor(tcell.ColorGray))
+	}
+
+	cpv.table.Select(0, 0)
+	cpv.table.ScrollToBeginning()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+)
+
+// cmdInfo describes a command supported by the command line, for the command
+// palette.
+type cmdInfo struct {
+	// Name is the full name of the command, as typed after the ":".
+	Name string
+
+	// Args is the human-readable args synopsis, like "name [pattern]"; empty
+	// if the command doesn't take any args. Optional args are in square
+	// brackets.
+	Args string
+
+	// Descr is a short one-line description.
+	Descr string
+}
+
+// RequiresArgs returns whether the command can't be run without args, so
+// the user has to be prompted for them.
+func (ci cmdInfo) RequiresArgs() bool {
+	return ci.Args != "" && !strings.HasPrefix(ci.Args, "[")
+}
+
+// allCommands contains all commands handled by handleCmd, in the order they
+// are shown in the command palette. Aliases are omitted, except the vim-like
+// ones which people type out of habit, like :x or :q!.
+//
+// NOTE: when adding a new command to handleCmd, add it here too.
+var allCommands = []cmdInfo{
+	{Name: "help", Descr: "Show this command palette"},
+	{Name: "edit", Descr: "Open the query edit form"},
+	{Name: "refresh", Args: "[--force]", Descr: "Rerun the current query"},
+	{Name: "refresh!", Args: "[--force]", Descr: "Rerun the current query, rebuilding the index"},
+	{Name: "back", Descr: "Go to the previous query"},
+	{Name: "fwd", Descr: "Go to the next query"},
+	{Name: "time", Args: "range [--force]", Descr: "Set the time range, like -1h or 10:00 to 11:00"},
+	{Name: "from", Args: "time [--force]", Descr: "Set only the start of the time range, like -3h or 10:00"},
+	{Name: "to", Args: "[time] [--force]", Descr: "Set only the end of the time range, like -1h or 11:00; without it, up to now"},
+	{Name: "tail", Args: "[interval]", Descr: "Follow the last minute of logs, refreshing every interval"},
+	{Name: "time-histogram", Descr: "Set the time range to what the histogram shows"},
+	{Name: "around", Args: "[duration]", Descr: "Query the time around the selected message, arounddur before and after by default"},
+	{Name: "time-presets", Descr: "Choose one of the time range presets"},
+	{Name: "filter-out", Args: "[substring]", Descr: "Exclude lines containing the substring"},
+	{Name: "extract", Args: "name [regexp]", Descr: "Extract a field from the messages using the regexp"},
+	{Name: "split", Args: "[delimiter]", Descr: "Split the messages by the delimiter into columns"},
+	{Name: "recent-lstreams", Descr: "Switch to one of the recently used logstreams filters"},
+	{Name: "mute", Args: "lstream [lstream ...]", Descr: "Exclude logstreams from the query"},
+	{Name: "unmute", Args: "[lstream ...]", Descr: "Include muted logstreams back"},
+	{Name: "only", Args: "lstream", Descr: "Query just the given logstream"},
+	{Name: "all", Descr: "Set the logstreams filter to all the logstreams from the config"},
+	{Name: "union", Args: "[name pattern]", Descr: "Show the union of named queries, tagging each line with the ones it matches"},
+	{Name: "union-delete", Args: "[name ...]", Descr: "Delete named queries, or all of them"},
+	{Name: "lines", Args: "file from to", Descr: "Fetch a range of lines from the file"},
+	{Name: "run", Args: "name [param=value ...]", Descr: "Run the query template"},
+	{Name: "template-save", Args: "name [pattern]", Descr: "Save the pattern as a query template"},
+	{Name: "template-delete", Args: "name", Descr: "Delete the query template"},
+	{Name: "templates", Descr: "Show all saved query templates"},
+	{Name: "tabnew", Descr: "Open a new query tab"},
+	{Name: "tabnext", Args: "[N]", Descr: "Go to the next query tab, or to the tab N"},
+	{Name: "tabprev", Descr: "Go to the previous query tab"},
+	{Name: "tabclose", Descr: "Close the current query tab"},
+	{Name: "focus", Args: "query|histogram|logs", Descr: "Focus the query input, the histogram or the logs table"},
+	{Name: "lstreams", Descr: "Show all known logstreams and groups"},
+	{Name: "lstream", Args: "info <name>", Descr: "Show how the logstream is accessed, like the equivalent ssh command, and its state"},
+	{Name: "warnings", Descr: "Show the agent warnings from the last query"},
+	{Name: "formats", Descr: "Show the log format of every logstream, configured or detected"},
+	{Name: "freeze", Descr: "Hold back the new autorefresh results (the freeze option)"},
+	{Name: "unfreeze", Descr: "Show the results held back by the freeze option and turn it off"},
+	{Name: "anchor", Descr: "Resolve the relative time ranges against the current instant from now on"},
+	{Name: "unanchor", Descr: "Undo :anchor, so the relative time ranges end at the current time again"},
+	{Name: "watch", Args: "filter op threshold [window]", Descr: "Alert when the count of matching messages trips the threshold, like level:error > 10"},
+	{Name: "watches", Descr: "Show all watches and their state"},
+	{Name: "unwatch", Args: "[N]", Descr: "Remove the watch N, or all watches"},
+	{Name: "gaps", Descr: "List the periods without any logs"},
+	{Name: "debug", Args: "[lstreams]", Descr: "Show debug info for the last query, or the state of all logstreams"},
+	{Name: "xclip", Descr: "Copy the nerdlog command for the current query"},
+	{Name: "yank-args", Descr: "Copy the current query as command line flags"},
+	{Name: "share", Descr: "Copy the current query as a shareable token"},
+	{Name: "open", Args: "token", Descr: "Open the query from a token copied with :share"},
+	{Name: "yank-all", Descr: "Copy all loaded logs as tab-separated values"},
+	{Name: "write", Args: "[filename] | hist filename [csv|text]", Descr: "Write all loaded logs, or the histogram data, to the file"},
+	{Name: "write-html", Args: "[filename]", Descr: "Write a standalone HTML report with the query, histogram and loaded logs"},
+	{Name: "annotate", Args: "[note]", Descr: "Attach the note to the selected message, or remove it"},
+	{Name: "annotations", Descr: "Show all the annotations"},
+	{Name: "nohlsearch", Descr: "Stop highlighting the search matches"},
+	{Name: "snapshot", Args: "save|diff name", Descr: "Save the loaded logs as a snapshot, or rerun the query and diff against it"},
+	{Name: "write-histogram", Args: "filename [csv|text]", Descr: "Write the histogram data as CSV or a text chart to the file"},
+	{Name: "set", Args: "option[=value]", Descr: "Set or get an option"},
+	{Name: "config", Descr: "Edit and reload the logstreams config"},
+	{Name: "reload-config", Args: "[path]", Descr: "Reload the logstreams config, optionally from another file"},
+	{Name: "reconnect", Descr: "Reconnect to all logstreams"},
+	{Name: "disconnect", Descr: "Disconnect from all logstreams"},
+	{Name: "version", Descr: "Show version info"},
+	{Name: "quit", Descr: "Quit the app"},
+	{Name: "q!", Descr: "Quit the app (same as :quit, since there's nothing to discard)"},
+	{Name: "qall", Descr: "Quit the app (same as :quit, since there's only one window)"},
+	{Name: "qa!", Descr: "Quit the app (same as :quit)"},
+	{Name: "wq", Args: "[filename]", Descr: "Write all loaded logs to the file if given, and quit"},
+	{Name: "x", Args: "[filename]", Descr: "Same as :wq"},
+}
+
+// filterCommands returns the commands whose name or description contains
+// the filter, case-insensitively.
+func filterCommands(cmds []cmdInfo, filter string) []cmdInfo {
+	filter = strings.ToLower(strings.TrimSpace(filter))
+
+	ret := []cmdInfo{}
+	for _, ci := range cmds {
+		if strings.Contains(ci.Name, filter) ||
+			strings.Contains(strings.ToLower(ci.Descr), filter) {
+			ret = append(ret, ci)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterCommands(t *testing.T) {
+	cmds := []cmdInfo{
+		{Name: "refresh", Descr: "Rerun the current query"},
+		{Name: "mute", Args: "lstream [lstream ...]", Descr: "Exclude logstreams from the query"},
+		{Name: "tabnext", Args: "[N]", Descr: "Go to the next query tab"},
+	}
+
+	var names []string
+	for _, ci := range filterCommands(cmds, " Query ") {
+		names = append(names, ci.Name)
+	}
+	assert.Equal(t, []string{"refresh", "mute", "tabnext"}, names)
+
+	assert.Equal(t, []cmdInfo{cmds[1]}, filterCommands(cmds, "MUT"))
+	assert.Equal(t, []cmdInfo{cmds[2]}, filterCommands(cmds, "tab"))
+	assert.Equal(t, []cmdInfo{}, filterCommands(cmds, "nonexisting"))
+	assert.Equal(t, cmds, filterCommands(cmds, ""))
+
+	assert.False(t, cmds[0].RequiresArgs())
+	assert.True(t, cmds[1].RequiresArgs())
+	assert.False(t, cmds[2].RequiresArgs())
+}
+
+func TestAllCommandsUnique(t *testing.T) {
+	// Every command in the palette should have a unique name.
+	seen := map[string]struct{}{}
+	for _, ci := range allCommands {
+		_, ok := seen[ci.Name]
+		assert.False(t, ok, "duplicate command %q", ci.Name)
+		seen[ci.Name] = struct{}{}
+	}
+}
@@ -12,6 +12,10 @@ import (
 
 type ConfigLogStreams struct {
 	LogStreams core.ConfigLogStreams `yaml:"log_streams"`
+
+	// Groups are named groups of logstreams, which can be used in the
+	// logstreams spec just like a single logstream.
+	Groups core.ConfigLStreamGroups `yaml:"groups"`
 }
 
 func LoadLogstreamsConfigFromFile(path string) (*ConfigLogStreams, error) {
@@ -53,6 +57,26 @@ func LoadLogstreamsConfigFromFile(path string) (*ConfigLogStreams, error) {
 				"%s: both sudo and sudo_mode are set; please only use one of them", k,
 			)
 		}
+
+		if cls.Options.KeepaliveInterval < 0 {
+			return nil, errors.Errorf("%s: keepalive_interval can't be negative", k)
+		}
+
+		if cls.Options.IdleTimeout < 0 {
+			return nil, errors.Errorf("%s: idle_timeout can't be negative", k)
+		}
+
+		if cls.Options.TimestampLayout != "" {
+			if _, err := core.GenerateTimeDescr(cls.Options.TimestampLayout); err != nil {
+				return nil, errors.Annotatef(
+					err, "%s: invalid timestamp_layout %q", k, cls.Options.TimestampLayout,
+				)
+			}
+		}
+	}
+
+	if err := cfg.Groups.Validate(); err != nil {
+		return nil, errors.Annotatef(err, "groups in %s", path)
 	}
 
 	return &cfg, nil
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// dedupRow is a row of the logs table in the dedup mode, where consecutive
+// messages with the same Msg are collapsed into a single row.
+type dedupRow struct {
+	// msgIdx is the index of the message shown in the row.
+	msgIdx int
+
+	// groupIdx is the index of the first message in the group of consecutive
+	// messages with the same Msg, which this row belongs to; groupSize is the
+	// number of messages in that group.
+	groupIdx  int
+	groupSize int
+
+	// collapsed is true if the whole group is collapsed into this row.
+	collapsed bool
+
+	// wrapLine is the index of the line of the wrapped message shown in the
+	// row; it's always 0 unless the messages are wrapped (see
+	// logsTableContent.setWrapWidth).
+	wrapLine int
+}
+
+// dedupLogMsgs groups consecutive messages with the same Msg, and returns the
+// rows to show: one row per group, except the groups whose first message
+// index is in expanded, which are shown in full.
+func dedupLogMsgs(logs []core.LogMsg, expanded map[int]struct{}) []dedupRow {
+	ret := make([]dedupRow, 0, len(logs))
+
+	for groupIdx := 0; groupIdx < len(logs); {
+		groupSize := 1
+		for groupIdx+groupSize < len(logs) && logs[groupIdx+groupSize].Msg == logs[groupIdx].Msg {
+			groupSize++
+		}
+
+		_, isExpanded := expanded[groupIdx]
+		if groupSize > 1 && !isExpanded {
+			ret = append(ret, dedupRow{
+				msgIdx:    groupIdx,
+				groupIdx:  groupIdx,
+				groupSize: groupSize,
+				collapsed: true,
+			})
+		} else {
+			for i := 0; i < groupSize; i++ {
+				ret = append(ret, dedupRow{
+					msgIdx:    groupIdx + i,
+					groupIdx:  groupIdx,
+					groupSize: groupSize,
+				})
+			}
+		}
+
+		groupIdx += groupSize
+	}
+
+	return ret
+}
+
+// formatTimeSpan formats the time range of a collapsed group for the time
+// column; the date of the last message is only included if it differs from
+// the first one.
+func formatTimeSpan(first, last time.Time, tz *time.Location) string {
+	first = first.In(tz)
+	last = last.In(tz)
+
+	lastLayout := "15:04:05.000"
+	if first.YearDay() != last.YearDay() || first.Year() != last.Year() {
+		lastLayout = logsTableTimeLayout
+	}
+
+	return first.Format(logsTableTimeLayout) + " - " + last.Format(lastLayout)
+}
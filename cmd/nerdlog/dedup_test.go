@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupLogMsgs(t *testing.T) {
+	logs := []core.LogMsg{
+		{Msg: "a"},
+		{Msg: "b"},
+		{Msg: "b"},
+		{Msg: "b"},
+		{Msg: "c"},
+		{Msg: "a"},
+		{Msg: "a"},
+	}
+
+	assert.Equal(t, []dedupRow{
+		{msgIdx: 0, groupIdx: 0, groupSize: 1},
+		{msgIdx: 1, groupIdx: 1, groupSize: 3, collapsed: true},
+		{msgIdx: 4, groupIdx: 4, groupSize: 1},
+		{msgIdx: 5, groupIdx: 5, groupSize: 2, collapsed: true},
+	}, dedupLogMsgs(logs, nil))
+
+	assert.Equal(t, []dedupRow{
+		{msgIdx: 0, groupIdx: 0, groupSize: 1},
+		{msgIdx: 1, groupIdx: 1, groupSize: 3},
+		{msgIdx: 2, groupIdx: 1, groupSize: 3},
+		{msgIdx: 3, groupIdx: 1, groupSize: 3},
+		{msgIdx: 4, groupIdx: 4, groupSize: 1},
+		{msgIdx: 5, groupIdx: 5, groupSize: 2, collapsed: true},
+	}, dedupLogMsgs(logs, map[int]struct{}{1: {}}))
+
+	assert.Equal(t, []dedupRow{}, dedupLogMsgs(nil, nil))
+}
+
+func TestFormatTimeSpan(t *testing.T) {
+	first := time.Date(2025, time.March, 10, 1, 30, 0, 0, time.UTC)
+
+	assert.Equal(t,
+		"Mar10 01:30:00.000 - 01:35:10.500",
+		formatTimeSpan(first, first.Add(5*time.Minute+10500*time.Millisecond), time.UTC),
+	)
+	assert.Equal(t,
+		"Mar10 01:30:00.000 - Mar11 01:30:00.000",
+		formatTimeSpan(first, first.Add(24*time.Hour), time.UTC),
+	)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+)
+
+// logExtractor derives a field from unstructured log messages client-side:
+// the regexp is matched against every message, and the first capture group
+// becomes the value of the field with the given name (see the ":extract"
+// command).
+type logExtractor struct {
+	name string
+	re   *regexp.Regexp
+}
+
+func newLogExtractor(name, pattern string) (logExtractor, error) {
+	switch name {
+	case FieldNameTime, FieldNameMessage, FieldNameFilename, FieldNameLinenumber, "lstream":
+		return logExtractor{}, errors.Errorf("can't use the built-in field name %q", name)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return logExtractor{}, errors.Annotatef(err, "invalid regexp")
+	}
+
+	if re.NumSubexp() == 0 {
+		return logExtractor{}, errors.Errorf("regexp %q has no capture groups", pattern)
+	}
+
+	return logExtractor{name: name, re: re}, nil
+}
+
+// extract returns the value of the first capture group when the regexp
+// matches the message; if it doesn't, the original line is tried as well,
+// since it might contain more than the parsed message (e.g. the syslog
+// header).
+func (le logExtractor) extract(msg *core.LogMsg) (string, bool) {
+	for _, s := range []string{msg.Msg, msg.OrigLine} {
+		if m := le.re.FindStringSubmatch(s); m != nil {
+			return m[1], true
+		}
+	}
+
+	return "", false
+}
+
+// applyLogExtractors applies all extractors to every message, and stores the
+// extracted values in the messages' Context. Context maps are copied before
+// being modified, since they might be shared with the core.
+func applyLogExtractors(logs []core.LogMsg, extractors []logExtractor) {
+	if len(extractors) == 0 {
+		return
+	}
+
+	for i := range logs {
+		msg := &logs[i]
+
+		newContext := make(map[string]string, len(msg.Context)+len(extractors))
+		for k, v := range msg.Context {
+			newContext[k] = v
+		}
+
+		for _, le := range extractors {
+			if val, ok := le.extract(msg); ok {
+				newContext[le.name] = val
+			} else {
+				delete(newContext, le.name)
+			}
+		}
+
+		msg.Context = newContext
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyLogExtractors(t *testing.T) {
+	reqID, err := newLogExtractor("req_id", `req=(\w+)`)
+	assert.NoError(t, err)
+
+	latency, err := newLogExtractor("latency", `took (\d+)ms`)
+	assert.NoError(t, err)
+
+	sharedContext := map[string]string{"lstream": "myhost"}
+	logs := []core.LogMsg{
+		{Msg: "handled req=abc, took 15ms", Context: sharedContext},
+		{Msg: "something else", OrigLine: "Mar 10 myhost app[1]: req=def something else", Context: sharedContext},
+		{Msg: "no context, took 3ms"},
+	}
+
+	applyLogExtractors(logs, []logExtractor{reqID, latency})
+
+	assert.Equal(t, map[string]string{"lstream": "myhost", "req_id": "abc", "latency": "15"}, logs[0].Context)
+	assert.Equal(t, map[string]string{"lstream": "myhost", "req_id": "def"}, logs[1].Context)
+	assert.Equal(t, map[string]string{"latency": "3"}, logs[2].Context)
+
+	// The original map must not be modified.
+	assert.Equal(t, map[string]string{"lstream": "myhost"}, sharedContext)
+}
+
+func TestNewLogExtractorErrors(t *testing.T) {
+	_, err := newLogExtractor("foo", `no groups`)
+	assert.Error(t, err)
+
+	_, err = newLogExtractor("foo", `invalid(`)
+	assert.Error(t, err)
+
+	_, err = newLogExtractor(FieldNameMessage, `(.*)`)
+	assert.Error(t, err)
+
+	_, err = newLogExtractor(FieldNameLinenumber, `(.*)`)
+	assert.Error(t, err)
+}
@@ -71,6 +71,29 @@ func (ftr *FromToRange) String() string {
 	return fromStr + " to " + ftr.To.Format(format)
 }
 
+// parseTimeRangeEndpoint parses a single endpoint of the time range, for
+// :from and :to, where the other endpoint is kept. Just like in
+// ParseFromToRange, the date can be omitted: then it's taken from the other
+// endpoint if it's absolute, or it's today otherwise.
+func parseTimeRangeEndpoint(
+	timezone *time.Location, s string, other TimeOrDur, now time.Time,
+) (TimeOrDur, error) {
+	if s == "" {
+		return TimeOrDur{}, errors.New("time can't be empty. try -5h")
+	}
+
+	if _, err := time.ParseDuration(s); err != nil && len(s) <= 5 {
+		date := now.In(timezone)
+		if other.IsAbsolute() {
+			date = other.Time.In(timezone)
+		}
+
+		s = date.Format("Jan2") + " " + s
+	}
+
+	return parseAndInferTimeOrDur(timezone, inputTimeLayout, s)
+}
+
 func parseAndInferTimeOrDur(timezone *time.Location, layout, s string) (TimeOrDur, error) {
 	t, err := ParseTimeOrDur(timezone, layout, s)
 	if err != nil {
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeRangeEndpoint(t *testing.T) {
+	now := time.Now().In(time.UTC)
+
+	// Duration
+	got, err := parseTimeRangeEndpoint(time.UTC, "-3h", TimeOrDur{}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, TimeOrDur{Dur: -3 * time.Hour}, got)
+
+	// Time without a date, and the other endpoint is relative: today.
+	got, err = parseTimeRangeEndpoint(time.UTC, "10:30", TimeOrDur{Dur: -time.Hour}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Format("Jan2")+" 10:30", got.Format(inputTimeLayout))
+
+	// Time without a date, and the other endpoint is absolute: its date.
+	other := TimeOrDur{Time: now.AddDate(0, 0, -3)}
+	got, err = parseTimeRangeEndpoint(time.UTC, "10:30", other, now)
+	assert.NoError(t, err)
+	assert.Equal(t, other.Time.Format("Jan2")+" 10:30", got.Format(inputTimeLayout))
+
+	_, err = parseTimeRangeEndpoint(time.UTC, "foo", TimeOrDur{}, now)
+	assert.Error(t, err)
+
+	_, err = parseTimeRangeEndpoint(time.UTC, "", TimeOrDur{}, now)
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/gdamore/tcell/v2"
@@ -49,6 +50,10 @@ type Histogram struct {
 	// bin.
 	data map[int]int
 
+	// errData is like data, but only counts the errors; it's used to find the
+	// error spikes, see GetErrorSpikes.
+	errData map[int]int
+
 	// getXMarks returns where to put marks on X axis
 	getXMarks func(from, to int, numChars int) []int
 
@@ -65,6 +70,11 @@ type Histogram struct {
 	// a range. The from is inclusive, the to is not.
 	selected func(from, to int)
 
+	// cursorMoved, if not nil, is called whenever the user moves the cursor,
+	// with the range covered by the cursor's bar. The from is inclusive, the
+	// to is not.
+	cursorMoved func(from, to int)
+
 	// curMarks is returned from the last call to getXMarks
 	curMarks []int
 
@@ -82,6 +92,11 @@ type Histogram struct {
 
 	externalCursor        int
 	externalCursorVisible bool
+
+	// gapMinLen is the minimum length (in the same units as from, to etc) of
+	// a run of empty data bins to be considered a gap, which is highlighted
+	// on the ruler. Zero means gaps are not highlighted.
+	gapMinLen int
 }
 
 func NewHistogram() *Histogram {
@@ -103,6 +118,11 @@ func (h *Histogram) SetRange(from, to int) *Histogram {
 	return h
 }
 
+// GetRange returns the range which was last set with SetRange.
+func (h *Histogram) GetRange() (from, to int) {
+	return h.from, h.to
+}
+
 func (h *Histogram) alignCursor(cursor int, isCeiling bool) int {
 	divisor := h.getDataBinsInChartBar() * h.binSize
 	cursor -= h.from
@@ -128,6 +148,14 @@ func (h *Histogram) SetData(data map[int]int) *Histogram {
 	return h
 }
 
+// SetErrorData sets the number of errors in every bin, in the same format as
+// SetData.
+func (h *Histogram) SetErrorData(errData map[int]int) *Histogram {
+	h.errData = errData
+
+	return h
+}
+
 func (h *Histogram) SetXFormatter(xFormat func(v int) string) *Histogram {
 	h.xFormat = xFormat
 
@@ -152,6 +180,12 @@ func (h *Histogram) SetXMarker(getXMarks func(from, to int, numChars int) []int)
 	return h
 }
 
+func (h *Histogram) SetGapMinLen(gapMinLen int) *Histogram {
+	h.gapMinLen = gapMinLen
+
+	return h
+}
+
 func (h *Histogram) SetExternalCursor(externalCursor int) *Histogram {
 	h.externalCursor = externalCursor
 
@@ -223,6 +257,19 @@ func (h *Histogram) Draw(screen tcell.Screen) {
 	rulerBlank := "[:#656565]" + strings.Repeat(" ", maxOffset) + "[:-]"
 	tview.Print(screen, rulerBlank, x+fldMarginLeft, y+height-1, width-fldMarginLeft, tview.AlignLeft, tcell.ColorWhite)
 
+	// Highlight the gaps on the ruler background, so that periods without any
+	// logs (e.g. when a host was down) stand out.
+	for _, gap := range h.GetGaps() {
+		gapFromOffset := h.valToCoord(gap.From) / 2
+		gapToOffset := (h.valToCoord(gap.To) + 1) / 2
+		if gapToOffset <= gapFromOffset {
+			gapToOffset = gapFromOffset + 1
+		}
+
+		gapStr := "[:#870000]" + strings.Repeat(" ", gapToOffset-gapFromOffset) + "[:-]"
+		tview.Print(screen, gapStr, x+fldMarginLeft+gapFromOffset, y+height-1, width-fldMarginLeft-gapFromOffset, tview.AlignLeft, tcell.ColorWhite)
+	}
+
 	// Print the ruler under the histogram.
 	h.curMarks = h.getXMarks(h.from, h.to, width-fldMarginLeft)
 
@@ -355,6 +402,116 @@ func (h *Histogram) getDataBinsInChartBar() int {
 	return h.fldData.dataBinsInChartBar
 }
 
+// HistogramBin represents a single bar of the histogram as it is currently
+// displayed: from is inclusive, to is not, and val is the sum of all data
+// bins covered by the bar.
+type HistogramBin struct {
+	From int
+	To   int
+	Val  int
+}
+
+// GetBins returns the histogram data aggregated using the same binning as the
+// one currently displayed (so if a single bar covers e.g. 5 minutes, every
+// returned bin covers 5 minutes as well).
+func (h *Histogram) GetBins() []HistogramBin {
+	return h.getBins(h.data)
+}
+
+// getBins is like GetBins, but aggregates the given data.
+func (h *Histogram) getBins(data map[int]int) []HistogramBin {
+	if h.binSize == 0 || h.to <= h.from {
+		return nil
+	}
+
+	barSize := h.binSize * h.getDataBinsInChartBar()
+
+	ret := make([]HistogramBin, 0, (h.to-h.from+barSize-1)/barSize)
+	for from := h.from; from < h.to; from += barSize {
+		to := from + barSize
+		if to > h.to {
+			to = h.to
+		}
+
+		var val int
+		for v := from; v < to; v += h.binSize {
+			val += data[v]
+		}
+
+		ret = append(ret, HistogramBin{
+			From: from,
+			To:   to,
+			Val:  val,
+		})
+	}
+
+	return ret
+}
+
+// GetErrorSpikes returns the currently displayed bins with non-zero numbers
+// of errors (as set by SetErrorData), sorted by the number of errors in
+// descending order, so the first one is the biggest spike. Bins with equal
+// values are sorted by time.
+func (h *Histogram) GetErrorSpikes() []HistogramBin {
+	var ret []HistogramBin
+	for _, bin := range h.getBins(h.errData) {
+		if bin.Val > 0 {
+			ret = append(ret, bin)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Val > ret[j].Val
+	})
+
+	return ret
+}
+
+// HistogramGap is a run of empty data bins; from is inclusive, to is not.
+type HistogramGap struct {
+	From int
+	To   int
+}
+
+// GetGaps returns the runs of empty data bins which are at least gapMinLen
+// long, as set by SetGapMinLen. If gapMinLen is zero, returns nil.
+func (h *Histogram) GetGaps() []HistogramGap {
+	return findHistogramGaps(h.data, h.from, h.to, h.binSize, h.gapMinLen)
+}
+
+// findHistogramGaps returns the runs of empty data bins in the range [from, to)
+// which are at least minLen long. The from must be aligned to binSize.
+func findHistogramGaps(data map[int]int, from, to, binSize, minLen int) []HistogramGap {
+	if binSize == 0 || minLen <= 0 || to <= from {
+		return nil
+	}
+
+	var ret []HistogramGap
+
+	gapStart := -1
+	addGapIfLongEnough := func(gapEnd int) {
+		if gapStart >= 0 && gapEnd-gapStart >= minLen {
+			ret = append(ret, HistogramGap{From: gapStart, To: gapEnd})
+		}
+		gapStart = -1
+	}
+
+	for v := from; v < to; v += binSize {
+		if data[v] != 0 {
+			addGapIfLongEnough(v)
+			continue
+		}
+
+		if gapStart < 0 {
+			gapStart = v
+		}
+	}
+
+	addGapIfLongEnough(to)
+
+	return ret
+}
+
 func (h *Histogram) getChartBarWidth() int {
 	if h.fldData == nil {
 		return 1
@@ -367,6 +524,13 @@ func (h *Histogram) InputHandler() func(event *tcell.EventKey, setFocus func(p t
 	return h.WrapInputHandler(func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
 		maxCursor := h.alignCursor(h.to-h.binSize*h.getDataBinsInChartBar(), true)
 
+		prevCursor := h.cursor
+		defer func() {
+			if h.cursor != prevCursor && h.cursorMoved != nil {
+				h.cursorMoved(h.cursor, h.cursor+h.binSize*h.getDataBinsInChartBar())
+			}
+		}()
+
 		moveLeft := func() {
 			h.cursor -= h.binSize * h.getDataBinsInChartBar()
 			if h.cursor < h.from {
@@ -435,6 +599,41 @@ func (h *Histogram) InputHandler() func(event *tcell.EventKey, setFocus func(p t
 			}
 		}
 
+		// moveErrorSpike moves the cursor to the next (if delta is 1) or
+		// previous (if delta is -1) error spike, in the order returned by
+		// GetErrorSpikes. If the cursor isn't on any spike, it moves to the
+		// biggest one. The time range isn't changed, so that the other spikes
+		// remain reachable; the user can apply it as usual.
+		moveErrorSpike := func(delta int) {
+			spikes := h.GetErrorSpikes()
+			if len(spikes) == 0 {
+				return
+			}
+
+			idx := -1
+			for i, spike := range spikes {
+				if spike.From == h.cursor {
+					idx = i
+					break
+				}
+			}
+
+			if idx == -1 {
+				idx = 0
+			} else {
+				idx += delta
+			}
+
+			if idx < 0 {
+				idx = 0
+			} else if idx >= len(spikes) {
+				idx = len(spikes) - 1
+			}
+
+			h.cursor = spikes[idx].From
+			h.selectionStart = 0
+		}
+
 		selectionApplyIfActive := func() {
 			if h.selectionStart != 0 && h.selected != nil {
 				from, to := h.GetSelection()
@@ -468,6 +667,10 @@ func (h *Histogram) InputHandler() func(event *tcell.EventKey, setFocus func(p t
 				case 'v', ' ':
 					selectionApplyIfActive()
 					selectionToggle()
+				case ']':
+					moveErrorSpike(1)
+				case '[':
+					moveErrorSpike(-1)
 				case 'q':
 					selectionEnd()
 				case 'o':
@@ -536,6 +739,11 @@ func (h *Histogram) SetSelectedFunc(handler func(from, to int)) *Histogram {
 	return h
 }
 
+func (h *Histogram) SetCursorMovedFunc(handler func(from, to int)) *Histogram {
+	h.cursorMoved = handler
+	return h
+}
+
 func (h *Histogram) IsSelectionActive() bool {
 	return h.selectionStart != 0
 }
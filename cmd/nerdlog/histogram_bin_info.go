@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// histogramBinInfoLevels are the levels in the order they're listed by
+// formatHistogramBinInfo.
+var histogramBinInfoLevels = []core.LogLevel{
+	core.LogLevelError,
+	core.LogLevelWarn,
+	core.LogLevelInfo,
+	core.LogLevelDebug,
+	core.LogLevelUnknown,
+}
+
+// formatHistogramBinInfo returns the description of the histogram bar
+// covering the given time range: the range itself, the number of messages in
+// it as per the minute stats, and the breakdown by level of the ones which
+// are loaded. The logs must be sorted by time.
+func formatHistogramBinInfo(
+	from, to time.Time, minuteStats map[int64]core.MinuteStatsItem, logs []core.LogMsg,
+) string {
+	numMsgs := 0
+	for k, v := range minuteStats {
+		if k >= from.Unix() && k < to.Unix() {
+			numMsgs += v.NumMsgs
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s - %s: %d messages", from.Format("Jan02 15:04"), to.Format("15:04"), numMsgs)
+
+	startIdx := sort.Search(len(logs), func(i int) bool {
+		return !logs[i].Time.Before(from)
+	})
+
+	numLoaded := 0
+	byLevel := map[core.LogLevel]int{}
+	for i := startIdx; i < len(logs) && logs[i].Time.Before(to); i++ {
+		byLevel[logs[i].Level]++
+		numLoaded++
+	}
+
+	if numLoaded == 0 {
+		return sb.String()
+	}
+
+	if numLoaded < numMsgs {
+		fmt.Fprintf(&sb, "; of the %d loaded:", numLoaded)
+	} else {
+		sb.WriteString(":")
+	}
+
+	var parts []string
+	for _, level := range histogramBinInfoLevels {
+		if byLevel[level] == 0 {
+			continue
+		}
+
+		name := string(level)
+		if level == core.LogLevelUnknown {
+			name = "other"
+		}
+
+		parts = append(parts, fmt.Sprintf("%d %s", byLevel[level], name))
+	}
+	sb.WriteString(" " + strings.Join(parts, ", "))
+
+	return sb.String()
+}
+
+// getHistogramErrorData returns the number of errors among the given loaded
+// logs per histogram bin, in the same format as the histogram data: a map from
+// the unix timestamp of the beginning of the bin to the number of errors in it.
+func getHistogramErrorData(logs []core.LogMsg, binSize int) map[int]int {
+	ret := map[int]int{}
+	for _, msg := range logs {
+		if msg.Level != core.LogLevelError {
+			continue
+		}
+
+		t := int(msg.Time.Unix())
+		ret[t-t%binSize]++
+	}
+
+	return ret
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatHistogramBinInfo(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time {
+		return t0.Add(time.Duration(sec) * time.Second)
+	}
+
+	minuteStats := map[int64]core.MinuteStatsItem{
+		at(0).Unix():   {NumMsgs: 1},
+		at(120).Unix(): {NumMsgs: 3},
+		at(180).Unix(): {NumMsgs: 2},
+		at(240).Unix(): {NumMsgs: 100}, // Outside of the range
+	}
+
+	logs := []core.LogMsg{
+		{Time: at(10), Level: core.LogLevelInfo},
+		{Time: at(125), Level: core.LogLevelError},
+		{Time: at(130), Level: core.LogLevelInfo},
+		{Time: at(190), Level: core.LogLevelUnknown},
+		{Time: at(195), Level: core.LogLevelError},
+		{Time: at(250), Level: core.LogLevelWarn},
+	}
+
+	assert.Equal(t,
+		"Mar10 10:02 - 10:04: 5 messages; of the 4 loaded: 2 error, 1 info, 1 other",
+		formatHistogramBinInfo(at(120), at(240), minuteStats, logs),
+	)
+
+	// All of them are loaded.
+	assert.Equal(t,
+		"Mar10 10:00 - 10:01: 1 messages: 1 info",
+		formatHistogramBinInfo(at(0), at(60), minuteStats, logs),
+	)
+
+	// Nothing is loaded.
+	assert.Equal(t,
+		"Mar10 10:02 - 10:04: 5 messages",
+		formatHistogramBinInfo(at(120), at(240), minuteStats, nil),
+	)
+}
+
+func TestGetHistogramErrorData(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time {
+		return t0.Add(time.Duration(sec) * time.Second)
+	}
+
+	logs := []core.LogMsg{
+		{Time: at(10), Level: core.LogLevelError},
+		{Time: at(125), Level: core.LogLevelError},
+		{Time: at(130), Level: core.LogLevelInfo},
+		{Time: at(170), Level: core.LogLevelError},
+		{Time: at(250), Level: core.LogLevelWarn},
+	}
+
+	assert.Equal(t, map[int]int{
+		int(at(0).Unix()):   1,
+		int(at(120).Unix()): 2,
+	}, getHistogramErrorData(logs, 60))
+}
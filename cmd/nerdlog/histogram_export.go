@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Formats supported by :write-histogram.
+const (
+	histogramExportCSV  = "csv"
+	histogramExportText = "text"
+)
+
+// histogramExportTextWidth is the width of the longest bar in the text chart
+// written by writeHistogramText.
+const histogramExportTextWidth = 60
+
+// histogramExportTimeLayout is how the bins are labeled in the text chart.
+const histogramExportTimeLayout = "2006-01-02 15:04"
+
+// parseHistogramExportFormat returns the histogram export format; an empty
+// string means CSV.
+func parseHistogramExportFormat(s string) (string, error) {
+	switch s {
+	case "", histogramExportCSV:
+		return histogramExportCSV, nil
+	case histogramExportText, "txt":
+		return histogramExportText, nil
+	}
+
+	return "", errors.Errorf("invalid histogram format %q, valid values are: csv, text", s)
+}
+
+// writeHistogramExport writes the histogram bins in the given format; see
+// writeHistogramCSV and writeHistogramText.
+func writeHistogramExport(w io.Writer, format string, bins []HistogramBin, tz *time.Location) error {
+	switch format {
+	case histogramExportCSV:
+		return errors.Trace(writeHistogramCSV(w, bins, tz))
+	case histogramExportText:
+		return errors.Trace(writeHistogramText(w, bins, tz))
+	}
+
+	return errors.Errorf("invalid histogram format %q", format)
+}
+
+// getHistogramExportHeader returns the lines describing the exported
+// histogram for the text chart: the time range, the bin size and the total,
+// each prefixed with "# ".
+func getHistogramExportHeader(bins []HistogramBin, tz *time.Location) string {
+	if len(bins) == 0 {
+		return "# No histogram data\n"
+	}
+
+	from := time.Unix(int64(bins[0].From), 0).In(tz)
+	to := time.Unix(int64(bins[len(bins)-1].To), 0).In(tz)
+	binSize := time.Duration(bins[0].To-bins[0].From) * time.Second
+
+	total := 0
+	for _, bin := range bins {
+		total += bin.Val
+	}
+
+	return fmt.Sprintf(
+		"# Time range: %s - %s\n# Bin size: %s\n# Total: %d messages\n",
+		from.Format(time.RFC3339), to.Format(time.RFC3339), formatDuration(binSize), total,
+	)
+}
+
+// writeHistogramCSV writes the histogram bins as CSV. Every line contains the
+// bin start time, formatted in the given timezone, and the number of messages,
+// followed by the bin end time and the bin size, so that the time range and
+// the binning are known without the header which the text chart has: many
+// CSV readers don't support comments.
+//
+// NOTE: there is no per-level breakdown, because the agent only reports total
+// numbers of messages per minute.
+func writeHistogramCSV(w io.Writer, bins []HistogramBin, tz *time.Location) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"time", "count", "end_time", "bin_size"}); err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, bin := range bins {
+		from := time.Unix(int64(bin.From), 0).In(tz)
+		to := time.Unix(int64(bin.To), 0).In(tz)
+		binSize := time.Duration(bin.To-bin.From) * time.Second
+		if err := cw.Write([]string{
+			from.Format(time.RFC3339), strconv.Itoa(bin.Val), to.Format(time.RFC3339), formatDuration(binSize),
+		}); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	cw.Flush()
+
+	return errors.Trace(cw.Error())
+}
+
+// writeHistogramText writes the histogram bins as a plain text chart with a
+// horizontal bar per bin, preceded by the header from
+// getHistogramExportHeader; it's handy to paste into a document as is.
+func writeHistogramText(w io.Writer, bins []HistogramBin, tz *time.Location) error {
+	var sb strings.Builder
+
+	sb.WriteString(getHistogramExportHeader(bins, tz))
+
+	maxVal := 0
+	for _, bin := range bins {
+		if bin.Val > maxVal {
+			maxVal = bin.Val
+		}
+	}
+
+	for _, bin := range bins {
+		barLen := 0
+		if maxVal > 0 {
+			barLen = (bin.Val*histogramExportTextWidth + maxVal - 1) / maxVal
+		}
+
+		t := time.Unix(int64(bin.From), 0).In(tz)
+		fmt.Fprintf(&sb, "%s | %s%s %d\n",
+			t.Format(histogramExportTimeLayout),
+			strings.Repeat("#", barLen), strings.Repeat(" ", histogramExportTextWidth-barLen),
+			bin.Val,
+		)
+	}
+
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
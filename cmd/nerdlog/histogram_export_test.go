@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteHistogramExport(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+	from := int(t0.Unix())
+
+	bins := []HistogramBin{
+		{From: from, To: from + 300, Val: 4},
+		{From: from + 300, To: from + 600, Val: 0},
+		{From: from + 600, To: from + 900, Val: 1},
+	}
+
+	header := "# Time range: 2025-03-10T10:00:00Z - 2025-03-10T10:15:00Z\n" +
+		"# Bin size: 5m\n" +
+		"# Total: 5 messages\n"
+
+	var sb strings.Builder
+	assert.NoError(t, writeHistogramExport(&sb, histogramExportCSV, bins, time.UTC))
+	assert.Equal(t, "time,count,end_time,bin_size\n"+
+		"2025-03-10T10:00:00Z,4,2025-03-10T10:05:00Z,5m\n"+
+		"2025-03-10T10:05:00Z,0,2025-03-10T10:10:00Z,5m\n"+
+		"2025-03-10T10:10:00Z,1,2025-03-10T10:15:00Z,5m\n",
+		sb.String(),
+	)
+
+	sb.Reset()
+	assert.NoError(t, writeHistogramExport(&sb, histogramExportText, bins, time.UTC))
+	assert.Equal(t, header+
+		"2025-03-10 10:00 | "+strings.Repeat("#", 60)+" 4\n"+
+		"2025-03-10 10:05 | "+strings.Repeat(" ", 60)+" 0\n"+
+		"2025-03-10 10:10 | "+strings.Repeat("#", 15)+strings.Repeat(" ", 45)+" 1\n",
+		sb.String(),
+	)
+
+	sb.Reset()
+	assert.NoError(t, writeHistogramExport(&sb, histogramExportCSV, nil, time.UTC))
+	assert.Equal(t, "time,count,end_time,bin_size\n", sb.String())
+
+	sb.Reset()
+	assert.NoError(t, writeHistogramExport(&sb, histogramExportText, nil, time.UTC))
+	assert.Equal(t, "# No histogram data\n", sb.String())
+}
+
+func TestParseHistogramExportFormat(t *testing.T) {
+	for s, want := range map[string]string{
+		"":     histogramExportCSV,
+		"csv":  histogramExportCSV,
+		"text": histogramExportText,
+		"txt":  histogramExportText,
+	} {
+		got, err := parseHistogramExportFormat(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+
+	_, err := parseHistogramExportFormat("png")
+	assert.Error(t, err)
+}
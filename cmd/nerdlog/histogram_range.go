@@ -0,0 +1,90 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+)
+
+// histRangeMode specifies what the X range of the histogram covers; see the
+// histrange option.
+type histRangeMode string
+
+const (
+	// histRangeQuery pins the histogram to the queried time range, so if there
+	// are no logs near the edges of the range, the edges are shown empty. This
+	// is the default.
+	histRangeQuery histRangeMode = "query"
+	// histRangeData narrows the histogram down to the range where the logs
+	// actually are.
+	histRangeData histRangeMode = "data"
+)
+
+func parseHistRangeMode(s string) (histRangeMode, error) {
+	switch mode := histRangeMode(s); mode {
+	case histRangeQuery, histRangeData:
+		return mode, nil
+	}
+
+	return "", errors.Errorf("invalid histogram range mode %q, valid values are: query, data", s)
+}
+
+// getMinuteStatsRange returns the timestamps of the first and the last minute
+// which have any messages. If there are none, both are zero.
+func getMinuteStatsRange(minuteStats map[int64]core.MinuteStatsItem) (first, last time.Time) {
+	var minKey, maxKey int64
+	found := false
+	for k, v := range minuteStats {
+		if v.NumMsgs == 0 {
+			continue
+		}
+
+		if !found || k < minKey {
+			minKey = k
+		}
+
+		if !found || k > maxKey {
+			maxKey = k
+		}
+
+		found = true
+	}
+
+	if !found {
+		return time.Time{}, time.Time{}
+	}
+
+	return time.Unix(minKey, 0).UTC(), time.Unix(maxKey, 0).UTC()
+}
+
+// narrowHistogramRange narrows the histogram range [from, to) down to the
+// minutes from statsFirst to statsLast inclusive, aligned to the granularity.
+// If there's no data (statsFirst is zero) or it's outside of the range, the
+// range is returned as is.
+func narrowHistogramRange(
+	from, to, statsFirst, statsLast time.Time, granularity time.Duration,
+) (time.Time, time.Time) {
+	if statsFirst.IsZero() {
+		return from, to
+	}
+
+	// The stats are in UTC, so snap them on the grid of the range itself.
+	loc := from.Location()
+	dataFrom := truncateInZone(statsFirst.In(loc), granularity)
+	dataTo := truncateCeil(statsLast.Add(minTimeRoundGranularity).In(loc), granularity)
+
+	if dataFrom.Before(from) {
+		dataFrom = from
+	}
+
+	if dataTo.After(to) {
+		dataTo = to
+	}
+
+	if !dataFrom.Before(dataTo) {
+		return from, to
+	}
+
+	return dataFrom, dataTo
+}
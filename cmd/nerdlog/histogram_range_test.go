@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMinuteStatsRange(t *testing.T) {
+	first, last := getMinuteStatsRange(nil)
+	assert.True(t, first.IsZero())
+	assert.True(t, last.IsZero())
+
+	first, last = getMinuteStatsRange(map[int64]core.MinuteStatsItem{
+		600: {NumMsgs: 0},
+		660: {NumMsgs: 3},
+		900: {NumMsgs: 1},
+		960: {NumMsgs: 0},
+	})
+	assert.Equal(t, time.Unix(660, 0).UTC(), first)
+	assert.Equal(t, time.Unix(900, 0).UTC(), last)
+}
+
+func TestNarrowHistogramRange(t *testing.T) {
+	mustParse := func(s string) time.Time {
+		tt, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			panic(err)
+		}
+		return tt
+	}
+
+	type testCase struct {
+		descr string
+
+		statsFirst, statsLast string
+		granularity           time.Duration
+
+		wantFrom, wantTo string
+	}
+
+	from := mustParse("2025-03-10T10:00:00Z")
+	to := mustParse("2025-03-10T12:00:00Z")
+
+	testCases := []testCase{
+		{
+			descr:       "no data",
+			granularity: time.Minute,
+			wantFrom:    "2025-03-10T10:00:00Z",
+			wantTo:      "2025-03-10T12:00:00Z",
+		},
+		{
+			descr:       "data in the middle",
+			statsFirst:  "2025-03-10T10:42:00Z",
+			statsLast:   "2025-03-10T11:13:00Z",
+			granularity: time.Minute,
+			wantFrom:    "2025-03-10T10:42:00Z",
+			wantTo:      "2025-03-10T11:14:00Z",
+		},
+		{
+			descr:       "aligned to granularity",
+			statsFirst:  "2025-03-10T10:42:00Z",
+			statsLast:   "2025-03-10T11:13:00Z",
+			granularity: 5 * time.Minute,
+			wantFrom:    "2025-03-10T10:40:00Z",
+			wantTo:      "2025-03-10T11:15:00Z",
+		},
+		{
+			descr:       "clamped to the query range",
+			statsFirst:  "2025-03-10T09:58:00Z",
+			statsLast:   "2025-03-10T12:00:00Z",
+			granularity: time.Minute,
+			wantFrom:    "2025-03-10T10:00:00Z",
+			wantTo:      "2025-03-10T12:00:00Z",
+		},
+		{
+			descr:       "data outside of the query range",
+			statsFirst:  "2025-03-10T13:00:00Z",
+			statsLast:   "2025-03-10T13:05:00Z",
+			granularity: time.Minute,
+			wantFrom:    "2025-03-10T10:00:00Z",
+			wantTo:      "2025-03-10T12:00:00Z",
+		},
+	}
+
+	for _, tc := range testCases {
+		var statsFirst, statsLast time.Time
+		if tc.statsFirst != "" {
+			statsFirst = mustParse(tc.statsFirst)
+			statsLast = mustParse(tc.statsLast)
+		}
+
+		gotFrom, gotTo := narrowHistogramRange(from, to, statsFirst, statsLast, tc.granularity)
+		assert.Equal(t, mustParse(tc.wantFrom), gotFrom.UTC(), tc.descr)
+		assert.Equal(t, mustParse(tc.wantTo), gotTo.UTC(), tc.descr)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -226,3 +228,148 @@ func TestGetOptimalScale_Random(t *testing.T) {
 		}
 	}
 }
+
+func TestHistogramGetBins(t *testing.T) {
+	h := NewHistogram().SetBinSize(60)
+	h.SetRange(0, 300)
+	h.SetData(map[int]int{
+		0:   1,
+		60:  2,
+		180: 5,
+		240: 7,
+	})
+
+	// Without any drawing done yet, every data bin is a separate bar.
+	assert.Equal(t, []HistogramBin{
+		{From: 0, To: 60, Val: 1},
+		{From: 60, To: 120, Val: 2},
+		{From: 120, To: 180, Val: 0},
+		{From: 180, To: 240, Val: 5},
+		{From: 240, To: 300, Val: 7},
+	}, h.GetBins())
+
+	// Pretend that the last draw resulted in 2 data bins per bar.
+	h.fldData = &fieldData{dataBinsInChartBar: 2}
+	assert.Equal(t, []HistogramBin{
+		{From: 0, To: 120, Val: 3},
+		{From: 120, To: 240, Val: 5},
+		{From: 240, To: 300, Val: 7},
+	}, h.GetBins())
+}
+
+func TestHistogramGetErrorSpikes(t *testing.T) {
+	h := NewHistogram().SetBinSize(60)
+	h.SetRange(0, 300)
+	h.SetData(map[int]int{
+		0:   50,
+		60:  20,
+		120: 100,
+		180: 50,
+		240: 70,
+	})
+	h.SetErrorData(map[int]int{
+		0:   5,
+		60:  2,
+		180: 5,
+		240: 7,
+	})
+
+	assert.Equal(t, []HistogramBin{
+		{From: 240, To: 300, Val: 7},
+		{From: 0, To: 60, Val: 5},
+		{From: 180, To: 240, Val: 5},
+		{From: 60, To: 120, Val: 2},
+	}, h.GetErrorSpikes())
+}
+
+func TestFindHistogramGaps(t *testing.T) {
+	data := map[int]int{
+		120: 1,
+		180: 3,
+		420: 2,
+		720: 1,
+	}
+
+	testCases := []struct {
+		name   string
+		from   int
+		to     int
+		minLen int
+		want   []HistogramGap
+	}{
+		{
+			name:   "disabled",
+			from:   0,
+			to:     900,
+			minLen: 0,
+			want:   nil,
+		},
+		{
+			name:   "every empty bin",
+			from:   0,
+			to:     900,
+			minLen: 60,
+			want: []HistogramGap{
+				{From: 0, To: 120},
+				{From: 240, To: 420},
+				{From: 480, To: 720},
+				{From: 780, To: 900},
+			},
+		},
+		{
+			name:   "only long enough gaps",
+			from:   0,
+			to:     900,
+			minLen: 180,
+			want: []HistogramGap{
+				{From: 240, To: 420},
+				{From: 480, To: 720},
+			},
+		},
+		{
+			name:   "gap until the end of the range",
+			from:   600,
+			to:     1200,
+			minLen: 240,
+			want: []HistogramGap{
+				{From: 780, To: 1200},
+			},
+		},
+		{
+			name:   "no gaps",
+			from:   120,
+			to:     240,
+			minLen: 60,
+			want:   nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, findHistogramGaps(data, tc.from, tc.to, 60, tc.minLen))
+		})
+	}
+}
+
+func TestHistogramCursorMovedFunc(t *testing.T) {
+	h := NewHistogram().SetBinSize(60)
+	h.SetRange(0, 300)
+
+	var moves [][2]int
+	h.SetCursorMovedFunc(func(from, to int) {
+		moves = append(moves, [2]int{from, to})
+	})
+
+	handler := h.InputHandler()
+	press := func(r rune) {
+		handler(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone), func(p tview.Primitive) {})
+	}
+
+	// The cursor starts at the last bar, so moving right doesn't move it.
+	press('l')
+	assert.Nil(t, moves)
+
+	press('h')
+	press('g')
+	assert.Equal(t, [][2]int{{180, 240}, {0, 60}}, moves)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+)
+
+// defaultWriteHTMLFilename is where :write-html writes the report if the
+// filename isn't given.
+const defaultWriteHTMLFilename = "/tmp/last_nerdlog.html"
+
+// htmlReportTimeLayout is how the times are formatted in the HTML report;
+// unlike in the logs table, the date is complete, since the report might be
+// read long after.
+const htmlReportTimeLayout = "2006-01-02 15:04:05.000"
+
+// htmlReportMaxBars is the max number of bars in the histogram of the HTML
+// report; if there are more minutes in the range, every bar covers multiple
+// minutes.
+const htmlReportMaxBars = 240
+
+// Dimensions of the histogram SVG in the HTML report.
+const (
+	htmlReportHistWidth  = 960
+	htmlReportHistHeight = 120
+)
+
+// htmlReportData is everything which goes into the HTML report.
+type htmlReportData struct {
+	Query QueryFull
+	// TimeRange is the human-readable actual time range of the query.
+	TimeRange string
+
+	// HistFrom and HistTo is the time range of the histogram.
+	HistFrom, HistTo time.Time
+	MinuteStats      map[int64]core.MinuteStatsItem
+
+	Logs []core.LogMsg
+	// ColNames are the names of the columns to show, in the same order as in
+	// the logs table, including the time and the message.
+	ColNames []string
+	// NumMsgsTotal is the number of messages matching the query, which can
+	// be larger than len(Logs).
+	NumMsgsTotal int
+
+	TZ          *time.Location
+	GeneratedAt time.Time
+}
+
+type htmlReportBar struct {
+	X, Y, W, H float64
+	Title      string
+}
+
+type htmlReportRow struct {
+	Level string
+	Cells []string
+}
+
+// htmlReportTmplData is what htmlReportTmpl is executed with; it's derived
+// from htmlReportData.
+type htmlReportTmplData struct {
+	*htmlReportData
+
+	HistWidth, HistHeight int
+	Bars                  []htmlReportBar
+	Rows                  []htmlReportRow
+	GeneratedAtStr        string
+}
+
+// getHTMLReportBars returns the bars of the histogram, with the coordinates
+// in the SVG of the given size.
+func getHTMLReportBars(data *htmlReportData, width, height int) []htmlReportBar {
+	fromUnix, toUnix := data.HistFrom.Unix(), data.HistTo.Unix()
+	if toUnix <= fromUnix {
+		return nil
+	}
+
+	numMinutes := int((toUnix - fromUnix + 59) / 60)
+	minutesPerBar := (numMinutes + htmlReportMaxBars - 1) / htmlReportMaxBars
+	numBars := (numMinutes + minutesPerBar - 1) / minutesPerBar
+	barSecs := int64(minutesPerBar * 60)
+
+	vals := make([]int, numBars)
+	maxVal := 0
+	for k, v := range data.MinuteStats {
+		if k < fromUnix || k >= toUnix {
+			continue
+		}
+
+		idx := int((k - fromUnix) / barSecs)
+		vals[idx] += v.NumMsgs
+		if vals[idx] > maxVal {
+			maxVal = vals[idx]
+		}
+	}
+
+	if maxVal == 0 {
+		return nil
+	}
+
+	barWidth := float64(width) / float64(numBars)
+
+	var ret []htmlReportBar
+	for i, val := range vals {
+		if val == 0 {
+			continue
+		}
+
+		h := float64(height) * float64(val) / float64(maxVal)
+		barFrom := time.Unix(fromUnix+int64(i)*barSecs, 0).In(data.TZ)
+
+		ret = append(ret, htmlReportBar{
+			X:     barWidth * float64(i),
+			Y:     float64(height) - h,
+			W:     barWidth,
+			H:     h,
+			Title: fmt.Sprintf("%s: %d", barFrom.Format("Jan02 15:04"), val),
+		})
+	}
+
+	return ret
+}
+
+func getHTMLReportRows(data *htmlReportData) []htmlReportRow {
+	ret := make([]htmlReportRow, 0, len(data.Logs))
+	for i := range data.Logs {
+		msg := &data.Logs[i]
+
+		row := htmlReportRow{
+			Level: string(msg.Level),
+			Cells: make([]string, 0, len(data.ColNames)),
+		}
+
+		for _, colName := range data.ColNames {
+			if colName == FieldNameTime {
+				row.Cells = append(row.Cells, msg.Time.In(data.TZ).Format(htmlReportTimeLayout))
+				continue
+			}
+
+			row.Cells = append(row.Cells, getLogMsgColValue(msg, colName, ""))
+		}
+
+		ret = append(ret, row)
+	}
+
+	return ret
+}
+
+// writeHTMLReport renders the standalone HTML report, with the query, the
+// histogram as an inline SVG, and the logs colored by level.
+func writeHTMLReport(w io.Writer, data *htmlReportData) error {
+	tmplData := &htmlReportTmplData{
+		htmlReportData: data,
+		HistWidth:      htmlReportHistWidth,
+		HistHeight:     htmlReportHistHeight,
+		Bars:           getHTMLReportBars(data, htmlReportHistWidth, htmlReportHistHeight),
+		Rows:           getHTMLReportRows(data),
+		GeneratedAtStr: data.GeneratedAt.In(data.TZ).Format(htmlReportTimeLayout),
+	}
+
+	if err := htmlReportTmpl.Execute(w, tmplData); err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+var htmlReportTmpl = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>nerdlog: {{.Query.Query}}</title>
+<style>
+body { background: #1c1c1c; color: #d0d0d0; font-family: monospace; font-size: 13px; margin: 16px; }
+h1 { font-size: 16px; }
+table.query td { padding: 1px 8px 1px 0; vertical-align: top; }
+table.query td:first-child { color: #87afff; }
+svg.hist { background: #262626; display: block; margin: 12px 0; }
+svg.hist rect { fill: #5fd75f; }
+table.logs { border-collapse: collapse; }
+table.logs th { text-align: left; color: #87afff; border-bottom: 1px solid #444; padding: 2px 8px; }
+table.logs td { padding: 1px 8px; vertical-align: top; white-space: pre-wrap; }
+table.logs td:first-child { color: #87afff; white-space: nowrap; }
+tr.level-debug { color: #87d7ff; }
+tr.level-info { color: #87ff87; }
+tr.level-warn { color: #ffff5f; }
+tr.level-error { color: #ffafd7; }
+tr:hover { background: #303030; }
+</style>
+</head>
+<body>
+<h1>nerdlog report</h1>
+<table class="query">
+<tr><td>Logstreams</td><td>{{.Query.LStreams}}</td></tr>
+<tr><td>Time</td><td>{{.TimeRange}}</td></tr>
+<tr><td>Query</td><td>{{.Query.Query}}</td></tr>
+{{- if .Query.Exclude}}
+<tr><td>Excluding</td><td>{{.Query.Exclude}}</td></tr>
+{{- end}}
+<tr><td>Messages</td><td>{{len .Logs}} shown, {{.NumMsgsTotal}} total</td></tr>
+<tr><td>Generated</td><td>{{.GeneratedAtStr}}</td></tr>
+</table>
+<svg class="hist" width="{{.HistWidth}}" height="{{.HistHeight}}" viewBox="0 0 {{.HistWidth}} {{.HistHeight}}" xmlns="http://www.w3.org/2000/svg">
+{{- range .Bars}}
+<rect x="{{printf "%.2f" .X}}" y="{{printf "%.2f" .Y}}" width="{{printf "%.2f" .W}}" height="{{printf "%.2f" .H}}"><title>{{.Title}}</title></rect>
+{{- end}}
+</svg>
+<table class="logs">
+<tr>{{range .ColNames}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr class="level-{{.Level}}">{{range .Cells}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
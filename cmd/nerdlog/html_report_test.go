@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+
+	data := &htmlReportData{
+		Query: QueryFull{
+			LStreams: "host-*",
+			Time:     "-1h",
+			Query:    "/foo & bar/",
+		},
+		TimeRange: "last 1h",
+		HistFrom:  t0,
+		HistTo:    t0.Add(4 * time.Minute),
+		MinuteStats: map[int64]core.MinuteStatsItem{
+			t0.Unix():                        {NumMsgs: 1},
+			t0.Add(2 * time.Minute).Unix():   {NumMsgs: 4},
+			t0.Add(-10 * time.Minute).Unix(): {NumMsgs: 100}, // Outside of the range
+		},
+		Logs: []core.LogMsg{
+			{
+				Time:    t0.Add(10 * time.Second),
+				Msg:     "all good",
+				Level:   core.LogLevelInfo,
+				Context: map[string]string{"lstream": "host-1"},
+			},
+			{
+				Time:    t0.Add(130 * time.Second),
+				Msg:     "<script>alert(1)</script>",
+				Level:   core.LogLevelError,
+				Context: map[string]string{"lstream": "host-2"},
+			},
+		},
+		ColNames:     []string{FieldNameTime, "lstream", FieldNameMessage},
+		NumMsgsTotal: 5,
+		TZ:           time.UTC,
+		GeneratedAt:  t0.Add(time.Hour),
+	}
+
+	var sb strings.Builder
+	assert.NoError(t, writeHTMLReport(&sb, data))
+	html := sb.String()
+
+	assert.Contains(t, html, "<td>host-*</td>")
+	assert.Contains(t, html, "<td>/foo &amp; bar/</td>")
+	assert.Contains(t, html, "<td>2 shown, 5 total</td>")
+	assert.Contains(t, html, "<th>time</th><th>lstream</th><th>message</th>")
+	assert.Contains(t, html,
+		`<tr class="level-info"><td>2025-03-10 10:00:10.000</td><td>host-1</td><td>all good</td></tr>`,
+	)
+	assert.Contains(t, html, `<tr class="level-error">`)
+	assert.Contains(t, html, "&lt;script&gt;alert(1)&lt;/script&gt;")
+	assert.NotContains(t, html, "<script>")
+
+	// Two bars: the one with 4 messages is full height, the other one is a
+	// quarter of it.
+	assert.Equal(t, 2, strings.Count(html, "<rect "))
+	assert.Contains(t, html, `<rect x="480.00" y="0.00" width="240.00" height="120.00"><title>Mar10 10:02: 4</title></rect>`)
+	assert.Contains(t, html, `<rect x="0.00" y="90.00" width="240.00" height="30.00"><title>Mar10 10:00: 1</title></rect>`)
+}
+
+func TestGetHTMLReportBarsMultipleMinutes(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	// A day is 1440 minutes, so every bar covers 6 minutes.
+	data := &htmlReportData{
+		HistFrom: t0,
+		HistTo:   t0.Add(24 * time.Hour),
+		MinuteStats: map[int64]core.MinuteStatsItem{
+			t0.Add(5 * time.Minute).Unix(): {NumMsgs: 1},
+			t0.Add(6 * time.Minute).Unix(): {NumMsgs: 4},
+		},
+		TZ: time.UTC,
+	}
+
+	bars := getHTMLReportBars(data, 240, 100)
+	assert.Equal(t, []htmlReportBar{
+		{X: 0, Y: 75, W: 1, H: 25, Title: "Mar10 00:00: 1"},
+		{X: 1, Y: 0, W: 1, H: 100, Title: "Mar10 00:06: 4"},
+	}, bars)
+}
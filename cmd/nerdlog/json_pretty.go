@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// Colors of the JSON tokens in prettyPrintJSON.
+const (
+	jsonColorKey     = "lightskyblue"
+	jsonColorString  = "lightgreen"
+	jsonColorNumber  = "yellow"
+	jsonColorLiteral = "orchid"
+)
+
+// getJSONStart returns the index of the JSON object in the log line, which
+// might be prefixed with something like a timestamp; ok is false if there is
+// no valid JSON object till the end of the line.
+func getJSONStart(line string) (idx int, ok bool) {
+	idx = strings.Index(line, "{")
+	if idx < 0 {
+		return 0, false
+	}
+
+	if !json.Valid([]byte(strings.TrimSpace(line[idx:]))) {
+		return 0, false
+	}
+
+	return idx, true
+}
+
+// prettyPrintJSON returns the log line with the JSON object in it indented
+// and colored, as a tview text; whatever precedes the JSON, like a timestamp,
+// is on the first line as is. If there is no valid JSON object, ok is false.
+func prettyPrintJSON(line string) (text string, ok bool) {
+	idx, ok := getJSONStart(line)
+	if !ok {
+		return "", false
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(strings.TrimSpace(line[idx:])), "", "  "); err != nil {
+		return "", false
+	}
+
+	var sb strings.Builder
+	if prefix := strings.TrimSpace(line[:idx]); prefix != "" {
+		sb.WriteString(tview.Escape(prefix))
+		sb.WriteString("\n")
+	}
+
+	colorizeJSON(&sb, indented.String())
+
+	return sb.String(), true
+}
+
+// colorizeJSON writes the given valid JSON to the builder, with the tview
+// color tags around the keys and values.
+func colorizeJSON(sb *strings.Builder, s string) {
+	writeColored := func(color, token string) {
+		sb.WriteString("[" + color + "]")
+		sb.WriteString(tview.Escape(token))
+		sb.WriteString("[-]")
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+
+			// It's a key if it's followed by a colon.
+			color := jsonColorString
+			if strings.HasPrefix(strings.TrimLeft(s[end:], " "), ":") {
+				color = jsonColorKey
+			}
+
+			writeColored(color, s[i:end])
+			i = end
+
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(s) && strings.IndexByte("0123456789.eE+-", s[end]) >= 0 {
+				end++
+			}
+
+			writeColored(jsonColorNumber, s[i:end])
+			i = end
+
+		case c == 't' || c == 'f' || c == 'n':
+			end := i + 1
+			for end < len(s) && s[end] >= 'a' && s[end] <= 'z' {
+				end++
+			}
+
+			writeColored(jsonColorLiteral, s[i:end])
+			i = end
+
+		case c == '[' && strings.HasPrefix(s[i:], "[]"):
+			// tview would take "[]" for a color tag, and it can't be escaped.
+			sb.WriteString("[ ]")
+			i += 2
+
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrettyPrintJSON(t *testing.T) {
+	text, ok := prettyPrintJSON(`2025-03-10T10:00:01Z {"msg":"hi [x]","n":-1.5e3,"ok":true,"tags":["a",null],"\"q\"":{},"e":[]}`)
+	assert.True(t, ok)
+	assert.Equal(t,
+		"2025-03-10T10:00:01Z\n"+
+			"{\n"+
+			`  [lightskyblue]"msg"[-]: [lightgreen]"hi [x[]"[-],`+"\n"+
+			`  [lightskyblue]"n"[-]: [yellow]-1.5e3[-],`+"\n"+
+			`  [lightskyblue]"ok"[-]: [orchid]true[-],`+"\n"+
+			`  [lightskyblue]"tags"[-]: [`+"\n"+
+			`    [lightgreen]"a"[-],`+"\n"+
+			`    [orchid]null[-]`+"\n"+
+			`  ],`+"\n"+
+			`  [lightskyblue]"\"q\""[-]: {},`+"\n"+
+			`  [lightskyblue]"e"[-]: [ ]`+"\n"+
+			"}",
+		text,
+	)
+
+	for _, line := range []string{
+		"plain text",
+		`2025-03-10T10:00:01Z {"broken": `,
+		`{"trailing": 1} garbage`,
+	} {
+		_, ok := prettyPrintJSON(line)
+		assert.False(t, ok, line)
+	}
+}
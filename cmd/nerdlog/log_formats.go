@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// formatLogFormats returns the human-readable list of the log formats used
+// for every logstream, with the hints on how to override the detected ones.
+func formatLogFormats(logFormats map[string]core.LogFormatGuess) string {
+	if len(logFormats) == 0 {
+		return "No logstreams have connected yet"
+	}
+
+	names := make([]string, 0, len(logFormats))
+	for name := range logFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	numDetected := 0
+
+	for _, name := range names {
+		guess := logFormats[name]
+
+		how := "detected"
+		if guess.Configured {
+			how = "configured"
+		} else {
+			numDetected++
+			if guess.Ambiguous {
+				how = "ambiguous, the example lines look different"
+			}
+		}
+
+		sb.WriteString(fmt.Sprintf(
+			"%s: %s (%s), timestamps: %s\n", name, guess.Format, how, guess.TimestampLayout,
+		))
+	}
+
+	if numDetected > 0 {
+		sb.WriteString("\nIf a detected format is wrong, set it in the logstream options in the config, like:\n\n")
+		sb.WriteString("  options:\n")
+		sb.WriteString("    format: syslog\n\n")
+		sb.WriteString("Valid formats are: syslog, journald, rfc3339, json, raw.\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatLogFormats(t *testing.T) {
+	assert.Equal(t, "No logstreams have connected yet", formatLogFormats(nil))
+
+	got := formatLogFormats(map[string]core.LogFormatGuess{
+		"host-02": {
+			Format:          core.LogFormatRaw,
+			TimestampLayout: "2006-01-02 15:04:05",
+			Ambiguous:       true,
+		},
+		"host-01": {
+			Format:          core.LogFormatSyslog,
+			TimestampLayout: "Jan _2 15:04:05",
+			Configured:      true,
+		},
+	})
+
+	assert.Equal(t, `host-01: syslog (configured), timestamps: Jan _2 15:04:05
+host-02: raw (ambiguous, the example lines look different), timestamps: 2006-01-02 15:04:05
+
+If a detected format is wrong, set it in the logstream options in the config, like:
+
+  options:
+    format: syslog
+
+Valid formats are: syslog, journald, rfc3339, json, raw.
+`, got)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// sameLogMsg returns whether the two messages are the same logical log line,
+// e.g. fetched by two different queries. Line numbers are only compared if
+// both messages have them, since e.g. journalctl ones don't.
+func sameLogMsg(a, b *core.LogMsg) bool {
+	if !a.Time.Equal(b.Time) || a.Msg != b.Msg || a.Context["lstream"] != b.Context["lstream"] {
+		return false
+	}
+
+	if a.LogFilename != b.LogFilename {
+		return false
+	}
+
+	if a.LogLinenumber != 0 && b.LogLinenumber != 0 && a.LogLinenumber != b.LogLinenumber {
+		return false
+	}
+
+	return true
+}
+
+// findLogMsg returns the index of the given message in the logs, which must
+// be sorted by time. If there's no such message, the one nearest by time is
+// returned instead, but only if the message's time is within the time span
+// of the logs: otherwise, the logs are likely about something else entirely,
+// and false is returned.
+func findLogMsg(logs []core.LogMsg, target *core.LogMsg) (int, bool) {
+	if len(logs) == 0 {
+		return 0, false
+	}
+
+	// Index of the first message not before the target.
+	idx := sort.Search(len(logs), func(i int) bool {
+		return !logs[i].Time.Before(target.Time)
+	})
+
+	for i := idx; i < len(logs) && logs[i].Time.Equal(target.Time); i++ {
+		if sameLogMsg(&logs[i], target) {
+			return i, true
+		}
+	}
+
+	if target.Time.Before(logs[0].Time) || target.Time.After(logs[len(logs)-1].Time) {
+		return 0, false
+	}
+
+	// The target is within the span, so idx is a valid index; check if the
+	// previous message is nearer.
+	if idx > 0 && target.Time.Sub(logs[idx-1].Time) < logs[idx].Time.Sub(target.Time) {
+		return idx - 1, true
+	}
+
+	return idx, true
+}
+
+// findFirstLogMsgIn returns the index of the first message in the time range
+// [from, to), and false if there are no messages in it. The logs must be
+// sorted by time.
+func findFirstLogMsgIn(logs []core.LogMsg, from, to time.Time) (int, bool) {
+	idx := sort.Search(len(logs), func(i int) bool {
+		return !logs[i].Time.Before(from)
+	})
+
+	if idx >= len(logs) || !logs[idx].Time.Before(to) {
+		return 0, false
+	}
+
+	return idx, true
+}
+
+// getNewLogMsgs returns the messages from logs which came after all of the
+// prevLogs, e.g. the ones brought by the autorefresh. Both must be sorted by
+// time. If the last previous message is still there, everything after it is
+// new; otherwise, everything later than it is.
+func getNewLogMsgs(prevLogs, logs []core.LogMsg) []core.LogMsg {
+	if len(prevLogs) == 0 {
+		return logs
+	}
+
+	prevLast := &prevLogs[len(prevLogs)-1]
+	for i := len(logs) - 1; i >= 0; i-- {
+		if sameLogMsg(&logs[i], prevLast) {
+			return logs[i+1:]
+		}
+
+		if logs[i].Time.Before(prevLast.Time) {
+			break
+		}
+	}
+
+	idx := sort.Search(len(logs), func(i int) bool {
+		return logs[i].Time.After(prevLast.Time)
+	})
+
+	return logs[idx:]
+}
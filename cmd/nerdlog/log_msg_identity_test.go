@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindLogMsg(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+	newMsg := func(sec int, msg, lstream string, linenr int) core.LogMsg {
+		return core.LogMsg{
+			Time:          t0.Add(time.Duration(sec) * time.Second),
+			Msg:           msg,
+			LogFilename:   "/var/log/syslog",
+			LogLinenumber: linenr,
+			Context:       map[string]string{"lstream": lstream},
+		}
+	}
+
+	logs := []core.LogMsg{
+		newMsg(0, "foo", "host-1", 10),
+		newMsg(10, "bar", "host-1", 11),
+		newMsg(10, "bar", "host-2", 20),
+		newMsg(30, "baz", "host-1", 12),
+	}
+
+	testCases := []struct {
+		name    string
+		target  core.LogMsg
+		wantIdx int
+		wantOK  bool
+	}{
+		{name: "exact", target: newMsg(10, "bar", "host-2", 20), wantIdx: 2, wantOK: true},
+		{name: "no linenumber", target: newMsg(10, "bar", "host-2", 0), wantIdx: 2, wantOK: true},
+		{name: "nearest earlier", target: newMsg(12, "gone", "host-1", 0), wantIdx: 2, wantOK: true},
+		{name: "nearest later", target: newMsg(25, "gone", "host-1", 0), wantIdx: 3, wantOK: true},
+		{name: "before span", target: newMsg(-5, "foo", "host-1", 9), wantOK: false},
+		{name: "after span", target: newMsg(40, "foo", "host-1", 13), wantOK: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			idx, ok := findLogMsg(logs, &tc.target)
+			assert.Equal(t, tc.wantOK, ok)
+			if tc.wantOK {
+				assert.Equal(t, tc.wantIdx, idx)
+			}
+		})
+	}
+
+	_, ok := findLogMsg(nil, &logs[0])
+	assert.False(t, ok)
+}
+
+func TestFindFirstLogMsgIn(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time {
+		return t0.Add(time.Duration(sec) * time.Second)
+	}
+
+	logs := []core.LogMsg{
+		{Time: at(0), Msg: "foo"},
+		{Time: at(60), Msg: "bar"},
+		{Time: at(70), Msg: "baz"},
+		{Time: at(180), Msg: "qux"},
+	}
+
+	testCases := []struct {
+		name     string
+		from, to int
+		wantIdx  int
+		wantOK   bool
+	}{
+		{name: "first", from: 0, to: 60, wantIdx: 0, wantOK: true},
+		{name: "first of many", from: 60, to: 120, wantIdx: 1, wantOK: true},
+		{name: "empty range", from: 120, to: 180, wantOK: false},
+		{name: "wide range", from: -60, to: 600, wantIdx: 0, wantOK: true},
+		{name: "after all", from: 240, to: 300, wantOK: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			idx, ok := findFirstLogMsgIn(logs, at(tc.from), at(tc.to))
+			assert.Equal(t, tc.wantOK, ok)
+			if tc.wantOK {
+				assert.Equal(t, tc.wantIdx, idx)
+			}
+		})
+	}
+}
+
+func TestGetNewLogMsgs(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+	newMsg := func(sec int, msg string) core.LogMsg {
+		return core.LogMsg{
+			Time:    t0.Add(time.Duration(sec) * time.Second),
+			Msg:     msg,
+			Context: map[string]string{"lstream": "host-1"},
+		}
+	}
+
+	prevLogs := []core.LogMsg{newMsg(0, "a"), newMsg(10, "b"), newMsg(10, "c")}
+
+	// The last previous message is still there, even though the older ones
+	// have gone out of the time range.
+	logs := []core.LogMsg{newMsg(10, "b"), newMsg(10, "c"), newMsg(10, "d"), newMsg(20, "e")}
+	assert.Equal(t, logs[2:], getNewLogMsgs(prevLogs, logs))
+
+	// The last previous message is gone: everything after its time is new.
+	logs = []core.LogMsg{newMsg(10, "b"), newMsg(15, "d"), newMsg(20, "e")}
+	assert.Equal(t, logs[1:], getNewLogMsgs(prevLogs, logs))
+
+	// Nothing new.
+	assert.Empty(t, getNewLogMsgs(prevLogs, prevLogs))
+
+	// No previous logs: everything is new.
+	assert.Equal(t, logs, getNewLogMsgs(nil, logs))
+}
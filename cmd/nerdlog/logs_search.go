@@ -0,0 +1,131 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+	"github.com/rivo/tview"
+)
+
+// logsSearch is the state of the vim-like search within the loaded logs
+// (started with "/" or "?" in the logs table).
+type logsSearch struct {
+	pattern string
+	re      *regexp.Regexp
+
+	// backward is true if the search was started with "?", so "n" goes to the
+	// previous match and "N" to the next one, like in vim.
+	backward bool
+
+	// matches contains the indices of the matching messages, in ascending
+	// order.
+	matches []int
+}
+
+// newLogsSearch parses the search pattern, which is a Go regexp. Like vim
+// with smartcase, it's case-insensitive unless it contains an uppercase
+// letter.
+func newLogsSearch(pattern string, backward bool) (*logsSearch, error) {
+	reStr := pattern
+	if strings.IndexFunc(pattern, unicode.IsUpper) < 0 {
+		reStr = "(?i)" + reStr
+	}
+
+	re, err := regexp.Compile(reStr)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid search pattern %q", pattern)
+	}
+
+	return &logsSearch{
+		pattern:  pattern,
+		re:       re,
+		backward: backward,
+	}, nil
+}
+
+// getLogMsgSearchText returns the text of the message which is searched
+// through: the same as what the message column shows.
+func getLogMsgSearchText(msg *core.LogMsg, rawMessage bool) string {
+	if rawMessage {
+		return msg.OrigLine
+	}
+
+	return msg.Msg
+}
+
+// updateMatches finds all the matching messages in the logs.
+func (s *logsSearch) updateMatches(logs []core.LogMsg, rawMessage bool) {
+	s.matches = nil
+	for i := range logs {
+		if s.re.MatchString(getLogMsgSearchText(&logs[i], rawMessage)) {
+			s.matches = append(s.matches, i)
+		}
+	}
+}
+
+// getMatchNum returns the index in s.matches of the given message, if it's
+// a match.
+func (s *logsSearch) getMatchNum(msgIdx int) (int, bool) {
+	k := sort.SearchInts(s.matches, msgIdx)
+	if k < len(s.matches) && s.matches[k] == msgIdx {
+		return k, true
+	}
+
+	return 0, false
+}
+
+// findNext returns the index in s.matches of the next match after the
+// message msgIdx (or the previous one, if forward is false), wrapping around
+// at the ends like vim does; wrapped is true if it has happened. If there are
+// no matches at all, ok is false.
+func (s *logsSearch) findNext(msgIdx int, forward bool) (k int, wrapped, ok bool) {
+	if len(s.matches) == 0 {
+		return 0, false, false
+	}
+
+	if forward {
+		k = sort.SearchInts(s.matches, msgIdx+1)
+		if k == len(s.matches) {
+			return 0, true, true
+		}
+
+		return k, false, true
+	}
+
+	k = sort.SearchInts(s.matches, msgIdx) - 1
+	if k < 0 {
+		return len(s.matches) - 1, true, true
+	}
+
+	return k, false, true
+}
+
+// highlightSearchMatches returns the text escaped for tview, with all the
+// matches of the regexp highlighted.
+func highlightSearchMatches(text string, re *regexp.Regexp) string {
+	if re == nil {
+		return tview.Escape(text)
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringIndex(text, -1) {
+		if loc[0] == loc[1] {
+			// Empty matches can't be highlighted.
+			continue
+		}
+
+		sb.WriteString(tview.Escape(text[last:loc[0]]))
+		sb.WriteString("[black:yellow]")
+		sb.WriteString(tview.Escape(text[loc[0]:loc[1]]))
+		sb.WriteString("[-:-]")
+		last = loc[1]
+	}
+	sb.WriteString(tview.Escape(text[last:]))
+
+	return sb.String()
+}
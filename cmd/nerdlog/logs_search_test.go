@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogsSearchFindNext(t *testing.T) {
+	s, err := newLogsSearch("error", false)
+	assert.NoError(t, err)
+
+	s.updateMatches([]core.LogMsg{
+		{Msg: "foo"},
+		{Msg: "Error: one"},
+		{Msg: "bar"},
+		{Msg: "error: two", OrigLine: "Jan 1 error: two"},
+		{Msg: "baz"},
+	}, false)
+	assert.Equal(t, []int{1, 3}, s.matches)
+
+	testCases := []struct {
+		name     string
+		msgIdx   int
+		forward  bool
+		wantK    int
+		wantWrap bool
+	}{
+		{name: "forward from the top", msgIdx: -1, forward: true, wantK: 0},
+		{name: "forward from a match", msgIdx: 1, forward: true, wantK: 1},
+		{name: "forward wraps", msgIdx: 3, forward: true, wantK: 0, wantWrap: true},
+		{name: "backward from the bottom", msgIdx: 5, forward: false, wantK: 1},
+		{name: "backward from between", msgIdx: 2, forward: false, wantK: 0},
+		{name: "backward wraps", msgIdx: 1, forward: false, wantK: 1, wantWrap: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			k, wrapped, ok := s.findNext(tc.msgIdx, tc.forward)
+			assert.True(t, ok)
+			assert.Equal(t, tc.wantK, k)
+			assert.Equal(t, tc.wantWrap, wrapped)
+		})
+	}
+
+	k, ok := s.getMatchNum(3)
+	assert.True(t, ok)
+	assert.Equal(t, 1, k)
+
+	_, ok = s.getMatchNum(2)
+	assert.False(t, ok)
+
+	// With an uppercase letter, the search is case-sensitive.
+	s, err = newLogsSearch("Error", false)
+	assert.NoError(t, err)
+	s.updateMatches([]core.LogMsg{{Msg: "Error: one"}, {Msg: "error: two"}}, false)
+	assert.Equal(t, []int{0}, s.matches)
+
+	_, _, ok = (&logsSearch{}).findNext(0, true)
+	assert.False(t, ok)
+
+	_, err = newLogsSearch("foo(", false)
+	assert.Error(t, err)
+}
+
+func TestHighlightSearchMatches(t *testing.T) {
+	s, err := newLogsSearch("o+", false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "f[black:yellow]oo[-:-] [red[] b[black:yellow]o[-:-]", highlightSearchMatches("foo [red] bo", s.re))
+	assert.Equal(t, "[red[]", highlightSearchMatches("[red]", nil))
+}
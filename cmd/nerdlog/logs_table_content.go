@@ -0,0 +1,554 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// logsTableContent implements tview.TableContent for the logs table. Instead
+// of keeping a TableCell for every field of every log message, the data cells
+// are created on the fly right from the log messages, so only the visible
+// ones are ever materialized. This makes a big difference for large result
+// sets, both in terms of memory and time to apply the results.
+//
+// Only the rows before rowIdxFirstData (the header and the "load older" row)
+// are stored as actual cells, and only those can be modified with SetCell.
+//
+// In the reverse mode, the newest messages are at the top, and the "load
+// older" row is at the bottom, after all the data rows; see getFirstDataRow
+// and getLoadOlderRow.
+type logsTableContent struct {
+	tview.TableContentReadOnly
+
+	// fixedRows contains the cells for the rows before rowIdxFirstData.
+	fixedRows [][]*tview.TableCell
+
+	logs     []core.LogMsg
+	colNames []string
+	tz       *time.Location
+
+	// showNumbers is whether the leading column (before the colNames) contains
+	// row numbers.
+	showNumbers bool
+
+	// dedupRows, if not nil, contains the rows to show in the dedup mode (see
+	// setDedup); otherwise, every message takes its own row.
+	dedupRows []dedupRow
+
+	// colColors, if not nil, overrides the colors of the context cells.
+	colColors *columnColorRules
+	// colFormats, if not nil, formats the values of the context cells.
+	colFormats *columnFormatRules
+
+	// msgSplitDelim, if not empty, is the delimiter to split the messages by
+	// into the synthetic columns (see msgSplitColPrefix).
+	msgSplitDelim string
+
+	// rawMessage is whether the message column shows the original log line
+	// instead of the parsed message.
+	rawMessage bool
+
+	// searchRe, if not nil, is the regexp whose matches are highlighted in the
+	// message column; see logsSearch.
+	searchRe *regexp.Regexp
+
+	// annotated, if not nil, contains the indices of the messages which have
+	// annotations; then the time column has a marker for them.
+	annotated map[int]struct{}
+
+	// wrapWidth, if non-zero, is the width to wrap the messages at; then every
+	// row from dedupRows (or every message) takes as many rows as it has
+	// lines, and those rows are in wrapRows.
+	wrapWidth int
+	wrapRows  []dedupRow
+
+	// reverse is whether the rows are shown in the reverse order, newest first.
+	reverse bool
+
+	// rowLevels caches the result of getRowLevels; nil if it needs to be
+	// recalculated.
+	rowLevels []core.LogLevel
+}
+
+var _ tview.TableContent = &logsTableContent{}
+
+func newLogsTableContent() *logsTableContent {
+	return &logsTableContent{
+		fixedRows: make([][]*tview.TableCell, rowIdxFirstData),
+		tz:        time.UTC,
+	}
+}
+
+// setLogs sets the log messages to show in the table, and the names of the
+// columns to show for every message. If showNumbers is true, there is also a
+// leading column with the row numbers, starting from 1.
+func (c *logsTableContent) setLogs(
+	logs []core.LogMsg, colNames []string, tz *time.Location, showNumbers bool,
+) {
+	c.logs = logs
+	c.colNames = colNames
+	c.tz = tz
+	c.showNumbers = showNumbers
+	c.dedupRows = nil
+	c.wrapRows = nil
+	c.rowLevels = nil
+}
+
+// setColumnColors sets the rules to color the context cells by value; nil
+// means the default colors.
+func (c *logsTableContent) setColumnColors(colColors *columnColorRules) {
+	c.colColors = colColors
+}
+
+// setColumnFormats sets the rules to format the values of the context cells;
+// nil means the values are shown as is.
+func (c *logsTableContent) setColumnFormats(colFormats *columnFormatRules) {
+	c.colFormats = colFormats
+}
+
+// setMsgSplitDelim sets the delimiter to split the messages by, for the
+// synthetic columns like "message#1"; empty means no split.
+func (c *logsTableContent) setMsgSplitDelim(delim string) {
+	c.msgSplitDelim = delim
+}
+
+// setRawMessage sets whether the message column shows the original log line
+// instead of the parsed message.
+func (c *logsTableContent) setRawMessage(rawMessage bool) {
+	c.rawMessage = rawMessage
+}
+
+// setSearchRegexp sets the regexp whose matches are highlighted in the
+// message column; nil means no highlighting.
+func (c *logsTableContent) setSearchRegexp(re *regexp.Regexp) {
+	c.searchRe = re
+}
+
+// setAnnotated sets the indices of the annotated messages; nil means there
+// are none.
+func (c *logsTableContent) setAnnotated(annotated map[int]struct{}) {
+	c.annotated = annotated
+}
+
+// setDedup enables or disables the dedup mode, where consecutive messages with
+// the same Msg are collapsed into a single row with a count; the groups whose
+// first message index is in expanded are shown in full. It must be called
+// after setLogs.
+func (c *logsTableContent) setDedup(enabled bool, expanded map[int]struct{}) {
+	c.rowLevels = nil
+
+	if !enabled {
+		c.dedupRows = nil
+	} else {
+		c.dedupRows = dedupLogMsgs(c.logs, expanded)
+	}
+
+	c.updateWrapRows()
+}
+
+// setReverse sets whether the rows are shown in the reverse order, newest
+// first. It must be called after setLogs.
+func (c *logsTableContent) setReverse(reverse bool) {
+	c.reverse = reverse
+	c.updateWrapRows()
+}
+
+// setWrapWidth sets the width to wrap the messages at, so that every line of
+// a message takes its own row; 0 means no wrapping. It must be called after
+// setLogs.
+func (c *logsTableContent) setWrapWidth(width int) {
+	c.wrapWidth = width
+	c.updateWrapRows()
+}
+
+// updateWrapRows rebuilds wrapRows as per the current wrapWidth.
+func (c *logsTableContent) updateWrapRows() {
+	c.wrapRows = nil
+	c.rowLevels = nil
+
+	if c.wrapWidth <= 0 {
+		return
+	}
+
+	numRows := c.getNumUnwrappedRows()
+
+	// Note that getDedupRow returns the rows without wrapping here, since
+	// c.wrapRows is nil yet; they're in the display order already, so the
+	// lines of every message stay in their order in the reverse mode too.
+	wrapRows := make([]dedupRow, 0, numRows)
+	for i := 0; i < numRows; i++ {
+		dr, _ := c.getDedupRow(i + c.getFirstDataRow())
+		numLines := len(wrapText(getLogMsgSearchText(&c.logs[dr.msgIdx], c.rawMessage), c.wrapWidth))
+		for line := 0; line < numLines; line++ {
+			dr.wrapLine = line
+			wrapRows = append(wrapRows, dr)
+		}
+	}
+
+	c.wrapRows = wrapRows
+}
+
+// getRowLevels returns the log level of the message in every data row.
+func (c *logsTableContent) getRowLevels() []core.LogLevel {
+	if c.rowLevels != nil {
+		return c.rowLevels
+	}
+
+	c.rowLevels = make([]core.LogLevel, c.getNumDataRows())
+	for i := range c.rowLevels {
+		if dr, ok := c.getDedupRow(i + c.getFirstDataRow()); ok {
+			c.rowLevels[i] = c.logs[dr.msgIdx].Level
+		}
+	}
+
+	return c.rowLevels
+}
+
+// getDedupRow returns the info about the given data row of the table. If the
+// dedup mode is off, every row is a group of a single message.
+func (c *logsTableContent) getDedupRow(row int) (dedupRow, bool) {
+	idx := row - c.getFirstDataRow()
+	if idx < 0 {
+		return dedupRow{}, false
+	}
+
+	// The wrapped rows are built in the display order already.
+	if c.wrapRows != nil {
+		if idx >= len(c.wrapRows) {
+			return dedupRow{}, false
+		}
+
+		return c.wrapRows[idx], true
+	}
+
+	numRows := c.getNumUnwrappedRows()
+	if idx >= numRows {
+		return dedupRow{}, false
+	}
+
+	if c.reverse {
+		idx = numRows - 1 - idx
+	}
+
+	if c.dedupRows == nil {
+		return dedupRow{msgIdx: idx, groupIdx: idx, groupSize: 1}, true
+	}
+
+	return c.dedupRows[idx], true
+}
+
+// getNumUnwrappedRows returns the number of data rows as if the messages
+// weren't wrapped.
+func (c *logsTableContent) getNumUnwrappedRows() int {
+	if c.dedupRows != nil {
+		return len(c.dedupRows)
+	}
+
+	return len(c.logs)
+}
+
+// getNumDataRows returns the number of data rows, i.e. not counting the
+// header and the "load older" row.
+func (c *logsTableContent) getNumDataRows() int {
+	if rows := c.getRows(); rows != nil {
+		return len(rows)
+	}
+
+	return len(c.logs)
+}
+
+// getFirstDataRow returns the index of the first data row: normally, it's
+// rowIdxFirstData, but in the reverse mode, the data rows follow the header
+// right away.
+func (c *logsTableContent) getFirstDataRow() int {
+	if c.reverse {
+		return rowIdxLoadOlder
+	}
+
+	return rowIdxFirstData
+}
+
+// getLoadOlderRow returns the index of the "load older" row: normally, it's
+// rowIdxLoadOlder, but in the reverse mode, it's the last row.
+func (c *logsTableContent) getLoadOlderRow() int {
+	if c.reverse {
+		return rowIdxLoadOlder + c.getNumDataRows()
+	}
+
+	return rowIdxLoadOlder
+}
+
+// getLatestRow returns the data row with the newest messages: the last one,
+// or the first one in the reverse mode. If there are no data rows, it's the
+// "load older" row.
+func (c *logsTableContent) getLatestRow() int {
+	if c.reverse || c.getNumDataRows() == 0 {
+		return c.getFirstDataRow()
+	}
+
+	return c.getFirstDataRow() + c.getNumDataRows() - 1
+}
+
+// getRows returns the data rows of the table if they don't map to the
+// messages one to one (either in the dedup mode, or with the messages
+// wrapped), or nil otherwise.
+func (c *logsTableContent) getRows() []dedupRow {
+	if c.wrapRows != nil {
+		return c.wrapRows
+	}
+
+	return c.dedupRows
+}
+
+// getRowByMsgIdx returns the table row which shows the message with the given
+// index (in the dedup mode, it might be a collapsed row of the whole group).
+func (c *logsTableContent) getRowByMsgIdx(msgIdx int) int {
+	if c.getRows() == nil {
+		if c.reverse {
+			return len(c.logs) - 1 - msgIdx + c.getFirstDataRow()
+		}
+
+		return msgIdx + c.getFirstDataRow()
+	}
+
+	for i := 0; i < c.getNumDataRows(); i++ {
+		row := i + c.getFirstDataRow()
+		dr, _ := c.getDedupRow(row)
+		if dr.wrapLine > 0 {
+			continue
+		}
+
+		if dr.msgIdx == msgIdx || (dr.collapsed && msgIdx >= dr.groupIdx && msgIdx < dr.groupIdx+dr.groupSize) {
+			return row
+		}
+	}
+
+	return c.getLatestRow()
+}
+
+func (c *logsTableContent) GetCell(row, column int) *tview.TableCell {
+	if row < 0 || column < 0 {
+		return nil
+	}
+
+	// The fixed rows are stored by their normal indices, no matter where
+	// they're shown.
+	fixedRow := -1
+	switch row {
+	case rowIdxHeader:
+		fixedRow = rowIdxHeader
+	case c.getLoadOlderRow():
+		fixedRow = rowIdxLoadOlder
+	}
+
+	if fixedRow >= 0 {
+		if column >= len(c.fixedRows[fixedRow]) {
+			return nil
+		}
+
+		return c.fixedRows[fixedRow][column]
+	}
+
+	dr, ok := c.getDedupRow(row)
+	if !ok || column >= c.numDataColumns() {
+		return nil
+	}
+
+	msgIdx := dr.msgIdx
+	msg := c.logs[msgIdx]
+
+	var cell *tview.TableCell
+	if c.showNumbers {
+		if column == 0 {
+			numStr := strconv.Itoa(msgIdx + 1)
+			if dr.wrapLine > 0 {
+				numStr = ""
+			}
+
+			cell = newTableCellLogmsg(numStr).
+				SetTextColor(tcell.ColorGray).
+				SetAlign(tview.AlignRight).
+				SetSelectable(false)
+		} else {
+			cell = c.newCellLogmsgField(dr, msg, c.colNames[column-1])
+		}
+	} else {
+		cell = c.newCellLogmsgField(dr, msg, c.colNames[column])
+	}
+
+	// The first cell of every row keeps the reference to the message, no matter
+	// which column it is.
+	if column == 0 {
+		cell.SetReference(msg)
+	}
+
+	return cell
+}
+
+// newCellLogmsgField returns a table cell for the given field of the message;
+// for the collapsed rows in the dedup mode, the time shows the time range of
+// the whole group, and the message is prefixed with the count. If the
+// messages are wrapped, the message column only shows the line of the row,
+// and the rest of the columns are only shown in the row of the first line.
+func (c *logsTableContent) newCellLogmsgField(
+	dr dedupRow, msg core.LogMsg, colName string,
+) *tview.TableCell {
+	if dr.wrapLine > 0 && colName != FieldNameMessage {
+		return newTableCellLogmsg("")
+	}
+
+	var cell *tview.TableCell
+	if colName == FieldNameMessage && c.wrapRows != nil {
+		lines := wrapText(getLogMsgSearchText(&msg, c.rawMessage), c.wrapWidth)
+		line := ""
+		if dr.wrapLine < len(lines) {
+			line = lines[dr.wrapLine]
+		}
+
+		cell = newTableCellLogmsgField(msg, FieldNameMessage, c.tz).
+			SetText(highlightSearchMatches(line, c.searchRe))
+	} else if part, ok := getMsgSplitPart(msg.Msg, c.msgSplitDelim, colName); ok {
+		// Parts of the split message look just like the message itself.
+		cell = newTableCellLogmsgField(msg, FieldNameMessage, c.tz).
+			SetText(highlightSearchMatches(part, c.searchRe))
+	} else {
+		cell = newTableCellLogmsgField(msg, colName, c.tz)
+		if colName == FieldNameMessage && (c.rawMessage || c.searchRe != nil) {
+			cell.SetText(highlightSearchMatches(getLogMsgSearchText(&msg, c.rawMessage), c.searchRe))
+		}
+	}
+
+	if colName != FieldNameTime && colName != FieldNameMessage {
+		value := getLogMsgColValue(&msg, colName, c.msgSplitDelim)
+		if color, ok := c.colColors.getColor(colName, value); ok {
+			cell.SetTextColor(color)
+		}
+
+		if formatted, ok := c.colFormats.format(colName, value, c.tz); ok {
+			cell.SetText(formatted)
+		}
+	}
+
+	if dr.collapsed && dr.wrapLine == 0 {
+		switch colName {
+		case FieldNameTime:
+			lastMsg := c.logs[dr.groupIdx+dr.groupSize-1]
+			cell.SetText(formatTimeSpan(msg.Time, lastMsg.Time, c.tz))
+		case FieldNameMessage:
+			cell.SetText(fmt.Sprintf("[yellow::b]x%d[-::-] %s", dr.groupSize, cell.Text))
+		}
+	}
+
+	// If there are any annotated messages, all the times are prefixed, so that
+	// they stay aligned.
+	if colName == FieldNameTime && c.annotated != nil {
+		marker := " "
+		if _, ok := c.annotated[dr.msgIdx]; ok {
+			marker = annotationMarker
+		}
+
+		cell.SetText(marker + cell.Text)
+	}
+
+	return cell
+}
+
+func (c *logsTableContent) numDataColumns() int {
+	if c.showNumbers {
+		return len(c.colNames) + 1
+	}
+
+	return len(c.colNames)
+}
+
+func (c *logsTableContent) GetRowCount() int {
+	return rowIdxFirstData + c.getNumDataRows()
+}
+
+func (c *logsTableContent) GetColumnCount() int {
+	ret := c.numDataColumns()
+	for _, cells := range c.fixedRows {
+		if len(cells) > ret {
+			ret = len(cells)
+		}
+	}
+
+	return ret
+}
+
+// SetCell only works for the rows before rowIdxFirstData; the data rows are
+// read-only. Note that the "load older" row is always set as rowIdxLoadOlder,
+// even in the reverse mode, where it's shown at the bottom.
+func (c *logsTableContent) SetCell(row, column int, cell *tview.TableCell) {
+	if row < 0 || row >= rowIdxFirstData || column < 0 {
+		return
+	}
+
+	for len(c.fixedRows[row]) <= column {
+		c.fixedRows[row] = append(c.fixedRows[row], nil)
+	}
+
+	c.fixedRows[row][column] = cell
+}
+
+func (c *logsTableContent) Clear() {
+	c.fixedRows = make([][]*tview.TableCell, rowIdxFirstData)
+	c.logs = nil
+	c.colNames = nil
+	c.dedupRows = nil
+	c.wrapRows = nil
+	c.rowLevels = nil
+}
+
+// formatLogLinenumber returns the line number as a string, or an empty string
+// if it's unknown (e.g. for journalctl).
+func formatLogLinenumber(linenumber int) string {
+	if linenumber == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(linenumber)
+}
+
+// newTableCellLogmsgField returns a table cell for the given field of the log
+// message.
+func newTableCellLogmsgField(msg core.LogMsg, colName string, tz *time.Location) *tview.TableCell {
+	// TODO: make the colors configurable
+	msgColor := tcell.ColorWhite
+	switch msg.Level {
+	case core.LogLevelDebug:
+		msgColor = tcell.ColorLightBlue
+	case core.LogLevelInfo:
+		msgColor = tcell.ColorLightGreen
+	case core.LogLevelWarn:
+		msgColor = tcell.ColorYellow
+	case core.LogLevelError:
+		msgColor = tcell.ColorPink
+	}
+
+	switch colName {
+	case FieldNameTime:
+		timeStr := msg.Time.In(tz).Format(logsTableTimeLayout)
+		if msg.DecreasedTimestamp {
+			timeStr = ""
+		}
+
+		return newTableCellLogmsg(timeStr).SetTextColor(tcell.ColorLightBlue)
+	case FieldNameMessage:
+		return newTableCellLogmsg(tview.Escape(msg.Msg)).SetTextColor(msgColor)
+	case FieldNameFilename:
+		return newTableCellLogmsg(tview.Escape(msg.LogFilename)).SetTextColor(tcell.ColorLightGray)
+	case FieldNameLinenumber:
+		return newTableCellLogmsg(formatLogLinenumber(msg.LogLinenumber)).
+			SetTextColor(tcell.ColorLightGray).
+			SetAlign(tview.AlignRight)
+	default:
+		return newTableCellLogmsg(msg.Context[colName]).SetTextColor(msgColor)
+	}
+}
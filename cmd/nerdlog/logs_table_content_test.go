@@ -0,0 +1,168 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/rivo/tview"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogsTableContent(t *testing.T) {
+	c := newLogsTableContent()
+
+	c.SetCell(0, 0, newTableCellHeader("time"))
+	c.SetCell(0, 1, newTableCellHeader("message"))
+	c.SetCell(rowIdxLoadOlder, 0, newTableCellButton("< MOAR ! >"))
+
+	logs := []core.LogMsg{
+		{
+			Time:     time.Date(2025, time.March, 10, 1, 30, 0, 0, time.UTC),
+			Msg:      "foo [bar]",
+			OrigLine: "Mar 10 01:30:00 host-1 myapp[123]: foo [bar]",
+			Context:  map[string]string{"lstream": "host-1"},
+		},
+		{
+			Time:    time.Date(2025, time.March, 10, 1, 31, 0, 0, time.UTC),
+			Msg:     "baz",
+			Context: map[string]string{"lstream": "host-2"},
+		},
+	}
+
+	c.setLogs(logs, []string{FieldNameTime, FieldNameMessage, "lstream"}, time.UTC, false)
+
+	assert.Equal(t, rowIdxFirstData+2, c.GetRowCount())
+	assert.Equal(t, 3, c.GetColumnCount())
+
+	assert.Equal(t, "message", c.GetCell(0, 1).Text)
+	assert.Nil(t, c.GetCell(0, 2))
+	assert.Equal(t, "< MOAR ! >", c.GetCell(rowIdxLoadOlder, 0).Text)
+
+	assert.Equal(t, "Mar10 01:31:00.000", c.GetCell(rowIdxFirstData+1, 0).Text)
+	assert.Equal(t, logs[1], c.GetCell(rowIdxFirstData+1, 0).GetReference())
+	assert.Equal(t, tview.Escape("foo [bar]"), c.GetCell(rowIdxFirstData, 1).Text)
+	assert.Equal(t, "host-2", c.GetCell(rowIdxFirstData+1, 2).Text)
+	assert.Nil(t, c.GetCell(rowIdxFirstData+2, 0))
+
+	// With rawmessage, the message column shows the original line instead,
+	// and the other columns stay the same.
+	c.setRawMessage(true)
+	assert.Equal(t, tview.Escape("Mar 10 01:30:00 host-1 myapp[123]: foo [bar]"), c.GetCell(rowIdxFirstData, 1).Text)
+	assert.Equal(t, "Mar10 01:30:00.000", c.GetCell(rowIdxFirstData, 0).Text)
+	assert.Equal(t, "host-1", c.GetCell(rowIdxFirstData, 2).Text)
+	c.setRawMessage(false)
+
+	// Data rows are read-only.
+	c.SetCell(rowIdxFirstData, 0, newTableCellLogmsg("overridden"))
+	assert.Equal(t, "Mar10 01:30:00.000", c.GetCell(rowIdxFirstData, 0).Text)
+
+	// With row numbers, the numbers take the first column, but the first cell
+	// still references the message.
+	c.setLogs(logs, []string{FieldNameTime, FieldNameMessage, "lstream"}, time.UTC, true)
+	assert.Equal(t, 4, c.GetColumnCount())
+	assert.Equal(t, "2", c.GetCell(rowIdxFirstData+1, 0).Text)
+	assert.True(t, c.GetCell(rowIdxFirstData+1, 0).NotSelectable)
+	assert.Equal(t, logs[1], c.GetCell(rowIdxFirstData+1, 0).GetReference())
+	assert.Equal(t, "host-2", c.GetCell(rowIdxFirstData+1, 3).Text)
+
+	// In the dedup mode, consecutive identical messages are collapsed.
+	dupLogs := append([]core.LogMsg{logs[0]}, logs...)
+	dupLogs[1].Time = dupLogs[1].Time.Add(10 * time.Second)
+	c.setLogs(dupLogs, []string{FieldNameTime, FieldNameMessage, "lstream"}, time.UTC, false)
+	c.setDedup(true, nil)
+	assert.Equal(t, rowIdxFirstData+2, c.GetRowCount())
+	assert.Equal(t, "Mar10 01:30:00.000 - 01:30:10.000", c.GetCell(rowIdxFirstData, 0).Text)
+	assert.Equal(t, "[yellow::b]x2[-::-] "+tview.Escape("foo [bar]"), c.GetCell(rowIdxFirstData, 1).Text)
+	assert.Equal(t, "baz", c.GetCell(rowIdxFirstData+1, 1).Text)
+	assert.Equal(t, rowIdxFirstData+1, c.getRowByMsgIdx(2))
+
+	c.setDedup(true, map[int]struct{}{0: {}})
+	assert.Equal(t, rowIdxFirstData+3, c.GetRowCount())
+	assert.Equal(t, "Mar10 01:30:10.000", c.GetCell(rowIdxFirstData+1, 0).Text)
+
+	// The file and line number columns, with the line number right-aligned and
+	// empty if unknown.
+	locLogs := []core.LogMsg{logs[0], logs[1]}
+	locLogs[0].LogFilename = "/var/log/syslog"
+	locLogs[0].LogLinenumber = 123
+	c.setLogs(locLogs, []string{FieldNameTime, FieldNameFilename, FieldNameLinenumber}, time.UTC, false)
+	c.setDedup(false, nil)
+	assert.Equal(t, "/var/log/syslog", c.GetCell(rowIdxFirstData, 1).Text)
+	assert.Equal(t, "123", c.GetCell(rowIdxFirstData, 2).Text)
+	assert.Equal(t, tview.AlignRight, c.GetCell(rowIdxFirstData, 2).Align)
+	assert.Equal(t, "", c.GetCell(rowIdxFirstData+1, 2).Text)
+
+	// A context field named like the location isn't shadowed by it.
+	locLogs[0].Context = map[string]string{"filename": "app.py"}
+	c.setLogs(locLogs, []string{FieldNameTime, FieldNameFilename, "filename"}, time.UTC, false)
+	assert.Equal(t, "/var/log/syslog", c.GetCell(rowIdxFirstData, 1).Text)
+	assert.Equal(t, "app.py", c.GetCell(rowIdxFirstData, 2).Text)
+
+	c.Clear()
+	assert.Equal(t, rowIdxFirstData, c.GetRowCount())
+	assert.Nil(t, c.GetCell(0, 0))
+}
+
+func TestLogsTableContentReverse(t *testing.T) {
+	c := newLogsTableContent()
+
+	c.SetCell(0, 0, newTableCellHeader("time"))
+	c.SetCell(0, 1, newTableCellHeader("message"))
+	c.SetCell(rowIdxLoadOlder, 0, newTableCellButton("< MOAR ! >"))
+
+	logs := []core.LogMsg{
+		{
+			Time: time.Date(2025, time.March, 10, 1, 30, 0, 0, time.UTC),
+			Msg:  "foo",
+		},
+		{
+			Time: time.Date(2025, time.March, 10, 1, 30, 10, 0, time.UTC),
+			Msg:  "foo",
+		},
+		{
+			Time: time.Date(2025, time.March, 10, 1, 31, 0, 0, time.UTC),
+			Msg:  "the last message which is long enough to be wrapped",
+		},
+	}
+
+	c.setLogs(logs, []string{FieldNameTime, FieldNameMessage}, time.UTC, false)
+	c.setReverse(true)
+
+	// The newest message goes right after the header, and the "load older" row
+	// is at the bottom.
+	assert.Equal(t, rowIdxFirstData+3, c.GetRowCount())
+	assert.Equal(t, rowIdxLoadOlder, c.getFirstDataRow())
+	assert.Equal(t, rowIdxLoadOlder+3, c.getLoadOlderRow())
+	assert.Equal(t, "message", c.GetCell(0, 1).Text)
+	assert.Equal(t, logs[2], c.GetCell(rowIdxLoadOlder, 0).GetReference())
+	assert.Equal(t, logs[0], c.GetCell(rowIdxLoadOlder+2, 0).GetReference())
+	assert.Equal(t, "< MOAR ! >", c.GetCell(rowIdxLoadOlder+3, 0).Text)
+	assert.Equal(t, rowIdxLoadOlder+2, c.getRowByMsgIdx(0))
+	assert.Equal(t, rowIdxLoadOlder, c.getLatestRow())
+
+	// In the dedup mode, the groups are reversed as a whole.
+	c.setDedup(true, nil)
+	assert.Equal(t, rowIdxFirstData+2, c.GetRowCount())
+	assert.Equal(t, "Mar10 01:30:00.000 - 01:30:10.000", c.GetCell(rowIdxLoadOlder+1, 0).Text)
+	assert.Equal(t, rowIdxLoadOlder+1, c.getRowByMsgIdx(1))
+	assert.Equal(t, "< MOAR ! >", c.GetCell(rowIdxLoadOlder+2, 0).Text)
+
+	// The wrapped lines of every message stay in their order.
+	c.setDedup(false, nil)
+	c.setWrapWidth(20)
+	assert.Equal(t, rowIdxFirstData+5, c.GetRowCount())
+	assert.Equal(t, "the last message ", c.GetCell(rowIdxLoadOlder, 1).Text)
+	assert.Equal(t, "which is long ", c.GetCell(rowIdxLoadOlder+1, 1).Text)
+	assert.Equal(t, "enough to be wrapped", c.GetCell(rowIdxLoadOlder+2, 1).Text)
+	assert.Equal(t, logs[1], c.GetCell(rowIdxLoadOlder+3, 0).GetReference())
+	assert.Equal(t, rowIdxLoadOlder+4, c.getRowByMsgIdx(0))
+	assert.Equal(t, "< MOAR ! >", c.GetCell(rowIdxLoadOlder+5, 0).Text)
+
+	// Back to normal.
+	c.setWrapWidth(0)
+	c.setReverse(false)
+	assert.Equal(t, logs[0], c.GetCell(rowIdxFirstData, 0).GetReference())
+	assert.Equal(t, "< MOAR ! >", c.GetCell(rowIdxLoadOlder, 0).Text)
+	assert.Equal(t, rowIdxFirstData+2, c.getLatestRow())
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/tview"
+)
+
+// minWrapWidth is the narrowest the message column gets when the messages are
+// wrapped; if there's not enough room for it, the table is scrolled
+// horizontally as usual.
+const minWrapWidth = 20
+
+// wrapText splits the text into lines which are at most width wide, breaking
+// at the last space before the limit if there's one in the second half of the
+// line, and anywhere otherwise. It always returns at least one line.
+func wrapText(text string, width int) []string {
+	if width <= 0 || runewidth.StringWidth(text) <= width {
+		return []string{text}
+	}
+
+	var lines []string
+
+	lineStart := 0
+	lineWidth := 0
+	lastSpace := -1
+
+	for i, r := range text {
+		rw := runewidth.RuneWidth(r)
+		if lineWidth+rw > width && i > lineStart {
+			breakAt := i
+			if lastSpace > lineStart && runewidth.StringWidth(text[lineStart:lastSpace]) >= width/2 {
+				breakAt = lastSpace + 1
+			}
+
+			lines = append(lines, text[lineStart:breakAt])
+			lineStart = breakAt
+			lineWidth = runewidth.StringWidth(text[lineStart:i])
+			lastSpace = -1
+		}
+
+		if r == ' ' {
+			lastSpace = i
+		}
+
+		lineWidth += rw
+	}
+
+	return append(lines, text[lineStart:])
+}
+
+// getMsgWrapWidth returns the width of the message column such that the
+// whole row fits into the table of the given width, or 0 if the messages
+// shouldn't be wrapped: either there's no message column, or not enough room
+// for it. Every column takes the width of its widest value (formatted, if
+// there's a formatter for the column), plus one char of the separator.
+func (c *logsTableContent) getMsgWrapWidth(tableWidth int) int {
+	hasMessage := false
+	othersWidth := 0
+
+	if c.showNumbers {
+		othersWidth += len(strconv.Itoa(len(c.logs))) + 1
+	}
+
+	for i, colName := range c.colNames {
+		if colName == FieldNameMessage {
+			hasMessage = true
+			continue
+		}
+
+		colWidth := 0
+		if header := c.GetCell(0, i+c.numDataColumns()-len(c.colNames)); header != nil {
+			colWidth = tview.TaggedStringWidth(header.Text)
+		}
+
+		if colName == FieldNameTime {
+			// All the times have the same width, plus the annotation marker; in
+			// the dedup mode, there might be time spans, which are at most twice
+			// as wide.
+			w := len(logsTableTimeLayout) + 1
+			if c.dedupRows != nil {
+				w = 2*len(logsTableTimeLayout) + 4
+			}
+
+			if w > colWidth {
+				colWidth = w
+			}
+		} else {
+			for j := range c.logs {
+				// The formatted values (see the colformats option) might be
+				// wider or narrower than the raw ones, and it's them who are shown.
+				value := getLogMsgColValue(&c.logs[j], colName, c.msgSplitDelim)
+				if formatted, ok := c.colFormats.format(colName, value, c.tz); ok {
+					value = formatted
+				}
+
+				w := runewidth.StringWidth(value)
+				if w > colWidth {
+					colWidth = w
+				}
+			}
+		}
+
+		othersWidth += colWidth + 1
+	}
+
+	wrapWidth := tableWidth - othersWidth
+	if !hasMessage || wrapWidth < minWrapWidth {
+		return 0
+	}
+
+	return wrapWidth
+}
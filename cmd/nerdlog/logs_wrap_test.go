@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapText(t *testing.T) {
+	testCases := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{text: "", width: 10, want: []string{""}},
+		{text: "short", width: 10, want: []string{"short"}},
+		{text: "exactly 10", width: 10, want: []string{"exactly 10"}},
+		{text: "no wrapping", width: 0, want: []string{"no wrapping"}},
+		{
+			// Breaks at the spaces.
+			text:  "foo bar baz qux quux",
+			width: 10,
+			want:  []string{"foo bar ", "baz qux ", "quux"},
+		},
+		{
+			// No spaces in the second half of the line, so it breaks anywhere.
+			text:  "a verylongwordwhichdoesntfit",
+			width: 10,
+			want:  []string{"a verylong", "wordwhichd", "oesntfit"},
+		},
+		{
+			// Wide chars take two columns.
+			text:  "日本語のテキスト",
+			width: 6,
+			want:  []string{"日本語", "のテキ", "スト"},
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, wrapText(tc.text, tc.width), "text %q, width %d", tc.text, tc.width)
+	}
+}
+
+func TestLogsTableContentWrap(t *testing.T) {
+	c := newLogsTableContent()
+	c.SetCell(0, 0, newTableCellHeader("time"))
+	c.SetCell(0, 1, newTableCellHeader("lstream"))
+	c.SetCell(0, 2, newTableCellHeader("message"))
+
+	logs := []core.LogMsg{
+		{
+			Time:    time.Date(2025, time.March, 10, 1, 30, 0, 0, time.UTC),
+			Msg:     "the first message which is long enough to be wrapped",
+			Context: map[string]string{"lstream": "host-1"},
+		},
+		{
+			Time:    time.Date(2025, time.March, 10, 1, 31, 0, 0, time.UTC),
+			Msg:     "short one",
+			Context: map[string]string{"lstream": "host-2"},
+		},
+	}
+
+	c.setLogs(logs, []string{FieldNameTime, "lstream", FieldNameMessage}, time.UTC, false)
+
+	// The time takes 18 chars plus the annotation marker, and lstream takes 7,
+	// plus a separator after each.
+	assert.Equal(t, 20, c.getMsgWrapWidth(48))
+	assert.Equal(t, 0, c.getMsgWrapWidth(47))
+
+	c.setWrapWidth(20)
+	assert.Equal(t, rowIdxFirstData+4, c.GetRowCount())
+
+	assert.Equal(t, "Mar10 01:30:00.000", c.GetCell(rowIdxFirstData, 0).Text)
+	assert.Equal(t, "host-1", c.GetCell(rowIdxFirstData, 1).Text)
+	assert.Equal(t, "the first message ", c.GetCell(rowIdxFirstData, 2).Text)
+
+	// The continuation rows only have the message, but still reference it.
+	assert.Equal(t, "", c.GetCell(rowIdxFirstData+1, 0).Text)
+	assert.Equal(t, logs[0], c.GetCell(rowIdxFirstData+1, 0).GetReference())
+	assert.Equal(t, "", c.GetCell(rowIdxFirstData+1, 1).Text)
+	assert.Equal(t, "which is long ", c.GetCell(rowIdxFirstData+1, 2).Text)
+	assert.Equal(t, "enough to be wrapped", c.GetCell(rowIdxFirstData+2, 2).Text)
+
+	assert.Equal(t, "short one", c.GetCell(rowIdxFirstData+3, 2).Text)
+	assert.Equal(t, logs[1], c.GetCell(rowIdxFirstData+3, 0).GetReference())
+
+	assert.Equal(t, rowIdxFirstData+3, c.getRowByMsgIdx(1))
+	dr, ok := c.getDedupRow(rowIdxFirstData + 2)
+	assert.True(t, ok)
+	assert.Equal(t, 0, dr.msgIdx)
+	assert.Equal(t, 2, dr.wrapLine)
+
+	// Unwrapping gets back to a row per message.
+	c.setWrapWidth(0)
+	assert.Equal(t, rowIdxFirstData+2, c.GetRowCount())
+	assert.Equal(t, rowIdxFirstData+1, c.getRowByMsgIdx(1))
+}
+
+func TestLogsTableContentWrapFormatted(t *testing.T) {
+	c := newLogsTableContent()
+	c.SetCell(0, 0, newTableCellHeader("size"))
+	c.SetCell(0, 1, newTableCellHeader("message"))
+
+	logs := []core.LogMsg{
+		{
+			Time:    time.Date(2025, time.March, 10, 1, 30, 0, 0, time.UTC),
+			Msg:     "the first message which is long enough to be wrapped",
+			Context: map[string]string{"size": "1048576"},
+		},
+	}
+
+	c.setLogs(logs, []string{"size", FieldNameMessage}, time.UTC, false)
+
+	// The raw value is 7 chars wide, plus a separator.
+	assert.Equal(t, 42, c.getMsgWrapWidth(50))
+
+	// With the epoch formatter, the value is shown as a full timestamp, which
+	// is much wider.
+	formats, err := parseColumnFormatRules("size:epoch")
+	assert.NoError(t, err)
+	c.setColumnFormats(formats)
+
+	formatted, ok := formats.format("size", "1048576", time.UTC)
+	assert.True(t, ok)
+	assert.Greater(t, len(formatted), 7)
+	assert.Equal(t, 50-len(formatted)-1, c.getMsgWrapWidth(50))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/shellescape"
+)
+
+// sshAuthInfo is how nerdlog authenticates over ssh: it tries ssh-agent
+// first, if SSH_AUTH_SOCK is set, and otherwise uses the first existing key
+// of the ones given with --ssh-key.
+type sshAuthInfo struct {
+	// AgentSock is the value of SSH_AUTH_SOCK.
+	AgentSock string
+
+	// Keys are all the keys given with --ssh-key, and KeyPath is the first one
+	// which exists, or an empty string if none does.
+	Keys    []string
+	KeyPath string
+}
+
+// getSSHAuthInfo returns the sshAuthInfo for the given --ssh-key values and
+// the current environment.
+func getSSHAuthInfo(sshKeys []string) sshAuthInfo {
+	ret := sshAuthInfo{
+		AgentSock: os.Getenv("SSH_AUTH_SOCK"),
+		Keys:      sshKeys,
+	}
+
+	for _, keyPath := range sshKeys {
+		if _, err := os.Stat(keyPath); err == nil {
+			ret.KeyPath = keyPath
+			break
+		}
+	}
+
+	return ret
+}
+
+// formatLStreamInfo returns the human-readable details of the logstream with
+// the given name: its current state, how exactly it's accessed, and, for the
+// ssh logstreams, the equivalent ssh command, which is handy for debugging
+// connection issues manually.
+func formatLStreamInfo(name string, state *core.LStreamsManagerState, auth sshAuthInfo) string {
+	if state == nil {
+		return "-- No state updates received yet --"
+	}
+
+	ls, ok := state.LogStreams[name]
+	if !ok {
+		names := make([]string, 0, len(state.LogStreams))
+		for k := range state.LogStreams {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		return fmt.Sprintf(
+			"Logstream %q doesn't match the current logstreams filter; the matching ones are: %s",
+			name, strings.Join(names, ", "),
+		)
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("Logstream: %s\n", name))
+	sb.WriteString(fmt.Sprintf("State: %s\n", getLStreamClientState(state, name)))
+	if stage, ok := state.BusyStageByLStream[name]; ok {
+		sb.WriteString(fmt.Sprintf("Busy stage: %d %s\n", stage.Num, stage.Title))
+	}
+	if details, ok := state.ConnDetailsByLStream[name]; ok && details.Err != "" {
+		sb.WriteString(fmt.Sprintf("Last connection error: %s\n", details.Err))
+	}
+
+	sb.WriteString("\n")
+
+	switch {
+	case ls.HTTP != nil:
+		sb.WriteString("Transport: HTTP\n")
+		sb.WriteString(fmt.Sprintf("URL: %s\n", ls.HTTP.URL))
+		sb.WriteString(fmt.Sprintf("Selector: %s\n", ls.HTTP.Selector))
+
+		// Don't show any other details: they're only applicable to the shell
+		// logstreams.
+		return sb.String()
+
+	case ls.Transport.SSH != nil:
+		ssh := ls.Transport.SSH
+
+		sb.WriteString("Transport: ssh\n")
+		sb.WriteString(fmt.Sprintf("Host: %s\n", ssh.Host.Addr))
+		sb.WriteString(fmt.Sprintf("User: %s\n", ssh.Host.User))
+		if ssh.Jumphost != nil {
+			sb.WriteString(fmt.Sprintf("Jumphost: %s@%s\n", ssh.Jumphost.User, ssh.Jumphost.Addr))
+		}
+		if ssh.ProxyCommand != "" {
+			sb.WriteString(fmt.Sprintf("Proxy command: %s\n", ssh.ProxyCommand))
+		}
+		sb.WriteString(fmt.Sprintf("Auth: %s\n", auth.descr()))
+		sb.WriteString(fmt.Sprintf("Equivalent ssh command: %s\n", shellescape.Escape(getSSHCommandArgs(ssh, auth))))
+
+	case ls.Transport.Localhost != nil:
+		sb.WriteString("Transport: local shell\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("Log files: %s\n", strings.Join(ls.LogFiles, ", ")))
+	if ls.Options.SudoMode != "" && ls.Options.SudoMode != core.SudoModeNone {
+		sb.WriteString(fmt.Sprintf("Sudo mode: %s\n", ls.Options.SudoMode))
+	}
+
+	return sb.String()
+}
+
+// getLStreamClientState returns the state of the given logstream client, as
+// per LStreamsByState.
+func getLStreamClientState(state *core.LStreamsManagerState, name string) core.LStreamClientState {
+	for lsState, names := range state.LStreamsByState {
+		if _, ok := names[name]; ok {
+			return lsState
+		}
+	}
+
+	return "unknown"
+}
+
+func (a sshAuthInfo) descr() string {
+	var keyDescr string
+	if a.KeyPath != "" {
+		keyDescr = fmt.Sprintf("key %s", a.KeyPath)
+	} else {
+		keyDescr = fmt.Sprintf("none of the keys exist: %s", strings.Join(a.Keys, ", "))
+	}
+
+	if a.AgentSock == "" {
+		return fmt.Sprintf("SSH_AUTH_SOCK is not set, so no ssh-agent; %s", keyDescr)
+	}
+
+	return fmt.Sprintf("ssh-agent via SSH_AUTH_SOCK=%s, falling back to %s", a.AgentSock, keyDescr)
+}
+
+// getSSHCommandArgs returns the args of the ssh command which connects to the
+// host the same way nerdlog does.
+func getSSHCommandArgs(ssh *core.ConfigLogStreamShellTransportSSH, auth sshAuthInfo) []string {
+	ret := []string{"ssh"}
+
+	if auth.AgentSock == "" && auth.KeyPath != "" {
+		ret = append(ret, "-i", auth.KeyPath)
+	}
+
+	switch {
+	case ssh.ProxyCommand != "":
+		// The placeholders like %h and %p are the same as in ssh, so the command
+		// is used as is.
+		ret = append(ret, "-o", "ProxyCommand="+ssh.ProxyCommand)
+	case ssh.Jumphost != nil:
+		ret = append(ret, "-J", ssh.Jumphost.User+"@"+ssh.Jumphost.Addr)
+	}
+
+	host, port, err := net.SplitHostPort(ssh.Host.Addr)
+	if err != nil {
+		host, port = ssh.Host.Addr, ""
+	}
+
+	if port != "" && port != "22" {
+		ret = append(ret, "-p", port)
+	}
+
+	return append(ret, ssh.Host.User+"@"+host)
+}
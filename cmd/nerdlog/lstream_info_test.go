@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSSHCommandArgs(t *testing.T) {
+	noAgent := sshAuthInfo{KeyPath: "/home/me/.ssh/id_ed25519"}
+	withAgent := sshAuthInfo{AgentSock: "/tmp/agent.sock", KeyPath: "/home/me/.ssh/id_ed25519"}
+
+	sshDetails := &core.ConfigLogStreamShellTransportSSH{
+		Host: core.ConfigHost{Addr: "myhost:22", User: "me"},
+	}
+	assert.Equal(t, []string{"ssh", "me@myhost"}, getSSHCommandArgs(sshDetails, withAgent))
+	assert.Equal(t,
+		[]string{"ssh", "-i", "/home/me/.ssh/id_ed25519", "me@myhost"},
+		getSSHCommandArgs(sshDetails, noAgent),
+	)
+
+	sshDetails = &core.ConfigLogStreamShellTransportSSH{
+		Host:     core.ConfigHost{Addr: "10.0.0.5:2222", User: "admin"},
+		Jumphost: &core.ConfigHost{Addr: "bastion:22", User: "me"},
+	}
+	assert.Equal(t,
+		[]string{"ssh", "-J", "me@bastion:22", "-p", "2222", "admin@10.0.0.5"},
+		getSSHCommandArgs(sshDetails, withAgent),
+	)
+
+	// The proxy command takes precedence over the jumphost, just like when
+	// connecting.
+	sshDetails.ProxyCommand = "nc -X connect %h %p"
+	assert.Equal(t,
+		[]string{"ssh", "-o", "ProxyCommand=nc -X connect %h %p", "-p", "2222", "admin@10.0.0.5"},
+		getSSHCommandArgs(sshDetails, withAgent),
+	)
+}
+
+func TestFormatLStreamInfo(t *testing.T) {
+	auth := sshAuthInfo{Keys: []string{"/nonexistent/id_rsa"}}
+
+	assert.Equal(t, "-- No state updates received yet --", formatLStreamInfo("myhost", nil, auth))
+
+	state := &core.LStreamsManagerState{
+		LStreamsByState: map[core.LStreamClientState]map[string]struct{}{
+			core.LStreamClientStateConnecting: {"myhost": {}},
+		},
+		ConnDetailsByLStream: map[string]core.ConnDetails{
+			"myhost": {Err: "dial tcp: i/o timeout"},
+		},
+		LogStreams: map[string]core.LogStream{
+			"myhost": {
+				Name: "myhost",
+				Transport: core.ConfigLogStreamShellTransport{
+					SSH: &core.ConfigLogStreamShellTransportSSH{
+						Host: core.ConfigHost{Addr: "myhost:22", User: "me"},
+					},
+				},
+				LogFiles: []string{"/var/log/syslog", "/var/log/syslog.1"},
+			},
+		},
+	}
+
+	assert.Equal(t,
+		"Logstream: myhost\n"+
+			"State: connecting\n"+
+			"Last connection error: dial tcp: i/o timeout\n"+
+			"\n"+
+			"Transport: ssh\n"+
+			"Host: myhost:22\n"+
+			"User: me\n"+
+			"Auth: SSH_AUTH_SOCK is not set, so no ssh-agent; none of the keys exist: /nonexistent/id_rsa\n"+
+			"Equivalent ssh command: ssh 'me@myhost'\n"+
+			"Log files: /var/log/syslog, /var/log/syslog.1\n",
+		formatLStreamInfo("myhost", state, auth),
+	)
+
+	assert.Equal(t,
+		`Logstream "other" doesn't match the current logstreams filter; the matching ones are: myhost`,
+		formatLStreamInfo("other", state, auth),
+	)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// formatLStreamsManagerState returns the full human-readable dump of the
+// LStreamsManager state, for debugging the connection issues; unlike the
+// status line, it shows every logstream by name, along with its busy stage and
+// the last connection error, if any.
+func formatLStreamsManagerState(state *core.LStreamsManagerState) string {
+	if state == nil {
+		return "-- No state updates received yet --"
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("NumLStreams: %d\n", state.NumLStreams))
+	sb.WriteString(fmt.Sprintf("NumConnected: %d\n", state.NumConnected))
+	sb.WriteString(fmt.Sprintf("Connected: %v\n", state.Connected))
+	sb.WriteString(fmt.Sprintf("Busy: %v\n", state.Busy))
+	sb.WriteString(fmt.Sprintf("NoMatchingLStreams: %v\n", state.NoMatchingLStreams))
+
+	statesStrs := make([]string, 0, len(state.LStreamsByState))
+	for lsState := range state.LStreamsByState {
+		statesStrs = append(statesStrs, string(lsState))
+	}
+	sort.Strings(statesStrs)
+
+	sb.WriteString("\nLStreamsByState:\n")
+	if len(statesStrs) == 0 {
+		sb.WriteString("  (none)\n")
+	}
+	for _, lsStateStr := range statesStrs {
+		var names []string
+		for name := range state.LStreamsByState[core.LStreamClientState(lsStateStr)] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		sb.WriteString(fmt.Sprintf("  %s (%d): %s\n", lsStateStr, len(names), strings.Join(names, ", ")))
+	}
+
+	if len(state.BusyStageByLStream) > 0 {
+		sb.WriteString("\nBusyStageByLStream:\n")
+		names := make([]string, 0, len(state.BusyStageByLStream))
+		for name := range state.BusyStageByLStream {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			stage := state.BusyStageByLStream[name]
+			sb.WriteString(fmt.Sprintf("  %s: %d %s", name, stage.Num, stage.Title))
+			if stage.Percentage > 0 {
+				sb.WriteString(fmt.Sprintf(" (%d%%)", stage.Percentage))
+			}
+			if stage.ExtraInfo != "" {
+				sb.WriteString(fmt.Sprintf(" [%s]", stage.ExtraInfo))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	var connErrNames []string
+	for name, details := range state.ConnDetailsByLStream {
+		if details.Err != "" {
+			connErrNames = append(connErrNames, name)
+		}
+	}
+	sort.Strings(connErrNames)
+
+	if len(connErrNames) > 0 {
+		sb.WriteString("\nConnection errors:\n")
+		for _, name := range connErrNames {
+			sb.WriteString(fmt.Sprintf("  %s: %s\n", name, state.ConnDetailsByLStream[name].Err))
+		}
+	}
+
+	if len(state.TearingDown) > 0 {
+		sb.WriteString(fmt.Sprintf("\nTearingDown: %s\n", strings.Join(state.TearingDown, ", ")))
+	}
+
+	if len(state.DefaultQueryByLStream) > 0 {
+		sb.WriteString("\nDefaultQueryByLStream:\n")
+		names := make([]string, 0, len(state.DefaultQueryByLStream))
+		for name := range state.DefaultQueryByLStream {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			sb.WriteString(fmt.Sprintf("  %s: %s\n", name, state.DefaultQueryByLStream[name]))
+		}
+	}
+
+	if len(state.LogFormatByLStream) > 0 {
+		sb.WriteString("\nLogFormatByLStream:\n")
+		names := make([]string, 0, len(state.LogFormatByLStream))
+		for name := range state.LogFormatByLStream {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			guess := state.LogFormatByLStream[name]
+			sb.WriteString(fmt.Sprintf(
+				"  %s: %s (configured: %v, ambiguous: %v)\n",
+				name, guess.Format, guess.Configured, guess.Ambiguous,
+			))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatLStreamsManagerState(t *testing.T) {
+	assert.Equal(t, "-- No state updates received yet --", formatLStreamsManagerState(nil))
+
+	state := &core.LStreamsManagerState{
+		NumLStreams: 3,
+		LStreamsByState: map[core.LStreamClientState]map[string]struct{}{
+			core.LStreamClientStateConnectedBusy: {"host-2": {}, "host-1": {}},
+			core.LStreamClientStateConnecting:    {"host-3": {}},
+		},
+		NumConnected: 2,
+		Busy:         true,
+		ConnDetailsByLStream: map[string]core.ConnDetails{
+			"host-1": {},
+			"host-3": {Err: "connection refused"},
+		},
+		BusyStageByLStream: map[string]core.BusyStage{
+			"host-1": {Num: 2, Title: "Scanning logs", Percentage: 40},
+			"host-2": {Num: 1, Title: "Finding offsets", ExtraInfo: "syslog"},
+		},
+		DefaultQueryByLStream: map[string]string{
+			"host-1": "!/healthcheck/",
+		},
+	}
+
+	assert.Equal(t, `NumLStreams: 3
+NumConnected: 2
+Connected: false
+Busy: true
+NoMatchingLStreams: false
+
+LStreamsByState:
+  connected_busy (2): host-1, host-2
+  connecting (1): host-3
+
+BusyStageByLStream:
+  host-1: 2 Scanning logs (40%)
+  host-2: 1 Finding offsets [syslog]
+
+Connection errors:
+  host-3: connection refused
+
+DefaultQueryByLStream:
+  host-1: !/healthcheck/
+`, formatLStreamsManagerState(state))
+}
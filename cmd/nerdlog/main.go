@@ -35,7 +35,9 @@ func main() {
 
 		flagTime        = pflag.StringP("time", "t", "", "Time range in the same format as accepted by the UI. Examples: '1h', 'Mar27 12:00'")
 		flagLStreams    = pflag.StringP("lstreams", "h", "", "Logstreams to connect to, as comma-separated glob patterns, e.g. 'foo-*,bar-*'")
-		flagQuery       = pflag.StringP("pattern", "p", "", "Initial awk pattern to use")
+		flagQuery       = pflag.StringP("pattern", "p", "", "Initial awk pattern to use; if it's '-', it's read from stdin, like --pattern-file -")
+		flagQueryFile   = pflag.String("pattern-file", "", "File to read the initial awk pattern from, or '-' for stdin; the lines are joined with spaces, and the ones starting with # are skipped")
+		flagExclude     = pflag.StringP("exclude", "x", "", "Initial awk pattern to exclude: matching lines are dropped even if they match the --pattern")
 		flagSelectQuery = pflag.StringP("selquery", "s", "", "SELECT-like query to specify which fields to show, like 'time STICKY, message, lstream, level_name AS level, *'")
 		flagLogLevel    = pflag.String("loglevel", "error", "This is NOT about the logs that nerdlog fetches from the remote servers, it's rather about nerdlog's own log. Valid values are: error, warning, info, verbose1, verbose2 or verbose3")
 		flagSSHConfig   = pflag.String("ssh-config", filepath.Join(homeDir, ".ssh", "config"), "ssh config file to use; set to an empty string to disable reading ssh config")
@@ -67,6 +69,7 @@ func main() {
 		initialLStreams = "myserver.com:22"
 	}
 	initialQuery := ""
+	initialExclude := ""
 	initialSelectQuery := DefaultSelectQuery
 	connectRightAway := false
 
@@ -80,11 +83,34 @@ func main() {
 		connectRightAway = true
 	}
 
-	if *flagQuery != "" {
+	if *flagQuery != "" && *flagQueryFile != "" {
+		fmt.Fprintf(os.Stderr, "--pattern and --pattern-file can't be used together\n")
+		os.Exit(1)
+	}
+
+	queryFile := *flagQueryFile
+	if *flagQuery == stdinFilename {
+		queryFile = stdinFilename
+	} else if *flagQuery != "" {
 		initialQuery = *flagQuery
 		connectRightAway = true
 	}
 
+	if queryFile != "" {
+		initialQuery, err = readQueryFile(queryFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading the pattern from %s: %s\n", queryFile, err)
+			os.Exit(1)
+		}
+
+		connectRightAway = true
+	}
+
+	if *flagExclude != "" {
+		initialExclude = *flagExclude
+		connectRightAway = true
+	}
+
 	if *flagSelectQuery != "" {
 		initialSelectQuery = SelectQuery(*flagSelectQuery)
 		connectRightAway = true
@@ -93,6 +119,7 @@ func main() {
 	initialQueryData := QueryFull{
 		Time:        initialTime,
 		Query:       initialQuery,
+		Exclude:     initialExclude,
 		LStreams:    initialLStreams,
 		SelectQuery: initialSelectQuery,
 	}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
@@ -25,11 +28,19 @@ const (
 	pageNameRowDetails      = "row_details"
 	pageNameColumnDetails   = "column_details"
 	pageNameTextView        = "text_view"
+	pageNameCommandPalette  = "command_palette"
+	pageNameRecentLStreams  = "recent_lstreams"
 )
 
 const (
+	// rowIdxHeader is the index of the row with the column names.
+	rowIdxHeader = 0
 	// rowIdxLoadOlder is the index of the row acting as a button to load more (older) logs
+	// (in the reverse mode, it's shown at the bottom; see getLoadOlderRow).
 	rowIdxLoadOlder = 1
+	// rowIdxFirstData is the index of the first row with an actual log message
+	// (in the reverse mode, it's rowIdxLoadOlder; see getFirstDataRow).
+	rowIdxFirstData = 2
 )
 
 const histogramBinSize = 60 // 1 minute
@@ -45,12 +56,43 @@ type MainViewParams struct {
 
 	OnLStreamsChange OnLStreamsChange
 
+	// OnMutedLStreamsChange is called when the user mutes or unmutes some
+	// logstreams; names contains all the muted logstreams.
+	OnMutedLStreamsChange func(names []string) error
+
+	// OnFetchLines is called when the given lines need to be fetched from the
+	// given logstream separately from the query, see core.LStreamsManager.FetchLines;
+	// the result comes to handleFetchedLines.
+	OnFetchLines func(lstreamName string, lineRange core.LineRange)
+
 	OnDisconnectRequest OnDisconnectRequest
 	OnReconnectRequest  OnReconnectRequest
 
 	// TODO: support command history
 	OnCmd OnCmdCallback
 
+	// OnCmdComplete is called when the user presses Tab in the command line;
+	// it should return all the possible completions of the given command (the
+	// full command strings, without the ":" prefix).
+	OnCmdComplete func(cmd string) []string
+
+	// GetLStreamSudoMode should return the sudo mode configured for the given
+	// logstream name, so that the shell commands we suggest to the user (e.g.
+	// to see the original message) can also use sudo when needed.
+	GetLStreamSudoMode func(lstream string) core.SudoMode
+
+	// IsLStreamLocal should return whether the given logstream is on the local
+	// host, so that its log files can be opened in the editor directly.
+	IsLStreamLocal func(lstream string) bool
+
+	// RecentLStreams is updated whenever the logstreams filter is applied, and
+	// is used for the quick switcher.
+	RecentLStreams *RecentLStreams
+
+	// Annotations are the notes attached to log lines, shown with a marker in
+	// the logs table.
+	Annotations *Annotations
+
 	CmdHistory   *clhistory.CLHistory
 	QueryHistory *clhistory.CLHistory
 
@@ -66,12 +108,25 @@ type MainView struct {
 	screenHeight int
 
 	rootPages *tview.Pages
+	// mainFlex contains everything on the main page; it's kept to be able to
+	// resize the histogram.
+	mainFlex  *tview.Flex
 	logsTable *tview.Table
+	// logsFlex contains the logsTable and the minimap next to it.
+	logsFlex *tview.Flex
+	minimap  *Minimap
+	// logsTableContent is the content of logsTable; it materializes the cells
+	// only when they're needed for drawing.
+	logsTableContent *logsTableContent
 
 	queryLabel *tview.TextView
 	queryInput *tview.InputField
 	cmdInput   *tview.InputField
 
+	// defaultQueriesLabel is shown next to the query input if some of the
+	// current logstreams have default queries.
+	defaultQueriesLabel *tview.TextView
+
 	topFlex      *tview.Flex
 	queryEditBtn *tview.Button
 	timeLabel    *tview.TextView
@@ -86,6 +141,12 @@ type MainView struct {
 	overlaySpinner            rune
 	overlayMsgViewIsMinimized bool
 
+	// lstreamsMsgView is nil unless the :lstreams modal is shown; it's updated
+	// with every query result. lstreamsKnownText is the part of its text which
+	// doesn't depend on the results.
+	lstreamsMsgView   *MessageView
+	lstreamsKnownText string
+
 	// focusedBeforeCmd is a primitive which was focused before cmdInput was
 	// focused. Once the user is done editing command, focusedBeforeCmd
 	// normally resumes focus.
@@ -98,12 +159,37 @@ type MainView struct {
 
 	lstreamsSpec string
 
+	// lstreamGroups are the logstream groups from the config; used to show
+	// the resolved number of logstreams if the spec contains a group.
+	lstreamGroups core.ConfigLStreamGroups
+
+	// mutedLStreams contains the sorted names of the logstreams which are
+	// temporarily excluded from the logstreams filter, via :mute.
+	mutedLStreams []string
+
+	// namedQueries are the queries whose union is shown, via :union; every
+	// message is tagged with the names of the ones it matches, in the
+	// "nerdlog_query" column (see core.FieldNameNamedQueries).
+	namedQueries []core.NamedQuery
+
+	// lineRange is not nil if the last query was for a range of lines instead
+	// of the time range (via :lines).
+	lineRange *core.LineRange
+
 	// from, to represent the selected time range
 	from, to TimeOrDur
 
 	// query is the effective search query
 	query string
 
+	// lastQueryTime is when the last query was initiated; used for the
+	// autorefresh.
+	lastQueryTime time.Time
+
+	// exclude is the effective exclude pattern: lines matching it are dropped
+	// even if they match the query. Set with the :filter-out command.
+	exclude string
+
 	// actualFrom, actualTo represent the actual time range resolved from from
 	// and to, and they both can't be zero.
 	//
@@ -127,6 +213,63 @@ type MainView struct {
 	// queried logs (regardless of whether those columns exist in the UI).
 	existingTagNames map[string]struct{}
 
+	// curColNames contains names of the fields which are currently shown in
+	// the logs table as columns, in the same order.
+	curColNames []string
+
+	// tabs contains the queries of all the query tabs; see :tabnew.
+	tabs *queryTabs
+
+	// pendingG is true if the last key pressed in the logs table or the
+	// histogram was "g", so that the vim-like "gt" and "gT" can switch tabs,
+	// and "gq", "gh", "gl" can jump the focus (see focusKeys).
+	pendingG bool
+
+	// curQueryAutoRefresh is whether the current query was initiated by the
+	// autorefresh; see doQueryParams.autoRefresh.
+	curQueryAutoRefresh bool
+	// curQueryFromHistogram is whether the current query was initiated by
+	// selecting a range on the histogram; see doQueryParams.fromHistogram.
+	curQueryFromHistogram bool
+
+	// pendingBell is set when the terminal bell should be rung, which happens
+	// on the next draw, since only then we have access to the screen.
+	pendingBell bool
+
+	// watches are evaluated with every query result; see the ":watch" command.
+	watches []*watch
+
+	// frozenLogResp is the latest query result received while the freeze
+	// option is on; it's applied once the option is off. Nil if there's
+	// nothing pending.
+	frozenLogResp *core.LogRespTotal
+
+	// anchoredNow, if not zero, is the instant which the relative time ranges
+	// like "-1h" are resolved against, instead of the current time; see the
+	// ":anchor" command.
+	anchoredNow time.Time
+
+	// stableTags contains all the context tags seen since the stablecolumns
+	// option was turned on; they're all kept in the logs table, even if the
+	// current logs don't have them. Nil if the option is off.
+	stableTags map[string]struct{}
+
+	// dedupExpanded contains the indices of the first messages of the groups
+	// which are expanded in the dedup mode (see the "dedup" option).
+	dedupExpanded map[int]struct{}
+
+	// logExtractors derive extra fields from the messages client-side; see the
+	// ":extract" command.
+	logExtractors []logExtractor
+
+	// msgSplitDelim, if not empty, is the delimiter to split the messages by
+	// into multiple columns, for display only; see the ":split" command.
+	msgSplitDelim string
+
+	// curNumStickyCols is the number of sticky columns among curColNames (those
+	// are always the first ones).
+	curNumStickyCols int
+
 	// When doQueryParamsOnceConnected is not nil, it means that whenever we get
 	// a new status update (ApplyHMState gets called), if Connected is true
 	// there, we'll call doQuery().
@@ -139,12 +282,30 @@ type MainView struct {
 
 	curHMState *core.LStreamsManagerState
 	curLogResp *core.LogRespTotal
-	// statsFrom and statsTo represent the first and last element present
-	// in curLogResp.MinuteStats. Note that this range might be smaller than
-	// (from, to), because for some minute stats might be missing. statsFrom
-	// and statsTo are only useful for cases when from and/or to are zero (meaning,
-	// time range isn't limited)
+	// lastCompleteLogResp is the last non-partial response (see
+	// core.LogRespTotal.Partial), so that new logs are only alerted on once the
+	// query has finished on all logstreams.
+	lastCompleteLogResp *core.LogRespTotal
+	// partialSelection is the logs table selection as it was before the first
+	// partial response of the query in progress; it's reused for every next
+	// response, until the final one comes.
+	partialSelection *logsTableSelection
+	// pendingSnapshotDiff, if not nil, is the snapshot to compare the results
+	// of the query in progress against, once they arrive; see :snapshot diff.
+	pendingSnapshotDiff *pendingSnapshotDiff
+
+	// search, if not nil, is the current search within the loaded logs,
+	// started with "/" or "?" in the logs table.
+	search *logsSearch
+	// statsFrom and statsTo represent the first and last minute with any
+	// messages in curLogResp.MinuteStats. Note that this range might be smaller
+	// than (from, to), because for some minute stats might be missing. They're
+	// zero if there are no messages at all. Used for the histrange=data option.
 	statsFrom, statsTo time.Time
+	// histFrom and histTo is the histogram range for the queried time range,
+	// as of the last query; with the histrange=data option, the actual
+	// histogram range can be narrower. See bumpHistogramRange.
+	histFrom, histTo time.Time
 
 	//marketViewsByID map[common.MarketID]*MarketView
 	//marketDescrByID map[common.MarketID]MarketDescr
@@ -223,6 +384,7 @@ func NewMainView(params *MainViewParams) *MainView {
 
 	mv := &MainView{
 		params: *params,
+		tabs:   newQueryTabs(),
 	}
 
 	var err error
@@ -231,21 +393,34 @@ func NewMainView(params *MainViewParams) *MainView {
 		panic(err.Error())
 	}
 
-	// Remember screen size before every draw.
+	// Remember screen size before every draw, and re-layout things if it has
+	// changed.
 	mv.params.App.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
 		width, height := screen.Size()
-		mv.screenWidth = width
-		mv.screenHeight = height
+		if width != mv.screenWidth || height != mv.screenHeight {
+			mv.screenWidth = width
+			mv.screenHeight = height
+			mv.onScreenResize()
+		}
+
+		if mv.pendingBell {
+			mv.pendingBell = false
+			screen.Beep()
+		}
 		return false
 	})
 
 	mv.rootPages = tview.NewPages()
 
 	mainFlex := tview.NewFlex().SetDirection(tview.FlexRow)
+	mv.mainFlex = mainFlex
 
 	mv.queryLabel = tview.NewTextView()
 	mv.queryLabel.SetDynamicColors(true).SetScrollable(false).SetText(queryLabelMatch)
 
+	mv.defaultQueriesLabel = tview.NewTextView()
+	mv.defaultQueriesLabel.SetDynamicColors(true).SetScrollable(false)
+
 	mv.queryInput = tview.NewInputField()
 	mv.queryInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		event = mv.eventHandlerBrowserLike(event)
@@ -255,6 +430,13 @@ func NewMainView(params *MainViewParams) *MainView {
 
 		switch event.Key() {
 		case tcell.KeyEnter:
+			if err := core.ValidateQuery(mv.queryInput.GetText()); err != nil {
+				mv.showMessagebox("err", "Invalid query", err.Error(), &MessageboxParams{
+					BackgroundColor: tcell.ColorDarkRed,
+				})
+				return nil
+			}
+
 			mv.setQuery(mv.queryInput.GetText())
 			mv.bumpTimeRange(false)
 
@@ -411,7 +593,7 @@ func NewMainView(params *MainViewParams) *MainView {
 				mv.menuDropdown.SetCurrentOption(-1)
 				mv.menuDropdown.CloseList(mv.setFocus)
 			}
-			mv.params.App.SetFocus(mv.histogram)
+			mv.params.App.SetFocus(mv.getHistogramOrLogsTable())
 			return nil
 		case tcell.KeyBacktab:
 			if mv.menuDropdown.IsListOpen() {
@@ -501,11 +683,14 @@ func NewMainView(params *MainViewParams) *MainView {
 		return event
 	})
 
+	// NOTE: when changing the fixed-width items here, update
+	// topFlexFixedWidth too.
 	mv.topFlex = tview.NewFlex().SetDirection(tview.FlexColumn)
 	mv.topFlex.
 		AddItem(mv.queryLabel, 12, 0, false).
 		AddItem(nil, 1, 0, false).
 		AddItem(mv.queryInput, 0, 1, true).
+		AddItem(mv.defaultQueriesLabel, 0, 0, false).
 		AddItem(nil, 1, 0, false).
 		AddItem(mv.timeLabel, 1, 0, false).
 		AddItem(nil, 1, 0, false).
@@ -534,7 +719,11 @@ func NewMainView(params *MainViewParams) *MainView {
 			return fromTime.In(tz).Format("Jan02 15:04")
 		}
 
-		toTime := time.Unix(int64(*to), 0).In(tz)
+		// Show the selection the same way it'll be queried: rounded according
+		// to the timeround option (see bumpTimeRange).
+		rounding := mv.params.Options.GetTimeRounding()
+		fromTime = rounding.round(fromTime)
+		toTime := rounding.round(time.Unix(int64(*to), 0).In(tz))
 
 		return fmt.Sprintf(
 			"%s - %s (%s)",
@@ -547,13 +736,23 @@ func NewMainView(params *MainViewParams) *MainView {
 		tz := mv.params.Options.GetTimezone()
 		return getXMarksForHistogram(tz, from, to, numChars)
 	})
-	mv.histogram.SetDataBinsSnapper(snapDataBinsInChartDot)
+	mv.histogram.SetDataBinsSnapper(func(dataBinsInChartDot int) int {
+		return mv.params.Options.GetTimeRounding().snapDataBinsInChartDot(dataBinsInChartDot)
+	})
 	mv.histogram.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		event = mv.eventHandlerBrowserLike(event)
 		if event == nil {
 			return nil
 		}
 
+		// Just like in the logs table, the "g" itself still moves the cursor.
+		pendingG := mv.pendingG
+		mv.pendingG = event.Key() == tcell.KeyRune && event.Rune() == 'g'
+
+		if pendingG && event.Key() == tcell.KeyRune && mv.focusByKey(event.Rune()) {
+			return nil
+		}
+
 		switch event.Key() {
 		case tcell.KeyTab:
 			mv.params.App.SetFocus(mv.logsTable)
@@ -577,6 +776,10 @@ func NewMainView(params *MainViewParams) *MainView {
 			case 'i', 'a':
 				mv.params.App.SetFocus(mv.queryInput)
 				return nil
+
+			case 'R':
+				mv.params.OnCmd("time-histogram", CmdOpts{Internal: true})
+				return nil
 			}
 		}
 
@@ -594,12 +797,18 @@ func NewMainView(params *MainViewParams) *MainView {
 		}
 
 		mv.setTimeRange(fromTime, toTime)
-		mv.doQuery(doQueryParams{})
+		mv.doQuery(doQueryParams{fromHistogram: true})
+	})
+	mv.histogram.SetCursorMovedFunc(func(from, to int) {
+		mv.selectLinkedLogMsg(from, to)
+		mv.showHistogramBinInfo(from, to)
 	})
 
-	mainFlex.AddItem(mv.histogram, 6, 0, false)
+	mainFlex.AddItem(mv.histogram, histogramHeight, 0, false)
 
 	mv.logsTable = tview.NewTable()
+	mv.logsTableContent = newLogsTableContent()
+	mv.logsTable.SetContent(mv.logsTableContent)
 	mv.updateTableHeader(nil)
 
 	//mv.logsTable.SetEvaluateAllRows(true)
@@ -620,6 +829,11 @@ func NewMainView(params *MainViewParams) *MainView {
 
 		key := event.Key()
 
+		// The "g" itself is still handled by the table (moving the cursor to the
+		// top), but if it's followed by "t" or "T", switch tabs like in Vim.
+		pendingG := mv.pendingG
+		mv.pendingG = key == tcell.KeyRune && event.Rune() == 'g'
+
 		switch key {
 		case tcell.KeyCtrlD:
 			// TODO: ideally we'd want to only go half a page down, but for now just
@@ -630,6 +844,12 @@ func NewMainView(params *MainViewParams) *MainView {
 			// return Ctrl+B which will go the full page up
 			return tcell.NewEventKey(tcell.KeyCtrlB, 0, tcell.ModNone)
 
+		case tcell.KeyCtrlP:
+			// Most terminals don't distinguish between Ctrl+P and Ctrl+Shift+P, so
+			// both of them show the command palette.
+			mv.showCommandPalette()
+			return nil
+
 		case tcell.KeyEsc:
 			if mv.overlayMsgView != nil && mv.overlayMsgViewIsMinimized {
 				mv.makeOverlayVisible()
@@ -637,14 +857,118 @@ func NewMainView(params *MainViewParams) *MainView {
 			}
 
 		case tcell.KeyRune:
+			if pendingG && mv.focusByKey(event.Rune()) {
+				return nil
+			}
+
+			if pendingG && (event.Rune() == 't' || event.Rune() == 'T') {
+				delta := 1
+				if event.Rune() == 'T' {
+					delta = -1
+				}
+
+				if err := mv.switchTabBy(delta); err != nil {
+					mv.printMsg(err.Error(), nlMsgLevelErr)
+				}
+				return nil
+			}
+
 			switch event.Rune() {
 			case ':':
 				mv.focusCmdline()
 				return nil
 
+			case '/', '?':
+				mv.focusCmdlineWithPrefix(string(event.Rune()))
+				return nil
+
+			case 'n':
+				mv.jumpToSearchMatch(true)
+				return nil
+
+			case 'N':
+				mv.jumpToSearchMatch(false)
+				return nil
+
 			case 'i', 'a':
 				mv.params.App.SetFocus(mv.queryInput)
 				return nil
+
+			case 'S':
+				mv.splitTimeRange()
+				return nil
+
+			case 'A':
+				mv.queryAround(mv.params.Options.GetAroundDur())
+				return nil
+
+			case 'T':
+				mv.showTimeRangePresets()
+				return nil
+
+			case 'W':
+				mv.showLastQueryWarnings()
+				return nil
+
+			case 'E':
+				if msg, ok := mv.getSelectedMsg(); ok {
+					mv.openOriginalMsgInEditor(msg)
+				}
+				return nil
+
+			case 'J':
+				if msg, ok := mv.getSelectedMsg(); ok {
+					mv.showPrettyJSON(msg)
+				}
+				return nil
+
+			case 'Y':
+				mv.params.OnCmd("yank-args", CmdOpts{Internal: true})
+				return nil
+
+			case 'L':
+				mv.params.OnCmd("tail", CmdOpts{Internal: true})
+				return nil
+
+			case 'z':
+				mv.toggleDedupGroup()
+				return nil
+
+			case ']':
+				mv.jumpToNextHotRow(true)
+				return nil
+
+			case '[':
+				mv.jumpToNextHotRow(false)
+				return nil
+
+			case 'V':
+				mv.toggleHistogram()
+				return nil
+
+			case 'H':
+				mv.showRecentLStreams()
+				return nil
+
+			case 'm':
+				mv.editSelectedMsgAnnotation()
+				return nil
+
+			case 'w':
+				mv.toggleWrap()
+				return nil
+
+			case 'f':
+				mv.quickFilterBySelectedCell(false)
+				return nil
+
+			case 'F':
+				mv.quickFilterBySelectedCell(true)
+				return nil
+
+			case 'p':
+				mv.togglePIDFilter()
+				return nil
 			}
 		}
 
@@ -659,17 +983,39 @@ func NewMainView(params *MainViewParams) *MainView {
 			mv.params.App.SetFocus(mv.queryInput)
 		}
 		if key == tcell.KeyBacktab {
-			mv.params.App.SetFocus(mv.histogram)
+			if mv.params.Options.GetShowHistogram() {
+				mv.params.App.SetFocus(mv.histogram)
+			} else {
+				mv.params.App.SetFocus(mv.menuDropdown)
+			}
 		}
 	}).SetSelectedFunc(func(row int, column int) {
-		if row == rowIdxLoadOlder {
+		isLoadOlderRow := row == mv.logsTableContent.getLoadOlderRow()
+
+		if isLoadOlderRow && mv.curLogResp != nil && mv.curLogResp.CountOnly {
+			// In the count-only mode, there's nothing older to load; instead, fetch
+			// the lines for the current time range.
+			mv.doQuery(doQueryParams{fetchLines: true})
+			mv.logsTable.SetCell(
+				rowIdxLoadOlder, 0,
+				newTableCellButton("... loading ..."),
+			)
+			return
+		}
+
+		if isLoadOlderRow {
 			// Request to load more (older) logs
 
 			// Do the query to core
 			mv.params.OnLogQuery(core.QueryLogsParams{
-				From:  mv.actualFrom,
-				To:    mv.actualToForQuery,
-				Query: mv.query,
+				From:         mv.actualFrom,
+				To:           mv.actualToForQuery,
+				LineRange:    mv.lineRange,
+				Query:        mv.query,
+				Exclude:      mv.exclude,
+				NamedQueries: mv.namedQueries,
+
+				MaxLineLength: mv.params.Options.GetMaxLineLength(),
 
 				LoadEarlier: true,
 			})
@@ -727,7 +1073,13 @@ func NewMainView(params *MainViewParams) *MainView {
 		}
 	*/
 
-	mainFlex.AddItem(mv.logsTable, 0, 1, false)
+	mv.minimap = NewMinimap(mv.getMinimapData)
+
+	mv.logsFlex = tview.NewFlex().SetDirection(tview.FlexColumn).
+		AddItem(mv.logsTable, 0, 1, true).
+		AddItem(mv.minimap, 1, 0, false)
+
+	mainFlex.AddItem(mv.logsFlex, 0, 1, false)
 
 	mv.statusLineLeft = tview.NewTextView()
 	mv.statusLineLeft.SetScrollable(false).SetDynamicColors(true)
@@ -739,7 +1091,9 @@ func NewMainView(params *MainViewParams) *MainView {
 	statusLineFlex.
 		AddItem(mv.statusLineLeft, 0, 1, false).
 		AddItem(nil, 1, 0, false).
-		AddItem(mv.statusLineRight, 30, 0, true)
+		// Wide enough for something like
+		// "/12/345 | 12 warnings | 1201 / 1455 / 2948122".
+		AddItem(mv.statusLineRight, 54, 0, true)
 
 	mainFlex.AddItem(statusLineFlex, 1, 0, false)
 
@@ -753,6 +1107,11 @@ func NewMainView(params *MainViewParams) *MainView {
 
 	mv.cmdInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		cmd := mv.cmdInput.GetText()
+		if !strings.HasPrefix(cmd, ":") {
+			// It's a search, so the commands history and completion don't apply.
+			return event
+		}
+
 		// Remove the ":" prefix
 		cmd = cmd[1:]
 
@@ -766,6 +1125,12 @@ func NewMainView(params *MainViewParams) *MainView {
 			item, _ := mv.params.CmdHistory.Next(cmd)
 			mv.cmdInput.SetText(":" + item.Str)
 			return nil
+
+		case tcell.KeyTab:
+			if mv.params.OnCmdComplete != nil {
+				mv.cmdInput.SetText(":" + getCompletedCmd(cmd, mv.params.OnCmdComplete(cmd)))
+			}
+			return nil
 		}
 
 		mv.params.CmdHistory.Reset()
@@ -777,10 +1142,17 @@ func NewMainView(params *MainViewParams) *MainView {
 		switch key {
 		case tcell.KeyEnter:
 			cmd := mv.cmdInput.GetText()
+			prefix := cmd[:1]
 
-			// Remove the ":" prefix
+			// Remove the ":" (or a search) prefix
 			cmd = cmd[1:]
 
+			if prefix != ":" {
+				mv.cmdInput.SetText("")
+				mv.startSearch(cmd, prefix == "?")
+				return
+			}
+
 			if cmd != "" {
 				mv.params.OnCmd(cmd, CmdOpts{})
 			} else {
@@ -870,8 +1242,14 @@ func (mv *MainView) eventHandlerBrowserLike(event *tcell.EventKey) *tcell.EventK
 }
 
 func (mv *MainView) focusCmdline() {
+	mv.focusCmdlineWithPrefix(":")
+}
+
+// focusCmdlineWithPrefix focuses the command line with the given prefix: ":"
+// for commands, or "/" and "?" for the search.
+func (mv *MainView) focusCmdlineWithPrefix(prefix string) {
 	mv.cmdInput.SetFieldStyle(cmdLineCommand)
-	mv.cmdInput.SetText(":")
+	mv.cmdInput.SetText(prefix)
 	mv.focusedBeforeCmd = mv.params.App.GetFocus()
 	mv.params.App.SetFocus(mv.cmdInput)
 }
@@ -945,9 +1323,48 @@ func (mv *MainView) tick() (needDraw bool) {
 		needDraw = true
 	}
 
+	if mv.needAutoRefresh() {
+		mv.bumpTimeRange(false)
+
+		// The user has already seen this query, no need to confirm it again.
+		mv.doQuery(doQueryParams{dontAddHistoryItem: true, force: true, autoRefresh: true})
+		needDraw = true
+	}
+
 	return needDraw
 }
 
+// needAutoRefresh returns whether it's time to rerun the query due to the
+// autorefresh option. Refreshing an absolute time range is pointless, so it
+// only happens for relative ones; and to avoid stacking queries, it never
+// happens while the previous query is still in progress or while there's an
+// overlay message.
+func (mv *MainView) needAutoRefresh() bool {
+	interval := mv.params.Options.GetAutoRefresh()
+	if interval == 0 {
+		return false
+	}
+
+	if mv.from.IsZero() || mv.from.IsAbsolute() || mv.to.IsAbsolute() {
+		return false
+	}
+
+	// Refreshing would get us out of the line range mode.
+	if mv.lineRange != nil {
+		return false
+	}
+
+	if mv.curHMState == nil || !mv.curHMState.Connected || mv.curHMState.Busy {
+		return false
+	}
+
+	if mv.overlayMsgView != nil || mv.curLogResp == nil {
+		return false
+	}
+
+	return time.Since(mv.lastQueryTime) >= interval
+}
+
 func (mv *MainView) bumpOverlay() {
 	// If overlay message isn't minimized by the user, update it;
 	// otherwise, print a message in the command line.
@@ -959,6 +1376,28 @@ func (mv *MainView) bumpOverlay() {
 	}
 }
 
+// bumpDefaultQueriesLabel updates the label next to the query input, which
+// indicates that some of the current logstreams have default queries, which
+// are ANDed with the query (or bypassed, if the defaultqueries option is off).
+// If there are no default queries, the label is hidden.
+func (mv *MainView) bumpDefaultQueriesLabel() {
+	var text string
+	if mv.curHMState != nil && len(mv.curHMState.DefaultQueryByLStream) > 0 {
+		if mv.params.Options.GetDefaultQueries() {
+			text = " [yellow::b]+dq[-::-]"
+		} else {
+			text = " [gray]-dq[-]"
+		}
+	}
+
+	mv.defaultQueriesLabel.SetText(text)
+	mv.topFlex.ResizeItem(mv.defaultQueriesLabel, tview.TaggedStringWidth(text), 0)
+
+	// The time label has to give way to the default queries label on narrow
+	// screens.
+	mv.bumpTimeLabel()
+}
+
 func (mv *MainView) queryInputApplyStyle() {
 	style := queryInputStateMatch
 	text := queryLabelMatch
@@ -984,7 +1423,16 @@ func (mv *MainView) applyQueryEditData(data QueryFull, dqp doQueryParams) error
 		return errors.Annotatef(err, "select query")
 	}
 
+	if err := core.ValidateQuery(data.Query); err != nil {
+		return errors.Annotatef(err, "query")
+	}
+
+	if err := core.ValidateQuery(data.Exclude); err != nil {
+		return errors.Annotatef(err, "exclude")
+	}
+
 	mv.setQuery(data.Query)
+	mv.setExclude(data.Exclude)
 	mv.setTimeRange(ftr.From, ftr.To)
 
 	mv.params.Logger.Infof("Applying lstreams: %s", data.LStreams)
@@ -1020,6 +1468,8 @@ func (mv *MainView) applyHMState(lsmanState *core.LStreamsManagerState) {
 	mv.params.Logger.Verbose1f("Applying HM state: %+v", lsmanState)
 
 	mv.curHMState = lsmanState
+	mv.bumpDefaultQueriesLabel()
+
 	var overlayMsg string
 
 	if !mv.curHMState.Connected && !mv.curHMState.NoMatchingLStreams {
@@ -1116,6 +1566,33 @@ func (mv *MainView) applyHMState(lsmanState *core.LStreamsManagerState) {
 
 	mv.bumpStatusLineLeft()
 
+	// If the user has just applied the logstreams filter which doesn't match
+	// anything, there's nothing to query, so instead of silently showing an
+	// empty table, explain what's going on.
+	if mv.curHMState.NoMatchingLStreams && mv.doQueryParamsOnceConnected != nil {
+		mv.doQueryParamsOnceConnected = nil
+
+		msg := fmt.Sprintf(
+			"The logstreams filter %q doesn't match any logstreams, so there is nothing to query.\n\nEdit the query (the Edit button or :e) to specify logstreams, and use :lstreams to see the ones available from the configs.",
+			mv.lstreamsSpec,
+		)
+		if len(mv.mutedLStreams) > 0 {
+			msg += fmt.Sprintf(
+				"\n\nNote that some logstreams are muted: %s. Use :unmute to unmute them.",
+				strings.Join(mv.mutedLStreams, ", "),
+			)
+		}
+
+		mv.showMessagebox(
+			"noMatchingLStreams",
+			"No matching logstreams",
+			msg,
+			&MessageboxParams{
+				BackgroundColor: tcell.ColorDarkRed,
+			},
+		)
+	}
+
 	if mv.curHMState.Connected && mv.doQueryParamsOnceConnected != nil {
 		mv.doQuery(*mv.doQueryParamsOnceConnected)
 		mv.doQueryParamsOnceConnected = nil
@@ -1188,6 +1665,22 @@ func (mv *MainView) updateTableHeader(msgs []core.LogMsg) (colNames []string) {
 		}
 	}
 
+	if mv.params.Options.GetStableColumns() {
+		if mv.stableTags == nil {
+			mv.stableTags = map[string]struct{}{}
+		}
+
+		for name := range existingTags {
+			mv.stableTags[name] = struct{}{}
+		}
+
+		for name := range mv.stableTags {
+			existingTags[name] = struct{}{}
+		}
+	} else {
+		mv.stableTags = nil
+	}
+
 	numSticky := 0
 	fields := make([]SelectQueryField, 0, len(mv.selectQuery.Fields))
 	for _, fld := range mv.selectQuery.Fields {
@@ -1238,6 +1731,55 @@ func (mv *MainView) updateTableHeader(msgs []core.LogMsg) (colNames []string) {
 		fields = append(fields, implicitFields...)
 	}
 
+	// If the messages are being split, the message column is replaced with the
+	// columns for every part.
+	if mv.msgSplitDelim != "" {
+		numParts := getMsgSplitNumCols(msgs, mv.msgSplitDelim)
+
+		splitFields := make([]SelectQueryField, 0, len(fields)+numParts)
+		for _, fld := range fields {
+			if fld.Name != FieldNameMessage {
+				splitFields = append(splitFields, fld)
+				continue
+			}
+
+			_, isExplicit := explicit[fld.Name]
+			for i := 0; i < numParts; i++ {
+				name := msgSplitColName(i)
+				splitFields = append(splitFields, SelectQueryField{
+					Name:        name,
+					DisplayName: name,
+					Sticky:      fld.Sticky,
+				})
+
+				existingTags[name] = struct{}{}
+				if isExplicit {
+					explicit[name] = struct{}{}
+				}
+			}
+
+			if fld.Sticky {
+				numSticky += numParts - 1
+			}
+		}
+
+		fields = splitFields
+	}
+
+	// In the raw view, there is only the message column, with the original
+	// log lines; see getRawMessage.
+	if mv.params.Options.GetViewMode() == viewModeRaw {
+		fields = []SelectQueryField{{Name: FieldNameMessage, DisplayName: "raw"}}
+		explicit[FieldNameMessage] = struct{}{}
+		numSticky = 0
+	}
+
+	// If row numbers are shown, they take the first column.
+	colOffset := mv.logsTableColOffset()
+	if colOffset > 0 {
+		mv.logsTable.SetCell(0, 0, newTableCellHeader("#").SetAlign(tview.AlignRight))
+	}
+
 	colNames = make([]string, 0, len(fields))
 	for i, fld := range fields {
 		displayName := fld.DisplayName
@@ -1255,376 +1797,2395 @@ func (mv *MainView) updateTableHeader(msgs []core.LogMsg) (colNames []string) {
 			cell.SetTextColor(tcell.ColorLightGray)
 		}
 
-		mv.logsTable.SetCell(0, i, cell)
+		mv.logsTable.SetCell(0, colOffset+i, cell)
 
 		colNames = append(colNames, fld.Name)
 	}
 
-	mv.logsTable.SetFixed(1, numSticky)
+	mv.logsTable.SetFixed(1, colOffset+numSticky)
+	mv.curNumStickyCols = numSticky
 
 	return colNames
 }
 
+// getRawMessage returns whether the message column shows the original log
+// lines: either because of the rawmessage option, or in the raw view.
+func (mv *MainView) getRawMessage() bool {
+	return mv.params.Options.GetRawMessage() || mv.params.Options.GetViewMode() == viewModeRaw
+}
+
+// logsTableSelection is the state of the logs table selection, remembered
+// before applying new logs.
+type logsTableSelection struct {
+	numRows     int
+	selectedRow int
+	offsetRow   int
+	offsetCol   int
+
+	selectedMsg    core.LogMsg
+	hasSelectedMsg bool
+}
+
+func (mv *MainView) getLogsTableSelection() *logsTableSelection {
+	sel := &logsTableSelection{
+		numRows: mv.logsTable.GetRowCount(),
+	}
+	sel.selectedRow, _ = mv.logsTable.GetSelection()
+	sel.offsetRow, sel.offsetCol = mv.logsTable.GetOffset()
+
+	// Remember the selected message, to keep the user's place if the same query
+	// is rerun or slightly tweaked. If the latest row is selected though (the
+	// last one, or the first one in the reverse mode), the user is presumably
+	// following the latest logs, so that's what we'll keep.
+	sel.selectedMsg, sel.hasSelectedMsg = mv.getSelectedMsg()
+	if mv.logsTableContent.reverse {
+		if sel.selectedRow <= mv.logsTableContent.getFirstDataRow() {
+			sel.hasSelectedMsg = false
+		}
+	} else if sel.selectedRow >= sel.numRows-1 {
+		sel.hasSelectedMsg = false
+	}
+
+	return sel
+}
+
 func (mv *MainView) applyLogs(resp *core.LogRespTotal) {
+	prevResp := mv.lastCompleteLogResp
 	mv.curLogResp = resp
+	applyLogExtractors(resp.Logs, mv.logExtractors)
+
+	// While the results are arriving in batches, keep restoring the selection
+	// which was there before the first batch, so that the rows getting inserted
+	// don't move the user's place, and once all the results are there, we
+	// still correctly snap to the bottom if needed.
+	sel := mv.partialSelection
+	if sel == nil || resp.LoadedEarlier {
+		sel = mv.getLogsTableSelection()
+	}
 
-	oldNumRows := mv.logsTable.GetRowCount()
-	selectedRow, _ := mv.logsTable.GetSelection()
-	offsetRow, offsetCol := mv.logsTable.GetOffset()
+	mv.partialSelection = nil
+	if resp.Partial {
+		mv.partialSelection = sel
+	} else {
+		mv.lastCompleteLogResp = resp
+	}
+
+	oldNumRows := sel.numRows
+	selectedRow := sel.selectedRow
+	offsetRow, offsetCol := sel.offsetRow, sel.offsetCol
+	prevSelectedMsg, hadSelectedMsg := sel.selectedMsg, sel.hasSelectedMsg
+
+	// Message indices change with every response, so expanded groups in the
+	// dedup mode have to be reset.
+	mv.dedupExpanded = nil
 
 	mv.formatLogs()
 
 	if !resp.LoadedEarlier {
-		// Replaced all logs
-		mv.logsTable.Select(len(resp.Logs)+1, 0)
-		mv.logsTable.ScrollToEnd()
+		// Replaced all logs; select the same message as before, if it's still
+		// there (or the one nearest by time), keeping it at the same position on
+		// the screen. Otherwise, go to the latest one.
+		msgIdx, found := 0, false
+		if hadSelectedMsg {
+			msgIdx, found = findLogMsg(resp.Logs, &prevSelectedMsg)
+		}
+
+		if found {
+			newSelectedRow := mv.logsTableContent.getRowByMsgIdx(msgIdx)
+			newOffsetRow := newSelectedRow - (selectedRow - offsetRow)
+			if newOffsetRow < 0 {
+				newOffsetRow = 0
+			}
+
+			mv.logsTable.SetOffset(newOffsetRow, offsetCol)
+			mv.logsTable.Select(newSelectedRow, 0)
+		} else if mv.logsTableContent.reverse {
+			mv.logsTable.Select(mv.logsTableContent.getLatestRow(), 0)
+			mv.logsTable.ScrollToBeginning()
+		} else {
+			mv.logsTable.Select(mv.logsTable.GetRowCount()-1, 0)
+			mv.logsTable.ScrollToEnd()
+		}
 		mv.bumpTimeRange(true)
+	} else if mv.logsTableContent.reverse {
+		// Loaded more (earlier) logs in the reverse mode: they're added at the
+		// bottom, so nothing moves, unless some of the newest ones were evicted
+		// from the top.
+		newOffsetRow := offsetRow - resp.NumEvicted
+		if newOffsetRow < 0 {
+			newOffsetRow = 0
+		}
+
+		newSelectedRow := selectedRow - resp.NumEvicted
+		if newSelectedRow < mv.logsTableContent.getFirstDataRow() {
+			newSelectedRow = mv.logsTableContent.getFirstDataRow()
+		}
+
+		mv.logsTable.SetOffset(newOffsetRow, offsetCol)
+		mv.logsTable.Select(newSelectedRow, 0)
 	} else {
-		// Loaded more (earlier) logs
-		numNewRows := mv.logsTable.GetRowCount() - oldNumRows
+		// Loaded more (earlier) logs; if some of the newest ones were evicted
+		// from the bottom, it doesn't affect the offset.
+		numNewRows := mv.logsTable.GetRowCount() - oldNumRows + resp.NumEvicted
 		mv.logsTable.SetOffset(offsetRow+numNewRows, offsetCol)
 		mv.logsTable.Select(selectedRow+numNewRows, 0)
 	}
 
-	mv.printMsg(fmt.Sprintf("Query took: %s", resp.QueryDur.Round(1*time.Millisecond)), nlMsgLevelInfo)
-}
+	if resp.Partial {
+		mv.printMsg(fmt.Sprintf(
+			"Got partial results in %s, waiting for %d more logstream(s)...",
+			resp.QueryDur.Round(1*time.Millisecond), resp.NumPendingLStreams,
+		), nlMsgLevelInfo)
+		return
+	}
 
-func (mv *MainView) getLastQueryDebugInfo() string {
-	if mv.curLogResp == nil {
-		return "-- No query results --"
+	queryTookStr := fmt.Sprintf("Query took: %s", resp.QueryDur.Round(1*time.Millisecond))
+	if resp.NumDeduped > 0 {
+		queryTookStr += fmt.Sprintf(" (%d duplicate(s) from merged files dropped)", resp.NumDeduped)
 	}
 
-	lstreamNames := make([]string, 0, len(mv.curLogResp.DebugInfo))
-	for lstreamName := range mv.curLogResp.DebugInfo {
-		lstreamNames = append(lstreamNames, lstreamName)
+	notes, isWarn := getQueryStatusNotes(resp, mv.getQuietLStreams())
+	if len(notes) > 0 {
+		queryTookStr += "; " + strings.Join(notes, "; ")
 	}
-	sort.Strings(lstreamNames)
 
-	var sb strings.Builder
+	msgLevel := nlMsgLevelInfo
+	if isWarn {
+		msgLevel = nlMsgLevelWarn
+	}
 
-	for _, lstreamName := range lstreamNames {
-		debugInfo := mv.curLogResp.DebugInfo[lstreamName]
-		if len(debugInfo.AgentStdout) > 0 {
-			if sb.Len() > 0 {
-				sb.WriteString("\n")
-			}
+	mv.printMsg(queryTookStr, msgLevel)
 
-			sb.WriteString(fmt.Sprintf("%s stdout:\n", lstreamName))
-			for _, line := range debugInfo.AgentStdout {
-				sb.WriteString(line)
-				sb.WriteString("\n")
-			}
-		}
+	if mv.curQueryAutoRefresh && prevResp != nil && !resp.LoadedEarlier {
+		mv.alertOnNewLogs(getNewLogMsgs(prevResp.Logs, resp.Logs))
+	}
 
-		if len(debugInfo.AgentStderr) > 0 {
-			if sb.Len() > 0 {
-				sb.WriteString("\n")
-			}
+	if !resp.LoadedEarlier {
+		mv.evaluateWatches(resp)
+	}
 
-			sb.WriteString(fmt.Sprintf("%s stderr:\n", lstreamName))
-			for _, line := range debugInfo.AgentStderr {
-				sb.WriteString(line)
-				sb.WriteString("\n")
+	if mv.curQueryFromHistogram && !resp.LoadedEarlier && mv.params.Options.GetJumpToError() {
+		mv.selectFirstError(resp.Logs)
+	}
+
+	if pending := mv.pendingSnapshotDiff; pending != nil && !resp.LoadedEarlier {
+		mv.pendingSnapshotDiff = nil
+		mv.showSnapshotDiff(pending.name, pending.snap, resp)
+	}
+}
+
+// startSearch starts the search within the loaded logs, and goes to the first
+// match after the selected message (or before it, if backward is true). An
+// empty pattern repeats the last search.
+func (mv *MainView) startSearch(pattern string, backward bool) {
+	if pattern == "" {
+		if mv.search == nil {
+			mv.printMsg("No previous search pattern", nlMsgLevelErr)
+			return
+		}
+
+		pattern = mv.search.pattern
+	}
+
+	search, err := newLogsSearch(pattern, backward)
+	if err != nil {
+		mv.printMsg(err.Error(), nlMsgLevelErr)
+		return
+	}
+
+	mv.search = search
+	mv.formatLogs()
+	mv.jumpToSearchMatch(true)
+}
+
+// clearSearch stops highlighting the search matches, see :nohlsearch.
+func (mv *MainView) clearSearch() {
+	mv.search = nil
+	mv.formatLogs()
+	mv.bumpStatusLineRight()
+}
+
+// jumpToSearchMatch selects the next search match if next is true, or the
+// previous one otherwise; "next" is in the direction of the search, like "n"
+// and "N" in vim. It wraps around at the ends.
+func (mv *MainView) jumpToSearchMatch(next bool) {
+	s := mv.search
+	if s == nil {
+		mv.printMsg("No previous search pattern", nlMsgLevelErr)
+		return
+	}
+
+	forward := next != s.backward
+	prefix := "/"
+	if s.backward {
+		prefix = "?"
+	}
+
+	// Forward is down the table, which is back in time in the reverse mode.
+	msgsForward := forward != mv.logsTableContent.reverse
+
+	// If nothing is selected, start from the corresponding end.
+	curMsgIdx := -1
+	if !msgsForward && mv.curLogResp != nil {
+		curMsgIdx = len(mv.curLogResp.Logs)
+	}
+
+	selectedRow, _ := mv.logsTable.GetSelection()
+	if dr, ok := mv.logsTableContent.getDedupRow(selectedRow); ok {
+		curMsgIdx = dr.msgIdx
+		if dr.collapsed && msgsForward {
+			// Skip the rest of the group, it's all on the same row.
+			curMsgIdx = dr.groupIdx + dr.groupSize - 1
+		}
+	}
+
+	k, wrapped, ok := s.findNext(curMsgIdx, msgsForward)
+	if !ok {
+		mv.printMsg(fmt.Sprintf("Pattern not found: %s", s.pattern), nlMsgLevelErr)
+		return
+	}
+
+	mv.logsTable.Select(mv.logsTableContent.getRowByMsgIdx(s.matches[k]), 0)
+
+	countStr := fmt.Sprintf("[%d/%d]", k+1, len(s.matches))
+	if !wrapped {
+		mv.printMsg(fmt.Sprintf("%s%s %s", prefix, s.pattern, countStr), nlMsgLevelInfo)
+	} else if forward {
+		mv.printMsg(fmt.Sprintf("search hit BOTTOM, continuing at TOP %s", countStr), nlMsgLevelWarn)
+	} else {
+		mv.printMsg(fmt.Sprintf("search hit TOP, continuing at BOTTOM %s", countStr), nlMsgLevelWarn)
+	}
+}
+
+// selectFirstError selects the first message with the error level, or the
+// first message if there are no errors.
+func (mv *MainView) selectFirstError(logs []core.LogMsg) {
+	if len(logs) == 0 {
+		return
+	}
+
+	msgIdx := 0
+	for i := range logs {
+		if logs[i].Level == core.LogLevelError {
+			msgIdx = i
+			break
+		}
+	}
+
+	row := mv.logsTableContent.getRowByMsgIdx(msgIdx)
+	mv.logsTable.Select(row, 0)
+
+	// If it's the oldest message, also show the "load older" row next to it.
+	if msgIdx == 0 {
+		if mv.logsTableContent.reverse {
+			mv.logsTable.ScrollToEnd()
+		} else {
+			mv.logsTable.ScrollToBeginning()
+		}
+	}
+}
+
+// pendingSnapshotDiff is the snapshot to compare the next query results
+// against.
+type pendingSnapshotDiff struct {
+	name string
+	snap *LogSnapshot
+}
+
+// diffWithSnapshot reruns the current query, and once the results arrive,
+// shows how they differ from the given snapshot.
+func (mv *MainView) diffWithSnapshot(name string, snap *LogSnapshot) {
+	mv.pendingSnapshotDiff = &pendingSnapshotDiff{name: name, snap: snap}
+	mv.doQuery(doQueryParams{force: true, fetchLines: true})
+}
+
+func (mv *MainView) showSnapshotDiff(name string, snap *LogSnapshot, resp *core.LogRespTotal) {
+	text := formatLogSnapshotDiff(name, snap, diffLogSnapshot(snap, resp.Logs))
+	if resp.Truncated {
+		text = "NOTE: the results are truncated, so only the loaded lines are compared\n\n" + text
+	}
+
+	mv.showMessagebox("snapshotDiff", "Snapshot diff", tview.Escape(text), &MessageboxParams{
+		BackgroundColor: tcell.ColorDarkBlue,
+		CopyButton:      true,
+	})
+}
+
+// alertOnNewLogs rings the bell and prints a message if the alert option is
+// set and there are new lines (matching the alerton regexp, if it's set).
+func (mv *MainView) alertOnNewLogs(newLogs []core.LogMsg) {
+	if !mv.params.Options.GetAlert() {
+		return
+	}
+
+	numMatching := len(newLogs)
+	if re := mv.params.Options.GetAlertOn(); re != nil {
+		numMatching = 0
+		for i := range newLogs {
+			if re.MatchString(newLogs[i].Msg) {
+				numMatching++
 			}
 		}
 	}
 
-	ret := sb.String()
-	if ret == "" {
-		ret = "-- No debug info --"
+	if numMatching == 0 {
+		return
 	}
 
-	return ret
+	mv.pendingBell = true
+	mv.printMsg(fmt.Sprintf("Alert: %d new matching line(s)", numMatching), nlMsgLevelWarn)
 }
 
-func (mv *MainView) showLastQueryDebugInfo() {
-	text := mv.getLastQueryDebugInfo()
+// isCurQueryAutoRefresh returns whether the current query was rerun by the
+// autorefresh, as opposed to being initiated by the user.
+func (mv *MainView) isCurQueryAutoRefresh() bool {
+	return mv.curQueryAutoRefresh
+}
 
-	mv.showMessagebox("debug", "Debug info for the last query", text, &MessageboxParams{
+// setFrozenLogResp remembers the query result received while the freeze
+// option is on, to be applied later; see frozenLogResp.
+func (mv *MainView) setFrozenLogResp(resp *core.LogRespTotal) {
+	mv.frozenLogResp = resp
+	mv.bumpStatusLineRight()
+}
+
+// takeFrozenLogResp returns the pending query result received while the
+// freeze option was on (nil if there is none), and forgets it.
+func (mv *MainView) takeFrozenLogResp() *core.LogRespTotal {
+	resp := mv.frozenLogResp
+	mv.frozenLogResp = nil
+	mv.bumpStatusLineRight()
+
+	return resp
+}
+
+// addWatch parses the watch expression and adds the watch; it's evaluated
+// right away if there are query results already.
+func (mv *MainView) addWatch(src string) error {
+	expr, err := parseWatchExpr(src)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	mv.watches = append(mv.watches, &watch{expr: expr})
+
+	if mv.curLogResp != nil && !mv.curLogResp.Partial {
+		mv.evaluateWatches(mv.curLogResp)
+	}
+
+	return nil
+}
+
+// removeWatch removes the watch with the given number, as shown by
+// ":watches" (starting from 1); 0 removes all of them.
+func (mv *MainView) removeWatch(n int) error {
+	if n == 0 {
+		mv.watches = nil
+		mv.bumpStatusLineRight()
+		return nil
+	}
+
+	if n < 1 || n > len(mv.watches) {
+		return errors.Errorf("no watch %d, there are %d watch(es)", n, len(mv.watches))
+	}
+
+	mv.watches = append(mv.watches[:n-1], mv.watches[n:]...)
+	mv.bumpStatusLineRight()
+
+	return nil
+}
+
+func (mv *MainView) showWatches() {
+	mv.showMessagebox("watches", "Watches", tview.Escape(formatWatches(mv.watches)), &MessageboxParams{
 		BackgroundColor: tcell.ColorDarkBlue,
 		CopyButton:      true,
 	})
 }
 
-func (mv *MainView) formatLogs() {
+// evaluateWatches evaluates all the watches against the query results, and
+// if some of them have just become tripped, prints an alert and, if the
+// watchbell option is set, rings the bell. The tripped watches are also
+// shown in the status line until they're back to normal.
+func (mv *MainView) evaluateWatches(resp *core.LogRespTotal) {
+	var justTripped []string
+	for _, w := range mv.watches {
+		if w.evaluate(resp, mv.actualTo) {
+			justTripped = append(justTripped, fmt.Sprintf("%s (count: %d)", w.expr.src, w.count))
+		}
+	}
+
+	mv.bumpStatusLineRight()
+
+	if len(justTripped) == 0 {
+		return
+	}
+
+	if mv.params.Options.GetWatchBell() {
+		mv.pendingBell = true
+	}
+
+	mv.printMsg(fmt.Sprintf(
+		"Watch tripped: %s (see :watches)", strings.Join(justTripped, "; "),
+	), nlMsgLevelWarn)
+}
+
+// formatNumParseErrors formats the number of parse errors per logstream like
+// "host1: 3, host2: 10", sorted by logstream name.
+func formatNumParseErrors(numParseErrors map[string]int) string {
+	lstreamNames := make([]string, 0, len(numParseErrors))
+	for name := range numParseErrors {
+		lstreamNames = append(lstreamNames, name)
+	}
+	sort.Strings(lstreamNames)
+
+	parts := make([]string, 0, len(lstreamNames))
+	for _, name := range lstreamNames {
+		parts = append(parts, fmt.Sprintf("%s: %d", name, numParseErrors[name]))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// splitTimeRange is used when the results are truncated: it narrows the time
+// range down to the part which is not covered by the currently loaded logs,
+// and queries it. The part which is already loaded remains accessible via the
+// history (Alt+Left or :back).
+func (mv *MainView) splitTimeRange() {
 	resp := mv.curLogResp
-	if resp == nil {
-		resp = &core.LogRespTotal{}
+	if resp == nil || !resp.Truncated {
+		mv.printMsg("Results are not truncated, nothing to split", nlMsgLevelWarn)
+		return
 	}
 
-	histogramData := make(map[int]int, len(resp.MinuteStats))
-	for k, v := range resp.MinuteStats {
-		histogramData[int(k)] = v.NumMsgs
+	if len(resp.Logs) == 0 {
+		mv.printMsg("No logs loaded, can't split", nlMsgLevelErr)
+		return
 	}
 
-	mv.histogram.SetData(histogramData)
+	// Round the split point forward, so that nothing falls through the gap
+	// between the two halves (the minute containing the earliest loaded
+	// message will be present in both).
+	splitTime := mv.params.Options.GetTimeRounding().ceil(resp.Logs[0].Time)
+	if !splitTime.After(mv.actualFrom) {
+		mv.printMsg("Time range is too small to split further", nlMsgLevelErr)
+		return
+	}
 
-	// TODO: perhaps optimize it, instead of clearing and repopulating whole table
-	mv.logsTable.Clear()
+	mv.setTimeRange(TimeOrDur{Time: mv.actualFrom}, TimeOrDur{Time: splitTime})
+	mv.doQuery(doQueryParams{})
+}
 
-	// Update existingTagNames
-	mv.existingTagNames = map[string]struct{}{
-		FieldNameTime:    {},
-		FieldNameMessage: {},
+func getNumWarnings(warningsByLStream map[string][]string) int {
+	ret := 0
+	for _, warnings := range warningsByLStream {
+		ret += len(warnings)
 	}
-	for _, msg := range resp.Logs {
-		for name := range msg.Context {
-			mv.existingTagNames[name] = struct{}{}
-		}
+
+	return ret
+}
+
+// getQuietLStreams returns the logstreams which had no logs in the last
+// query while others had plenty; see getQuietLStreams.
+func (mv *MainView) getQuietLStreams() []string {
+	if mv.curLogResp == nil {
+		return nil
 	}
 
-	// Update table header
-	colNames := mv.updateTableHeader(resp.Logs)
+	var expectQuiet map[string]struct{}
+	if mv.curHMState != nil {
+		expectQuiet = mv.curHMState.ExpectQuietLStreams
+	}
 
-	mv.logsTable.SetCell(
-		rowIdxLoadOlder, 0,
-		newTableCellButton("< MOAR ! >"),
+	return getQuietLStreams(
+		mv.curLogResp.NumMsgsByLStream, expectQuiet, mv.params.Options.GetQuietThreshold(),
 	)
+}
 
-	tz := mv.params.Options.GetTimezone()
+func formatNumWarnings(numWarnings int) string {
+	if numWarnings == 1 {
+		return "1 warning"
+	}
 
-	// Add all available logs
-	for i, rowIdx := 0, 2; i < len(resp.Logs); i, rowIdx = i+1, rowIdx+1 {
-		msg := resp.Logs[i]
+	return fmt.Sprintf("%d warnings", numWarnings)
+}
 
-		// TODO: make the colors configurable
-		msgColor := tcell.ColorWhite
-		switch msg.Level {
-		case core.LogLevelDebug:
-			msgColor = tcell.ColorLightBlue
-		case core.LogLevelInfo:
-			msgColor = tcell.ColorLightGreen
-		case core.LogLevelWarn:
-			msgColor = tcell.ColorYellow
-		case core.LogLevelError:
-			msgColor = tcell.ColorPink
-		}
+// showLastQueryWarnings shows the warnings reported by the agents during the
+// last query, grouped by logstream.
+func (mv *MainView) showLastQueryWarnings() {
+	if mv.curLogResp == nil || len(mv.curLogResp.WarningsByLStream) == 0 {
+		mv.printMsg("No warnings for the last query", nlMsgLevelInfo)
+		return
+	}
 
-		timeStr := msg.Time.In(tz).Format(logsTableTimeLayout)
-		if msg.DecreasedTimestamp {
-			timeStr = ""
+	lstreamNames := make([]string, 0, len(mv.curLogResp.WarningsByLStream))
+	for name := range mv.curLogResp.WarningsByLStream {
+		lstreamNames = append(lstreamNames, name)
+	}
+	sort.Strings(lstreamNames)
+
+	var sb strings.Builder
+	for _, name := range lstreamNames {
+		sb.WriteString(fmt.Sprintf("%s:\n", name))
+		for _, warning := range mv.curLogResp.WarningsByLStream[name] {
+			sb.WriteString("  ")
+			sb.WriteString(warning)
+			sb.WriteString("\n")
 		}
+		sb.WriteString("\n")
+	}
 
-		for i, colName := range colNames {
-			var cell *tview.TableCell
-
-			switch colName {
-			case FieldNameTime:
-				cell = newTableCellLogmsg(timeStr).SetTextColor(tcell.ColorLightBlue)
-			case FieldNameMessage:
-				cell = newTableCellLogmsg(tview.Escape(msg.Msg)).SetTextColor(msgColor)
-			default:
-				cell = newTableCellLogmsg(msg.Context[colName]).SetTextColor(msgColor)
-			}
+	mv.showMessagebox("warnings", "Warnings for the last query", tview.Escape(sb.String()), &MessageboxParams{
+		BackgroundColor: tcell.ColorDarkBlue,
+		CopyButton:      true,
+	})
+}
 
-			mv.logsTable.SetCell(rowIdx, i, cell)
-		}
+// toggleDedupGroup expands the collapsed group of identical messages under
+// the cursor in the dedup mode, or collapses it back if it's expanded.
+func (mv *MainView) toggleDedupGroup() {
+	if !mv.params.Options.GetDedup() {
+		mv.printMsg("Dedup mode is off, use :set dedup on to enable it", nlMsgLevelInfo)
+		return
+	}
+
+	row, _ := mv.logsTable.GetSelection()
+	dr, ok := mv.logsTableContent.getDedupRow(row)
+	if !ok || dr.groupSize <= 1 {
+		return
+	}
+
+	if mv.dedupExpanded == nil {
+		mv.dedupExpanded = map[int]struct{}{}
+	}
 
-		mv.logsTable.GetCell(rowIdx, 0).SetReference(msg)
+	if dr.collapsed {
+		mv.dedupExpanded[dr.groupIdx] = struct{}{}
+	} else {
+		delete(mv.dedupExpanded, dr.groupIdx)
 	}
 
+	mv.logsTableContent.setDedup(true, mv.dedupExpanded)
+	mv.logsTable.Select(mv.logsTableContent.getRowByMsgIdx(dr.groupIdx), 0)
 	mv.bumpStatusLineRight()
 }
 
-func (mv *MainView) bumpStatusLineLeft() {
-	sb := strings.Builder{}
+// getMinimapData returns the data for the minimap: the log levels of all
+// rows in the logs table, and the range of rows currently visible.
+func (mv *MainView) getMinimapData() (levels []core.LogLevel, viewFrom, viewTo int) {
+	levels = mv.logsTableContent.getRowLevels()
 
-	lsmanState := mv.curHMState
-	if lsmanState == nil {
-		// We haven't received a single HMState update, so just use the zero value.
-		lsmanState = &core.LStreamsManagerState{}
+	// The header row is fixed, so the offset only applies to the rest.
+	offsetRow, _ := mv.logsTable.GetOffset()
+	_, _, _, height := mv.logsTable.GetInnerRect()
+
+	viewFrom = offsetRow + 1 - mv.logsTableContent.getFirstDataRow()
+	viewTo = viewFrom + height - 1
+	if viewFrom < 0 {
+		viewFrom = 0
 	}
 
-	if !lsmanState.Connected && !lsmanState.NoMatchingLStreams {
-		sb.WriteString("conn ")
-	} else if lsmanState.Busy {
-		sb.WriteString("busy ")
-	} else {
-		sb.WriteString("idle ")
+	return levels, viewFrom, viewTo
+}
+
+// bumpMinimap shows or hides the minimap as per the minimap option.
+func (mv *MainView) bumpMinimap() {
+	width := 0
+	if mv.params.Options.GetShowMinimap() {
+		width = 1
 	}
 
-	numIdle := len(lsmanState.LStreamsByState[core.LStreamClientStateConnectedIdle])
-	numBusy := len(lsmanState.LStreamsByState[core.LStreamClientStateConnectedBusy])
-	numOther := lsmanState.NumLStreams - numIdle - numBusy
+	mv.logsFlex.ResizeItem(mv.minimap, width, 0)
+}
 
-	sb.WriteString(getStatuslineNumStr("🖳", numIdle, "green"))
-	sb.WriteString(" ")
-	sb.WriteString(getStatuslineNumStr("🖳", numBusy, "orange"))
-	sb.WriteString(" ")
-	sb.WriteString(getStatuslineNumStr("🖳", numOther, "red"))
+// focusTargets are the names of the primitives which can be focused
+// directly, with the ":focus" command or the "g" key combinations.
+var focusTargets = []string{"query", "histogram", "logs"}
 
-	sb.WriteString(" | ")
-	sb.WriteString(mv.lstreamsSpec)
+// focusKeys maps the keys which, following a "g", jump the focus directly
+// to the named primitive.
+var focusKeys = map[rune]string{
+	'q': "query",
+	'h': "histogram",
+	'l': "logs",
+}
 
-	mv.statusLineLeft.SetText(sb.String())
+// focusByName focuses the primitive with the given name, one of focusTargets.
+func (mv *MainView) focusByName(name string) error {
+	switch name {
+	case "query":
+		mv.params.App.SetFocus(mv.queryInput)
+	case "histogram":
+		if !mv.params.Options.GetShowHistogram() {
+			return errors.Errorf("the histogram is hidden, use :set histogram to show it")
+		}
+		mv.params.App.SetFocus(mv.histogram)
+	case "logs":
+		mv.params.App.SetFocus(mv.logsTable)
+	default:
+		return errors.Errorf(
+			"unknown focus target %q, valid ones are: %s", name, strings.Join(focusTargets, ", "),
+		)
+	}
+
+	return nil
 }
 
-func (mv *MainView) bumpStatusLineRight() {
-	selectedRow, _ := mv.logsTable.GetSelection()
-	selectedRow -= 1
+// focusByKey handles the key following a "g": if it's one of focusKeys, it
+// focuses the corresponding primitive and returns true.
+func (mv *MainView) focusByKey(r rune) bool {
+	name, ok := focusKeys[r]
+	if !ok {
+		return false
+	}
 
-	var selectedRowStr string
-	if selectedRow >= 1 {
-		selectedRowStr = strconv.Itoa(selectedRow)
-	} else {
-		selectedRowStr = "-"
+	if err := mv.focusByName(name); err != nil {
+		mv.printMsg(err.Error(), nlMsgLevelErr)
 	}
 
-	if mv.curLogResp != nil {
-		mv.statusLineRight.SetText(fmt.Sprintf(
-			"%s / %d / %d",
-			selectedRowStr, len(mv.curLogResp.Logs), mv.curLogResp.NumMsgsTotal,
-		))
-	} else {
-		mv.statusLineRight.SetText("-")
+	return true
+}
+
+// histogramHeight is the height of the histogram when it's shown.
+const histogramHeight = 6
+
+// bumpHistogram shows or hides the histogram as per the histogram option.
+// When hidden, its data is still updated, so it reappears populated.
+func (mv *MainView) bumpHistogram() {
+	height := 0
+	if mv.params.Options.GetShowHistogram() {
+		height = histogramHeight
+	}
+
+	mv.mainFlex.ResizeItem(mv.histogram, height, 0)
+
+	if height == 0 && mv.histogram.HasFocus() {
+		mv.params.App.SetFocus(mv.logsTable)
+	}
+}
+
+// toggleHistogram flips the histogram option, and shows or hides the
+// histogram accordingly.
+func (mv *MainView) toggleHistogram() {
+	mv.params.Options.Call(func(o *Options) {
+		o.ShowHistogram = !o.ShowHistogram
+	})
+
+	mv.bumpHistogram()
+}
+
+// getHistogramOrLogsTable returns the histogram if it's shown, or the logs
+// table otherwise; used to skip the hidden histogram when cycling the focus.
+func (mv *MainView) getHistogramOrLogsTable() tview.Primitive {
+	if mv.params.Options.GetShowHistogram() {
+		return mv.histogram
+	}
+
+	return mv.logsTable
+}
+
+// jumpToNextHotRow selects the first error or warning in the next (or
+// previous, if forward is false) region which has any, as per the minimap.
+func (mv *MainView) jumpToNextHotRow(forward bool) {
+	firstDataRow := mv.logsTableContent.getFirstDataRow()
+
+	row, _ := mv.logsTable.GetSelection()
+	if row < firstDataRow {
+		row = firstDataRow
+	}
+
+	hotRow, ok := mv.minimap.GetNextHotRow(row-firstDataRow, forward)
+	if !ok {
+		mv.printMsg("No more errors or warnings in this direction", nlMsgLevelInfo)
+		return
+	}
+
+	mv.logsTable.Select(hotRow+firstDataRow, 0)
+	mv.bumpStatusLineRight()
+}
+
+// getSelectedMsg returns the message in the selected row of the logs table.
+func (mv *MainView) getSelectedMsg() (core.LogMsg, bool) {
+	row, _ := mv.logsTable.GetSelection()
+	if row < mv.logsTableContent.getFirstDataRow() {
+		return core.LogMsg{}, false
+	}
+
+	firstCell := mv.logsTable.GetCell(row, 0)
+	if firstCell == nil {
+		return core.LogMsg{}, false
+	}
+
+	msg, ok := firstCell.GetReference().(core.LogMsg)
+	return msg, ok
+}
+
+// editSelectedMsgAnnotation opens the command line with the :annotate command
+// for the selected message, prefilled with its current note if any.
+func (mv *MainView) editSelectedMsgAnnotation() {
+	msg, ok := mv.getSelectedMsg()
+	if !ok || mv.params.Annotations == nil {
+		return
+	}
+
+	note, _ := mv.params.Annotations.Get(&msg)
+	mv.focusCmdlineWithPrefix(":annotate " + note)
+}
+
+// annotateSelectedMsg attaches the note to the selected message, or removes
+// it if the note is empty.
+func (mv *MainView) annotateSelectedMsg(note string) error {
+	msg, ok := mv.getSelectedMsg()
+	if !ok {
+		return errors.Errorf("No message selected")
+	}
+
+	if err := mv.params.Annotations.Set(&msg, note); err != nil {
+		return errors.Trace(err)
+	}
+
+	if mv.curLogResp != nil {
+		mv.logsTableContent.setAnnotated(mv.params.Annotations.getAnnotatedMsgIdxs(mv.curLogResp.Logs))
+	}
+
+	return nil
+}
+
+// showAnnotations shows all the annotations, including the ones for the log
+// lines which aren't currently loaded.
+func (mv *MainView) showAnnotations() {
+	annotations := mv.params.Annotations.GetAll()
+	if len(annotations) == 0 {
+		mv.printMsg("No annotations yet, press m on a message in the logs table to add one", nlMsgLevelInfo)
+		return
+	}
+
+	tz := mv.params.Options.GetTimezone()
+
+	var sb strings.Builder
+	for _, a := range annotations {
+		location := a.LStream
+		if a.Linenumber != 0 {
+			location = fmt.Sprintf("%s %s:%d", a.LStream, a.Filename, a.Linenumber)
+		}
+
+		fmt.Fprintf(&sb, "%s %s\n  %s\n  [yellow]%s[-]\n\n",
+			a.Time.In(tz).Format(logsTableTimeLayout), tview.Escape(location),
+			tview.Escape(a.Msg), tview.Escape(a.Note),
+		)
+	}
+
+	mv.showMessagebox("annotations", "Annotations", sb.String(), &MessageboxParams{
+		BackgroundColor: tcell.ColorDarkBlue,
+		CopyButton:      true,
+	})
+}
+
+// getQuickFilterColName returns the name of the column used by the quick
+// filter (keys f and F in the logs table): the first non-sticky column which
+// is currently visible, so the column can be chosen by scrolling the table
+// horizontally.
+func (mv *MainView) getQuickFilterColName() string {
+	_, offsetCol := mv.logsTable.GetOffset()
+	idx := mv.curNumStickyCols + offsetCol
+	if idx >= len(mv.curColNames) {
+		return ""
+	}
+
+	return mv.curColNames[idx]
+}
+
+// quickFilterBySelectedCell takes the value of the quick filter column (see
+// getQuickFilterColName) from the selected message, and adds it to the query,
+// or, if exclude is true, to the exclude pattern; then reruns the query.
+//
+// The lstream column is special since it's not a part of the log line: for it,
+// all the other logstreams get muted (or, if exclude is true, this logstream
+// gets muted).
+func (mv *MainView) quickFilterBySelectedCell(exclude bool) {
+	msg, ok := mv.getSelectedMsg()
+	if !ok {
+		return
+	}
+
+	colName := mv.getQuickFilterColName()
+
+	var val string
+	switch colName {
+	case "":
+		return
+
+	case FieldNameTime:
+		mv.printMsg("Can't filter by time, scroll to another column, or use the histogram to select the time range", nlMsgLevelWarn)
+		return
+
+	case FieldNameFilename, FieldNameLinenumber:
+		mv.printMsg(fmt.Sprintf("Can't filter by %s, it's not a part of the log line", colName), nlMsgLevelWarn)
+		return
+
+	case "lstream":
+		lstream := msg.Context["lstream"]
+
+		var toMute []string
+		if exclude {
+			toMute = []string{lstream}
+		} else {
+			for _, name := range mv.getCurLStreamNames() {
+				if name != lstream {
+					toMute = append(toMute, name)
+				}
+			}
+		}
+
+		if err := mv.muteLStreams(toMute); err != nil {
+			mv.printMsg(err.Error(), nlMsgLevelErr)
+		}
+
+		return
+
+	case core.FieldNameNamedQueries:
+		if msg.Context[core.FieldNameNamedQueries] == "" {
+			mv.printMsg("The selected message doesn't match any named queries", nlMsgLevelWarn)
+			return
+		}
+
+		names := strings.Split(msg.Context[core.FieldNameNamedQueries], ",")
+
+		var err error
+		if exclude {
+			err = mv.removeNamedQueries(names)
+		} else {
+			err = mv.onlyNamedQueries(names)
+		}
+		if err != nil {
+			mv.printMsg(err.Error(), nlMsgLevelErr)
+		}
+
+		return
+
+	default:
+		val = getLogMsgColValue(&msg, colName, mv.msgSplitDelim)
+	}
+
+	if val == "" {
+		mv.printMsg(fmt.Sprintf("No %s in the selected message", colName), nlMsgLevelWarn)
+		return
+	}
+
+	part := getQuickFilterPattern(&msg, colName, val, mv.msgSplitDelim)
+	if exclude {
+		mv.setExclude(addToAwkExclude(mv.exclude, part))
+	} else {
+		mv.setQuery(addToAwkQuery(mv.query, part))
+	}
+
+	mv.doQuery(doQueryParams{})
+}
+
+// togglePIDFilter adds the filter by the process (or thread) id of the
+// selected message to the query (see getPIDFilter), or, if it's already
+// there, removes it; then reruns the query.
+func (mv *MainView) togglePIDFilter() {
+	msg, ok := mv.getSelectedMsg()
+	if !ok {
+		return
+	}
+
+	pattern, field, value, ok := getPIDFilter(&msg)
+	if !ok {
+		mv.printMsg("No pid or tid in the selected message", nlMsgLevelWarn)
+		return
+	}
+
+	query, added := toggleAwkQueryTerm(mv.query, pattern)
+	if added {
+		mv.printMsg(fmt.Sprintf("Filtering by %s %s, press p again to remove the filter", field, value), nlMsgLevelInfo)
+	} else {
+		mv.printMsg(fmt.Sprintf("Removed the filter by %s %s", field, value), nlMsgLevelInfo)
+	}
+
+	mv.setQuery(query)
+	mv.doQuery(doQueryParams{})
+}
+
+func (mv *MainView) getLastQueryDebugInfo() string {
+	if mv.curLogResp == nil {
+		return "-- No query results --"
+	}
+
+	lstreamNames := make([]string, 0, len(mv.curLogResp.DebugInfo))
+	for lstreamName := range mv.curLogResp.DebugInfo {
+		lstreamNames = append(lstreamNames, lstreamName)
+	}
+	sort.Strings(lstreamNames)
+
+	var sb strings.Builder
+
+	for _, lstreamName := range lstreamNames {
+		debugInfo := mv.curLogResp.DebugInfo[lstreamName]
+		if len(debugInfo.AgentStdout) > 0 {
+			if sb.Len() > 0 {
+				sb.WriteString("\n")
+			}
+
+			sb.WriteString(fmt.Sprintf("%s stdout:\n", lstreamName))
+			for _, line := range debugInfo.AgentStdout {
+				sb.WriteString(line)
+				sb.WriteString("\n")
+			}
+		}
+
+		if len(debugInfo.AgentStderr) > 0 {
+			if sb.Len() > 0 {
+				sb.WriteString("\n")
+			}
+
+			sb.WriteString(fmt.Sprintf("%s stderr:\n", lstreamName))
+			for _, line := range debugInfo.AgentStderr {
+				sb.WriteString(line)
+				sb.WriteString("\n")
+			}
+		}
+	}
+
+	ret := sb.String()
+	if ret == "" {
+		ret = "-- No debug info --"
+	}
+
+	return ret
+}
+
+// writeHistogram writes the histogram data in the given format (see
+// writeHistogramExport) to the given writer, using the same binning which is
+// currently displayed. Timestamps are formatted in the currently configured
+// timezone.
+func (mv *MainView) writeHistogram(w io.Writer, format string) error {
+	return errors.Trace(writeHistogramExport(
+		w, format, mv.histogram.GetBins(), mv.params.Options.GetTimezone(),
+	))
+}
+
+// getLogsTSV returns all currently loaded logs as tab-separated values,
+// with the same columns (and in the same order) as shown in the logs table.
+// The first line is the header.
+func (mv *MainView) getLogsTSV() string {
+	if mv.curLogResp == nil {
+		return ""
+	}
+
+	tz := mv.params.Options.GetTimezone()
+	tsvEscape := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+	var sb strings.Builder
+
+	for i := range mv.curColNames {
+		if i > 0 {
+			sb.WriteString("\t")
+		}
+		sb.WriteString(tsvEscape.Replace(mv.logsTable.GetCell(0, mv.logsTableColOffset()+i).Text))
+	}
+	sb.WriteString("\n")
+
+	for _, msg := range mv.curLogResp.Logs {
+		for i, colName := range mv.curColNames {
+			if i > 0 {
+				sb.WriteString("\t")
+			}
+
+			var val string
+			if colName == FieldNameTime {
+				val = msg.Time.In(tz).Format(logsTableTimeLayout)
+			} else {
+				val = getLogMsgColValue(&msg, colName, mv.msgSplitDelim)
+			}
+
+			sb.WriteString(tsvEscape.Replace(val))
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+func (mv *MainView) showLastQueryDebugInfo() {
+	text := mv.getLastQueryDebugInfo()
+
+	mv.showMessagebox("debug", "Debug info for the last query", text, &MessageboxParams{
+		BackgroundColor: tcell.ColorDarkBlue,
+		CopyButton:      true,
+	})
+}
+
+// showLogFormats shows the log format used for every logstream, either
+// configured or detected.
+func (mv *MainView) showLogFormats() {
+	var logFormats map[string]core.LogFormatGuess
+	if mv.curHMState != nil {
+		logFormats = mv.curHMState.LogFormatByLStream
+	}
+
+	mv.showMessagebox("log_formats", "Log formats", tview.Escape(formatLogFormats(logFormats)), &MessageboxParams{
+		BackgroundColor: tcell.ColorDarkBlue,
+		CopyButton:      true,
+	})
+}
+
+// showLStreams shows the logstreams known from the configs (knownText), and
+// if there are any query results, the activity of every logstream over the
+// queried time range, which is kept up to date as the new results arrive.
+func (mv *MainView) showLStreams(knownText string) {
+	mv.lstreamsKnownText = knownText
+
+	hide := func() {
+		mv.lstreamsMsgView.Hide()
+		mv.lstreamsMsgView = nil
+	}
+
+	mv.lstreamsMsgView = mv.showMessagebox("lstreams", "Logstreams", mv.getLStreamsText(), &MessageboxParams{
+		OnButtonPressed: func(label string, idx int) {
+			hide()
+		},
+		OnEsc:           hide,
+		BackgroundColor: tcell.ColorDarkBlue,
+		CopyButton:      true,
+	})
+}
+
+// bumpLStreamsActivity updates the activity in the :lstreams modal, if it's
+// shown.
+func (mv *MainView) bumpLStreamsActivity() {
+	if mv.lstreamsMsgView == nil {
+		return
+	}
+
+	mv.lstreamsMsgView.SetText(mv.getLStreamsText(), true)
+}
+
+func (mv *MainView) getLStreamsText() string {
+	var activity string
+	if mv.curLogResp != nil && !mv.histFrom.IsZero() {
+		activity = formatLStreamsActivity(mv.curLogResp.MinuteStatsByLStream, mv.histFrom, mv.histTo)
+	}
+
+	if activity == "" {
+		return mv.lstreamsKnownText
+	}
+
+	return "Activity over the queried time range:\n\n" + activity + "\n" + mv.lstreamsKnownText
+}
+
+// showLStreamsStateDebugInfo shows the full current state of the logstreams
+// manager, which is otherwise only summarized in the status line.
+func (mv *MainView) showLStreamsStateDebugInfo() {
+	text := tview.Escape(formatLStreamsManagerState(mv.curHMState))
+
+	mv.showMessagebox("debugLStreams", "Logstreams state", text, &MessageboxParams{
+		BackgroundColor: tcell.ColorDarkBlue,
+		CopyButton:      true,
+	})
+}
+
+// showLStreamInfo shows how the given logstream is accessed, along with its
+// current state; see formatLStreamInfo.
+func (mv *MainView) showLStreamInfo(name string, auth sshAuthInfo) {
+	text := tview.Escape(formatLStreamInfo(name, mv.curHMState, auth))
+
+	mv.showMessagebox("lstreamInfo", "Logstream "+tview.Escape(name), text, &MessageboxParams{
+		BackgroundColor: tcell.ColorDarkBlue,
+		CopyButton:      true,
+	})
+}
+
+func (mv *MainView) formatLogs() {
+	resp := mv.curLogResp
+	if resp == nil {
+		resp = &core.LogRespTotal{}
+	}
+
+	histogramData := make(map[int]int, len(resp.MinuteStats))
+	for k, v := range resp.MinuteStats {
+		histogramData[int(k)] = v.NumMsgs
+	}
+
+	mv.histogram.SetData(histogramData)
+	mv.histogram.SetErrorData(getHistogramErrorData(resp.Logs, histogramBinSize))
+	mv.histogram.SetGapMinLen(mv.getGapMinLen())
+
+	mv.statsFrom, mv.statsTo = getMinuteStatsRange(resp.MinuteStats)
+	mv.bumpHistogramRange(false)
+	mv.bumpLStreamsActivity()
+
+	// If the reverse option has just been changed, the same message will have
+	// to be selected in its new row.
+	reverse := mv.params.Options.GetReverse()
+	selectedRow, _ := mv.logsTable.GetSelection()
+	selectedDR, hasSelected := mv.logsTableContent.getDedupRow(selectedRow)
+	reverseChanged := reverse != mv.logsTableContent.reverse
+
+	mv.logsTable.Clear()
+
+	// Update existingTagNames
+	mv.existingTagNames = map[string]struct{}{
+		FieldNameTime:    {},
+		FieldNameMessage: {},
+	}
+	for _, msg := range resp.Logs {
+		for name := range msg.Context {
+			mv.existingTagNames[name] = struct{}{}
+		}
+	}
+
+	// Update table header
+	colNames := mv.updateTableHeader(resp.Logs)
+	mv.curColNames = colNames
+
+	if !resp.CountOnly {
+		mv.logsTable.SetCell(
+			rowIdxLoadOlder, 0,
+			newTableCellButton("< MOAR ! >"),
+		)
+	} else {
+		// Nothing older to load in the count-only mode; instead, the same row
+		// fetches the lines for the current range. The hint goes to the message
+		// column, since it's the only one wide enough.
+		mv.logsTable.SetCell(
+			rowIdxLoadOlder, 0,
+			newTableCellButton("< FETCH >"),
+		)
+
+		for i, colName := range colNames {
+			if colName == FieldNameMessage {
+				mv.logsTable.SetCell(
+					rowIdxLoadOlder, i+mv.logsTableColOffset(),
+					tview.NewTableCell("Count-only mode: narrow the range on the histogram, or press Enter here to fetch the lines").
+						SetTextColor(tcell.ColorGray),
+				)
+			}
+		}
+	}
+
+	// The data rows aren't populated here: the cells are created on the fly
+	// by logsTableContent, only for the rows being drawn.
+	mv.logsTableContent.setLogs(
+		resp.Logs, colNames,
+		mv.params.Options.GetTimezone(), mv.params.Options.GetShowLineNumbers(),
+	)
+	mv.logsTableContent.setColumnColors(mv.params.Options.GetColumnColors())
+	mv.logsTableContent.setColumnFormats(mv.params.Options.GetColumnFormats())
+	mv.logsTableContent.setMsgSplitDelim(mv.msgSplitDelim)
+	mv.logsTableContent.setRawMessage(mv.getRawMessage())
+
+	mv.logsTableContent.setAnnotated(mv.params.Annotations.getAnnotatedMsgIdxs(resp.Logs))
+
+	if mv.search != nil {
+		mv.search.updateMatches(resp.Logs, mv.getRawMessage())
+		mv.logsTableContent.setSearchRegexp(mv.search.re)
+	} else {
+		mv.logsTableContent.setSearchRegexp(nil)
+	}
+
+	// The defaultqueries, minimap and histogram options might have been
+	// changed.
+	mv.bumpDefaultQueriesLabel()
+	mv.bumpMinimap()
+	mv.bumpHistogram()
+	mv.logsTableContent.setReverse(reverse)
+	mv.logsTableContent.setDedup(mv.params.Options.GetDedup(), mv.dedupExpanded)
+	mv.logsTableContent.setWrapWidth(mv.getLogsWrapWidth())
+
+	if reverseChanged {
+		if hasSelected {
+			mv.logsTable.Select(mv.logsTableContent.getRowByMsgIdx(selectedDR.msgIdx), 0)
+		} else {
+			mv.logsTable.Select(mv.logsTableContent.getLatestRow(), 0)
+		}
+	}
+
+	mv.bumpStatusLineLeft()
+	mv.bumpStatusLineRight()
+}
+
+// getLogsWrapWidth returns the width to wrap the messages in the logs table
+// at, or 0 if they shouldn't be wrapped.
+func (mv *MainView) getLogsWrapWidth() int {
+	if !mv.params.Options.GetWrap() {
+		return 0
+	}
+
+	tableWidth := mv.screenWidth
+	if mv.params.Options.GetShowMinimap() {
+		tableWidth--
+	}
+
+	return mv.logsTableContent.getMsgWrapWidth(tableWidth)
+}
+
+// bumpLogsWrap re-wraps the messages in the logs table as per the wrap option
+// and the current screen width, keeping the same message selected, and at the
+// same position on the screen.
+func (mv *MainView) bumpLogsWrap() {
+	row, col := mv.logsTable.GetSelection()
+	offsetRow, offsetCol := mv.logsTable.GetOffset()
+	dr, ok := mv.logsTableContent.getDedupRow(row)
+
+	mv.logsTableContent.setWrapWidth(mv.getLogsWrapWidth())
+
+	if !ok {
+		return
+	}
+
+	newRow := mv.logsTableContent.getRowByMsgIdx(dr.msgIdx)
+	newOffsetRow := newRow - (row - offsetRow)
+	if newOffsetRow < 0 {
+		newOffsetRow = 0
+	}
+
+	mv.logsTable.SetOffset(newOffsetRow, offsetCol)
+	mv.logsTable.Select(newRow, col)
+	mv.bumpStatusLineRight()
+}
+
+// selectLinkedLogMsg is called when the histogram cursor moves to the range
+// [from, to); if the linkcursor option is on, it selects the first message
+// in that range in the logs table. Since the table isn't focused at this
+// point, it doesn't scroll to the selection by itself, so the selected row
+// is also scrolled to the middle of the table explicitly.
+func (mv *MainView) selectLinkedLogMsg(from, to int) {
+	if !mv.params.Options.GetLinkCursor() || mv.curLogResp == nil {
+		return
+	}
+
+	msgIdx, ok := findFirstLogMsgIn(mv.curLogResp.Logs, time.Unix(int64(from), 0), time.Unix(int64(to), 0))
+	if !ok {
+		return
+	}
+
+	row := mv.logsTableContent.getRowByMsgIdx(msgIdx)
+
+	_, offsetCol := mv.logsTable.GetOffset()
+	_, _, _, height := mv.logsTable.GetInnerRect()
+	newOffsetRow := row - height/2
+	if newOffsetRow < 0 {
+		newOffsetRow = 0
+	}
+
+	mv.logsTable.SetOffset(newOffsetRow, offsetCol)
+	mv.logsTable.Select(row, 0)
+}
+
+// showHistogramBinInfo is called when the histogram cursor moves to the range
+// [from, to), and prints the number of messages in that range, along with the
+// breakdown by level of the loaded ones.
+func (mv *MainView) showHistogramBinInfo(from, to int) {
+	if mv.curLogResp == nil {
+		return
+	}
+
+	tz := mv.params.Options.GetTimezone()
+	mv.printMsg(formatHistogramBinInfo(
+		time.Unix(int64(from), 0).In(tz), time.Unix(int64(to), 0).In(tz),
+		mv.curLogResp.MinuteStats, mv.curLogResp.Logs,
+	), nlMsgLevelInfo)
+}
+
+// toggleWrap toggles the wrap option, and re-wraps the messages right away.
+func (mv *MainView) toggleWrap() {
+	var wrap bool
+	mv.params.Options.Call(func(o *Options) {
+		o.Wrap = !o.Wrap
+		wrap = o.Wrap
+	})
+
+	mv.bumpLogsWrap()
+
+	switch {
+	case !wrap:
+		mv.printMsg("Wrapping off", nlMsgLevelInfo)
+	case mv.logsTableContent.wrapWidth == 0:
+		mv.printMsg("Wrapping on, but the other columns leave no room for the messages", nlMsgLevelWarn)
+	default:
+		mv.printMsg("Wrapping on", nlMsgLevelInfo)
+	}
+}
+
+// logsTableColOffset returns the index of the first column in the logs table
+// which contains a log message field: if row numbers are shown, it's 1,
+// otherwise 0.
+func (mv *MainView) logsTableColOffset() int {
+	if mv.params.Options.GetShowLineNumbers() {
+		return 1
+	}
+
+	return 0
+}
+
+// getStatusLineData returns the values which can be shown in the status line.
+func (mv *MainView) getStatusLineData() *statusLineData {
+	lsmanState := mv.curHMState
+	if lsmanState == nil {
+		// We haven't received a single HMState update, so just use the zero value.
+		lsmanState = &core.LStreamsManagerState{}
+	}
+
+	data := &statusLineData{
+		NumIdle:     len(lsmanState.LStreamsByState[core.LStreamClientStateConnectedIdle]),
+		NumBusy:     len(lsmanState.LStreamsByState[core.LStreamClientStateConnectedBusy]),
+		NumUnused:   len(lsmanState.LStreamsByState[core.LStreamClientStateIdleDisconnected]),
+		NumLStreams: lsmanState.NumLStreams,
+
+		LStreams:  tview.Escape(mv.lstreamsSpec),
+		Muted:     tview.Escape(strings.Join(mv.mutedLStreams, ", ")),
+		Union:     tview.Escape(strings.Join(mv.getNamedQueryNames(), ", ")),
+		Query:     tview.Escape(mv.query),
+		Exclude:   tview.Escape(mv.exclude),
+		TimeRange: tview.Escape(mv.getTimeRangeStr()),
+
+		Tab:     mv.tabs.cur + 1,
+		NumTabs: len(mv.tabs.tabs),
+
+		Frozen:        mv.params.Options.GetFreeze(),
+		FrozenPending: mv.frozenLogResp != nil,
+	}
+
+	if mv.lineRange != nil {
+		data.LineRange = tview.Escape(fmt.Sprintf(
+			"%s:%d-%d", mv.lineRange.File, mv.lineRange.From, mv.lineRange.To,
+		))
+	}
+	data.NumOther = data.NumLStreams - data.NumIdle - data.NumBusy - data.NumUnused
+
+	if lsmanState.NoMatchingLStreams {
+		data.State = "none"
+	} else if !lsmanState.Connected {
+		data.State = "conn"
+	} else if lsmanState.Busy {
+		data.State = "busy"
+	} else {
+		data.State = "idle"
+	}
+
+	selectedRow, _ := mv.logsTable.GetSelection()
+	if dr, ok := mv.logsTableContent.getDedupRow(selectedRow); ok {
+		data.Selected = dr.msgIdx + 1
+	}
+
+	if s := mv.search; s != nil {
+		data.SearchMatch = fmt.Sprintf("-/%d", len(s.matches))
+		if k, ok := s.getMatchNum(data.Selected - 1); ok {
+			data.SearchMatch = fmt.Sprintf("%d/%d", k+1, len(s.matches))
+		}
+	}
+
+	if mv.curLogResp != nil {
+		data.Loaded = len(mv.curLogResp.Logs)
+		data.Total = mv.curLogResp.NumMsgsTotal
+		data.Truncated = mv.curLogResp.Truncated
+		data.NumWarnings = getNumWarnings(mv.curLogResp.WarningsByLStream)
+		data.NumQuiet = len(mv.getQuietLStreams())
+		data.NumTripped = getNumTrippedWatches(mv.watches)
+	}
+
+	return data
+}
+
+func (mv *MainView) bumpStatusLineLeft() {
+	data := mv.getStatusLineData()
+
+	if tmpl := mv.params.Options.GetStatusLineLeft(); tmpl != nil {
+		mv.statusLineLeft.SetText(tmpl.render(data))
+		return
+	}
+
+	sb := strings.Builder{}
+
+	if data.State == "none" {
+		sb.WriteString("[red]none[-] ")
+	} else {
+		sb.WriteString(data.State)
+		sb.WriteString(" ")
+	}
+
+	sb.WriteString(getStatuslineNumStr("🖳", data.NumIdle, "green"))
+	sb.WriteString(" ")
+	sb.WriteString(getStatuslineNumStr("🖳", data.NumBusy, "orange"))
+	sb.WriteString(" ")
+	sb.WriteString(getStatuslineNumStr("🖳", data.NumOther, "red"))
+
+	// The ones disconnected due to the idle timeout are only shown if there
+	// are any, since the idle timeout is off by default.
+	if data.NumUnused > 0 {
+		sb.WriteString(" ")
+		sb.WriteString(getStatuslineNumStr("🖳", data.NumUnused, "gray"))
+	}
+
+	sb.WriteString(" | ")
+	sb.WriteString(data.LStreams)
+
+	// If there are groups, the spec alone doesn't tell how many logstreams
+	// there are, so show that too.
+	if mv.lstreamsSpecHasGroups() {
+		sb.WriteString(fmt.Sprintf(" (%d lstreams)", data.NumLStreams))
+	}
+
+	if data.LineRange != "" {
+		sb.WriteString(" | [yellow]lines:[-] ")
+		sb.WriteString(data.LineRange)
+	}
+
+	if data.NumTabs > 1 {
+		sb.WriteString(fmt.Sprintf(" | [yellow]tab:[-] %d/%d", data.Tab, data.NumTabs))
+	}
+
+	if data.Muted != "" {
+		sb.WriteString(" | [yellow]muted:[-] ")
+		sb.WriteString(data.Muted)
+	}
+
+	if data.Union != "" {
+		sb.WriteString(" | [yellow]union:[-] ")
+		sb.WriteString(data.Union)
+	}
+
+	if data.Exclude != "" {
+		sb.WriteString(" | [yellow]excluding:[-] ")
+		sb.WriteString(data.Exclude)
+	}
+
+	mv.statusLineLeft.SetText(sb.String())
+}
+
+func (mv *MainView) bumpStatusLineRight() {
+	data := mv.getStatusLineData()
+
+	if tmpl := mv.params.Options.GetStatusLineRight(); tmpl != nil {
+		mv.statusLineRight.SetText(tmpl.render(data))
+		return
+	}
+
+	selectedRowStr := "-"
+	if data.Selected >= 1 {
+		selectedRowStr = strconv.Itoa(data.Selected)
+	}
+
+	if mv.curLogResp != nil {
+		numLoadedStr := strconv.Itoa(data.Loaded)
+		if data.Truncated {
+			// Make it visible that not everything is loaded
+			numLoadedStr = fmt.Sprintf("[yellow::b]%s![-::-]", numLoadedStr)
+		}
+
+		var warningsStr string
+		if data.NumWarnings > 0 {
+			warningsStr = fmt.Sprintf("[yellow]%s[-] | ", formatNumWarnings(data.NumWarnings))
+		}
+
+		var quietStr string
+		if data.NumQuiet > 0 {
+			quietStr = fmt.Sprintf("[yellow]%d quiet[-] | ", data.NumQuiet)
+		}
+
+		var frozenStr string
+		if data.Frozen {
+			frozenStr = "[black:lightblue]frozen[-:-] | "
+			if data.FrozenPending {
+				frozenStr = "[black:lightblue]frozen, new data pending[-:-] | "
+			}
+		}
+
+		var trippedStr string
+		if data.NumTripped > 0 {
+			trippedStr = fmt.Sprintf("[white:red:bl]%d tripped[-:-:-] | ", data.NumTripped)
+		}
+
+		var searchStr string
+		if data.SearchMatch != "" {
+			searchStr = fmt.Sprintf("[black:yellow]/[-:-]%s | ", data.SearchMatch)
+		}
+
+		mv.statusLineRight.SetText(fmt.Sprintf(
+			"%s%s%s%s%s%s / %s / %d",
+			frozenStr, searchStr, trippedStr, warningsStr, quietStr, selectedRowStr, numLoadedStr, data.Total,
+		))
+	} else {
+		mv.statusLineRight.SetText("-")
+	}
+}
+
+func (mv *MainView) bumpHistogramExternalCursor(row int) {
+	// For the "load older" row, use the oldest message next to it.
+	if row == mv.logsTableContent.getLoadOlderRow() {
+		if mv.logsTableContent.reverse {
+			row -= 1
+		} else {
+			row += 1
+		}
+	}
+
+	firstCell := mv.logsTable.GetCell(row, 0)
+	if firstCell == nil {
+		return
+	}
+
+	msg, ok := firstCell.GetReference().(core.LogMsg)
+	if !ok {
+		return
+	}
+	mv.histogram.SetExternalCursor(int(msg.Time.Unix()))
+}
+
+func newTableCellHeader(text string) *tview.TableCell {
+	return tview.NewTableCell(text).
+		SetTextColor(tcell.ColorLightBlue).
+		SetAttributes(tcell.AttrBold).
+		SetAlign(tview.AlignLeft).
+		SetSelectable(false)
+}
+
+func newTableCellLogmsg(text string) *tview.TableCell {
+	return tview.NewTableCell(text).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignLeft)
+}
+
+func newTableCellButton(text string) *tview.TableCell {
+	return tview.NewTableCell(text).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignCenter)
+}
+
+func (mv *MainView) setQuery(q string) {
+	if mv.queryInput.GetText() != q {
+		mv.queryInput.SetText(q)
+	}
+	mv.query = q
+}
+
+func (mv *MainView) setExclude(exclude string) {
+	mv.exclude = exclude
+	mv.bumpStatusLineLeft()
+}
+
+func (mv *MainView) setSelectQuery(sqp *SelectQueryParsed) {
+	mv.selectQuery = sqp
+}
+
+func (mv *MainView) setTimeRange(from, to TimeOrDur) {
+	if from.IsZero() {
+		// TODO: maybe better error handling
+		panic("from can't be zero")
+	}
+
+	mv.from = from
+	mv.to = to
+
+	mv.formatTimeRange()
+}
+
+// setTimeRangeFrom parses the given start of the time range (see
+// parseTimeRangeEndpoint), and sets it, while keeping the end as it is.
+func (mv *MainView) setTimeRangeFrom(s string) error {
+	from, err := parseTimeRangeEndpoint(mv.params.Options.GetTimezone(), s, mv.to, mv.getNow())
+	if err != nil {
+		return errors.Annotatef(err, "invalid 'from' time")
+	}
+
+	mv.setTimeRange(from, mv.to)
+
+	return nil
+}
+
+// setTimeRangeTo is like setTimeRangeFrom, but for the end of the time range;
+// "now" (or an empty string) means that the range has no end.
+func (mv *MainView) setTimeRangeTo(s string) error {
+	if s == "" || s == "now" {
+		mv.setTimeRange(mv.from, TimeOrDur{})
+		return nil
+	}
+
+	to, err := parseTimeRangeEndpoint(mv.params.Options.GetTimezone(), s, mv.from, mv.getNow())
+	if err != nil {
+		return errors.Annotatef(err, "invalid 'to' time")
+	}
+
+	mv.setTimeRange(mv.from, to)
+
+	return nil
+}
+
+func (mv *MainView) formatTimeRange() {
+	tz := mv.params.Options.GetTimezone()
+	mv.from = mv.from.In(tz)
+	mv.to = mv.to.In(tz)
+
+	mv.bumpTimeRange(false)
+
+	mv.bumpTimeLabel()
+}
+
+// bumpTimeLabel updates the time range label next to the query input, making
+// it shorter if the screen is too narrow for it; see fitTimeRangeStr.
+func (mv *MainView) bumpTimeLabel() {
+	maxWidth := -1
+	if mv.screenWidth > 0 {
+		maxWidth = mv.screenWidth - topFlexFixedWidth - minQueryInputWidth -
+			tview.TaggedStringWidth(mv.defaultQueriesLabel.GetText(false))
+		if maxWidth < 0 {
+			maxWidth = 0
+		}
+	}
+
+	timeStr := fitTimeRangeStr(mv.getTimeRangeStr(), maxWidth)
+
+	mv.timeLabel.SetText(timeStr)
+	mv.topFlex.ResizeItem(mv.timeLabel, tview.TaggedStringWidth(timeStr), 0)
+}
+
+// onScreenResize is called before drawing, when the screen size has changed
+// (including the very first draw), to adapt the layout to the new size.
+func (mv *MainView) onScreenResize() {
+	mv.bumpTimeLabel()
+
+	// The column widths are recomputed on every draw anyway, but the selected
+	// row might end up out of view after the table has shrunk, so make the
+	// table scroll to it again.
+	row, col := mv.logsTable.GetSelection()
+	mv.logsTable.Select(row, col)
+
+	// The wrapped messages need to be re-wrapped for the new width.
+	if mv.params.Options.GetWrap() {
+		mv.bumpLogsWrap()
+	}
+}
+
+// getGapMinLen returns the minimum length of a gap in the logs coverage, in
+// seconds, to be used by the histogram. Zero means gaps should not be
+// detected: either it's disabled, or there's no data to detect them in.
+func (mv *MainView) getGapMinLen() int {
+	// Without the logs response, everything would look like a gap; and in the
+	// line range mode, the time range doesn't matter.
+	if mv.curLogResp == nil || mv.lineRange != nil {
+		return 0
+	}
+
+	return int(mv.params.Options.GetGapThreshold().Seconds())
+}
+
+// showGaps shows the gaps in the logs coverage within the current time range,
+// as detected by the histogram.
+func (mv *MainView) showGaps() {
+	if mv.getGapMinLen() == 0 {
+		mv.printMsg("Gaps detection is disabled (see :set gapthreshold), or there are no logs yet", nlMsgLevelErr)
+		return
+	}
+
+	gaps := mv.histogram.GetGaps()
+	if len(gaps) == 0 {
+		mv.printMsg(
+			fmt.Sprintf("No gaps of at least %s", formatDuration(mv.params.Options.GetGapThreshold())),
+			nlMsgLevelInfo,
+		)
+		return
+	}
+
+	tz := mv.params.Options.GetTimezone()
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(
+		"Periods of at least %s without any logs:\n\n",
+		formatDuration(mv.params.Options.GetGapThreshold()),
+	))
+	for _, gap := range gaps {
+		from := time.Unix(int64(gap.From), 0).In(tz)
+		to := time.Unix(int64(gap.To), 0).In(tz)
+		sb.WriteString(fmt.Sprintf(
+			"%s to %s (%s)\n",
+			from.Format(inputTimeLayout), to.Format(inputTimeLayout), formatDuration(to.Sub(from)),
+		))
+	}
+
+	mv.showMessagebox("gaps", "Gaps in the logs", sb.String(), &MessageboxParams{
+		CopyButton: true,
+	})
+}
+
+// getTimeRangeStr returns the current time range formatted for the user,
+// like "last 1h".
+func (mv *MainView) getTimeRangeStr() string {
+	if mv.from.IsZero() {
+		// The time range isn't set yet.
+		return ""
+	}
+
+	rangeDur := mv.actualTo.Sub(mv.actualFrom)
+
+	// For the absolute times, show them after rounding (see bumpTimeRange),
+	// so it's clear which range is actually queried; e.g. when
+	// selecting a range on the histogram, the selection might be not aligned.
+	tz := mv.params.Options.GetTimezone()
+	fromStr := mv.from.Format(inputTimeLayout)
+	if mv.from.IsAbsolute() {
+		fromStr = mv.actualFrom.In(tz).Format(inputTimeLayout)
+	}
+
+	if !mv.to.IsZero() {
+		toStr := mv.to.Format(inputTimeLayout)
+		if mv.to.IsAbsolute() {
+			toStr = mv.actualTo.In(tz).Format(inputTimeLayout)
+		}
+
+		return fmt.Sprintf("%s%s to %s (%s)", mv.getAnchoredNowStr(), fromStr, toStr, formatDuration(rangeDur))
+	} else if mv.from.IsAbsolute() {
+		return fmt.Sprintf("%s%s to now (%s)", mv.getAnchoredNowStr(), fromStr, formatDuration(rangeDur))
+	}
+
+	return fmt.Sprintf("%slast %s", mv.getAnchoredNowStr(), TimeOrDur{Dur: -mv.from.Dur})
+}
+
+// getAnchoredNowStr returns the prefix for the time range string which tells
+// that the time is anchored with ":anchor", like "anchored Mar10 10:00, ";
+// empty if it's not anchored.
+func (mv *MainView) getAnchoredNowStr() string {
+	if mv.anchoredNow.IsZero() {
+		return ""
+	}
+
+	tz := mv.params.Options.GetTimezone()
+	return fmt.Sprintf("anchored %s, ", mv.anchoredNow.In(tz).Format(inputTimeLayout))
+}
+
+// getNow returns the instant which the relative time ranges are resolved
+// against: the anchored one, if the time is anchored with ":anchor", or the
+// current time otherwise.
+func (mv *MainView) getNow() time.Time {
+	if !mv.anchoredNow.IsZero() {
+		return mv.anchoredNow
+	}
+
+	return time.Now()
+}
+
+// anchorNow makes the relative time ranges resolve against the current
+// instant from now on, until unanchorNow is called, so that re-running a
+// query like "-1h" gives exactly the same window. The current query is
+// rerun, so that its range is resolved against the anchored instant too.
+func (mv *MainView) anchorNow() {
+	mv.anchoredNow = time.Now()
+
+	tz := mv.params.Options.GetTimezone()
+	mv.printMsg(fmt.Sprintf(
+		"Time anchored at %s; relative time ranges end there until :unanchor",
+		mv.anchoredNow.In(tz).Format(inputTimeLayout),
+	), nlMsgLevelInfo)
+
+	if !mv.from.IsZero() {
+		mv.doQuery(doQueryParams{})
+	}
+}
+
+// unanchorNow undoes anchorNow and reruns the current query; it returns
+// whether the time was anchored.
+func (mv *MainView) unanchorNow() bool {
+	if mv.anchoredNow.IsZero() {
+		return false
+	}
+
+	mv.anchoredNow = time.Time{}
+
+	if !mv.from.IsZero() {
+		mv.doQuery(doQueryParams{})
+	}
+
+	return true
+}
+
+// bumpTimeRange only does something useful if the time is relative to current time.
+func (mv *MainView) bumpTimeRange(updateHistogramRange bool) {
+	if mv.from.IsZero() {
+		panic("should never be here")
+	}
+
+	// Since relative durations are relative to current time, only negative values are
+	// meaningful, so if it's positive, reverse it.
+
+	if !mv.from.IsAbsolute() && mv.from.Dur > 0 {
+		mv.from.Dur = -mv.from.Dur
+	}
+
+	if !mv.to.IsAbsolute() && mv.to.Dur > 0 {
+		mv.to.Dur = -mv.to.Dur
+	}
+
+	now := mv.getNow()
+	mv.actualFrom = mv.from.AbsoluteTime(now)
+
+	if !mv.to.IsZero() {
+		mv.actualTo = mv.to.AbsoluteTime(now)
+		mv.actualToForQuery = mv.actualTo
+	} else if !mv.anchoredNow.IsZero() {
+		// The time is anchored, so the range has to end at the anchored instant
+		// instead of being open-ended.
+		mv.actualTo = now
+		mv.actualToForQuery = now
+	} else {
+		mv.actualTo = now
+		mv.actualToForQuery = time.Time{}
+	}
+
+	// Round both actualFrom and actualTo according to the timeround and
+	// timegranularity options; by default, to the 1m grid, forward.
+	rounding := mv.params.Options.GetTimeRounding()
+	mv.actualFrom = rounding.round(mv.actualFrom)
+	mv.actualTo = rounding.round(mv.actualTo)
+	if !mv.actualToForQuery.IsZero() {
+		mv.actualToForQuery = rounding.round(mv.actualToForQuery)
+	}
+
+	// If from is after than to, swap them.
+	if mv.actualFrom.After(mv.actualTo) {
+		mv.actualFrom, mv.actualTo = mv.actualTo, mv.actualFrom
+
+		// Sanity check: mv.actualToForQuery can never be zero in this case.
+		if mv.actualToForQuery.IsZero() {
+			panic("actualToForQuery is zero while actualFrom is after actualTo")
+		}
+	}
+
+	// Also update the histogram
+	if updateHistogramRange {
+		mv.histFrom, mv.histTo = rounding.roundHistogramRange(mv.actualFrom, mv.actualTo)
+		mv.bumpHistogramRange(true)
+	}
+}
+
+// bumpHistogramRange sets the histogram range according to the histrange
+// option: either the range of the last query, or only the part of it where
+// the logs are. Unless reset is true, the histogram is left intact if the
+// range doesn't change, so that its cursor and selection are preserved.
+func (mv *MainView) bumpHistogramRange(reset bool) {
+	if mv.histFrom.IsZero() {
+		// No query yet.
+		return
+	}
+
+	from, to := mv.histFrom, mv.histTo
+	if mv.params.Options.GetHistogramRange() == histRangeData {
+		granularity := mv.params.Options.GetTimeRounding().getGranularity()
+		from, to = narrowHistogramRange(from, to, mv.statsFrom, mv.statsTo, granularity)
+	}
+
+	curFrom, curTo := mv.histogram.GetRange()
+	if !reset && curFrom == int(from.Unix()) && curTo == int(to.Unix()) {
+		return
+	}
+
+	mv.histogram.SetRange(int(from.Unix()), int(to.Unix()))
+}
+
+// addLogExtractor adds (or replaces, if there is one with the same name
+// already) the extractor, applies it to the logs which are already loaded,
+// and adds the extracted field as a column, unless it's there already.
+func (mv *MainView) addLogExtractor(le logExtractor) {
+	mv.removeLogExtractor(le.name)
+	mv.logExtractors = append(mv.logExtractors, le)
+
+	if mv.curLogResp != nil {
+		applyLogExtractors(mv.curLogResp.Logs, mv.logExtractors)
+	}
+
+	hasField := false
+	for _, fld := range mv.selectQuery.Fields {
+		if fld.Name == le.name {
+			hasField = true
+			break
+		}
+	}
+
+	if !hasField {
+		sqp := *mv.selectQuery
+		sqp.Fields = append(append([]SelectQueryField(nil), sqp.Fields...), SelectQueryField{
+			Name:        le.name,
+			DisplayName: le.name,
+		})
+		mv.setSelectQuery(&sqp)
+	}
+
+	mv.formatLogs()
+}
+
+// removeLogExtractor removes the extractor with the given name, and returns
+// whether there was one. The column, if any, stays in place.
+func (mv *MainView) removeLogExtractor(name string) bool {
+	for i, le := range mv.logExtractors {
+		if le.name == name {
+			mv.logExtractors = append(mv.logExtractors[:i:i], mv.logExtractors[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// setMsgSplitDelim sets the delimiter to split the messages by into multiple
+// columns, for display only; empty delim gets back to the single message
+// column.
+func (mv *MainView) setMsgSplitDelim(delim string) {
+	mv.msgSplitDelim = delim
+	mv.formatLogs()
+}
+
+// defaultTailAutoRefresh is the autorefresh interval which tail sets if the
+// autorefresh is disabled.
+const defaultTailAutoRefresh = 5 * time.Second
+
+// tail sets the time range to the last minute, enables the autorefresh so
+// that the logs keep being followed, and runs the query. If interval is zero,
+// the current autorefresh interval is kept, or defaultTailAutoRefresh is used
+// if it's disabled.
+func (mv *MainView) tail(interval time.Duration) {
+	mv.params.Options.Call(func(o *Options) {
+		if interval != 0 {
+			o.AutoRefresh = interval
+		} else if o.AutoRefresh == 0 {
+			o.AutoRefresh = defaultTailAutoRefresh
+		}
+	})
+
+	mv.setTimeRange(TimeOrDur{Dur: -1 * time.Minute}, TimeOrDur{})
+	mv.doQuery(doQueryParams{})
+}
+
+// setTimeRangeFromHistogram sets the time range to exactly what the histogram
+// shows (which is the range of the last applied query, so e.g. for a relative
+// range like "-1h", it's the absolute range as of the time of the query), and
+// reruns the query.
+func (mv *MainView) setTimeRangeFromHistogram() {
+	from, to := mv.histogram.GetRange()
+	if from == 0 && to == 0 {
+		mv.printMsg("No histogram yet", nlMsgLevelErr)
+		return
+	}
+
+	// The histogram range comes from bumpTimeRange, so it's already rounded;
+	// but round it the same way anyway, so that the query range always
+	// matches the bins exactly.
+	tz := mv.params.Options.GetTimezone()
+	rounding := mv.params.Options.GetTimeRounding()
+	fromTime := rounding.round(time.Unix(int64(from), 0)).In(tz)
+	toTime := rounding.round(time.Unix(int64(to), 0)).In(tz)
+
+	mv.setTimeRange(TimeOrDur{Time: fromTime}, TimeOrDur{Time: toTime})
+	mv.doQuery(doQueryParams{})
+}
+
+// queryAround sets the time range to the given duration before and after the
+// selected message, extended outward to the timegranularity grid (regardless
+// of the timeround mode, so that the message's surroundings are always
+// covered), and reruns the query: it shows what was happening around that
+// message.
+func (mv *MainView) queryAround(dur time.Duration) {
+	msg, ok := mv.getSelectedMsg()
+	if !ok {
+		mv.printMsg("No message selected", nlMsgLevelErr)
+		return
+	}
+
+	rounding := mv.params.Options.GetTimeRounding()
+	fromTime := rounding.floor(msg.Time.Add(-dur))
+	toTime := rounding.ceil(msg.Time.Add(dur))
+
+	mv.setTimeRange(TimeOrDur{Time: fromTime}, TimeOrDur{Time: toTime})
+	mv.doQuery(doQueryParams{})
+}
+
+// showCommandPalette shows a filterable list of all commands; once the user
+// picks one, it's run right away, or, if it requires args, the command line is
+// focused with the command name prefilled, so the user can type them.
+func (mv *MainView) showCommandPalette() {
+	cpv := NewCommandPaletteView(mv, &CommandPaletteViewParams{
+		Commands: allCommands,
+		OnSelected: func(ci cmdInfo) {
+			if ci.RequiresArgs() {
+				mv.focusCmdline()
+				mv.cmdInput.SetText(":" + ci.Name + " ")
+				return
+			}
+
+			mv.params.OnCmd(ci.Name, CmdOpts{})
+		},
+	})
+	cpv.Show()
+}
+
+// showTimeRangePresets shows a dialog with time range presets like "1h" or
+// "Today"; once the user picks one, it's applied and the query is rerun.
+func (mv *MainView) showTimeRangePresets() {
+	msgID := "timeRangePresets"
+
+	var msgv *MessageView
+	msgv = mv.showMessagebox(
+		msgID,
+		"Time range presets",
+		"Choose the time range ("+mv.timezoneStr(time.Now())+"), or press Esc to cancel",
+		&MessageboxParams{
+			Buttons: getTimeRangePresetTitles(),
+			OnButtonPressed: func(label string, idx int) {
+				msgv.Hide()
+
+				tz := mv.params.Options.GetTimezone()
+				from, to := timeRangePresets[idx].GetRange(mv.getNow().In(tz))
+
+				mv.setTimeRange(from, to)
+				mv.doQuery(doQueryParams{})
+			},
+			Width: 90,
+		},
+	)
+}
+
+func (mv *MainView) SetTimeRange(from, to TimeOrDur) {
+	mv.params.App.QueueUpdateDraw(func() {
+		mv.setTimeRange(from, to)
+	})
+}
+
+func (mv *MainView) setLStreams(s string) {
+	mv.lstreamsSpec = s
+
+	if s != "" && mv.params.RecentLStreams != nil {
+		if err := mv.params.RecentLStreams.Add(s); err != nil {
+			mv.params.Logger.Errorf("Failed to save recent logstreams: %s", err.Error())
+		}
+	}
+}
+
+// showRecentLStreams shows the quick switcher with the recently used
+// logstreams filters; when the user picks one, it's applied and the query is
+// rerun.
+func (mv *MainView) showRecentLStreams() {
+	var specs []string
+	if mv.params.RecentLStreams != nil {
+		specs = mv.params.RecentLStreams.Get()
+	}
+
+	if len(specs) == 0 {
+		mv.printMsg("No recent logstreams yet", nlMsgLevelWarn)
+		return
+	}
+
+	rlv := NewRecentLStreamsView(mv, &RecentLStreamsViewParams{
+		Specs: specs,
+		OnSelected: func(spec string) {
+			qf := mv.getQueryFull()
+			qf.LStreams = spec
+
+			if err := mv.applyQueryEditData(qf, doQueryParams{}); err != nil {
+				mv.printMsg(err.Error(), nlMsgLevelErr)
+			}
+		},
+	})
+	rlv.Show()
+}
+
+func (mv *MainView) setLStreamGroups(groups core.ConfigLStreamGroups) {
+	mv.lstreamGroups = groups
+	mv.bumpStatusLineLeft()
+}
+
+// getCurLStreamNames returns the sorted names of all the logstreams which the
+// current logstreams filter resolves to (not including the muted ones).
+func (mv *MainView) getCurLStreamNames() []string {
+	if mv.curHMState == nil {
+		return nil
+	}
+
+	var ret []string
+	for _, names := range mv.curHMState.LStreamsByState {
+		for name := range names {
+			ret = append(ret, name)
+		}
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+// muteLStreams temporarily excludes the given logstreams from the logstreams
+// filter, and reruns the query.
+func (mv *MainView) muteLStreams(names []string) error {
+	curNames := map[string]struct{}{}
+	for _, name := range mv.getCurLStreamNames() {
+		curNames[name] = struct{}{}
+	}
+
+	muted := append([]string{}, mv.mutedLStreams...)
+	for _, name := range names {
+		if _, ok := curNames[name]; !ok {
+			return errors.Errorf("no such logstream: %s", name)
+		}
+
+		muted = append(muted, name)
+	}
+
+	return mv.setMutedLStreams(muted)
+}
+
+// unmuteLStreams re-includes the given logstreams, previously muted with
+// muteLStreams, and reruns the query. If names is empty, all the muted
+// logstreams are unmuted.
+func (mv *MainView) unmuteLStreams(names []string) error {
+	if len(names) == 0 {
+		return mv.setMutedLStreams(nil)
+	}
+
+	toUnmute := map[string]struct{}{}
+	for _, name := range names {
+		toUnmute[name] = struct{}{}
+	}
+
+	var muted []string
+	for _, name := range mv.mutedLStreams {
+		if _, ok := toUnmute[name]; ok {
+			delete(toUnmute, name)
+			continue
+		}
+
+		muted = append(muted, name)
+	}
+
+	for name := range toUnmute {
+		return errors.Errorf("logstream %s is not muted", name)
+	}
+
+	return mv.setMutedLStreams(muted)
+}
+
+// onlyLStream sets the logstreams filter to just the given logstream, and
+// reruns the query.
+func (mv *MainView) onlyLStream(name string) error {
+	qf := mv.getQueryFull()
+	qf.LStreams = name
+
+	if err := mv.applyQueryEditData(qf, doQueryParams{}); err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// allLStreams sets the logstreams filter to all the given logstreams (which
+// are normally all the ones from the config), and reruns the query.
+func (mv *MainView) allLStreams(names []string) error {
+	qf := mv.getQueryFull()
+	qf.LStreams = strings.Join(names, ", ")
+
+	if err := mv.applyQueryEditData(qf, doQueryParams{}); err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// setNamedQuery adds the named query, or replaces the existing one with the
+// same name, and reruns the query.
+func (mv *MainView) setNamedQuery(nq core.NamedQuery) error {
+	if err := core.ValidateNamedQuery(nq.Query); err != nil {
+		return errors.Annotatef(err, "named query %s", nq.Name)
+	}
+
+	nqs := append([]core.NamedQuery{}, mv.namedQueries...)
+	replaced := false
+	for i := range nqs {
+		if nqs[i].Name == nq.Name {
+			nqs[i] = nq
+			replaced = true
+			break
+		}
+	}
+
+	if !replaced {
+		nqs = append(nqs, nq)
+	}
+
+	mv.setNamedQueries(nqs)
+
+	return nil
+}
+
+// removeNamedQueries removes the named queries with the given names, and
+// reruns the query. If names is empty, all the named queries are removed.
+func (mv *MainView) removeNamedQueries(names []string) error {
+	if len(names) == 0 {
+		mv.setNamedQueries(nil)
+		return nil
+	}
+
+	toRemove := map[string]struct{}{}
+	for _, name := range names {
+		toRemove[name] = struct{}{}
+	}
+
+	var nqs []core.NamedQuery
+	for _, nq := range mv.namedQueries {
+		if _, ok := toRemove[nq.Name]; ok {
+			delete(toRemove, nq.Name)
+			continue
+		}
+
+		nqs = append(nqs, nq)
+	}
+
+	for name := range toRemove {
+		return errors.Errorf("no such named query: %s", name)
 	}
+
+	mv.setNamedQueries(nqs)
+
+	return nil
 }
 
-func (mv *MainView) bumpHistogramExternalCursor(row int) {
-	if row == rowIdxLoadOlder {
-		row += 1
+// onlyNamedQueries removes all the named queries except the given ones, and
+// reruns the query.
+func (mv *MainView) onlyNamedQueries(names []string) error {
+	toKeep := map[string]struct{}{}
+	for _, name := range names {
+		toKeep[name] = struct{}{}
 	}
 
-	firstCell := mv.logsTable.GetCell(row, 0)
-	if firstCell == nil {
-		return
+	var toRemove []string
+	for _, nq := range mv.namedQueries {
+		if _, ok := toKeep[nq.Name]; !ok {
+			toRemove = append(toRemove, nq.Name)
+		}
 	}
 
-	msg, ok := firstCell.GetReference().(core.LogMsg)
-	if !ok {
-		return
+	if len(toRemove) == 0 {
+		return nil
 	}
-	mv.histogram.SetExternalCursor(int(msg.Time.Unix()))
+
+	return mv.removeNamedQueries(toRemove)
 }
 
-func newTableCellHeader(text string) *tview.TableCell {
-	return tview.NewTableCell(text).
-		SetTextColor(tcell.ColorLightBlue).
-		SetAttributes(tcell.AttrBold).
-		SetAlign(tview.AlignLeft).
-		SetSelectable(false)
+func (mv *MainView) setNamedQueries(nqs []core.NamedQuery) {
+	mv.namedQueries = nqs
+	mv.bumpStatusLineLeft()
+	mv.doQuery(doQueryParams{})
 }
 
-func newTableCellLogmsg(text string) *tview.TableCell {
-	return tview.NewTableCell(text).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignLeft)
+// getNamedQueryNames returns the names of the current named queries, in the
+// order they were added.
+func (mv *MainView) getNamedQueryNames() []string {
+	ret := make([]string, 0, len(mv.namedQueries))
+	for _, nq := range mv.namedQueries {
+		ret = append(ret, nq.Name)
+	}
+
+	return ret
 }
 
-func newTableCellButton(text string) *tview.TableCell {
-	return tview.NewTableCell(text).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignCenter)
+// newTab adds a new query tab right after the current one, with the same
+// query, and switches to it.
+func (mv *MainView) newTab() {
+	qf := mv.getQueryFull()
+	mv.tabs.saveCur(qf)
+	mv.tabs.add(qf)
+	mv.bumpStatusLineLeft()
 }
 
-func (mv *MainView) setQuery(q string) {
-	if mv.queryInput.GetText() != q {
-		mv.queryInput.SetText(q)
+// closeTab closes the current query tab, and switches to the next one.
+func (mv *MainView) closeTab() error {
+	if err := mv.tabs.closeCur(); err != nil {
+		return errors.Trace(err)
 	}
-	mv.query = q
-}
 
-func (mv *MainView) setSelectQuery(sqp *SelectQueryParsed) {
-	mv.selectQuery = sqp
+	return errors.Trace(mv.applyCurTab())
 }
 
-func (mv *MainView) setTimeRange(from, to TimeOrDur) {
-	if from.IsZero() {
-		// TODO: maybe better error handling
-		panic("from can't be zero")
+// switchTabBy switches to the query tab which is delta tabs away from the
+// current one, and reruns the query.
+func (mv *MainView) switchTabBy(delta int) error {
+	if len(mv.tabs.tabs) == 1 {
+		return errors.Errorf("there is only one tab, use :tabnew to add more")
 	}
 
-	mv.from = from
-	mv.to = to
+	mv.tabs.saveCur(mv.getQueryFull())
+	mv.tabs.switchBy(delta)
 
-	mv.formatTimeRange()
+	return errors.Trace(mv.applyCurTab())
 }
 
-func (mv *MainView) formatTimeRange() {
-	tz := mv.params.Options.GetTimezone()
-	mv.from = mv.from.In(tz)
-	mv.to = mv.to.In(tz)
+// switchTabTo switches to the query tab with the given index (starting from
+// 0), and reruns the query.
+func (mv *MainView) switchTabTo(idx int) error {
+	prevTab := mv.tabs.cur
+	if err := mv.tabs.switchTo(idx); err != nil {
+		return errors.Trace(err)
+	}
 
-	mv.bumpTimeRange(false)
+	mv.tabs.tabs[prevTab] = mv.getQueryFull()
 
-	rangeDur := mv.actualTo.Sub(mv.actualFrom)
+	return errors.Trace(mv.applyCurTab())
+}
 
-	var timeStr string
-	if !mv.to.IsZero() {
-		timeStr = fmt.Sprintf("%s to %s (%s)", mv.from.Format(inputTimeLayout), mv.to.Format(inputTimeLayout), formatDuration(rangeDur))
-	} else if mv.from.IsAbsolute() {
-		timeStr = fmt.Sprintf("%s to now (%s)", mv.from.Format(inputTimeLayout), formatDuration(rangeDur))
-	} else {
-		timeStr = fmt.Sprintf("last %s", TimeOrDur{Dur: -mv.from.Dur})
+// applyCurTab applies the query of the current tab, keeping the current time
+// range (it's shared by all tabs), and reruns the query.
+func (mv *MainView) applyCurTab() error {
+	qf := mv.tabs.getCur()
+	qf.Time = mv.getQueryFull().Time
+
+	if err := mv.applyQueryEditData(qf, doQueryParams{}); err != nil {
+		return errors.Trace(err)
 	}
 
-	mv.timeLabel.SetText(timeStr)
-	mv.topFlex.ResizeItem(mv.timeLabel, len(timeStr), 0)
-}
+	mv.bumpStatusLineLeft()
 
-// bumpTimeRange only does something useful if the time is relative to current time.
-func (mv *MainView) bumpTimeRange(updateHistogramRange bool) {
-	if mv.from.IsZero() {
-		panic("should never be here")
-	}
+	return nil
+}
 
-	// Since relative durations are relative to current time, only negative values are
-	// meaningful, so if it's positive, reverse it.
+func (mv *MainView) setMutedLStreams(names []string) error {
+	names = uniqueSortedStrings(names)
 
-	if !mv.from.IsAbsolute() && mv.from.Dur > 0 {
-		mv.from.Dur = -mv.from.Dur
+	if err := mv.params.OnMutedLStreamsChange(names); err != nil {
+		return errors.Trace(err)
 	}
 
-	if !mv.to.IsAbsolute() && mv.to.Dur > 0 {
-		mv.to.Dur = -mv.to.Dur
-	}
+	mv.mutedLStreams = names
+	mv.bumpStatusLineLeft()
 
-	mv.actualFrom = mv.from.AbsoluteTime(time.Now())
+	// Just like when applying the query edit data, the query will be done
+	// once we receive the state update with Connected being true.
+	mv.doQueryParamsOnceConnected = &doQueryParams{}
 
-	if !mv.to.IsZero() {
-		mv.actualTo = mv.to.AbsoluteTime(time.Now())
-		mv.actualToForQuery = mv.actualTo
-	} else {
-		mv.actualTo = time.Now()
-		mv.actualToForQuery = time.Time{}
-	}
+	return nil
+}
 
-	// Snap both actualFrom and actualTo to the 1m grid, rounding forward.
-	mv.actualFrom = truncateCeil(mv.actualFrom, 1*time.Minute)
-	mv.actualTo = truncateCeil(mv.actualTo, 1*time.Minute)
-	if !mv.actualToForQuery.IsZero() {
-		mv.actualToForQuery = truncateCeil(mv.actualToForQuery, 1*time.Minute)
+func uniqueSortedStrings(ss []string) []string {
+	if len(ss) == 0 {
+		return nil
 	}
 
-	// If from is after than to, swap them.
-	if mv.actualFrom.After(mv.actualTo) {
-		mv.actualFrom, mv.actualTo = mv.actualTo, mv.actualFrom
-
-		// Sanity check: mv.actualToForQuery can never be zero in this case.
-		if mv.actualToForQuery.IsZero() {
-			panic("actualToForQuery is zero while actualFrom is after actualTo")
+	m := make(map[string]struct{}, len(ss))
+	ret := make([]string, 0, len(ss))
+	for _, s := range ss {
+		if _, ok := m[s]; ok {
+			continue
 		}
-	}
 
-	// Also update the histogram
-	if updateHistogramRange {
-		mv.histogram.SetRange(int(mv.actualFrom.Unix()), int(mv.actualTo.Unix()))
+		m[s] = struct{}{}
+		ret = append(ret, s)
 	}
-}
 
-func truncateCeil(t time.Time, dur time.Duration) time.Time {
-	t2 := t.Truncate(dur)
-	if t2.Equal(t) {
-		return t
-	}
+	sort.Strings(ret)
 
-	return t2.Add(dur)
+	return ret
 }
 
-func (mv *MainView) SetTimeRange(from, to TimeOrDur) {
-	mv.params.App.QueueUpdateDraw(func() {
-		mv.setTimeRange(from, to)
-	})
-}
+// lstreamsSpecHasGroups returns whether the current logstreams spec contains
+// at least one group name.
+func (mv *MainView) lstreamsSpecHasGroups() bool {
+	for _, entry := range strings.Split(mv.lstreamsSpec, ",") {
+		if _, ok := mv.lstreamGroups[strings.TrimSpace(entry)]; ok {
+			return true
+		}
+	}
 
-func (mv *MainView) setLStreams(s string) {
-	mv.lstreamsSpec = s
+	return false
 }
 
 type doQueryParams struct {
@@ -1637,19 +4198,165 @@ type doQueryParams struct {
 	// rebuild it from scratch (no-op for journalctl logstreams, because there's
 	// no nerdlog-maintained index for journalctl).
 	refreshIndex bool
+
+	// If lineRange is not nil, the given range of lines is queried instead of
+	// the time range. Any query without the lineRange gets back to the regular
+	// time-based mode.
+	lineRange *core.LineRange
+
+	// If fetchLines is true, the log lines are fetched even if the countonly
+	// option is set.
+	fetchLines bool
+
+	// If force is true, the query is run without asking for confirmation even
+	// if it exceeds the confirmlarge threshold.
+	force bool
+
+	// autoRefresh is true if the query is rerun due to the autorefresh option;
+	// only then the alert option has an effect.
+	autoRefresh bool
+
+	// fromHistogram is true if the query is for the range selected on the
+	// histogram; only then the jumptoerror option has an effect.
+	fromHistogram bool
 }
 
 func (mv *MainView) doQuery(params doQueryParams) {
+	if !params.force && params.lineRange == nil && mv.confirmLargeQuery(params) {
+		return
+	}
+
+	mv.lastQueryTime = time.Now()
+	mv.lineRange = params.lineRange
+	mv.curQueryAutoRefresh = params.autoRefresh
+	mv.curQueryFromHistogram = params.fromHistogram
+	mv.bumpStatusLineLeft()
+
 	mv.params.OnLogQuery(core.QueryLogsParams{
-		From:  mv.actualFrom,
-		To:    mv.actualToForQuery,
-		Query: mv.query,
+		From:         mv.actualFrom,
+		To:           mv.actualToForQuery,
+		LineRange:    mv.lineRange,
+		Query:        mv.query,
+		Exclude:      mv.exclude,
+		NamedQueries: mv.namedQueries,
+
+		// Line ranges are small by nature, so there's no point in count-only
+		// mode for them.
+		CountOnly: mv.params.Options.GetCountOnly() && !params.fetchLines && mv.lineRange == nil,
+
+		MaxLineLength: mv.params.Options.GetMaxLineLength(),
 
 		DontAddHistoryItem: params.dontAddHistoryItem,
 		RefreshIndex:       params.refreshIndex,
 	})
 }
 
+// confirmOpenQuery shows the query decoded from a shared token (see :open),
+// along with the time span it covers, and only applies it once the user
+// confirms: the token might come from someone else, and blindly running e.g.
+// a multi-month query across the whole fleet is not nice. Returns an error if
+// the query is invalid, in which case nothing is shown.
+func (mv *MainView) confirmOpenQuery(qf QueryFull) error {
+	tz := mv.params.Options.GetTimezone()
+
+	ftr, err := ParseFromToRange(tz, qf.Time)
+	if err != nil {
+		return errors.Annotatef(err, "time")
+	}
+
+	if _, err := ParseSelectQuery(qf.SelectQuery); err != nil {
+		return errors.Annotatef(err, "select query")
+	}
+
+	now := time.Now()
+	span := ftr.To.AbsoluteTime(now).Sub(ftr.From.AbsoluteTime(now))
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Logstreams: %s\n", tview.Escape(qf.LStreams)))
+	sb.WriteString(fmt.Sprintf("Time:       %s (%s)\n", tview.Escape(qf.Time), formatDuration(span)))
+	sb.WriteString(fmt.Sprintf("Query:      %s\n", tview.Escape(qf.Query)))
+	if qf.Exclude != "" {
+		sb.WriteString(fmt.Sprintf("Exclude:    %s\n", tview.Escape(qf.Exclude)))
+	}
+	sb.WriteString(fmt.Sprintf("Select:     %s\n", tview.Escape(string(qf.SelectQuery))))
+	sb.WriteString("\nApply this query?")
+
+	var msgv *MessageView
+	msgv = mv.showMessagebox(
+		"openQuery",
+		"Open shared query",
+		sb.String(),
+		&MessageboxParams{
+			Buttons: []string{"Apply", "Cancel"},
+			OnButtonPressed: func(label string, idx int) {
+				msgv.Hide()
+
+				if label != "Apply" {
+					return
+				}
+
+				if err := mv.applyQueryEditData(qf, doQueryParams{}); err != nil {
+					mv.printMsg(err.Error(), nlMsgLevelErr)
+				}
+			},
+			Width: 100,
+		},
+	)
+
+	return nil
+}
+
+// confirmLargeQuery checks the estimated cost of the query for the current
+// time range against the confirmlarge option, and if it's exceeded, asks the
+// user to confirm; the query is then rerun with the force flag. Returns
+// whether the confirmation was requested, in which case the caller should
+// not run the query.
+func (mv *MainView) confirmLargeQuery(params doQueryParams) bool {
+	threshold := mv.params.Options.GetConfirmLarge()
+	if threshold == 0 {
+		return false
+	}
+
+	numLStreams := 0
+	if mv.curHMState != nil {
+		numLStreams = mv.curHMState.NumLStreams
+	}
+
+	cost := estimateQueryCost(mv.actualFrom, mv.actualTo, numLStreams)
+	if cost <= threshold {
+		return false
+	}
+
+	msgID := "confirmLarge"
+
+	var msgv *MessageView
+	msgv = mv.showMessagebox(
+		msgID,
+		"Large query",
+		fmt.Sprintf(
+			"The query covers %s on %d logstream(s), which is %s of logs in total\n"+
+				"and exceeds the confirmlarge threshold of %s; it might take a long time.\n\n"+
+				"Run it anyway?",
+			formatDuration(mv.actualTo.Sub(mv.actualFrom)), numLStreams,
+			formatDuration(cost), formatDuration(threshold),
+		),
+		&MessageboxParams{
+			Buttons: []string{"Run anyway", "Cancel"},
+			OnButtonPressed: func(label string, idx int) {
+				msgv.Hide()
+
+				if label == "Run anyway" {
+					params.force = true
+					mv.doQuery(params)
+				}
+			},
+			Width: 80,
+		},
+	)
+
+	return true
+}
+
 func (mv *MainView) DoQuery(dqp doQueryParams) {
 	mv.params.App.QueueUpdateDraw(func() {
 		mv.doQuery(dqp)
@@ -1792,6 +4499,105 @@ func (mv *MainView) HideMessagebox(msgID string, focusAfterPageRemoval bool) {
 }
 
 func (mv *MainView) showOriginalMsg(msg core.LogMsg) {
+	sb := strings.Builder{}
+
+	buttons := []string{"OK", "Raw bytes"}
+
+	// Messages from journalctl or HTTP logstreams don't have a file to open.
+	if msg.LogFilename != core.SpecialFilenameJournalctl && msg.LogFilename != "" {
+		sb.WriteString(mv.getOriginalMsgSSHCmd(msg))
+		sb.WriteString("\n\n")
+
+		buttons = append(buttons, "Open in editor")
+	}
+
+	// The full line can only be fetched from a file.
+	if msg.TruncatedLen > 0 {
+		sb.WriteString(fmt.Sprintf(
+			"[yellow]The line is truncated, it's %d bytes long (see the maxlinelength option)[-]\n\n",
+			msg.TruncatedLen,
+		))
+
+		if msg.LogFilename != core.SpecialFilenameJournalctl && msg.LogFilename != "" {
+			buttons = append(buttons, "Full line")
+		}
+	}
+
+	sb.WriteString(tview.Escape(msg.OrigLine))
+
+	if _, ok := getJSONStart(msg.OrigLine); ok {
+		buttons = append(buttons, "Pretty JSON")
+	}
+
+	var msgv *MessageView
+	msgv = mv.showMessagebox("msg", "Message", sb.String(), &MessageboxParams{
+		Buttons:    buttons,
+		CopyButton: true,
+		OnButtonPressed: func(label string, idx int) {
+			msgv.Hide()
+
+			switch label {
+			case "Raw bytes":
+				mv.showRawBytes(msg.OrigLine)
+			case "Pretty JSON":
+				mv.showPrettyJSON(msg)
+			case "Open in editor":
+				mv.openOriginalMsgInEditor(msg)
+			case "Full line":
+				mv.fetchFullLine(msg)
+			}
+		},
+	})
+}
+
+// fetchFullLine fetches the line of the given message from its file, without
+// truncating it as per the maxlinelength option; the current query results
+// are left intact, and the line is shown once it's fetched, see
+// handleFetchedLines.
+func (mv *MainView) fetchFullLine(msg core.LogMsg) {
+	mv.params.OnFetchLines(msg.Context["lstream"], core.LineRange{
+		File: msg.LogFilename,
+		From: msg.LogLinenumber,
+		To:   msg.LogLinenumber,
+	})
+
+	mv.printMsg("Fetching the full line...", nlMsgLevelInfo)
+}
+
+// handleFetchedLines shows the full line fetched by fetchFullLine.
+func (mv *MainView) handleFetchedLines(fetched *core.FetchedLines) {
+	if fetched.Err != nil {
+		mv.printMsg(fmt.Sprintf("Failed to fetch the full line: %s", fetched.Err), nlMsgLevelErr)
+		return
+	}
+
+	if len(fetched.Logs) == 0 {
+		mv.printMsg(fmt.Sprintf(
+			"Line %d is not in %s anymore, the file might have been rotated",
+			fetched.LineRange.From, fetched.LineRange.File,
+		), nlMsgLevelWarn)
+		return
+	}
+
+	line := fetched.Logs[0].OrigLine
+
+	var msgv *MessageView
+	msgv = mv.showMessagebox("msgFullLine", "Full line", tview.Escape(line), &MessageboxParams{
+		Buttons:    []string{"OK", "Raw bytes"},
+		CopyButton: true,
+		OnButtonPressed: func(label string, idx int) {
+			msgv.Hide()
+
+			if label == "Raw bytes" {
+				mv.showRawBytes(line)
+			}
+		},
+	})
+}
+
+// getOriginalMsgSSHCmd returns the shell command to view the given message in
+// the log file on the remote host, with some surrounding lines.
+func (mv *MainView) getOriginalMsgSSHCmd(msg core.LogMsg) string {
 	lnOffsetUp := 1000   // How many surrounding lines to show, up
 	lnOffsetDown := 1000 // How many surrounding lines to show, down
 	lnBegin := msg.LogLinenumber - lnOffsetUp
@@ -1800,22 +4606,104 @@ func (mv *MainView) showOriginalMsg(msg core.LogMsg) {
 		lnBegin = 1
 	}
 
-	sb := strings.Builder{}
+	lstream := msg.Context["lstream"]
+	return fmt.Sprintf(
+		"ssh -t %s 'vim +\"set ft=messages\" +%d <(%stail -n +%d %s | head -n %d)'",
+		lstream, lnOffsetUp+1, mv.getSudoPrefix(lstream), lnBegin, msg.LogFilename, lnOffsetUp+lnOffsetDown,
+	)
+}
 
-	if msg.LogFilename != core.SpecialFilenameJournalctl {
-		sb.WriteString(fmt.Sprintf(
-			"ssh -t %s 'vim +\"set ft=messages\" +%d <(tail -n +%d %s | head -n %d)'\n\n",
-			msg.Context["lstream"], lnOffsetUp+1, lnBegin, msg.LogFilename, lnOffsetUp+lnOffsetDown,
-		))
+// isMsgFileLocal returns whether the log file of the given message is right
+// here on the local host, so it can be opened in the editor directly.
+func (mv *MainView) isMsgFileLocal(msg core.LogMsg) bool {
+	if msg.LogFilename == core.SpecialFilenameJournalctl || msg.LogFilename == "" {
+		return false
 	}
 
-	sb.WriteString(tview.Escape(msg.OrigLine))
+	return mv.params.IsLStreamLocal != nil && mv.params.IsLStreamLocal(msg.Context["lstream"])
+}
+
+// openOriginalMsgInEditor suspends the TUI and opens the log file of the given
+// message at its line. If the logstream is local, the file is opened in
+// $EDITOR directly; otherwise, the ssh command from getOriginalMsgSSHCmd is
+// executed.
+func (mv *MainView) openOriginalMsgInEditor(msg core.LogMsg) {
+	if msg.LogFilename == core.SpecialFilenameJournalctl {
+		mv.printMsg("Can't open journalctl logs in the editor", nlMsgLevelErr)
+		return
+	} else if msg.LogFilename == "" {
+		mv.printMsg("The message has no log file to open", nlMsgLevelErr)
+		return
+	}
+
+	lstream := msg.Context["lstream"]
+
+	var cmd *exec.Cmd
+	if mv.isMsgFileLocal(msg) {
+		args := append(getEditorCmd(), fmt.Sprintf("+%d", msg.LogLinenumber), msg.LogFilename)
+		if mv.getSudoPrefix(lstream) != "" {
+			args = append([]string{"sudo"}, args...)
+		}
+
+		cmd = exec.Command(args[0], args[1:]...)
+	} else {
+		cmd = exec.Command("sh", "-c", mv.getOriginalMsgSSHCmd(msg))
+	}
+
+	var cmdErr error
+	mv.params.App.Suspend(func() {
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmdErr = cmd.Run()
+	})
+
+	if cmdErr != nil {
+		mv.printMsg(fmt.Sprintf("Failed to open %s: %s", msg.LogFilename, cmdErr), nlMsgLevelErr)
+	}
+}
+
+// showPrettyJSON shows the original line of the message with the JSON in it
+// indented and colored; if there's no valid JSON, the line is shown as is.
+func (mv *MainView) showPrettyJSON(msg core.LogMsg) {
+	title := "Pretty JSON"
+	text, ok := prettyPrintJSON(msg.OrigLine)
+	if !ok {
+		title = "Message (not a valid JSON)"
+		text = tview.Escape(msg.OrigLine)
+	}
+
+	mv.showMessagebox("msgPrettyJSON", title, text, &MessageboxParams{
+		CopyButton: true,
+	})
+}
 
-	mv.showMessagebox("msg", "Message", sb.String(), &MessageboxParams{
+// showRawBytes shows the given log line with the non-printable characters
+// escaped, and its hex dump, to help diagnose encoding issues.
+func (mv *MainView) showRawBytes(line string) {
+	mv.showMessagebox("msgRawBytes", "Raw bytes", tview.Escape(formatRawBytes(line)), &MessageboxParams{
 		CopyButton: true,
+		Width:      90,
 	})
 }
 
+// getSudoPrefix returns "sudo " if the given logstream is configured to use
+// sudo, or an empty string otherwise. It's meant to be used in the shell
+// commands that we suggest to the user; since these commands are executed
+// interactively (with "ssh -t"), we don't use "-n" there, so sudo can ask for
+// the password if needed.
+func (mv *MainView) getSudoPrefix(lstream string) string {
+	if mv.params.GetLStreamSudoMode == nil {
+		return ""
+	}
+
+	if mv.params.GetLStreamSudoMode(lstream) != core.SudoModeFull {
+		return ""
+	}
+
+	return "sudo "
+}
+
 func (mv *MainView) showModal(pageName string, primitive tview.Primitive, width, height int, focus bool) {
 	modalGrid := tview.NewGrid().
 		SetColumns(0, width, 0).
@@ -1894,11 +4782,38 @@ func (mv *MainView) getQueryFull() QueryFull {
 	return QueryFull{
 		Time:        ftr.String(),
 		Query:       mv.query,
+		Exclude:     mv.exclude,
 		LStreams:    mv.lstreamsSpec,
 		SelectQuery: mv.selectQuery.Marshal(),
 	}
 }
 
+// getHTMLReportData returns the data for the HTML report (see :write-html)
+// about the current query results, or an error if there are none.
+func (mv *MainView) getHTMLReportData() (*htmlReportData, error) {
+	if mv.curLogResp == nil {
+		return nil, errors.Errorf("No logs yet")
+	}
+
+	histFrom, histTo := mv.histFrom, mv.histTo
+	if histFrom.IsZero() {
+		histFrom, histTo = mv.actualFrom, mv.actualTo
+	}
+
+	return &htmlReportData{
+		Query:        mv.getQueryFull(),
+		TimeRange:    mv.getTimeRangeStr(),
+		HistFrom:     histFrom,
+		HistTo:       histTo,
+		MinuteStats:  mv.curLogResp.MinuteStats,
+		Logs:         mv.curLogResp.Logs,
+		ColNames:     mv.curColNames,
+		NumMsgsTotal: mv.curLogResp.NumMsgsTotal,
+		TZ:           mv.params.Options.GetTimezone(),
+		GeneratedAt:  time.Now(),
+	}, nil
+}
+
 func (mv *MainView) setFocus(p tview.Primitive) {
 	mv.params.App.SetFocus(p)
 }
@@ -1933,12 +4848,18 @@ func (mv *MainView) openQueryEditView() {
 
 func (mv *MainView) disconnect() {
 	mv.curLogResp = nil
+	mv.lastCompleteLogResp = nil
+	mv.partialSelection = nil
+	mv.pendingSnapshotDiff = nil
 	mv.sendLStreamsChangeOnNextQuery = true
 	mv.params.OnDisconnectRequest()
 }
 
 // handleQueryError shows the right messagebox based on the error cause.
 func (mv *MainView) handleQueryError(err error) {
+	mv.partialSelection = nil
+	mv.pendingSnapshotDiff = nil
+
 	if errors.Cause(err) == core.ErrBusyWithAnotherQuery ||
 		errors.Cause(err) == core.ErrNotYetConnected {
 		// In this particular error ("busy with another query"), show a dialog
@@ -2010,6 +4931,15 @@ func (mv *MainView) handleBootstrapWarning(err error) {
 	})
 }
 
+// showStartupWarnings shows the non-fatal issues found during the startup,
+// like a corrupted file with the recently used logstreams.
+func (mv *MainView) showStartupWarnings(warnings []string) {
+	mv.showMessagebox("startupWarn", "Startup warning", tview.Escape(strings.Join(warnings, "\n\n")), &MessageboxParams{
+		BackgroundColor: tcell.ColorDarkOrchid,
+		CopyButton:      true,
+	})
+}
+
 func (mv *MainView) handleDataRequest(dataReq *core.ShellConnDataRequest) {
 	msgID := "dataRequest"
 	title := dataReq.Title
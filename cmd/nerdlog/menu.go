@@ -30,18 +30,42 @@ var mainMenu = []menuItem{
 			mv.params.OnCmd("refresh!", CmdOpts{Internal: true})
 		},
 	},
+	{
+		Title: "Time range presets   <T>        ",
+		Handler: func(mv *MainView) {
+			mv.params.OnCmd("time-presets", CmdOpts{Internal: true})
+		},
+	},
 	{
 		Title: "Copy query command   :xclip     ",
 		Handler: func(mv *MainView) {
 			mv.params.OnCmd("xclip", CmdOpts{Internal: true})
 		},
 	},
+	{
+		Title: "Copy query args      <Y>        ",
+		Handler: func(mv *MainView) {
+			mv.params.OnCmd("yank-args", CmdOpts{Internal: true})
+		},
+	},
 	{
 		Title: "Query debug info     :debug     ",
 		Handler: func(mv *MainView) {
 			mv.params.OnCmd("debug", CmdOpts{Internal: true})
 		},
 	},
+	{
+		Title: "Query warnings       <W>        ",
+		Handler: func(mv *MainView) {
+			mv.params.OnCmd("warnings", CmdOpts{Internal: true})
+		},
+	},
+	{
+		Title: "All commands         <Ctrl+P>   ",
+		Handler: func(mv *MainView) {
+			mv.params.OnCmd("help", CmdOpts{Internal: true})
+		},
+	},
 	{
 		Title: "About                :version   ",
 		Handler: func(mv *MainView) {
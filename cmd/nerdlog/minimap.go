@@ -0,0 +1,177 @@
+package main
+
+import (
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Minimap is a thin vertical bar shown alongside the logs table, giving a
+// position-based overview of all rows: every line of the minimap covers a
+// range of rows, and is shaded according to how many errors and warnings are
+// there. The rows currently visible in the table are marked with a lighter
+// background. It complements the histogram, which is time-based.
+type Minimap struct {
+	*tview.Box
+
+	// getData returns the log level of every row, and the range of rows
+	// currently visible in the table, to is exclusive. It's called on every
+	// draw, so that the minimap always follows the table scrolling.
+	getData func() (levels []core.LogLevel, viewFrom, viewTo int)
+
+	// lastHeight is the height of the minimap as of the last draw; it's used to
+	// map the rows to the minimap lines outside of drawing.
+	lastHeight int
+}
+
+// minimapLine is what a single line of the minimap covers.
+type minimapLine struct {
+	// rowFrom and rowTo is the range of rows, rowTo is exclusive; if they're
+	// equal, the line doesn't cover any rows.
+	rowFrom int
+	rowTo   int
+
+	numErrors   int
+	numWarnings int
+}
+
+func NewMinimap(getData func() (levels []core.LogLevel, viewFrom, viewTo int)) *Minimap {
+	return &Minimap{
+		Box:     tview.NewBox(),
+		getData: getData,
+	}
+}
+
+func (m *Minimap) Draw(screen tcell.Screen) {
+	m.Box.DrawForSubclass(screen, m)
+	x, y, width, height := m.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	m.lastHeight = height
+
+	levels, viewFrom, viewTo := m.getData()
+	lines := getMinimapLines(levels, height)
+
+	for i, line := range lines {
+		if line.rowFrom == line.rowTo {
+			continue
+		}
+
+		ch, color := minimapLineRune(line)
+		style := tcell.StyleDefault.Foreground(color)
+
+		// Mark the lines covering the visible rows.
+		if line.rowFrom < viewTo && line.rowTo > viewFrom {
+			style = style.Background(tcell.ColorDimGray)
+		}
+
+		for dx := 0; dx < width; dx++ {
+			screen.SetContent(x+dx, y+i, ch, nil, style)
+		}
+	}
+}
+
+// minimapLineRune returns the rune and its color to show the given minimap
+// line: the more errors and warnings, the denser the rune.
+func minimapLineRune(line minimapLine) (rune, tcell.Color) {
+	numHot := line.numErrors + line.numWarnings
+	if numHot == 0 {
+		return '│', tcell.ColorGray
+	}
+
+	color := tcell.ColorYellow
+	if line.numErrors > 0 {
+		color = tcell.ColorRed
+	}
+
+	ratio := float64(numHot) / float64(line.rowTo-line.rowFrom)
+	switch {
+	case ratio > 0.5:
+		return '█', color
+	case ratio > 0.1:
+		return '▓', color
+	default:
+		return '▒', color
+	}
+}
+
+// getMinimapLines distributes the rows with the given levels among the given
+// number of minimap lines. If there are fewer rows than lines, every row
+// takes a single line, and the rest of the lines are empty.
+func getMinimapLines(levels []core.LogLevel, numLines int) []minimapLine {
+	lines := make([]minimapLine, numLines)
+	numRows := len(levels)
+
+	for i := range lines {
+		line := &lines[i]
+		if numRows <= numLines {
+			if i < numRows {
+				line.rowFrom, line.rowTo = i, i+1
+			}
+		} else {
+			line.rowFrom = i * numRows / numLines
+			line.rowTo = (i + 1) * numRows / numLines
+		}
+
+		for _, level := range levels[line.rowFrom:line.rowTo] {
+			switch level {
+			case core.LogLevelError:
+				line.numErrors++
+			case core.LogLevelWarn:
+				line.numWarnings++
+			}
+		}
+	}
+
+	return lines
+}
+
+// GetNextHotRow returns the first row with an error or a warning in the next
+// (or, if forward is false, previous) minimap line which has any, relative to
+// the line containing the given row. Returns false if there's no such line.
+func (m *Minimap) GetNextHotRow(row int, forward bool) (int, bool) {
+	levels, _, _ := m.getData()
+
+	numLines := m.lastHeight
+	if numLines <= 0 {
+		numLines = len(levels)
+	}
+
+	return getNextHotRow(getMinimapLines(levels, numLines), levels, row, forward)
+}
+
+func getNextHotRow(lines []minimapLine, levels []core.LogLevel, row int, forward bool) (int, bool) {
+	curLineIdx := -1
+	for i, line := range lines {
+		if row >= line.rowFrom && row < line.rowTo {
+			curLineIdx = i
+			break
+		}
+	}
+
+	if curLineIdx < 0 {
+		return 0, false
+	}
+
+	step := 1
+	if !forward {
+		step = -1
+	}
+
+	for i := curLineIdx + step; i >= 0 && i < len(lines); i += step {
+		line := lines[i]
+		if line.numErrors+line.numWarnings == 0 {
+			continue
+		}
+
+		for r := line.rowFrom; r < line.rowTo; r++ {
+			if levels[r] == core.LogLevelError || levels[r] == core.LogLevelWarn {
+				return r, true
+			}
+		}
+	}
+
+	return 0, false
+}
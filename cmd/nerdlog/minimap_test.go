@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMinimapLines(t *testing.T) {
+	e, w, i := core.LogLevelError, core.LogLevelWarn, core.LogLevelInfo
+
+	// Fewer rows than lines: one row per line.
+	assert.Equal(t, []minimapLine{
+		{rowFrom: 0, rowTo: 1},
+		{rowFrom: 1, rowTo: 2, numErrors: 1},
+		{},
+	}, getMinimapLines([]core.LogLevel{i, e}, 3))
+
+	// More rows than lines.
+	levels := []core.LogLevel{i, i, e, w, i, i, i, i, w, i}
+	assert.Equal(t, []minimapLine{
+		{rowFrom: 0, rowTo: 3, numErrors: 1},
+		{rowFrom: 3, rowTo: 6, numWarnings: 1},
+		{rowFrom: 6, rowTo: 10, numWarnings: 1},
+	}, getMinimapLines(levels, 3))
+}
+
+func TestGetNextHotRow(t *testing.T) {
+	e, w, i := core.LogLevelError, core.LogLevelWarn, core.LogLevelInfo
+
+	levels := []core.LogLevel{i, e, i, i, i, i, i, w, i, e, i, i}
+	lines := getMinimapLines(levels, 4)
+
+	testCases := []struct {
+		name    string
+		row     int
+		forward bool
+		wantRow int
+		wantOK  bool
+	}{
+		{name: "forward from the first line", row: 0, forward: true, wantRow: 7, wantOK: true},
+		{name: "forward skips the current line", row: 7, forward: true, wantRow: 9, wantOK: true},
+		{name: "forward at the end", row: 9, forward: true, wantOK: false},
+		{name: "backward", row: 11, forward: false, wantRow: 7, wantOK: true},
+		{name: "backward at the start", row: 1, forward: false, wantOK: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			row, ok := getNextHotRow(lines, levels, tc.row, tc.forward)
+			assert.Equal(t, tc.wantOK, ok)
+			if tc.wantOK {
+				assert.Equal(t, tc.wantRow, row)
+			}
+		})
+	}
+}
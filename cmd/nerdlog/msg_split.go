@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// msgSplitColPrefix is the prefix of the synthetic columns which show the
+// parts of the message split by a delimiter (see the ":split" command); the
+// prefix is followed by the 1-based index of the part, like "message#1".
+const msgSplitColPrefix = FieldNameMessage + "#"
+
+// maxMsgSplitCols is the maximum number of columns a message can be split
+// into; the rest of the message stays in the last column.
+const maxMsgSplitCols = 32
+
+func msgSplitColName(partIdx int) string {
+	return msgSplitColPrefix + strconv.Itoa(partIdx+1)
+}
+
+// splitMsg splits the message by the delimiter, into at most maxMsgSplitCols
+// parts.
+func splitMsg(msg, delim string) []string {
+	return strings.SplitN(msg, delim, maxMsgSplitCols)
+}
+
+// getMsgSplitNumCols returns how many columns are needed to show all the
+// messages split by the delimiter.
+func getMsgSplitNumCols(logs []core.LogMsg, delim string) int {
+	ret := 1
+	for i := range logs {
+		if n := strings.Count(logs[i].Msg, delim) + 1; n > ret {
+			ret = n
+		}
+	}
+
+	if ret > maxMsgSplitCols {
+		ret = maxMsgSplitCols
+	}
+
+	return ret
+}
+
+// getMsgSplitPart returns the part of the message shown in the given
+// synthetic column. If colName isn't such a column, or the delimiter is
+// empty (the message isn't being split), ok is false.
+func getMsgSplitPart(msg, delim, colName string) (part string, ok bool) {
+	if delim == "" || !strings.HasPrefix(colName, msgSplitColPrefix) {
+		return "", false
+	}
+
+	partNum, err := strconv.Atoi(colName[len(msgSplitColPrefix):])
+	if err != nil || partNum < 1 {
+		return "", false
+	}
+
+	parts := splitMsg(msg, delim)
+	if partNum > len(parts) {
+		return "", true
+	}
+
+	return parts[partNum-1], true
+}
+
+// getLogMsgColValue returns the raw value of the given column (other than
+// the time) for the message; delim is the current message split delimiter,
+// if any.
+func getLogMsgColValue(msg *core.LogMsg, colName, delim string) string {
+	switch colName {
+	case FieldNameMessage:
+		return msg.Msg
+	case FieldNameFilename:
+		return msg.LogFilename
+	case FieldNameLinenumber:
+		return formatLogLinenumber(msg.LogLinenumber)
+	}
+
+	if part, ok := getMsgSplitPart(msg.Msg, delim, colName); ok {
+		return part
+	}
+
+	return msg.Context[colName]
+}
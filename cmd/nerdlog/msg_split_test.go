@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMsgSplit(t *testing.T) {
+	logs := []core.LogMsg{
+		{Msg: "GET|/foo|200", Context: map[string]string{"lstream": "host-1"}},
+		{Msg: "POST|/bar|500|slow"},
+		{Msg: "no delimiter"},
+	}
+
+	assert.Equal(t, 4, getMsgSplitNumCols(logs, "|"))
+	assert.Equal(t, 1, getMsgSplitNumCols(logs, ","))
+
+	assert.Equal(t, "message#1", msgSplitColName(0))
+
+	assert.Equal(t, "/foo", getLogMsgColValue(&logs[0], "message#2", "|"))
+	assert.Equal(t, "", getLogMsgColValue(&logs[0], "message#4", "|"))
+	assert.Equal(t, "slow", getLogMsgColValue(&logs[1], "message#4", "|"))
+	assert.Equal(t, "no delimiter", getLogMsgColValue(&logs[2], "message#1", "|"))
+	assert.Equal(t, "GET|/foo|200", getLogMsgColValue(&logs[0], FieldNameMessage, "|"))
+	assert.Equal(t, "host-1", getLogMsgColValue(&logs[0], "lstream", "|"))
+
+	// Without the delimiter, the synthetic columns are just regular fields.
+	_, ok := getMsgSplitPart(logs[0].Msg, "", "message#1")
+	assert.False(t, ok)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"sync"
 	"time"
@@ -15,6 +16,148 @@ type Options struct {
 	// MaxNumLines is how many log lines the nerdlog_agent.sh will return at
 	// most. Initially it's set to 250.
 	MaxNumLines int
+
+	// MaxRows is the maximum number of log messages retained in the logs
+	// table; once it's exceeded (e.g. after loading older logs many times),
+	// the messages furthest from the view are evicted. Zero means no limit.
+	MaxRows int
+
+	// MaxLineLength is the max length of a log line in bytes: longer ones are
+	// truncated before being shown. Zero means no limit.
+	MaxLineLength int
+
+	// AutoRefresh is the interval to rerun the query automatically, if the time
+	// range is relative. Zero means no auto-refresh.
+	AutoRefresh time.Duration
+
+	// RedrawInterval is the min interval between the redraws of the logs
+	// table and the histogram caused by the new query results; the results
+	// arriving more often are coalesced. Zero means no throttling.
+	RedrawInterval time.Duration
+
+	// PostQueryHook is the shell command which transforms the query results
+	// before they're shown; see runPostQueryHook. Empty means no hook.
+	PostQueryHook string
+
+	// QueryTimeout is how long to wait for all logstreams to respond to a
+	// query; the ones which didn't respond by then are reconnected, and the
+	// results from the rest are shown. Zero means no timeout.
+	QueryTimeout time.Duration
+
+	// IdleTimeout is how long a logstream can stay without any queries before
+	// it's disconnected, to free the remote resources; it's reconnected on the
+	// next query. It only applies to the logstreams which don't have their own
+	// idle_timeout in the config. Zero means no timeout.
+	IdleTimeout time.Duration
+
+	// ConfirmLarge is the threshold of the estimated query cost (the duration
+	// of the time range multiplied by the number of logstreams) above which the
+	// user is asked to confirm the query before it's run. Zero means never ask.
+	ConfirmLarge time.Duration
+
+	// ShowLineNumbers is whether to show the leading column with row numbers
+	// in the logs table.
+	ShowLineNumbers bool
+
+	// ShowMinimap is whether to show the minimap next to the logs table.
+	ShowMinimap bool
+
+	// ShowHistogram is whether to show the timeline histogram above the logs
+	// table.
+	ShowHistogram bool
+
+	// Dedup is whether to collapse consecutive messages with the same text
+	// into a single row with a count in the logs table.
+	Dedup bool
+
+	// RawMessage is whether to show the original log line in the message
+	// column of the logs table, instead of the parsed message.
+	RawMessage bool
+
+	// ViewMode is the layout of the logs table: either the structured table,
+	// or only the raw log lines.
+	ViewMode viewMode
+
+	// Wrap is whether to wrap long messages in the logs table, so that every
+	// line takes its own row, instead of scrolling the table horizontally.
+	Wrap bool
+
+	// Reverse is whether to show the logs in the reverse order, newest first.
+	Reverse bool
+
+	// LinkCursor is whether moving the cursor on the histogram also selects
+	// the first message under it in the logs table.
+	LinkCursor bool
+
+	// StableColumns is whether the context columns, once they've appeared in
+	// the logs table, are kept there for the rest of the session, even if the
+	// later query results don't have them, so the layout doesn't jump around.
+	StableColumns bool
+
+	// Freeze is whether the new query results brought by the autorefresh are
+	// held back instead of being shown, so that the logs can be read
+	// undisturbed; the latest one is shown once it's off.
+	Freeze bool
+
+	// JumpToError is whether to select the first error in the new range after
+	// selecting a histogram bar, instead of the latest message.
+	JumpToError bool
+
+	// DefaultQueries is whether the default queries configured for the
+	// logstreams are applied; turning it off allows to temporarily bypass them.
+	DefaultQueries bool
+
+	// CountOnly is whether the queries should only fetch the counts for the
+	// histogram, without any log lines.
+	CountOnly bool
+
+	// AroundDur is how much time before and after the selected message is
+	// queried by :around (or the A key) by default.
+	AroundDur time.Duration
+
+	// GapThreshold is the minimum duration without any logs to be considered
+	// a gap in the logs coverage; such gaps are highlighted on the histogram.
+	// Zero means gaps are not detected.
+	GapThreshold time.Duration
+
+	// QuietThreshold is the number of messages which at least one logstream
+	// must have, for the logstreams without any messages to be reported as
+	// suspiciously quiet. Zero means it's disabled.
+	QuietThreshold int
+
+	// StatusLineLeft and StatusLineRight are the custom templates for the
+	// left and right parts of the status line; nil means the default layout.
+	StatusLineLeft  *statusLineTemplate
+	StatusLineRight *statusLineTemplate
+
+	// ColumnColors contains the rules to color the context columns in the logs
+	// table by value; nil means no custom colors.
+	ColumnColors *columnColorRules
+
+	// ColumnFormats contains the formatters for the values of the context
+	// columns in the logs table, like "size:bytes"; nil means the values are
+	// shown as is.
+	ColumnFormats *columnFormatRules
+
+	// Alert is whether to ring the bell when the autorefresh brings new lines
+	// (only those matching AlertOn, if it's set).
+	Alert bool
+	// AlertOn, if not nil, limits the alerts to the new lines whose message
+	// matches it.
+	AlertOn *regexp.Regexp
+
+	// WatchBell is whether to ring the bell when a watch gets tripped; see the
+	// :watch command.
+	WatchBell bool
+
+	// TimeRound is how the time range endpoints are rounded to the
+	// TimeRoundGranularity, which is a whole number of minutes.
+	TimeRound            timeRoundMode
+	TimeRoundGranularity time.Duration
+
+	// HistogramRange is whether the histogram covers the whole queried time
+	// range, or only the part of it where the logs are.
+	HistogramRange histRangeMode
 }
 
 type OptionsShared struct {
@@ -41,6 +184,214 @@ func (o *OptionsShared) GetMaxNumLines() int {
 	return o.options.MaxNumLines
 }
 
+func (o *OptionsShared) GetMaxLineLength() int {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.MaxLineLength
+}
+
+func (o *OptionsShared) GetMaxRows() int {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.MaxRows
+}
+
+func (o *OptionsShared) GetAutoRefresh() time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.AutoRefresh
+}
+
+func (o *OptionsShared) GetRedrawInterval() time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.RedrawInterval
+}
+
+func (o *OptionsShared) GetPostQueryHook() string {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.PostQueryHook
+}
+
+func (o *OptionsShared) GetQueryTimeout() time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.QueryTimeout
+}
+
+func (o *OptionsShared) GetIdleTimeout() time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.IdleTimeout
+}
+
+func (o *OptionsShared) GetConfirmLarge() time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.ConfirmLarge
+}
+
+func (o *OptionsShared) GetShowLineNumbers() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.ShowLineNumbers
+}
+
+func (o *OptionsShared) GetShowMinimap() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.ShowMinimap
+}
+
+func (o *OptionsShared) GetShowHistogram() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.ShowHistogram
+}
+
+func (o *OptionsShared) GetDedup() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.Dedup
+}
+
+func (o *OptionsShared) GetRawMessage() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.RawMessage
+}
+
+func (o *OptionsShared) GetViewMode() viewMode {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.ViewMode
+}
+
+func (o *OptionsShared) GetWrap() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.Wrap
+}
+
+func (o *OptionsShared) GetReverse() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.Reverse
+}
+
+func (o *OptionsShared) GetLinkCursor() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.LinkCursor
+}
+
+func (o *OptionsShared) GetStableColumns() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.StableColumns
+}
+
+func (o *OptionsShared) GetFreeze() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.Freeze
+}
+
+func (o *OptionsShared) GetJumpToError() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.JumpToError
+}
+
+func (o *OptionsShared) GetDefaultQueries() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.DefaultQueries
+}
+
+func (o *OptionsShared) GetCountOnly() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.CountOnly
+}
+
+func (o *OptionsShared) GetAroundDur() time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.AroundDur
+}
+
+func (o *OptionsShared) GetGapThreshold() time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.GapThreshold
+}
+
+func (o *OptionsShared) GetQuietThreshold() int {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.QuietThreshold
+}
+
+func (o *OptionsShared) GetStatusLineLeft() *statusLineTemplate {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.StatusLineLeft
+}
+
+func (o *OptionsShared) GetStatusLineRight() *statusLineTemplate {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.StatusLineRight
+}
+
+func (o *OptionsShared) GetColumnColors() *columnColorRules {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.ColumnColors
+}
+
+func (o *OptionsShared) GetColumnFormats() *columnFormatRules {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.ColumnFormats
+}
+
+func (o *OptionsShared) GetAlert() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.Alert
+}
+
+func (o *OptionsShared) GetAlertOn() *regexp.Regexp {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.AlertOn
+}
+
+func (o *OptionsShared) GetWatchBell() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.WatchBell
+}
+
+func (o *OptionsShared) GetTimeRounding() timeRounding {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return timeRounding{
+		Mode:        o.options.TimeRound,
+		Granularity: o.options.TimeRoundGranularity,
+		Location:    o.options.Timezone,
+	}
+}
+
+func (o *OptionsShared) GetHistogramRange() histRangeMode {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.HistogramRange
+}
+
 func (o *OptionsShared) GetAll() Options {
 	o.mtx.Lock()
 	defer o.mtx.Unlock()
@@ -60,6 +411,15 @@ type OptionMeta struct {
 	Get  func(o *Options) string
 	Set  func(o *Options, value string) error
 	Help string
+
+	// If Bool is true, the option is boolean, and besides the regular
+	// ":set foo=true", it can also be set Vim-style: ":set foo", ":set nofoo"
+	// or ":set foo!" (to toggle it).
+	Bool bool
+
+	// If Requery is true, the option affects the query results, so changing
+	// it with :set reruns the query.
+	Requery bool
 }
 
 var AllOptions = map[string]*OptionMeta{
@@ -100,6 +460,652 @@ var AllOptions = map[string]*OptionMeta{
 	"numlines": {
 		AliasOf: "maxnumlines",
 	}, // }}}
+	"maxrows": { // {{{
+		Get: func(o *Options) string {
+			return fmt.Sprint(o.MaxRows)
+		},
+		Set: func(o *Options, value string) error {
+			maxRows, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if maxRows < 0 {
+				return errors.Errorf("maxrows can't be negative")
+			}
+
+			o.MaxRows = maxRows
+			return nil
+		},
+		Help: "Max number of log messages retained in the logs table; the ones furthest from the view are evicted. 0 means no limit",
+	}, // }}}
+	"maxlinelength": { // {{{
+		Get: func(o *Options) string {
+			return fmt.Sprint(o.MaxLineLength)
+		},
+		Set: func(o *Options, value string) error {
+			maxLineLength, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if maxLineLength < 0 {
+				return errors.Errorf("maxlinelength can't be negative")
+			}
+
+			o.MaxLineLength = maxLineLength
+			return nil
+		},
+		Help: "Max length of a log line in bytes; longer ones are truncated. 0 means no limit",
+	}, // }}}
+	"number": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.ShowLineNumbers)
+		},
+		Set: func(o *Options, value string) error {
+			showLineNumbers, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.ShowLineNumbers = showLineNumbers
+			return nil
+		},
+		Help: "Whether to show row numbers in the logs table",
+		Bool: true,
+	},
+	"nu": {
+		AliasOf: "number",
+	}, // }}}
+	"minimap": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.ShowMinimap)
+		},
+		Set: func(o *Options, value string) error {
+			showMinimap, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.ShowMinimap = showMinimap
+			return nil
+		},
+		Help: "Whether to show the minimap with errors and warnings next to the logs table",
+		Bool: true,
+	}, // }}}
+	"histogram": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.ShowHistogram)
+		},
+		Set: func(o *Options, value string) error {
+			showHistogram, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.ShowHistogram = showHistogram
+			return nil
+		},
+		Help: "Whether to show the timeline histogram above the logs table",
+		Bool: true,
+	}, // }}}
+	"dedup": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.Dedup)
+		},
+		Set: func(o *Options, value string) error {
+			dedup, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.Dedup = dedup
+			return nil
+		},
+		Help: "Whether to collapse consecutive messages with the same text into a single row with a count",
+		Bool: true,
+	}, // }}}
+	"rawmessage": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.RawMessage)
+		},
+		Set: func(o *Options, value string) error {
+			rawMessage, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.RawMessage = rawMessage
+			return nil
+		},
+		Help: "Whether to show the original log line in the message column, instead of the parsed message",
+		Bool: true,
+	}, // }}}
+	"view": { // {{{
+		Get: func(o *Options) string {
+			return string(o.ViewMode)
+		},
+		Set: func(o *Options, value string) error {
+			mode, err := parseViewMode(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.ViewMode = mode
+			return nil
+		},
+		Help: "Layout of the logs table: table (the time, message and other columns) or raw (only the original log lines)",
+	}, // }}}
+	"wrap": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.Wrap)
+		},
+		Set: func(o *Options, value string) error {
+			wrap, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.Wrap = wrap
+			return nil
+		},
+		Help: "Whether to wrap long messages in the logs table into multiple rows",
+		Bool: true,
+	}, // }}}
+	"reverse": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.Reverse)
+		},
+		Set: func(o *Options, value string) error {
+			reverse, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.Reverse = reverse
+			return nil
+		},
+		Help: "Whether to show the logs newest first, with the button to load older ones at the bottom",
+		Bool: true,
+	}, // }}}
+	"linkcursor": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.LinkCursor)
+		},
+		Set: func(o *Options, value string) error {
+			linkCursor, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.LinkCursor = linkCursor
+			return nil
+		},
+		Help: "Whether moving the cursor on the histogram also selects the first message under it in the logs table",
+		Bool: true,
+	}, // }}}
+	"stablecolumns": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.StableColumns)
+		},
+		Set: func(o *Options, value string) error {
+			stableColumns, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.StableColumns = stableColumns
+			return nil
+		},
+		Help: "Whether the context columns, once appeared, are kept in the logs table even if the later results don't have them",
+		Bool: true,
+	}, // }}}
+	"freeze": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.Freeze)
+		},
+		Set: func(o *Options, value string) error {
+			freeze, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.Freeze = freeze
+			return nil
+		},
+		Help: "Whether to hold back the new query results, so that the logs can be read undisturbed",
+		Bool: true,
+	}, // }}}
+	"jumptoerror": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.JumpToError)
+		},
+		Set: func(o *Options, value string) error {
+			jumpToError, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.JumpToError = jumpToError
+			return nil
+		},
+		Help: "Whether to select the first error in the new range after selecting a histogram bar, instead of the latest message",
+		Bool: true,
+	}, // }}}
+	"defaultqueries": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.DefaultQueries)
+		},
+		Set: func(o *Options, value string) error {
+			defaultQueries, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.DefaultQueries = defaultQueries
+			return nil
+		},
+		Help:    "Whether to apply the default queries configured for the logstreams",
+		Bool:    true,
+		Requery: true,
+	},
+	"dq": {
+		AliasOf: "defaultqueries",
+	}, // }}}
+	"countonly": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.CountOnly)
+		},
+		Set: func(o *Options, value string) error {
+			countOnly, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.CountOnly = countOnly
+			return nil
+		},
+		Help: "Whether to only fetch the counts for the histogram, without the log lines",
+		Bool: true,
+	}, // }}}
+	"autorefresh": { // {{{
+		Get: func(o *Options) string {
+			return o.AutoRefresh.String()
+		},
+		Set: func(o *Options, value string) error {
+			if value == "off" {
+				value = "0"
+			}
+
+			autoRefresh, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if autoRefresh != 0 && autoRefresh < 1*time.Second {
+				return errors.Errorf("autorefresh must be either 0 or at least 1s")
+			}
+
+			o.AutoRefresh = autoRefresh
+			return nil
+		},
+		Help: "Interval to rerun the query automatically if the time range is relative; 0 to disable",
+	}, // }}}
+	"redrawinterval": { // {{{
+		Get: func(o *Options) string {
+			return o.RedrawInterval.String()
+		},
+		Set: func(o *Options, value string) error {
+			if value == "off" {
+				value = "0"
+			}
+
+			redrawInterval, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if redrawInterval < 0 {
+				return errors.Errorf("redrawinterval can't be negative")
+			}
+
+			o.RedrawInterval = redrawInterval
+			return nil
+		},
+		Help: "Min interval between the redraws caused by the new query results, which are coalesced in between; 0 to disable",
+	}, // }}}
+	"posthook": { // {{{
+		Get: func(o *Options) string {
+			return o.PostQueryHook
+		},
+		Set: func(o *Options, value string) error {
+			o.PostQueryHook = value
+			return nil
+		},
+		Help: "Shell command which gets the query results on stdin as JSON lines, and prints the transformed ones; empty to disable",
+	}, // }}}
+	"timeout": { // {{{
+		Get: func(o *Options) string {
+			return o.QueryTimeout.String()
+		},
+		Set: func(o *Options, value string) error {
+			if value == "off" {
+				value = "0"
+			}
+
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if timeout < 0 {
+				return errors.Errorf("timeout can't be negative")
+			}
+
+			o.QueryTimeout = timeout
+			return nil
+		},
+		Help: "How long to wait for all logstreams to respond to a query; the ones which didn't are reconnected, and partial results are shown. 0 to disable",
+	}, // }}}
+	"idletimeout": { // {{{
+		Get: func(o *Options) string {
+			return o.IdleTimeout.String()
+		},
+		Set: func(o *Options, value string) error {
+			if value == "off" {
+				value = "0"
+			}
+
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if timeout < 0 {
+				return errors.Errorf("idle timeout can't be negative")
+			}
+
+			o.IdleTimeout = timeout
+			return nil
+		},
+		Help: "How long a logstream can stay without queries before it's disconnected; it's reconnected on the next query. 0 to disable",
+	},
+	"idle-timeout": {
+		AliasOf: "idletimeout",
+	}, // }}}
+	"confirmlarge": { // {{{
+		Get: func(o *Options) string {
+			return o.ConfirmLarge.String()
+		},
+		Set: func(o *Options, value string) error {
+			if value == "off" {
+				value = "0"
+			}
+
+			confirmLarge, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if confirmLarge < 0 {
+				return errors.Errorf("confirmlarge can't be negative")
+			}
+
+			o.ConfirmLarge = confirmLarge
+			return nil
+		},
+		Help: "Ask for confirmation if the time range multiplied by the number of logstreams exceeds it; 0 to disable",
+	},
+	"confirm-large": {
+		AliasOf: "confirmlarge",
+	}, // }}}
+	"arounddur": { // {{{
+		Get: func(o *Options) string {
+			return o.AroundDur.String()
+		},
+		Set: func(o *Options, value string) error {
+			aroundDur, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if aroundDur <= 0 {
+				return errors.Errorf("arounddur must be positive")
+			}
+
+			o.AroundDur = aroundDur
+			return nil
+		},
+		Help: "How much time before and after the selected message :around (or the A key) queries by default",
+	}, // }}}
+	"gapthreshold": { // {{{
+		Get: func(o *Options) string {
+			return o.GapThreshold.String()
+		},
+		Set: func(o *Options, value string) error {
+			if value == "off" {
+				value = "0"
+			}
+
+			gapThreshold, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if gapThreshold != 0 && gapThreshold < 1*time.Minute {
+				return errors.Errorf("gapthreshold must be either 0 or at least 1m")
+			}
+
+			o.GapThreshold = gapThreshold
+			return nil
+		},
+		Help: "Minimum duration without any logs to be highlighted as a gap on the histogram; 0 to disable",
+	}, // }}}
+	"quietthreshold": { // {{{
+		Get: func(o *Options) string {
+			return fmt.Sprint(o.QuietThreshold)
+		},
+		Set: func(o *Options, value string) error {
+			if value == "off" {
+				value = "0"
+			}
+
+			quietThreshold, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if quietThreshold < 0 {
+				return errors.Errorf("quietthreshold can't be negative")
+			}
+
+			o.QuietThreshold = quietThreshold
+			return nil
+		},
+		Help: "Warn about logstreams with no logs if some other logstream has at least this many; 0 to disable",
+	}, // }}}
+	"statuslineleft": { // {{{
+		Get: func(o *Options) string {
+			return o.StatusLineLeft.String()
+		},
+		Set: func(o *Options, value string) error {
+			tmpl, err := parseOptionalStatusLineTemplate(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.StatusLineLeft = tmpl
+			return nil
+		},
+		Help: "Template for the left part of the status line, like {{.State}} {{.LStreams}}; empty for the default",
+	},
+	"stl": {
+		AliasOf: "statuslineleft",
+	}, // }}}
+	"statuslineright": { // {{{
+		Get: func(o *Options) string {
+			return o.StatusLineRight.String()
+		},
+		Set: func(o *Options, value string) error {
+			tmpl, err := parseOptionalStatusLineTemplate(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.StatusLineRight = tmpl
+			return nil
+		},
+		Help: "Template for the right part of the status line, like {{.Selected}} / {{.Total}}; empty for the default",
+	},
+	"stlr": {
+		AliasOf: "statuslineright",
+	}, // }}}
+	"colorcols": { // {{{
+		Get: func(o *Options) string {
+			return o.ColumnColors.String()
+		},
+		Set: func(o *Options, value string) error {
+			rules, err := parseColumnColorRules(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.ColumnColors = rules
+			return nil
+		},
+		Help: "Rules to color context columns by value, like lstream:hash,level=^err:red; empty for no custom colors",
+	}, // }}}
+	"colformats": { // {{{
+		Get: func(o *Options) string {
+			return o.ColumnFormats.String()
+		},
+		Set: func(o *Options, value string) error {
+			rules, err := parseColumnFormatRules(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.ColumnFormats = rules
+			return nil
+		},
+		Help: "Formatters for context columns, like size:bytes,took:duration,ts:epoch_ms; empty to show values as is",
+	}, // }}}
+	"alert": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.Alert)
+		},
+		Set: func(o *Options, value string) error {
+			alert, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.Alert = alert
+			return nil
+		},
+		Help: "Whether to ring the bell when the autorefresh brings new lines",
+		Bool: true,
+	}, // }}}
+	"alerton": { // {{{
+		Get: func(o *Options) string {
+			if o.AlertOn == nil {
+				return ""
+			}
+
+			return o.AlertOn.String()
+		},
+		Set: func(o *Options, value string) error {
+			if value == "" {
+				o.AlertOn = nil
+				return nil
+			}
+
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			// Setting the pattern implies that the alerts are wanted.
+			o.AlertOn = re
+			o.Alert = true
+			return nil
+		},
+		Help: "Regexp to only alert on the new lines matching it; empty to alert on any new line",
+	},
+	"alert-on": {
+		AliasOf: "alerton",
+	}, // }}}
+	"watchbell": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.WatchBell)
+		},
+		Set: func(o *Options, value string) error {
+			watchBell, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.WatchBell = watchBell
+			return nil
+		},
+		Help: "Whether to ring the bell when a watch (see :watch) gets tripped",
+		Bool: true,
+	}, // }}}
+	"timeround": { // {{{
+		Get: func(o *Options) string {
+			return string(o.TimeRound)
+		},
+		Set: func(o *Options, value string) error {
+			mode, err := parseTimeRoundMode(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.TimeRound = mode
+			return nil
+		},
+		Help: "How to round the time range to the timegranularity: ceil, floor or none",
+	}, // }}}
+	"timegranularity": { // {{{
+		Get: func(o *Options) string {
+			return o.TimeRoundGranularity.String()
+		},
+		Set: func(o *Options, value string) error {
+			granularity, err := parseTimeRoundGranularity(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.TimeRoundGranularity = granularity
+			return nil
+		},
+		Help: "Granularity to round the time range to, a whole number of minutes, like 1m or 5m",
+	}, // }}}
+	"histrange": { // {{{
+		Get: func(o *Options) string {
+			return string(o.HistogramRange)
+		},
+		Set: func(o *Options, value string) error {
+			mode, err := parseHistRangeMode(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.HistogramRange = mode
+			return nil
+		},
+		Help: "What the histogram covers: query (the whole queried time range) or data (only where the logs are)",
+	}, // }}}
+}
+
+// parseOptionalStatusLineTemplate is like parseStatusLineTemplate, but an
+// empty string results in a nil template, meaning the default layout.
+func parseOptionalStatusLineTemplate(src string) (*statusLineTemplate, error) {
+	if src == "" {
+		return nil, nil
+	}
+
+	return parseStatusLineTemplate(src)
 }
 
 func OptionMetaByName(name string) *OptionMeta {
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// pasteScreen wraps the tcell.Screen to handle the bracketed paste: tview
+// doesn't know about it, so it'd handle the pasted text as if it was typed,
+// and e.g. a newline in the middle would submit the query before the rest is
+// pasted. Instead, the pasted text is collected until the paste is over, and
+// then delivered as if it was typed, but cleaned up by cleanPastedText, since
+// all our input fields are single-line.
+//
+// Only PollEvent is overridden; it's only called from the tview event loop
+// goroutine, so no locking is needed.
+type pasteScreen struct {
+	tcell.Screen
+
+	pasting bool
+	pasted  strings.Builder
+
+	// pending are the events with the cleaned up pasted text which are yet
+	// to be returned from PollEvent.
+	pending []tcell.Event
+}
+
+// newPasteScreen creates and initializes the screen with the bracketed paste
+// enabled.
+func newPasteScreen() (*pasteScreen, error) {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := screen.Init(); err != nil {
+		return nil, err
+	}
+
+	screen.EnablePaste()
+
+	return &pasteScreen{Screen: screen}, nil
+}
+
+func (s *pasteScreen) PollEvent() tcell.Event {
+	for {
+		if len(s.pending) > 0 {
+			ev := s.pending[0]
+			s.pending = s.pending[1:]
+			return ev
+		}
+
+		ev := s.Screen.PollEvent()
+		switch ev := ev.(type) {
+		case *tcell.EventPaste:
+			if ev.Start() {
+				s.pasting = true
+				s.pasted.Reset()
+				continue
+			}
+
+			s.pasting = false
+			for _, r := range cleanPastedText(s.pasted.String()) {
+				s.pending = append(s.pending, tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+			}
+			continue
+
+		case *tcell.EventKey:
+			if s.pasting {
+				switch ev.Key() {
+				case tcell.KeyRune:
+					s.pasted.WriteRune(ev.Rune())
+				case tcell.KeyEnter, tcell.KeyLF:
+					s.pasted.WriteRune('\n')
+				case tcell.KeyTab:
+					s.pasted.WriteRune('\t')
+				}
+
+				continue
+			}
+		}
+
+		return ev
+	}
+}
+
+// cleanPastedText makes the pasted text suitable for a single-line input
+// field: the leading and trailing newlines are stripped, and the ones in the
+// middle, as well as the tabs, are replaced with spaces.
+func cleanPastedText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.Trim(s, "\r\n")
+
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\r', '\n', '\t':
+			return ' '
+		}
+
+		return r
+	}, s)
+}
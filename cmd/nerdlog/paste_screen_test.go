@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanPastedText(t *testing.T) {
+	assert.Equal(t, "foo", cleanPastedText("foo"))
+	assert.Equal(t, "/foo/ && /bar/", cleanPastedText("\n/foo/ &&\n/bar/\n"))
+	assert.Equal(t, "a b  c", cleanPastedText("a\r\nb\t\tc\r\n"))
+	assert.Equal(t, "", cleanPastedText("\n\n"))
+}
+
+func TestPasteScreen(t *testing.T) {
+	sim := tcell.NewSimulationScreen("")
+	assert.NoError(t, sim.Init())
+	defer sim.Fini()
+
+	s := &pasteScreen{Screen: sim}
+
+	postKey := func(key tcell.Key, r rune) {
+		assert.NoError(t, sim.PostEvent(tcell.NewEventKey(key, r, tcell.ModNone)))
+	}
+
+	postKey(tcell.KeyRune, 'x')
+	assert.NoError(t, sim.PostEvent(tcell.NewEventPaste(true)))
+	postKey(tcell.KeyRune, 'a')
+	postKey(tcell.KeyEnter, 0)
+	postKey(tcell.KeyRune, 'b')
+	postKey(tcell.KeyEnter, 0)
+	assert.NoError(t, sim.PostEvent(tcell.NewEventPaste(false)))
+	postKey(tcell.KeyEnter, 0)
+
+	var got []string
+	for i := 0; i < 5; i++ {
+		ev, ok := s.PollEvent().(*tcell.EventKey)
+		if !assert.True(t, ok) {
+			return
+		}
+
+		got = append(got, ev.Name())
+	}
+
+	// The newline in the middle of the paste becomes a space, and the trailing
+	// one is dropped; the Enter after the paste is delivered as is.
+	assert.Equal(t, []string{"Rune[x]", "Rune[a]", "Rune[ ]", "Rune[b]", "Enter"}, got)
+}
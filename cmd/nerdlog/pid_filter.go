@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// pidFieldNames are the context fields with the id of the process or thread
+// which has logged the message, in the order of preference; see getPIDFilter.
+var pidFieldNames = []string{"pid", "tid"}
+
+// getPIDFilter returns the awk pattern which matches the lines logged by the
+// same process (or thread) as the given message, along with the name and the
+// value of the field it's based on. If the message doesn't have any of the
+// pidFieldNames, ok is false.
+//
+// For the syslog envelope, like "myprogram[1234]:", the pattern matches the
+// envelope exactly; otherwise, the numeric ids are compared numerically, like
+// "pid == 1234", so that both "pid=1234" and the JSON "pid": 1234 match.
+func getPIDFilter(msg *core.LogMsg) (pattern, field, value string, ok bool) {
+	for _, field = range pidFieldNames {
+		value = msg.Context[field]
+		if value != "" {
+			break
+		}
+	}
+
+	if value == "" {
+		return "", "", "", false
+	}
+
+	if program := msg.Context["program"]; field == "pid" && program != "" {
+		return fmt.Sprintf("/%s/", awkEscape(fmt.Sprintf("%s[%s]:", program, value))), field, value, true
+	}
+
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return fmt.Sprintf("%s == %s", field, value), field, value, true
+	}
+
+	return fmt.Sprintf("/%s/", awkEscape(fmt.Sprintf("%s=%s", field, value))), field, value, true
+}
+
+// toggleAwkQueryTerm adds the term to the awk query, joined with "&&", or
+// removes it if the query already has exactly this term; returns the
+// resulting query and whether the term was added. Unlike
+// addToOrRemoveFromAwkQuery, only the whole terms are compared, so e.g.
+// "pid == 123" isn't considered to be a part of "pid == 1234".
+func toggleAwkQueryTerm(query, term string) (newQuery string, added bool) {
+	var terms []string
+	if strings.TrimSpace(query) != "" {
+		terms = strings.Split(query, " && ")
+	}
+
+	kept := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if strings.TrimSpace(t) == term {
+			continue
+		}
+
+		kept = append(kept, strings.TrimSpace(t))
+	}
+
+	if len(kept) == len(terms) {
+		return strings.Join(append(kept, term), " && "), true
+	}
+
+	return strings.Join(kept, " && "), false
+}
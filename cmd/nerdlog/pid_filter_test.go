@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPIDFilter(t *testing.T) {
+	testCases := []struct {
+		descr string
+		ctx   map[string]string
+
+		wantPattern string
+		wantField   string
+		wantValue   string
+		wantOK      bool
+	}{
+		{
+			descr:       "syslog envelope",
+			ctx:         map[string]string{"program": "myprogram", "pid": "1234"},
+			wantPattern: `/myprogram\[1234\]\:/`,
+			wantField:   "pid",
+			wantValue:   "1234",
+			wantOK:      true,
+		},
+		{
+			descr:       "numeric pid without the envelope",
+			ctx:         map[string]string{"pid": "1234"},
+			wantPattern: "pid == 1234",
+			wantField:   "pid",
+			wantValue:   "1234",
+			wantOK:      true,
+		},
+		{
+			descr:       "thread id",
+			ctx:         map[string]string{"program": "myprogram", "tid": "7"},
+			wantPattern: "tid == 7",
+			wantField:   "tid",
+			wantValue:   "7",
+			wantOK:      true,
+		},
+		{
+			descr:       "non-numeric id",
+			ctx:         map[string]string{"tid": "worker-3"},
+			wantPattern: "/tid=worker-3/",
+			wantField:   "tid",
+			wantValue:   "worker-3",
+			wantOK:      true,
+		},
+		{
+			descr: "no id",
+			ctx:   map[string]string{"program": "myprogram"},
+		},
+	}
+
+	for _, tc := range testCases {
+		pattern, field, value, ok := getPIDFilter(&core.LogMsg{Context: tc.ctx})
+		assert.Equal(t, tc.wantOK, ok, tc.descr)
+		assert.Equal(t, tc.wantPattern, pattern, tc.descr)
+		assert.Equal(t, tc.wantField, field, tc.descr)
+		assert.Equal(t, tc.wantValue, value, tc.descr)
+	}
+}
+
+func TestToggleAwkQueryTerm(t *testing.T) {
+	testCases := []struct {
+		query string
+		term  string
+
+		wantQuery string
+		wantAdded bool
+	}{
+		{"", "pid == 123", "pid == 123", true},
+		{"/foo/", "pid == 123", "/foo/ && pid == 123", true},
+		{"/foo/ && pid == 123", "pid == 123", "/foo/", false},
+		{"pid == 123 && /foo/", "pid == 123", "/foo/", false},
+		{"pid == 123", "pid == 123", "", false},
+
+		// Only the whole terms are compared.
+		{"pid == 1234", "pid == 123", "pid == 1234 && pid == 123", true},
+		{"pid == 1234 && pid == 123", "pid == 123", "pid == 1234", false},
+	}
+
+	for _, tc := range testCases {
+		gotQuery, gotAdded := toggleAwkQueryTerm(tc.query, tc.term)
+		assert.Equal(t, tc.wantQuery, gotQuery, tc.query)
+		assert.Equal(t, tc.wantAdded, gotAdded, tc.query)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+)
+
+// postQueryHookTimeout is how long the post-query hook (see the posthook
+// option) may run before it's killed.
+const postQueryHookTimeout = 10 * time.Second
+
+// postQueryHookMsg is how a log message is passed to the post-query hook, and
+// how it's read back from it: as a JSON object per line.
+type postQueryHookMsg struct {
+	// Idx is the index of the message in the query results; the hook should
+	// keep it intact, so that the details which aren't passed to the hook, like
+	// the file and the line number, are restored.
+	Idx int `json:"idx"`
+
+	// Level, Msg and OrigLine are pointers, so that if the hook omits them,
+	// the original ones are kept, as opposed to being reset to empty.
+	Time    time.Time         `json:"time"`
+	Level   *core.LogLevel    `json:"level"`
+	Msg     *string           `json:"msg"`
+	Context map[string]string `json:"context"`
+
+	// OrigLine is the original log line, which is used e.g. in the message
+	// details, by :write and by the HTML report; so if the hook redacts
+	// something, it should redact it here as well.
+	OrigLine *string `json:"orig_line"`
+}
+
+// postQueryHookResult is the result of running the post-query hook in the
+// background, see runPostQueryHook.
+type postQueryHookResult struct {
+	// seq identifies the response which the hook was running for, so that the
+	// results which were already superseded by a newer response are dropped.
+	seq int
+
+	// orig is the original response, and hooked is the transformed one; if
+	// the hook has failed, hooked is nil and err is set.
+	orig   *core.LogRespTotal
+	hooked *core.LogRespTotal
+	err    error
+}
+
+// encodePostQueryHookInput returns the input for the post-query hook: every
+// message as a postQueryHookMsg JSON on its own line.
+func encodePostQueryHookInput(logs []core.LogMsg) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	for i := range logs {
+		msg := &logs[i]
+		if err := enc.Encode(postQueryHookMsg{
+			Idx:     i,
+			Time:    msg.Time,
+			Level:   &msg.Level,
+			Msg:     &msg.Msg,
+			Context: msg.Context,
+
+			OrigLine: &msg.OrigLine,
+		}); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodePostQueryHookOutput parses the output of the post-query hook, in the
+// same format as its input, and returns the resulting messages, based on the
+// original ones with the same idx. The hook may drop messages, and change
+// their time, level, message, context and the original line; whatever is
+// omitted is kept intact. The resulting messages are sorted by time, in case
+// the hook has changed it.
+func decodePostQueryHookOutput(logs []core.LogMsg, output []byte) ([]core.LogMsg, error) {
+	ret := make([]core.LogMsg, 0, len(logs))
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		hookMsg := postQueryHookMsg{Idx: -1}
+		if err := json.Unmarshal([]byte(line), &hookMsg); err != nil {
+			return nil, errors.Annotatef(err, "line %d", lineNum)
+		}
+
+		if hookMsg.Idx < 0 || hookMsg.Idx >= len(logs) {
+			return nil, errors.Errorf("line %d: invalid idx %d", lineNum, hookMsg.Idx)
+		}
+
+		msg := logs[hookMsg.Idx]
+		if !hookMsg.Time.IsZero() {
+			msg.Time = hookMsg.Time
+		}
+		if hookMsg.Level != nil {
+			msg.Level = *hookMsg.Level
+		}
+		if hookMsg.Msg != nil {
+			msg.Msg = *hookMsg.Msg
+		}
+		if hookMsg.Context != nil {
+			msg.Context = hookMsg.Context
+		}
+		if hookMsg.OrigLine != nil {
+			msg.OrigLine = *hookMsg.OrigLine
+		}
+
+		ret = append(ret, msg)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+
+	return ret, nil
+}
+
+// runPostQueryHook runs the given shell command as the post-query hook: it
+// gets the messages from the response on stdin, and prints the transformed
+// ones on stdout (see postQueryHookMsg). The returned response is a copy of
+// the given one, with the transformed messages; the given one is not
+// modified.
+//
+// If the hook doesn't finish in the given timeout, it's killed along with
+// all its child processes (see killPostQueryHook), since otherwise e.g. a
+// child of a pipeline could keep the stdout open and we'd keep waiting.
+func runPostQueryHook(
+	command string, resp *core.LogRespTotal, timeout time.Duration,
+) (*core.LogRespTotal, error) {
+	input, err := encodePostQueryHookInput(resp.Logs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setPostQueryHookProcAttrs(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	timer := time.AfterFunc(timeout, func() {
+		killPostQueryHook(cmd)
+	})
+
+	err = cmd.Wait()
+	if !timer.Stop() {
+		return nil, errors.Errorf("timed out after %s", timeout)
+	}
+
+	if err != nil {
+		if errMsg := strings.TrimSpace(stderr.String()); errMsg != "" {
+			return nil, errors.Annotatef(err, "%s", errMsg)
+		}
+
+		return nil, errors.Trace(err)
+	}
+
+	logs, err := decodePostQueryHookOutput(resp.Logs, stdout.Bytes())
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing the output")
+	}
+
+	ret := *resp
+	ret.Logs = logs
+
+	return &ret, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPostQueryHook(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+
+	resp := &core.LogRespTotal{
+		NumMsgsTotal: 3,
+		Logs: []core.LogMsg{
+			{
+				Time: t0, Msg: "login from 10.0.0.1", Level: core.LogLevelInfo,
+				Context: map[string]string{"lstream": "host-1"}, LogLinenumber: 10,
+			},
+			{
+				Time: t0.Add(time.Second), Msg: "login from 10.0.0.1", Level: core.LogLevelInfo,
+				Context: map[string]string{"lstream": "host-1"}, LogLinenumber: 11,
+			},
+			{
+				Time: t0.Add(2 * time.Second), Msg: "oops", Level: core.LogLevelError,
+				Context: map[string]string{"lstream": "host-2"}, LogLinenumber: 5,
+			},
+		},
+	}
+
+	// Redact the IPs and drop the second message; the line numbers have to be
+	// restored by the idx.
+	got, err := runPostQueryHook(
+		`sed -e 's/10\.0\.0\.1/x.x.x.x/' | grep -v '"idx":1,'`, resp, postQueryHookTimeout,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, got.NumMsgsTotal)
+	assert.Equal(t, []core.LogMsg{
+		{
+			Time: t0, Msg: "login from x.x.x.x", Level: core.LogLevelInfo,
+			Context: map[string]string{"lstream": "host-1"}, LogLinenumber: 10,
+		},
+		{
+			Time: t0.Add(2 * time.Second), Msg: "oops", Level: core.LogLevelError,
+			Context: map[string]string{"lstream": "host-2"}, LogLinenumber: 5,
+		},
+	}, got.Logs)
+
+	// The original response is intact.
+	assert.Equal(t, "login from 10.0.0.1", resp.Logs[0].Msg)
+	assert.Len(t, resp.Logs, 3)
+
+	// Whatever is omitted by the hook is kept intact.
+	got, err = runPostQueryHook(`echo '{"idx": 2, "context": {"lstream": "host-2", "geo": "NL"}}'`, resp, postQueryHookTimeout)
+	assert.NoError(t, err)
+	assert.Equal(t, []core.LogMsg{
+		{
+			Time: t0.Add(2 * time.Second), Msg: "oops", Level: core.LogLevelError,
+			Context: map[string]string{"lstream": "host-2", "geo": "NL"}, LogLinenumber: 5,
+		},
+	}, got.Logs)
+
+	// The original line can be changed too, and the messages are sorted by
+	// the new time.
+	got, err = runPostQueryHook(`printf '%s\n' `+
+		`'{"idx": 0, "time": "2025-03-10T10:00:05Z", "orig_line": "login from x.x.x.x"}' `+
+		`'{"idx": 2}'`, resp, postQueryHookTimeout)
+	assert.NoError(t, err)
+	assert.Equal(t, []core.LogMsg{
+		{
+			Time: t0.Add(2 * time.Second), Msg: "oops", Level: core.LogLevelError,
+			Context: map[string]string{"lstream": "host-2"}, LogLinenumber: 5,
+		},
+		{
+			Time: t0.Add(5 * time.Second), Msg: "login from 10.0.0.1", Level: core.LogLevelInfo,
+			Context: map[string]string{"lstream": "host-1"}, LogLinenumber: 10,
+			OrigLine: "login from x.x.x.x",
+		},
+	}, got.Logs)
+
+	// Failures.
+	_, err = runPostQueryHook("echo 'no geoip db' >&2; exit 1", resp, postQueryHookTimeout)
+	assert.EqualError(t, err, "no geoip db: exit status 1")
+
+	_, err = runPostQueryHook("echo garbage", resp, postQueryHookTimeout)
+	assert.Error(t, err)
+
+	_, err = runPostQueryHook(`echo '{"idx": 3}'`, resp, postQueryHookTimeout)
+	assert.EqualError(t, err, "parsing the output: line 1: invalid idx 3")
+
+	// On timeout, the child processes which keep the stdout open are killed
+	// too, so we don't keep waiting for them.
+	started := time.Now()
+	_, err = runPostQueryHook("sleep 30 | cat", resp, 200*time.Millisecond)
+	assert.EqualError(t, err, "timed out after 200ms")
+	assert.Less(t, int64(time.Since(started)), int64(5*time.Second))
+}
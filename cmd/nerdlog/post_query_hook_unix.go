@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setPostQueryHookProcAttrs makes the post-query hook run in its own process
+// group, so that killPostQueryHook can kill all its processes at once.
+func setPostQueryHookProcAttrs(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killPostQueryHook kills the whole process group of the post-query hook.
+func killPostQueryHook(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
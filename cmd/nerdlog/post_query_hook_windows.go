@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os/exec"
+)
+
+// setPostQueryHookProcAttrs does nothing on Windows, where there are no
+// process groups to kill at once.
+func setPostQueryHookProcAttrs(cmd *exec.Cmd) {}
+
+// killPostQueryHook kills the post-query hook process; on Windows, its child
+// processes are left running.
+func killPostQueryHook(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"encoding/base64"
+	"strings"
+
 	"github.com/dimonomid/nerdlog/shellescape"
 	"github.com/juju/errors"
 )
@@ -12,6 +15,9 @@ type QueryFull struct {
 	Time     string
 	Query    string
 
+	// Exclude is an optional awk pattern; lines matching it are filtered out.
+	Exclude string
+
 	SelectQuery SelectQuery
 }
 
@@ -52,9 +58,66 @@ func (qf *QueryFull) MarshalShellCmdParts() []string {
 	parts = append(parts, "--pattern", qf.Query)
 	parts = append(parts, "--selquery", string(qf.SelectQuery))
 
+	// Only add --exclude if it's set, so that the most common queries (with
+	// no exclude pattern) look the same as before.
+	if qf.Exclude != "" {
+		parts = append(parts, "--exclude", qf.Exclude)
+	}
+
 	return parts
 }
 
+// MarshalCLIArgs returns the query as command line flags, without the
+// executable name and the select query, e.g.:
+//
+//	--lstreams localhost --time -1h --pattern /foo/
+//
+// It's handy to rerun the same query from scripts. The time range is emitted
+// as is, so relative durations like -1h remain relative.
+func (qf *QueryFull) MarshalCLIArgs() string {
+	parts := []string{
+		"--lstreams", qf.LStreams,
+		"--time", qf.Time,
+		"--pattern", qf.Query,
+	}
+
+	if qf.Exclude != "" {
+		parts = append(parts, "--exclude", qf.Exclude)
+	}
+
+	return shellescape.Escape(parts)
+}
+
+// shareTokenPrefix is the prefix of the shareable query tokens, see
+// MarshalToken; the version is there in case the format ever changes.
+const shareTokenPrefix = "nl1."
+
+// MarshalToken returns the query as an opaque single-word token, which can be
+// pasted into a chat and then opened by a teammate with :open. It's just the
+// base64-encoded shell command, so it contains the same data.
+func (qf *QueryFull) MarshalToken() string {
+	return shareTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(qf.MarshalShellCmd()))
+}
+
+// UnmarshalToken is the counterpart of MarshalToken.
+func (qf *QueryFull) UnmarshalToken(token string) error {
+	token = strings.TrimSpace(token)
+	if !strings.HasPrefix(token, shareTokenPrefix) {
+		return errors.Errorf("invalid token: should begin with %q", shareTokenPrefix)
+	}
+
+	cmd, err := base64.RawURLEncoding.DecodeString(token[len(shareTokenPrefix):])
+	if err != nil {
+		return errors.Annotatef(err, "invalid token")
+	}
+
+	if err := qf.UnmarshalShellCmd(string(cmd)); err != nil {
+		return errors.Annotatef(err, "invalid token")
+	}
+
+	return nil
+}
+
 // UnmarshalShellCmdParts unmarshals shell command parts to the receiver
 // QueryFull.  Note that no checks are performed as to whether LStreams,
 // Time or Query are actually valid strings.
@@ -73,6 +136,9 @@ func (qf *QueryFull) UnmarshalShellCmdParts(parts []string) error {
 
 	var lstreamsSet, timeSet, querySet, selectQuerySet bool
 
+	// --exclude is optional, so reset it in case it's missing.
+	qf.Exclude = ""
+
 	for ; len(parts) >= 2; parts = parts[2:] {
 		switch parts[0] {
 		case "--lstreams":
@@ -87,6 +153,8 @@ func (qf *QueryFull) UnmarshalShellCmdParts(parts []string) error {
 		case "--selquery":
 			qf.SelectQuery = SelectQuery(parts[1])
 			selectQuerySet = true
+		case "--exclude":
+			qf.Exclude = parts[1]
 		}
 	}
 
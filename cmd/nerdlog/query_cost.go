@@ -0,0 +1,29 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// estimateQueryCost returns a rough estimate of how much work a query is: the
+// total timespan of logs to scan across all logstreams, i.e. the duration of
+// the time range multiplied by the number of logstreams. It doesn't account
+// for the actual log volume, but it's good enough to catch the accidental
+// multi-month queries across the whole fleet.
+func estimateQueryCost(from, to time.Time, numLStreams int) time.Duration {
+	dur := to.Sub(from)
+	if dur <= 0 {
+		return 0
+	}
+
+	if numLStreams < 1 {
+		numLStreams = 1
+	}
+
+	// Avoid overflows for ridiculously large ranges.
+	if dur > time.Duration(math.MaxInt64)/time.Duration(numLStreams) {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return dur * time.Duration(numLStreams)
+}
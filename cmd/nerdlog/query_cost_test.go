@@ -0,0 +1,21 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateQueryCost(t *testing.T) {
+	from := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 30*time.Hour, estimateQueryCost(from, from.Add(3*time.Hour), 10))
+	assert.Equal(t, 3*time.Hour, estimateQueryCost(from, from.Add(3*time.Hour), 0))
+	assert.Equal(t, time.Duration(0), estimateQueryCost(from, from.Add(-time.Hour), 10))
+	assert.Equal(
+		t, time.Duration(math.MaxInt64),
+		estimateQueryCost(from, from.Add(100*365*24*time.Hour), 1000),
+	)
+}
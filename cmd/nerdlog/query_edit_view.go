@@ -27,6 +27,8 @@ current time is used.
 var lstreamsLabelText = `Logstreams. Comma-separated strings in the format "[yellow][user@]myserver.com[:port[:/path/to/logfile]][-]"
 Examples: "[yellow]user@myserver.com[-]", or "[yellow]user@myserver.com:22:/var/log/syslog[-]"`
 
+var excludeLabelText = `Exclude: awk pattern, matching lines are dropped. Example: "[yellow]/healthcheck/ || /heartbeat/[-]"`
+
 var selectQueryLabelText = `Select field expression. Example: "[yellow]time STICKY, message, lstream, level_name AS level, *[-]".`
 
 type QueryEditViewParams struct {
@@ -53,6 +55,7 @@ type QueryEditView struct {
 	timezoneLabel *tview.TextView
 	lstreamsInput *tview.InputField
 	queryInput    *tview.InputField
+	excludeInput  *tview.InputField
 
 	selectQueryInput   *tview.InputField
 	selectQueryEditBtn *tview.Button
@@ -184,6 +187,17 @@ func NewQueryEditView(
 
 	qev.flex.AddItem(nil, 1, 0, false)
 
+	excludeLabel := tview.NewTextView()
+	excludeLabel.SetText(excludeLabelText)
+	excludeLabel.SetDynamicColors(true)
+	qev.flex.AddItem(excludeLabel, 1, 0, false)
+
+	qev.excludeInput = tview.NewInputField()
+	qev.flex.AddItem(qev.excludeInput, 1, 0, false)
+	focusers = append(focusers, qev.excludeInput)
+
+	qev.flex.AddItem(nil, 1, 0, false)
+
 	selectQueryLabel := tview.NewTextView()
 	selectQueryLabel.SetText(selectQueryLabelText)
 	selectQueryLabel.SetDynamicColors(true)
@@ -319,6 +333,28 @@ func NewQueryEditView(
 		return event
 	})
 
+	qev.excludeInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		event = qev.genericInputHandler(
+			event,
+			getGenericTabHandler(qev.excludeInput),
+			func(qf QueryFull) string { return qf.Exclude },
+			func(qf *QueryFull, part string) { qf.Exclude = part },
+		)
+		if event == nil {
+			return nil
+		}
+
+		switch event.Key() {
+		case tcell.KeyEnter:
+			if err := qev.applyQuery(); err != nil {
+				qev.mainView.handleQueryError(err)
+			}
+			return nil
+		}
+
+		return event
+	})
+
 	qev.selectQueryInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		event = qev.genericInputHandler(
 			event,
@@ -371,7 +407,7 @@ func (qev *QueryEditView) Show(data QueryFull) {
 	qev.mainView.showModal(
 		pageNameEditQueryParams, qev.frame,
 		105,
-		20,
+		23,
 		true,
 	)
 }
@@ -384,6 +420,7 @@ func (qev *QueryEditView) GetQueryFull() QueryFull {
 	return QueryFull{
 		Time:        qev.timeInput.GetText(),
 		Query:       qev.queryInput.GetText(),
+		Exclude:     qev.excludeInput.GetText(),
 		LStreams:    qev.lstreamsInput.GetText(),
 		SelectQuery: SelectQuery(qev.selectQueryInput.GetText()),
 	}
@@ -393,6 +430,7 @@ func (qev *QueryEditView) SetQueryFull(qf QueryFull) {
 	qev.timeInput.SetText(qf.Time)
 	qev.lstreamsInput.SetText(qf.LStreams)
 	qev.queryInput.SetText(qf.Query)
+	qev.excludeInput.SetText(qf.Exclude)
 
 	qev.selectQueryInput.SetText(string(qf.SelectQuery))
 
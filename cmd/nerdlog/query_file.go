@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// stdinFilename is the special filename which means reading from stdin, like
+// "--pattern -".
+const stdinFilename = "-"
+
+// readQueryFile reads the awk pattern from the given file, or from stdin if
+// the filename is "-"; see parseQueryFile for the format.
+func readQueryFile(filename string) (string, error) {
+	var data []byte
+	var err error
+
+	if filename == stdinFilename {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return parseQueryFile(string(data)), nil
+}
+
+// parseQueryFile turns the contents of a query file into a single-line awk
+// pattern, since that's what the query input holds: the lines are trimmed and
+// joined with spaces, and the empty lines and the lines starting with "#" (as
+// comments in awk) are skipped. So a long pattern can be written like this:
+//
+//	# Errors from the payment services
+//	/payment|billing/ &&
+//	  /error|fail/
+func parseQueryFile(data string) string {
+	var parts []string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts = append(parts, line)
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQueryFile(t *testing.T) {
+	type testCase struct {
+		name string
+		data string
+		want string
+	}
+
+	testCases := []testCase{
+		{
+			name: "empty",
+			data: "",
+			want: "",
+		},
+		{
+			name: "single line with trailing newline",
+			data: "/foo/ && !/bar/\n",
+			want: "/foo/ && !/bar/",
+		},
+		{
+			name: "multiple lines with comments",
+			data: "# Errors from the payment services\n/payment|billing/ &&\n\n  /error|fail/\r\n",
+			want: "/payment|billing/ && /error|fail/",
+		},
+		{
+			name: "hash inside of a line is kept",
+			data: "/issue #[0-9]+/",
+			want: "/issue #[0-9]+/",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, parseQueryFile(tc.data))
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// getQueryStatusNotes returns the notes about the query results to be shown in
+// the status line after the query duration, like the timed out logstreams or
+// the truncated results; all the applicable ones are returned, so that e.g. a
+// timeout doesn't hide the fact that the results are also truncated. isWarn
+// is true if any of the notes deserves a warning. quiet is the list of quiet
+// logstreams, see getQuietLStreams.
+func getQueryStatusNotes(resp *core.LogRespTotal, quiet []string) (notes []string, isWarn bool) {
+	if len(resp.TimedOutLStreams) > 0 {
+		notes = append(notes, fmt.Sprintf(
+			"timed out on %d logstream(s), results are partial: %s (see the timeout option)",
+			len(resp.TimedOutLStreams), strings.Join(resp.TimedOutLStreams, ", "),
+		))
+		isWarn = true
+	}
+
+	if numWarnings := getNumWarnings(resp.WarningsByLStream); numWarnings > 0 {
+		notes = append(notes, fmt.Sprintf(
+			"%s, results might be incomplete (press W in the logs table or :warnings to see them)",
+			formatNumWarnings(numWarnings),
+		))
+		isWarn = true
+	}
+
+	if len(resp.NumParseErrorsByLStream) > 0 {
+		notes = append(notes, fmt.Sprintf(
+			"skipped the log lines which failed to parse, check the timestamp layout: %s",
+			formatNumParseErrors(resp.NumParseErrorsByLStream),
+		))
+		isWarn = true
+	}
+
+	if len(quiet) > 0 {
+		notes = append(notes, fmt.Sprintf(
+			"no logs from %d logstream(s) while others have plenty, something might be wrong with them: %s (see the quietthreshold option)",
+			len(quiet), strings.Join(quiet, ", "),
+		))
+		isWarn = true
+	}
+
+	if resp.CountOnly {
+		notes = append(notes, "count-only mode, narrow the range on the histogram, or press Enter on the FETCH row to get the lines")
+	} else if resp.Truncated {
+		notes = append(notes, "results truncated, narrow your range (or press S in the logs table to split it)")
+		isWarn = true
+	}
+
+	return notes, isWarn
+}
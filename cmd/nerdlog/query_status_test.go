@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetQueryStatusNotes(t *testing.T) {
+	notes, isWarn := getQueryStatusNotes(&core.LogRespTotal{}, nil)
+	assert.Empty(t, notes)
+	assert.False(t, isWarn)
+
+	notes, isWarn = getQueryStatusNotes(&core.LogRespTotal{CountOnly: true, Truncated: true}, nil)
+	assert.Equal(t, []string{
+		"count-only mode, narrow the range on the histogram, or press Enter on the FETCH row to get the lines",
+	}, notes)
+	assert.False(t, isWarn)
+
+	// All the notes are there, so e.g. the timeout doesn't hide the truncation.
+	notes, isWarn = getQueryStatusNotes(&core.LogRespTotal{
+		TimedOutLStreams:        []string{"host2"},
+		NumParseErrorsByLStream: map[string]int{"host1": 3},
+		Truncated:               true,
+	}, []string{"host3"})
+	assert.Equal(t, []string{
+		"timed out on 1 logstream(s), results are partial: host2 (see the timeout option)",
+		"skipped the log lines which failed to parse, check the timestamp layout: host1: 3",
+		"no logs from 1 logstream(s) while others have plenty, something might be wrong with them: host3 (see the quietthreshold option)",
+		"results truncated, narrow your range (or press S in the logs table to split it)",
+	}, notes)
+	assert.True(t, isWarn)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/juju/errors"
+)
+
+// queryTabs keeps a few independent queries ("tabs") which the user can switch
+// between. Only the active tab is actually queried: on every switch, the
+// query of the new active tab is applied and rerun. The time range is not a
+// part of a tab, it's shared by all of them.
+type queryTabs struct {
+	// tabs contains the queries of all tabs; for the active one, it might be
+	// outdated, since the actual query is in the MainView, so it's only saved
+	// here before switching to another tab.
+	tabs []QueryFull
+
+	// cur is the index of the active tab.
+	cur int
+}
+
+func newQueryTabs() *queryTabs {
+	return &queryTabs{
+		tabs: []QueryFull{{}},
+	}
+}
+
+// saveCur saves the query of the active tab.
+func (qt *queryTabs) saveCur(qf QueryFull) {
+	qt.tabs[qt.cur] = qf
+}
+
+// add adds a new tab with the given query right after the active one, and
+// makes it active.
+func (qt *queryTabs) add(qf QueryFull) {
+	qt.tabs = append(qt.tabs, QueryFull{})
+	copy(qt.tabs[qt.cur+2:], qt.tabs[qt.cur+1:])
+	qt.cur++
+	qt.tabs[qt.cur] = qf
+}
+
+// closeCur closes the active tab, and makes the next one active (or the
+// previous one, if it was the last tab). The last remaining tab can't be
+// closed.
+func (qt *queryTabs) closeCur() error {
+	if len(qt.tabs) == 1 {
+		return errors.Errorf("can't close the last tab")
+	}
+
+	qt.tabs = append(qt.tabs[:qt.cur], qt.tabs[qt.cur+1:]...)
+	if qt.cur >= len(qt.tabs) {
+		qt.cur = len(qt.tabs) - 1
+	}
+
+	return nil
+}
+
+// switchBy makes the tab which is delta tabs away from the active one active,
+// wrapping around.
+func (qt *queryTabs) switchBy(delta int) {
+	n := len(qt.tabs)
+	qt.cur = ((qt.cur+delta)%n + n) % n
+}
+
+// switchTo makes the tab with the given index (starting from 0) active.
+func (qt *queryTabs) switchTo(idx int) error {
+	if idx < 0 || idx >= len(qt.tabs) {
+		return errors.Errorf("no tab %d, there are %d tabs", idx+1, len(qt.tabs))
+	}
+
+	qt.cur = idx
+	return nil
+}
+
+// getCur returns the query of the active tab.
+func (qt *queryTabs) getCur() QueryFull {
+	return qt.tabs[qt.cur]
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTabs(t *testing.T) {
+	qt := newQueryTabs()
+	qt.saveCur(QueryFull{Query: "/a/"})
+
+	qt.add(QueryFull{Query: "/b/"})
+	assert.Equal(t, 1, qt.cur)
+
+	// New tabs are added right after the active one.
+	qt.switchBy(-1)
+	qt.add(QueryFull{Query: "/c/"})
+	assert.Equal(t, []QueryFull{{Query: "/a/"}, {Query: "/c/"}, {Query: "/b/"}}, qt.tabs)
+	assert.Equal(t, "/c/", qt.getCur().Query)
+
+	// Switching wraps around in both directions.
+	qt.switchBy(2)
+	assert.Equal(t, "/a/", qt.getCur().Query)
+	qt.switchBy(-1)
+	assert.Equal(t, "/b/", qt.getCur().Query)
+
+	assert.NoError(t, qt.switchTo(1))
+	assert.Equal(t, "/c/", qt.getCur().Query)
+	assert.Error(t, qt.switchTo(3))
+
+	// Closing the last tab in the list makes the previous one active.
+	assert.NoError(t, qt.switchTo(2))
+	assert.NoError(t, qt.closeCur())
+	assert.Equal(t, "/c/", qt.getCur().Query)
+
+	assert.NoError(t, qt.switchTo(0))
+	assert.NoError(t, qt.closeCur())
+	assert.Equal(t, "/c/", qt.getCur().Query)
+
+	assert.Error(t, qt.closeCur())
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigQueryTemplates is the file with saved query templates, usually
+// ~/.config/nerdlog/query_templates.yaml.
+type ConfigQueryTemplates struct {
+	// Templates is a map from the template name to the awk pattern, which
+	// can contain placeholders like $svc or ${svc}.
+	Templates map[string]string `yaml:"templates"`
+}
+
+// queryTemplatePlaceholderRegexp matches template placeholders: either $name
+// or ${name}, where the name must start with a lowercase letter or an
+// underscore. This way, awk things like $1 or $NF are not considered
+// placeholders.
+var queryTemplatePlaceholderRegexp = regexp.MustCompile(
+	`\$(?:([a-z_][a-zA-Z0-9_]*)|\{([a-z_][a-zA-Z0-9_]*)\})`,
+)
+
+// loadQueryTemplatesIfExists loads the query templates from the given path;
+// if the file doesn't exist, it's not an error, and an empty map is returned.
+func loadQueryTemplatesIfExists(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+
+		return nil, errors.Annotatef(err, "reading query templates from %s", path)
+	}
+
+	var cfg ConfigQueryTemplates
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Annotatef(err, "unmarshaling yaml from %s", path)
+	}
+
+	if cfg.Templates == nil {
+		cfg.Templates = map[string]string{}
+	}
+
+	return cfg.Templates, nil
+}
+
+func saveQueryTemplates(path string, templates map[string]string) error {
+	data, err := yaml.Marshal(&ConfigQueryTemplates{Templates: templates})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Annotatef(err, "creating dir for %s", path)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return errors.Annotatef(err, "writing query templates to %s", path)
+	}
+
+	return nil
+}
+
+// parseQueryTemplateArgs parses args like "svc=foo" into a map.
+func parseQueryTemplateArgs(args []string) (map[string]string, error) {
+	ret := make(map[string]string, len(args))
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Errorf("invalid argument %q, should be like name=value", arg)
+		}
+
+		ret[kv[0]] = kv[1]
+	}
+
+	return ret, nil
+}
+
+// expandQueryTemplate substitutes all the placeholders in the template with
+// the values from params. If some placeholder doesn't have a value, an error
+// is returned.
+func expandQueryTemplate(tmpl string, params map[string]string) (string, error) {
+	var missing []string
+
+	ret := queryTemplatePlaceholderRegexp.ReplaceAllStringFunc(tmpl, func(ph string) string {
+		submatches := queryTemplatePlaceholderRegexp.FindStringSubmatch(ph)
+		name := submatches[1]
+		if name == "" {
+			name = submatches[2]
+		}
+
+		val, ok := params[name]
+		if !ok {
+			missing = append(missing, name)
+			return ph
+		}
+
+		return val
+	})
+
+	if len(missing) > 0 {
+		return "", errors.Errorf("missing values for: %s", strings.Join(missing, ", "))
+	}
+
+	return ret, nil
+}
+
+func getQueryTemplateNames(templates map[string]string) []string {
+	ret := make([]string, 0, len(templates))
+	for name := range templates {
+		ret = append(ret, name)
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
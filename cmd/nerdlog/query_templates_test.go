@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandQueryTemplate(t *testing.T) {
+	type testCase struct {
+		tmpl   string
+		params map[string]string
+
+		want    string
+		wantErr string
+	}
+
+	testCases := []testCase{
+		{
+			tmpl:   `/service:$svc/ && /level:error/`,
+			params: map[string]string{"svc": "foo"},
+			want:   `/service:foo/ && /level:error/`,
+		},
+		{
+			tmpl:   `/${svc}_v$ver/`,
+			params: map[string]string{"svc": "foo", "ver": "2"},
+			want:   `/foo_v2/`,
+		},
+		{
+			// awk fields like $1 or $NF are left intact.
+			tmpl:   `$1 ~ /$svc/ && $NF == "x"`,
+			params: map[string]string{"svc": "foo"},
+			want:   `$1 ~ /foo/ && $NF == "x"`,
+		},
+		{
+			tmpl:    `/$svc/ && /$host/`,
+			params:  map[string]string{"svc": "foo"},
+			wantErr: "missing values for: host",
+		},
+	}
+
+	for i, tc := range testCases {
+		got, err := expandQueryTemplate(tc.tmpl, tc.params)
+		if tc.wantErr != "" {
+			assert.EqualError(t, err, tc.wantErr, "test case #%d", i)
+			continue
+		}
+
+		assert.NoError(t, err, "test case #%d", i)
+		assert.Equal(t, tc.want, got, "test case #%d", i)
+	}
+}
+
+func TestGetCompletedCmd(t *testing.T) {
+	assert.Equal(t, "run fo", getCompletedCmd("run fo", nil))
+	assert.Equal(t, "run foo ", getCompletedCmd("run f", []string{"run foo"}))
+	assert.Equal(t, "run foo_ba", getCompletedCmd("run f", []string{"run foo_bar", "run foo_baz"}))
+	assert.Equal(t, "run ", getCompletedCmd("run ", []string{"run foo", "run bar"}))
+}
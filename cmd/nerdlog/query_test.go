@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryFullShellCmd(t *testing.T) {
+	type testCase struct {
+		name string
+		qf   QueryFull
+		cmd  string
+	}
+
+	testCases := []testCase{
+		{
+			name: "no exclude",
+			qf: QueryFull{
+				LStreams:    "localhost",
+				Time:        "-1h",
+				Query:       "/foo/",
+				SelectQuery: "time, message",
+			},
+			cmd: "nerdlog --lstreams localhost --time -1h --pattern /foo/ --selquery 'time, message'",
+		},
+		{
+			name: "with exclude",
+			qf: QueryFull{
+				LStreams:    "localhost",
+				Time:        "-1h",
+				Query:       "/foo/",
+				Exclude:     "/healthcheck/ || /heartbeat/",
+				SelectQuery: "time, message",
+			},
+			cmd: "nerdlog --lstreams localhost --time -1h --pattern /foo/ --selquery 'time, message' --exclude '/healthcheck/ || /heartbeat/'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.cmd, tc.qf.MarshalShellCmd())
+
+			// Unmarshal into a QueryFull with some exclude already set, to make sure
+			// it's reset if missing in the command.
+			qf := QueryFull{Exclude: "/stale/"}
+			assert.NoError(t, qf.UnmarshalShellCmd(tc.cmd))
+			assert.Equal(t, tc.qf, qf)
+		})
+	}
+}
+
+func TestQueryFullCLIArgs(t *testing.T) {
+	qf := QueryFull{
+		LStreams:    "host-*",
+		Time:        "-1h",
+		Query:       "/foo bar/",
+		SelectQuery: "time, message",
+	}
+	assert.Equal(t, "--lstreams 'host-*' --time -1h --pattern '/foo bar/'", qf.MarshalCLIArgs())
+
+	qf.Exclude = "/healthcheck/"
+	assert.Equal(t, "--lstreams 'host-*' --time -1h --pattern '/foo bar/' --exclude /healthcheck/", qf.MarshalCLIArgs())
+}
+
+func TestAddToAwkExclude(t *testing.T) {
+	exclude := addToAwkExclude("", "/foo/")
+	assert.Equal(t, "/foo/", exclude)
+
+	exclude = addToAwkExclude(exclude, "/bar/")
+	assert.Equal(t, "/foo/ || /bar/", exclude)
+
+	exclude = addToAwkExclude(exclude, "/foo/")
+	assert.Equal(t, "/foo/ || /bar/", exclude)
+}
+
+func TestQueryFullToken(t *testing.T) {
+	qf := QueryFull{
+		LStreams:    "host-*",
+		Time:        "2025-03-01 10:00 to 2025-03-01 11:00",
+		Query:       "/foo bar/",
+		Exclude:     "/healthcheck/",
+		SelectQuery: "time, message",
+	}
+
+	token := qf.MarshalToken()
+	assert.True(t, strings.HasPrefix(token, "nl1."))
+	assert.NotContains(t, token, " ")
+
+	var qf2 QueryFull
+	assert.NoError(t, qf2.UnmarshalToken(" "+token+"\n"))
+	assert.Equal(t, qf, qf2)
+
+	assert.EqualError(t, qf2.UnmarshalToken("foo"), `invalid token: should begin with "nl1."`)
+	assert.Error(t, qf2.UnmarshalToken("nl1.!!!"))
+	assert.Error(t, qf2.UnmarshalToken("nl1."+base64.RawURLEncoding.EncodeToString([]byte("ls -la"))))
+}
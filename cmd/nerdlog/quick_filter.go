@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// getQuickFilterPattern returns the awk pattern which matches the lines where
+// the given column has the given value, for the quick filter (keys f and F in
+// the logs table).
+//
+// For the fields which are present in the raw line as key=value or
+// "key": "value", the pattern is anchored to the field, like level:error (see
+// the name:value syntax in the docs), so that the value appearing elsewhere
+// in the line doesn't match. For everything else, like the message itself,
+// the message split parts or the fields from the syslog envelope, it's just
+// the value as a regexp.
+func getQuickFilterPattern(msg *core.LogMsg, colName, value, delim string) string {
+	_, isSplitPart := getMsgSplitPart(msg.Msg, delim, colName)
+	if colName == FieldNameMessage || isSplitPart || !isFieldInRawLine(msg, value) {
+		return fmt.Sprintf("/%s/", awkEscape(value))
+	}
+
+	return fmt.Sprintf("%s:%s", colName, awkQuoteFieldValue(value))
+}
+
+// isFieldInRawLine returns whether the value is present in the raw line of
+// the message as a value of some field, like key=value, key="value" or
+// "key": "value". The key itself isn't checked, since it might be an alias of
+// the column name.
+func isFieldInRawLine(msg *core.LogMsg, value string) bool {
+	line := msg.OrigLine
+	if line == "" {
+		line = msg.Msg
+	}
+
+	re := regexp.MustCompile(`\w"?(: *"?|="?)` + regexp.QuoteMeta(value) + `(\W|$)`)
+	return re.MatchString(line)
+}
+
+// awkQuoteFieldValue returns the value to be used in the name:value query
+// syntax: as is if possible, or quoted otherwise.
+func awkQuoteFieldValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t()&|!\"\\") {
+		return value
+	}
+
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+
+	return fmt.Sprintf(`"%s"`, value)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetQuickFilterPattern(t *testing.T) {
+	testCases := []struct {
+		descr   string
+		msg     core.LogMsg
+		colName string
+		value   string
+
+		wantPattern string
+	}{
+		{
+			descr: "key=value field",
+			msg: core.LogMsg{
+				OrigLine: "level=error user=bob msg=failed",
+				Msg:      "failed",
+			},
+			colName:     "user",
+			value:       "bob",
+			wantPattern: "user:bob",
+		},
+		{
+			descr: "JSON field with spaces in the value",
+			msg: core.LogMsg{
+				OrigLine: `{"level": "error", "msg": "connection refused (retrying)"}`,
+				Msg:      "connection refused (retrying)",
+			},
+			colName:     "msg",
+			value:       "connection refused (retrying)",
+			wantPattern: `msg:"connection refused (retrying)"`,
+		},
+		{
+			descr: "value with quotes",
+			msg: core.LogMsg{
+				OrigLine: `path="C:\dir" q=say "hi"`,
+			},
+			colName:     "q",
+			value:       `say "hi"`,
+			wantPattern: `q:"say \"hi\""`,
+		},
+		{
+			descr: "field from the syslog envelope",
+			msg: core.LogMsg{
+				OrigLine: "Oct 15 10:00:00 myhost myprogram[123]: started",
+				Msg:      "started",
+			},
+			colName:     "program",
+			value:       "myprogram",
+			wantPattern: "/myprogram/",
+		},
+		{
+			descr: "message",
+			msg: core.LogMsg{
+				OrigLine: "level=info msg=started",
+				Msg:      "started",
+			},
+			colName:     FieldNameMessage,
+			value:       "started",
+			wantPattern: "/started/",
+		},
+		{
+			descr: "value which is only a prefix of the field value",
+			msg: core.LogMsg{
+				OrigLine: "user=bobby",
+			},
+			colName:     "user",
+			value:       "bob",
+			wantPattern: "/bob/",
+		},
+	}
+
+	for _, tc := range testCases {
+		pattern := getQuickFilterPattern(&tc.msg, tc.colName, tc.value, "")
+		assert.Equal(t, tc.wantPattern, pattern, tc.descr)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sort"
+)
+
+// getQuietLStreams returns the sorted names of the logstreams which have no
+// messages at all, while some other logstream has at least threshold of them:
+// this often means that something is wrong with the quiet ones, rather than
+// they being quiet for real. The logstreams from expectQuiet are never
+// returned. If threshold is 0, the detection is disabled and nil is returned.
+func getQuietLStreams(
+	numMsgsByLStream map[string]int, expectQuiet map[string]struct{}, threshold int,
+) []string {
+	if threshold <= 0 {
+		return nil
+	}
+
+	maxNumMsgs := 0
+	for _, numMsgs := range numMsgsByLStream {
+		if numMsgs > maxNumMsgs {
+			maxNumMsgs = numMsgs
+		}
+	}
+
+	if maxNumMsgs < threshold {
+		return nil
+	}
+
+	var ret []string
+	for name, numMsgs := range numMsgsByLStream {
+		if numMsgs > 0 {
+			continue
+		}
+
+		if _, ok := expectQuiet[name]; ok {
+			continue
+		}
+
+		ret = append(ret, name)
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetQuietLStreams(t *testing.T) {
+	type testCase struct {
+		descr string
+
+		numMsgsByLStream map[string]int
+		expectQuiet      map[string]struct{}
+		threshold        int
+
+		want []string
+	}
+
+	testCases := []testCase{
+		{
+			descr: "some are quiet while others are not",
+			numMsgsByLStream: map[string]int{
+				"host-01": 500,
+				"host-02": 0,
+				"host-03": 12,
+				"host-04": 0,
+			},
+			threshold: 100,
+			want:      []string{"host-02", "host-04"},
+		},
+		{
+			descr: "expected to be quiet",
+			numMsgsByLStream: map[string]int{
+				"host-01": 500,
+				"host-02": 0,
+				"host-03": 0,
+			},
+			expectQuiet: map[string]struct{}{"host-03": {}},
+			threshold:   100,
+			want:        []string{"host-02"},
+		},
+		{
+			descr: "others are below the threshold",
+			numMsgsByLStream: map[string]int{
+				"host-01": 99,
+				"host-02": 0,
+			},
+			threshold: 100,
+			want:      nil,
+		},
+		{
+			descr: "disabled",
+			numMsgsByLStream: map[string]int{
+				"host-01": 500,
+				"host-02": 0,
+			},
+			threshold: 0,
+			want:      nil,
+		},
+		{
+			descr: "all are quiet",
+			numMsgsByLStream: map[string]int{
+				"host-01": 0,
+				"host-02": 0,
+			},
+			threshold: 1,
+			want:      nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		got := getQuietLStreams(tc.numMsgsByLStream, tc.expectQuiet, tc.threshold)
+		assert.Equal(t, tc.want, got, tc.descr)
+	}
+}
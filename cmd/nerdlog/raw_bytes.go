@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// escapeNonPrintable returns the string with all the non-printable characters
+// and invalid UTF-8 bytes escaped Go-style, like \t, \x1b or \u200b. Printable
+// characters, including non-ASCII ones, are left as is; backslashes are
+// doubled, so that the result is unambiguous.
+func escapeNonPrintable(s string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&sb, `\x%02x`, s[i])
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case unicode.IsPrint(r):
+			sb.WriteRune(r)
+		default:
+			// QuoteRune returns the rune in single quotes, like '\x1b', so we
+			// just strip the quotes.
+			quoted := strconv.QuoteRune(r)
+			sb.WriteString(quoted[1 : len(quoted)-1])
+		}
+
+		i += size
+	}
+
+	return sb.String()
+}
+
+// formatRawBytes returns a human-readable representation of the raw bytes of
+// the given log line: the line with non-printable characters escaped, and its
+// hex dump. Meant to help diagnosing encoding issues and binary junk in logs.
+func formatRawBytes(line string) string {
+	var sb strings.Builder
+
+	encodingStr := "valid UTF-8"
+	if !utf8.ValidString(line) {
+		encodingStr = "NOT valid UTF-8"
+	}
+
+	fmt.Fprintf(&sb, "%d bytes, %s\n\n", len(line), encodingStr)
+
+	sb.WriteString("Escaped:\n")
+	sb.WriteString(escapeNonPrintable(line))
+	sb.WriteString("\n\nHex dump:\n")
+	sb.WriteString(hex.Dump([]byte(line)))
+
+	return sb.String()
+}
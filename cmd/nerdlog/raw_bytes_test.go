@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeNonPrintable(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"plain text", "plain text"},
+		{"привет", "привет"},
+		{"tab\there", `tab\there`},
+		{"\x1b[31mred\x1b[0m", `\x1b[31mred\x1b[0m`},
+		{"back\\slash", `back\\slash`},
+		{"zero\u200bwidth", `zero\u200bwidth`},
+		{"bad\xffutf8\xc3", `bad\xffutf8\xc3`},
+		{"nul\x00", `nul\x00`},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, escapeNonPrintable(tc.in), "input: %q", tc.in)
+	}
+}
+
+func TestFormatRawBytes(t *testing.T) {
+	assert.Equal(t,
+		"4 bytes, NOT valid UTF-8\n\n"+
+			"Escaped:\n"+
+			`ab\xff\n`+"\n\n"+
+			"Hex dump:\n"+
+			"00000000  61 62 ff 0a                                       |ab..|\n",
+		formatRawBytes("ab\xff\n"),
+	)
+}
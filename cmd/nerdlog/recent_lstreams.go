@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// maxRecentLStreams is how many recently used logstreams filters are
+// remembered.
+const maxRecentLStreams = 10
+
+// ConfigRecentLStreams is the file with the recently used logstreams filters,
+// usually ~/.config/nerdlog/recent_lstreams.yaml. Unlike the logstream
+// groups, it's not meant to be edited manually: it's maintained
+// automatically.
+type ConfigRecentLStreams struct {
+	// LStreams contains the logstreams filters, the most recent first.
+	LStreams []string `yaml:"lstreams"`
+}
+
+// RecentLStreams is the MRU list of the logstreams filters, persisted to disk.
+type RecentLStreams struct {
+	path string
+
+	mtx   sync.Mutex
+	specs []string
+}
+
+// loadRecentLStreamsIfExists loads the recently used logstreams filters from
+// the given path; if the file doesn't exist, it's not an error, and the list
+// is just empty.
+func loadRecentLStreamsIfExists(path string) (*RecentLStreams, error) {
+	rl := &RecentLStreams{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rl, nil
+		}
+
+		return nil, errors.Annotatef(err, "reading recent logstreams from %s", path)
+	}
+
+	var cfg ConfigRecentLStreams
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Annotatef(err, "unmarshaling yaml from %s", path)
+	}
+
+	rl.specs = cfg.LStreams
+
+	return rl, nil
+}
+
+// loadRecentLStreamsOrEmpty is like loadRecentLStreamsIfExists, but if the
+// file can't be loaded (e.g. it's corrupted), the list just starts empty, and
+// the returned warning tells why: the list is maintained automatically, so
+// it's not worth failing the startup for.
+func loadRecentLStreamsOrEmpty(path string) (rl *RecentLStreams, warning string) {
+	rl, err := loadRecentLStreamsIfExists(path)
+	if err != nil {
+		return &RecentLStreams{path: path}, fmt.Sprintf(
+			"%s; starting with an empty list of recent logstreams", err,
+		)
+	}
+
+	return rl, ""
+}
+
+// Get returns the recently used logstreams filters, the most recent first.
+func (rl *RecentLStreams) Get() []string {
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+
+	return append([]string(nil), rl.specs...)
+}
+
+// Add moves the given logstreams filter to the top of the list, and saves the
+// list if it has changed.
+func (rl *RecentLStreams) Add(spec string) error {
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+
+	if len(rl.specs) > 0 && rl.specs[0] == spec {
+		return nil
+	}
+
+	rl.specs = addRecentLStreams(rl.specs, spec)
+
+	data, err := yaml.Marshal(&ConfigRecentLStreams{LStreams: rl.specs})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(rl.path), 0755); err != nil {
+		return errors.Annotatef(err, "creating dir for %s", rl.path)
+	}
+
+	if err := ioutil.WriteFile(rl.path, data, 0644); err != nil {
+		return errors.Annotatef(err, "writing recent logstreams to %s", rl.path)
+	}
+
+	return nil
+}
+
+// addRecentLStreams returns the new MRU list with the given spec at the top,
+// removing its older occurrence if any, and keeping at most
+// maxRecentLStreams items. Empty specs are ignored.
+func addRecentLStreams(specs []string, spec string) []string {
+	if spec == "" {
+		return specs
+	}
+
+	ret := make([]string, 0, len(specs)+1)
+	ret = append(ret, spec)
+	for _, s := range specs {
+		if s == spec {
+			continue
+		}
+
+		ret = append(ret, s)
+	}
+
+	if len(ret) > maxRecentLStreams {
+		ret = ret[:maxRecentLStreams]
+	}
+
+	return ret
+}
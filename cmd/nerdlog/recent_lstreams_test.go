@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddRecentLStreams(t *testing.T) {
+	type testCase struct {
+		name  string
+		specs []string
+		spec  string
+		want  []string
+	}
+
+	testCases := []testCase{
+		{
+			name:  "empty list",
+			specs: nil,
+			spec:  "foo-*",
+			want:  []string{"foo-*"},
+		},
+		{
+			name:  "new spec goes to the top",
+			specs: []string{"foo-*", "bar-*"},
+			spec:  "baz",
+			want:  []string{"baz", "foo-*", "bar-*"},
+		},
+		{
+			name:  "existing spec is moved to the top",
+			specs: []string{"foo-*", "bar-*", "baz"},
+			spec:  "bar-*",
+			want:  []string{"bar-*", "foo-*", "baz"},
+		},
+		{
+			name:  "empty spec is ignored",
+			specs: []string{"foo-*"},
+			spec:  "",
+			want:  []string{"foo-*"},
+		},
+		{
+			name:  "the oldest one is dropped",
+			specs: []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"},
+			spec:  "11",
+			want:  []string{"11", "1", "2", "3", "4", "5", "6", "7", "8", "9"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, addRecentLStreams(tc.specs, tc.spec))
+		})
+	}
+}
+
+func TestRecentLStreamsPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nerdlog", "recent_lstreams.yaml")
+
+	rl, err := loadRecentLStreamsIfExists(path)
+	assert.NoError(t, err)
+	assert.Empty(t, rl.Get())
+
+	assert.NoError(t, rl.Add("foo-*"))
+	assert.NoError(t, rl.Add("bar-*"))
+
+	rl2, err := loadRecentLStreamsIfExists(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bar-*", "foo-*"}, rl2.Get())
+}
+
+func TestLoadRecentLStreamsOrEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recent_lstreams.yaml")
+
+	// No file yet.
+	rl, warning := loadRecentLStreamsOrEmpty(path)
+	assert.Equal(t, "", warning)
+	assert.Empty(t, rl.Get())
+
+	// A corrupted file is not fatal, the list just starts empty, and it can
+	// still be saved.
+	assert.NoError(t, ioutil.WriteFile(path, []byte("lstreams: [oops"), 0644))
+
+	rl, warning = loadRecentLStreamsOrEmpty(path)
+	assert.Contains(t, warning, "starting with an empty list of recent logstreams")
+	assert.Empty(t, rl.Get())
+
+	assert.NoError(t, rl.Add("foo-*"))
+
+	rl, warning = loadRecentLStreamsOrEmpty(path)
+	assert.Equal(t, "", warning)
+	assert.Equal(t, []string{"foo-*"}, rl.Get())
+}
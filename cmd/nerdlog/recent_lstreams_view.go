@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type RecentLStreamsViewParams struct {
+	// Specs are the recently used logstreams filters, the most recent first.
+	Specs []string
+
+	// OnSelected is called when the user picks a logstreams filter; the view
+	// is already hidden at that point.
+	OnSelected func(spec string)
+}
+
+// RecentLStreamsView is a modal with the recently used logstreams filters,
+// to quickly switch between them.
+type RecentLStreamsView struct {
+	params   RecentLStreamsViewParams
+	mainView *MainView
+
+	table *tview.Table
+	frame *tview.Frame
+}
+
+func NewRecentLStreamsView(
+	mainView *MainView, params *RecentLStreamsViewParams,
+) *RecentLStreamsView {
+	rlv := &RecentLStreamsView{
+		params:   *params,
+		mainView: mainView,
+	}
+
+	rlv.table = tview.NewTable()
+	rlv.table.SetSelectable(true, false)
+
+	for i, spec := range params.Specs {
+		rlv.table.SetCell(i, 0, tview.NewTableCell(fmt.Sprintf("%d ", (i+1)%10)).SetTextColor(tcell.ColorYellow))
+		rlv.table.SetCell(i, 1, tview.NewTableCell(tview.Escape(spec)).SetExpansion(1))
+	}
+
+	rlv.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEnter:
+			row, _ := rlv.table.GetSelection()
+			rlv.selectIdx(row)
+			return nil
+
+		case tcell.KeyEsc:
+			rlv.Hide()
+			return nil
+
+		case tcell.KeyRune:
+			// Digits pick the item right away, like in the numbered list; 0 is
+			// the 10th one.
+			if r := event.Rune(); r >= '0' && r <= '9' {
+				idx := int(r - '1')
+				if r == '0' {
+					idx = 9
+				}
+
+				rlv.selectIdx(idx)
+				return nil
+			}
+		}
+
+		return event
+	})
+
+	rlv.frame = tview.NewFrame(rlv.table).SetBorders(0, 0, 0, 0, 0, 0)
+	rlv.frame.SetBorder(true).SetBorderPadding(0, 0, 1, 1)
+	rlv.frame.SetTitle("Recent logstreams")
+	rlv.frame.AddText(
+		"Enter or 1-9: apply   Esc: close",
+		false, tview.AlignLeft, tcell.ColorGray,
+	)
+
+	return rlv
+}
+
+func (rlv *RecentLStreamsView) selectIdx(idx int) {
+	if idx < 0 || idx >= len(rlv.params.Specs) {
+		return
+	}
+
+	rlv.Hide()
+	rlv.params.OnSelected(rlv.params.Specs[idx])
+}
+
+func (rlv *RecentLStreamsView) Show() {
+	rlv.table.Select(0, 0)
+
+	rlv.mainView.showModal(
+		pageNameRecentLStreams, rlv.frame,
+		90,
+		len(rlv.params.Specs)+4,
+		true,
+	)
+}
+
+func (rlv *RecentLStreamsView) Hide() {
+	rlv.mainView.hideModal(pageNameRecentLStreams, true)
+}
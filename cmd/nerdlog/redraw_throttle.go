@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// getRedrawThrottleDelay returns how long the pending query results have to
+// be held back, so that the logs table and the histogram are redrawn at most
+// once per the given interval (see the redrawinterval option); zero means
+// they can be shown right away. Since every result contains all the logs,
+// holding them back loses nothing: only the latest one is shown in the end.
+//
+// The results with errors, the first results of a new query and the ones
+// with the earlier logs loaded are never held back: the errors have to be
+// shown asap, the first results replace the ones of the previous query which
+// are stale by then, and the earlier logs are requested by the user
+// explicitly.
+func getRedrawThrottleDelay(
+	interval time.Duration, lastApplied, now time.Time, logResps []*core.LogRespTotal,
+) time.Duration {
+	if interval <= 0 || lastApplied.IsZero() {
+		return 0
+	}
+
+	for _, resp := range logResps {
+		if len(resp.Errs) > 0 || resp.First || resp.LoadedEarlier {
+			return 0
+		}
+	}
+
+	delay := lastApplied.Add(interval).Sub(now)
+	if delay < 0 {
+		return 0
+	}
+
+	return delay
+}
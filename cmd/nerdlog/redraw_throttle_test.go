@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRedrawThrottleDelay(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+	interval := 500 * time.Millisecond
+
+	partial := []*core.LogRespTotal{{Partial: true}, {Partial: true}}
+
+	// Disabled, or nothing applied yet.
+	assert.Equal(t, time.Duration(0), getRedrawThrottleDelay(0, t0, t0, partial))
+	assert.Equal(t, time.Duration(0), getRedrawThrottleDelay(interval, time.Time{}, t0, partial))
+
+	// Too soon after the last redraw.
+	assert.Equal(t,
+		300*time.Millisecond,
+		getRedrawThrottleDelay(interval, t0, t0.Add(200*time.Millisecond), partial),
+	)
+
+	// The interval has passed.
+	assert.Equal(t, time.Duration(0), getRedrawThrottleDelay(interval, t0, t0.Add(interval), partial))
+	assert.Equal(t, time.Duration(0), getRedrawThrottleDelay(interval, t0, t0.Add(time.Second), partial))
+
+	// Errors, the first results and the earlier logs are never held back.
+	withErr := append(partial, &core.LogRespTotal{Errs: []error{errors.New("boom")}})
+	assert.Equal(t, time.Duration(0), getRedrawThrottleDelay(interval, t0, t0, withErr))
+
+	first := []*core.LogRespTotal{{Partial: true, First: true}}
+	assert.Equal(t, time.Duration(0), getRedrawThrottleDelay(interval, t0, t0, first))
+
+	loadedEarlier := []*core.LogRespTotal{{LoadedEarlier: true}}
+	assert.Equal(t, time.Duration(0), getRedrawThrottleDelay(interval, t0, t0, loadedEarlier))
+}
@@ -57,6 +57,7 @@ type RowDetailsView struct {
 	okBtn       *tview.Button
 	cancelBtn   *tview.Button
 	showOrigBtn *tview.Button
+	editorBtn   *tview.Button
 	frame       *tview.Frame
 
 	affinity map[string]*rowDetailsFieldAffinity
@@ -454,7 +455,7 @@ func NewRowDetailsView(
 				}
 			}
 
-			if rCtx.valExists && rCtx.field.Name != FieldNameTime && rCtx.field.Name != "lstream" {
+			if rCtx.valExists && rCtx.field.Name != FieldNameTime && rCtx.field.Name != "lstream" && !isFieldNameLocation(rCtx.field.Name) {
 				if !rCtx.filteredByValue {
 					rdv.tbl.AddOption("[ ] Filter logs containing value", getToggleFilterByValue(rCtx.awkValue))
 				} else {
@@ -575,6 +576,28 @@ func NewRowDetailsView(
 			return event
 		})
 		focusers = append(focusers, rdv.showOrigBtn)
+
+		// For local files, offer opening the file in the editor right away,
+		// without going through ssh.
+		if mainView.isMsgFileLocal(*params.Msg) {
+			rdv.editorBtn = tview.NewButton("Open in editor")
+			rdv.editorBtn.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+				switch event.Key() {
+				case tcell.KeyEnter:
+					rdv.Hide()
+					rdv.mainView.openOriginalMsgInEditor(*params.Msg)
+					return nil
+				}
+
+				event = rdv.genericInputHandler(event, getGenericTabHandler(rdv.editorBtn), nil, nil)
+				if event == nil {
+					return nil
+				}
+
+				return event
+			})
+			focusers = append(focusers, rdv.editorBtn)
+		}
 	}
 
 	bottomFlex := tview.NewFlex().SetDirection(tview.FlexColumn)
@@ -587,8 +610,12 @@ func NewRowDetailsView(
 	if rdv.showOrigBtn != nil {
 		bottomFlex.
 			AddItem(rdv.showOrigBtn, 15, 0, false).
-			AddItem(nil, 0, 1, false)
+			AddItem(nil, 1, 0, false)
+	}
+	if rdv.editorBtn != nil {
+		bottomFlex.AddItem(rdv.editorBtn, 16, 0, false)
 	}
+	bottomFlex.AddItem(nil, 0, 1, false)
 	rdv.flex.AddItem(bottomFlex, 1, 0, false)
 
 	rdv.frame = tview.NewFrame(rdv.flex).SetBorders(0, 0, 0, 0, 0, 0)
@@ -622,8 +649,10 @@ func (rdv *RowDetailsView) setData(
 	rdv.msg = msg
 
 	rdv.allNamesSet = map[string]struct{}{
-		FieldNameTime:    {},
-		FieldNameMessage: {},
+		FieldNameTime:       {},
+		FieldNameMessage:    {},
+		FieldNameFilename:   {},
+		FieldNameLinenumber: {},
 	}
 	for _, field := range rdv.sq.Fields {
 		rdv.allNamesSet[field.Name] = struct{}{}
@@ -723,6 +752,9 @@ func (rdv *RowDetailsView) updateUI() {
 			case FieldNameMessage:
 				val = rdv.msg.Msg
 				valExists = true
+			case FieldNameFilename, FieldNameLinenumber:
+				val = getLogMsgColValue(rdv.msg, name.field.Name, "")
+				valExists = val != ""
 			default:
 				val, valExists = rdv.msg.Context[name.field.Name]
 			}
@@ -809,6 +841,7 @@ func (rdv *RowDetailsView) GetQueryFull() QueryFull {
 	return QueryFull{
 		Time:     rdv.queryFull.Time,
 		Query:    rdv.queryFull.Query,
+		Exclude:  rdv.queryFull.Exclude,
 		LStreams: rdv.queryFull.LStreams,
 
 		SelectQuery: rdv.sq.Marshal(),
@@ -859,11 +892,43 @@ func awkEscape(s string) string {
 	s = strings.ReplaceAll(s, "<", "\\<")
 	s = strings.ReplaceAll(s, ">", "\\>")
 	s = strings.ReplaceAll(s, ":", "\\:")
+	s = strings.ReplaceAll(s, "*", "\\*")
+	s = strings.ReplaceAll(s, "+", "\\+")
+	s = strings.ReplaceAll(s, "?", "\\?")
+	s = strings.ReplaceAll(s, "^", "\\^")
+	s = strings.ReplaceAll(s, "$", "\\$")
+	// The slash would terminate the regexp literal.
+	s = strings.ReplaceAll(s, "/", "\\/")
 	// TODO: it's not complete, e.g. quotes aren't handled properly, but
 	// we can polish it after we switch to structured logs everywhere.
 	return s
 }
 
+// addToAwkExclude adds the given part to the exclude awk pattern, which
+// is OR-ed: a line is dropped if it matches any of the parts. If the part is
+// already there, the exclude pattern is returned unchanged.
+func addToAwkExclude(exclude string, part string) string {
+	if exclude == "" {
+		return part
+	}
+
+	if strings.Contains(exclude, part) {
+		return exclude
+	}
+
+	return exclude + " || " + part
+}
+
+// addToAwkQuery adds the given part to the query, AND-ed with the rest. If
+// the part is already there, the query is returned unchanged.
+func addToAwkQuery(query string, part string) string {
+	if strings.Contains(query, part) {
+		return query
+	}
+
+	return addToOrRemoveFromAwkQuery(query, part)
+}
+
 func addToOrRemoveFromAwkQuery(query string, part string) string {
 	if !strings.Contains(query, part) {
 		// Need to add
@@ -11,11 +11,28 @@ var DefaultSelectQuery SelectQuery = FieldNameTime + " STICKY, " + FieldNameMess
 const (
 	FieldNameTime    = "time"
 	FieldNameMessage = "message"
+
+	// FieldNameFilename and FieldNameLinenumber are the file the message comes
+	// from and its line number there; unlike the context fields, they're not
+	// included by the "*", and have to be selected explicitly. They start
+	// with an underscore, so that they don't shadow the context fields (e.g.
+	// JSON keys) named "filename" or "linenumber".
+	FieldNameFilename   = "_filename"
+	FieldNameLinenumber = "_linenumber"
 )
 
 var FieldNamesSpecial = map[string]struct{}{
-	FieldNameTime:    {},
-	FieldNameMessage: {},
+	FieldNameTime:       {},
+	FieldNameMessage:    {},
+	FieldNameFilename:   {},
+	FieldNameLinenumber: {},
+}
+
+// isFieldNameLocation returns whether the field is the location of the
+// message (the file or line number), which is not a part of the log line, so
+// it can't be filtered by.
+func isFieldNameLocation(name string) bool {
+	return name == FieldNameFilename || name == FieldNameLinenumber
 }
 
 // TODO explain
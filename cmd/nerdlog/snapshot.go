@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// maxSnapshotDiffLinesShown is how many added and removed lines are shown in
+// the snapshot diff messagebox (each); the counts are always exact though.
+const maxSnapshotDiffLinesShown = 100
+
+// snapshotNameRegexp is what snapshot names must match: they're used as
+// filenames, so only a safe subset of chars is allowed.
+var snapshotNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// LogSnapshot is a saved result set, usually in
+// ~/.config/nerdlog/snapshots/<name>.yaml, which can be compared against the
+// results of a later query; see the :snapshot command.
+type LogSnapshot struct {
+	// Query is the query which produced the results, as a shell command; it's
+	// only informational.
+	Query   string    `yaml:"query"`
+	SavedAt time.Time `yaml:"saved_at"`
+
+	Lines []LogSnapshotLine `yaml:"lines"`
+}
+
+// LogSnapshotLine is a single log line in the snapshot.
+type LogSnapshotLine struct {
+	Time       time.Time `yaml:"time"`
+	LStream    string    `yaml:"lstream"`
+	Filename   string    `yaml:"filename,omitempty"`
+	Linenumber int       `yaml:"linenumber,omitempty"`
+	Msg        string    `yaml:"msg"`
+
+	// Hash identifies the line when comparing it against the later results;
+	// see getLogSnapshotLineHash.
+	Hash string `yaml:"hash"`
+}
+
+// logSnapshotDiff is the result of comparing the snapshot with the current
+// logs.
+type logSnapshotDiff struct {
+	// Added are the lines which are in the current logs but not in the
+	// snapshot, and Removed are the other way around.
+	Added   []LogSnapshotLine
+	Removed []LogSnapshotLine
+}
+
+// getLogSnapshotPath returns the path of the snapshot with the given name in
+// the given dir.
+func getLogSnapshotPath(dir, name string) (string, error) {
+	if !snapshotNameRegexp.MatchString(name) {
+		return "", errors.Errorf(
+			"invalid snapshot name %q: only letters, digits, dots, dashes and underscores are allowed", name,
+		)
+	}
+
+	return filepath.Join(dir, name+".yaml"), nil
+}
+
+// getLogSnapshotLineHash returns the content hash of the log message. Line
+// numbers are not a part of it, since they're not stable across log rotation:
+// the original line is, and it normally contains the timestamp, so repeated
+// messages are distinguished too.
+func getLogSnapshotLineHash(msg *core.LogMsg) string {
+	content := msg.OrigLine
+	if content == "" {
+		content = msg.Time.UTC().Format(time.RFC3339Nano) + " " + msg.Msg
+	}
+
+	sum := sha1.Sum([]byte(msg.Context["lstream"] + "\x00" + msg.LogFilename + "\x00" + content))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+func newLogSnapshotLine(msg *core.LogMsg) LogSnapshotLine {
+	return LogSnapshotLine{
+		Time:       msg.Time,
+		LStream:    msg.Context["lstream"],
+		Filename:   msg.LogFilename,
+		Linenumber: msg.LogLinenumber,
+		Msg:        msg.Msg,
+		Hash:       getLogSnapshotLineHash(msg),
+	}
+}
+
+func newLogSnapshot(query string, logs []core.LogMsg, savedAt time.Time) *LogSnapshot {
+	snap := &LogSnapshot{
+		Query:   query,
+		SavedAt: savedAt,
+		Lines:   make([]LogSnapshotLine, 0, len(logs)),
+	}
+
+	for i := range logs {
+		snap.Lines = append(snap.Lines, newLogSnapshotLine(&logs[i]))
+	}
+
+	return snap
+}
+
+func saveLogSnapshot(path string, snap *LogSnapshot) error {
+	data, err := yaml.Marshal(snap)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Annotatef(err, "creating dir for %s", path)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return errors.Annotatef(err, "writing snapshot to %s", path)
+	}
+
+	return nil
+}
+
+func loadLogSnapshot(path string) (*LogSnapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading snapshot from %s", path)
+	}
+
+	var snap LogSnapshot
+	if err := yaml.Unmarshal(data, &snap); err != nil {
+		return nil, errors.Annotatef(err, "unmarshaling yaml from %s", path)
+	}
+
+	return &snap, nil
+}
+
+// diffLogSnapshot compares the snapshot with the given logs. Lines are
+// matched by their hashes, as multisets: if the same line is there twice in
+// the logs but only once in the snapshot, one of them is considered added.
+func diffLogSnapshot(snap *LogSnapshot, logs []core.LogMsg) logSnapshotDiff {
+	snapCounts := make(map[string]int, len(snap.Lines))
+	for _, line := range snap.Lines {
+		snapCounts[line.Hash]++
+	}
+
+	var diff logSnapshotDiff
+
+	for i := range logs {
+		line := newLogSnapshotLine(&logs[i])
+		if snapCounts[line.Hash] > 0 {
+			snapCounts[line.Hash]--
+			continue
+		}
+
+		diff.Added = append(diff.Added, line)
+	}
+
+	// Whatever is left unmatched in the snapshot is removed; keep the original
+	// order.
+	for _, line := range snap.Lines {
+		if snapCounts[line.Hash] > 0 {
+			snapCounts[line.Hash]--
+			diff.Removed = append(diff.Removed, line)
+		}
+	}
+
+	return diff
+}
+
+// formatLogSnapshotDiff returns the human-readable diff, with the lines
+// prefixed with "+" or "-" like in a unified diff.
+func formatLogSnapshotDiff(name string, snap *LogSnapshot, diff logSnapshotDiff) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Snapshot %s, saved at %s, %d lines\n", name, snap.SavedAt.Format(time.RFC3339), len(snap.Lines))
+	fmt.Fprintf(&sb, "Snapshot query: %s\n\n", snap.Query)
+
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 {
+		sb.WriteString("No changes\n")
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "%d added, %d removed\n", len(diff.Added), len(diff.Removed))
+
+	writeLines := func(prefix string, lines []LogSnapshotLine) {
+		if len(lines) == 0 {
+			return
+		}
+
+		sb.WriteString("\n")
+		for i, line := range lines {
+			if i == maxSnapshotDiffLinesShown {
+				fmt.Fprintf(&sb, "%s ... %d more\n", prefix, len(lines)-i)
+				break
+			}
+
+			fmt.Fprintf(
+				&sb, "%s %s %s %s\n",
+				prefix, line.Time.Format(time.RFC3339), line.LStream, line.Msg,
+			)
+		}
+	}
+
+	writeLines("+", diff.Added)
+	writeLines("-", diff.Removed)
+
+	return sb.String()
+}
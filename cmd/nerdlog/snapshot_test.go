@@ -0,0 +1,103 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffLogSnapshot(t *testing.T) {
+	mkMsg := func(lstream string, sec int, msg string) core.LogMsg {
+		return core.LogMsg{
+			Time:     time.Unix(int64(sec), 0).UTC(),
+			Msg:      msg,
+			Context:  map[string]string{"lstream": lstream},
+			OrigLine: time.Unix(int64(sec), 0).UTC().Format(time.RFC3339) + " " + msg,
+		}
+	}
+
+	snap := newLogSnapshot("nerdlog", []core.LogMsg{
+		mkMsg("a", 1, "foo"),
+		mkMsg("a", 2, "error: bar"),
+		mkMsg("b", 2, "error: bar"),
+		mkMsg("a", 3, "dup"),
+	}, time.Unix(10, 0))
+
+	testCases := []struct {
+		name string
+		logs []core.LogMsg
+
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{
+			name: "no changes",
+			logs: []core.LogMsg{
+				mkMsg("a", 1, "foo"),
+				mkMsg("a", 2, "error: bar"),
+				mkMsg("b", 2, "error: bar"),
+				mkMsg("a", 3, "dup"),
+			},
+		},
+		{
+			name: "added and removed",
+			logs: []core.LogMsg{
+				mkMsg("a", 1, "foo"),
+				// Same message but on another logstream.
+				mkMsg("c", 2, "error: bar"),
+				mkMsg("b", 2, "error: bar"),
+				mkMsg("a", 3, "dup"),
+				mkMsg("a", 3, "dup"),
+			},
+			wantAdded:   []string{"c error: bar", "a dup"},
+			wantRemoved: []string{"a error: bar"},
+		},
+	}
+
+	formatLines := func(lines []LogSnapshotLine) []string {
+		var ret []string
+		for _, line := range lines {
+			ret = append(ret, line.LStream+" "+line.Msg)
+		}
+		return ret
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff := diffLogSnapshot(snap, tc.logs)
+			assert.Equal(t, tc.wantAdded, formatLines(diff.Added))
+			assert.Equal(t, tc.wantRemoved, formatLines(diff.Removed))
+		})
+	}
+}
+
+func TestLogSnapshotSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := getLogSnapshotPath(dir, "../foo")
+	assert.Error(t, err)
+
+	path, err := getLogSnapshotPath(dir, "before-fix")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "before-fix.yaml"), path)
+
+	snap := newLogSnapshot("nerdlog --pattern /error/", []core.LogMsg{
+		{
+			Time:          time.Unix(1, 0).UTC(),
+			LogFilename:   "/var/log/syslog",
+			LogLinenumber: 42,
+			Msg:           "error: foo",
+			Context:       map[string]string{"lstream": "a"},
+			OrigLine:      "Jan 1 00:00:01 error: foo",
+		},
+	}, time.Unix(10, 0).UTC())
+
+	assert.NoError(t, saveLogSnapshot(path, snap))
+
+	loaded, err := loadLogSnapshot(path)
+	assert.NoError(t, err)
+	assert.Equal(t, snap, loaded)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/rivo/tview"
+)
+
+// sparklineWidth is the max number of chars in the sparklines shown in the
+// :lstreams modal.
+const sparklineWidth = 30
+
+// sparklineRunes are the chars to render the sparklines, from the lowest to
+// the highest. Zero is always rendered as a space, so that the idle periods
+// are easy to tell from the quiet ones.
+var sparklineRunes = []rune("▁▂▃▄▅▆▇█")
+
+// getSparklineBuckets splits the range [from, to) into at most width buckets
+// (but not less than a minute each), and returns the number of messages in
+// each of them according to the minute stats.
+func getSparklineBuckets(
+	minuteStats map[int64]core.MinuteStatsItem, from, to time.Time, width int,
+) []int {
+	fromUnix, toUnix := from.Unix(), to.Unix()
+	if toUnix <= fromUnix || width <= 0 {
+		return nil
+	}
+
+	numMinutes := int((toUnix - fromUnix + 59) / 60)
+	if width > numMinutes {
+		width = numMinutes
+	}
+
+	ret := make([]int, width)
+	for k, v := range minuteStats {
+		if k < fromUnix || k >= toUnix {
+			continue
+		}
+
+		idx := int((k - fromUnix) * int64(width) / (toUnix - fromUnix))
+		ret[idx] += v.NumMsgs
+	}
+
+	return ret
+}
+
+// renderSparkline renders the buckets as a sparkline, scaled so that maxVal
+// is the highest char; it's a parameter so that multiple sparklines can be
+// compared with each other.
+func renderSparkline(buckets []int, maxVal int) string {
+	var sb strings.Builder
+	for _, v := range buckets {
+		if v <= 0 || maxVal <= 0 {
+			sb.WriteRune(' ')
+			continue
+		}
+
+		idx := (v*len(sparklineRunes) - 1) / maxVal
+		if idx >= len(sparklineRunes) {
+			idx = len(sparklineRunes) - 1
+		}
+
+		sb.WriteRune(sparklineRunes[idx])
+	}
+
+	return sb.String()
+}
+
+// formatLStreamsActivity returns a line per logstream, sorted by name, with
+// the sparkline of its activity over the range [from, to) and the total
+// number of messages. All sparklines are scaled the same way, so the noisy
+// logstreams stand out. Returns an empty string if there are no logstreams.
+func formatLStreamsActivity(
+	minuteStatsByLStream map[string]map[int64]core.MinuteStatsItem, from, to time.Time,
+) string {
+	names := make([]string, 0, len(minuteStatsByLStream))
+	bucketsByName := make(map[string][]int, len(minuteStatsByLStream))
+	maxNameLen := 0
+	maxVal := 0
+
+	for name, minuteStats := range minuteStatsByLStream {
+		names = append(names, name)
+		if len(name) > maxNameLen {
+			maxNameLen = len(name)
+		}
+
+		buckets := getSparklineBuckets(minuteStats, from, to, sparklineWidth)
+		for _, v := range buckets {
+			if v > maxVal {
+				maxVal = v
+			}
+		}
+
+		bucketsByName[name] = buckets
+	}
+
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		total := 0
+		for _, v := range bucketsByName[name] {
+			total += v
+		}
+
+		fmt.Fprintf(
+			&sb, "%s%s [yellow]%s[-] %d\n",
+			tview.Escape(name), strings.Repeat(" ", maxNameLen-len(name)),
+			renderSparkline(bucketsByName[name], maxVal), total,
+		)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSparklineBuckets(t *testing.T) {
+	from := time.Unix(600, 0)
+	to := time.Unix(600+10*60, 0)
+
+	minuteStats := map[int64]core.MinuteStatsItem{
+		540:  {NumMsgs: 100}, // Before the range
+		600:  {NumMsgs: 1},
+		660:  {NumMsgs: 2},
+		900:  {NumMsgs: 5},
+		1140: {NumMsgs: 3},
+		1200: {NumMsgs: 100}, // After the range
+	}
+
+	// Less minutes than the width: a bucket per minute.
+	assert.Equal(t,
+		[]int{1, 2, 0, 0, 0, 5, 0, 0, 0, 3},
+		getSparklineBuckets(minuteStats, from, to, 30),
+	)
+
+	// Two minutes per bucket.
+	assert.Equal(t,
+		[]int{3, 0, 5, 0, 3},
+		getSparklineBuckets(minuteStats, from, to, 5),
+	)
+
+	assert.Nil(t, getSparklineBuckets(minuteStats, to, from, 5))
+}
+
+func TestRenderSparkline(t *testing.T) {
+	assert.Equal(t, "▁▂ ▄█", renderSparkline([]int{1, 2, 0, 4, 8}, 8))
+	assert.Equal(t, "▁  ", renderSparkline([]int{1, 0, 0}, 100))
+	assert.Equal(t, "   ", renderSparkline([]int{0, 0, 0}, 0))
+}
+
+func TestFormatLStreamsActivity(t *testing.T) {
+	from := time.Unix(600, 0)
+	to := time.Unix(600+4*60, 0)
+
+	got := formatLStreamsActivity(map[string]map[int64]core.MinuteStatsItem{
+		"host-02": {
+			600: {NumMsgs: 8},
+			780: {NumMsgs: 8},
+		},
+		"host-1": {
+			660: {NumMsgs: 1},
+		},
+	}, from, to)
+
+	assert.Equal(t,
+		"host-02 [yellow]█  █[-] 16\n"+
+			"host-1  [yellow] ▁  [-] 1\n",
+		got,
+	)
+
+	assert.Equal(t, "", formatLStreamsActivity(nil, from, to))
+}
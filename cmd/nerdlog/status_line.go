@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/juju/errors"
+)
+
+// statusLineData contains all the values which can be referenced from the
+// status line templates, like {{.NumIdle}}. All the string values are already
+// escaped for tview, so the templates can freely use color tags like
+// [yellow]...[-] around them.
+type statusLineData struct {
+	// State is one of: "idle", "busy", "conn" (connecting), or "none" (the
+	// logstreams filter doesn't match anything).
+	State string
+
+	// NumIdle, NumBusy, NumUnused and NumOther are the numbers of logstreams
+	// which are connected and idle, connected and busy, disconnected due to
+	// the idle timeout (they'll be reconnected on the next query), and all the
+	// rest (connecting, disconnected etc).
+	NumIdle   int
+	NumBusy   int
+	NumUnused int
+	NumOther  int
+
+	// NumLStreams is the total number of logstreams the filter resolves to.
+	NumLStreams int
+
+	// LStreams is the logstreams filter, as entered by the user.
+	LStreams string
+	// Muted is the comma-separated list of muted logstreams.
+	Muted string
+	// Union is the comma-separated list of the named queries whose union is
+	// shown, see :union.
+	Union string
+
+	Query   string
+	Exclude string
+
+	// LineRange is the range of lines being shown, like
+	// "/var/log/syslog:1000-2000", if the lines were queried with :lines;
+	// otherwise it's empty.
+	LineRange string
+
+	// Tab is the number of the current query tab (starting from 1), and
+	// NumTabs is the total number of tabs.
+	Tab     int
+	NumTabs int
+
+	// TimeRange is the current time range, formatted the same way as in the
+	// top-right corner, like "last 1h".
+	TimeRange string
+
+	// Selected is the number of the selected row in the logs table, or 0 if
+	// none is selected.
+	Selected int
+	// Loaded is how many log messages are loaded, and Total is how many
+	// messages match the query in total.
+	Loaded int
+	Total  int
+	// Truncated is true if not all the messages for the time range are loaded.
+	Truncated bool
+	// NumWarnings is the number of warnings reported by the agents during the
+	// last query.
+	NumWarnings int
+	// NumQuiet is the number of logstreams which had no logs in the last
+	// query while others had plenty; see the quietthreshold option.
+	NumQuiet int
+	// NumTripped is the number of tripped watches; see the :watch command.
+	NumTripped int
+	// Frozen is true if the freeze option is on, so the new query results
+	// aren't shown; FrozenPending is true if there are some.
+	Frozen        bool
+	FrozenPending bool
+	// SearchMatch is like "3/17" if the selected message is the 3rd of 17
+	// search matches (see "/" in the logs table), or "-/17" if it's not a
+	// match; empty if there's no search.
+	SearchMatch string
+}
+
+// statusLineTemplate is a user-provided template for the status line, parsed
+// once when the option is set. It uses the text/template syntax, with the
+// statusLineData as the data.
+type statusLineTemplate struct {
+	src  string
+	tmpl *template.Template
+}
+
+// parseStatusLineTemplate parses the given status line template. Besides the
+// syntax, it also checks that the template only refers to existing values.
+func parseStatusLineTemplate(src string) (*statusLineTemplate, error) {
+	tmpl, err := template.New("statusline").Parse(src)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	// Parse alone doesn't catch references to non-existing fields, so try to
+	// execute it too.
+	if err := tmpl.Execute(&strings.Builder{}, &statusLineData{}); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &statusLineTemplate{
+		src:  src,
+		tmpl: tmpl,
+	}, nil
+}
+
+func (t *statusLineTemplate) String() string {
+	if t == nil {
+		return ""
+	}
+
+	return t.src
+}
+
+// render executes the template with the given data; if it fails, the error
+// is rendered instead, so that the user can see what's wrong.
+func (t *statusLineTemplate) render(data *statusLineData) string {
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, data); err != nil {
+		return "[red]status line template error:[-] " + err.Error()
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusLineTemplate(t *testing.T) {
+	data := &statusLineData{
+		State:     "idle",
+		NumIdle:   3,
+		NumOther:  1,
+		LStreams:  "myhost-*",
+		Query:     "/error/",
+		TimeRange: "last 1h",
+		Selected:  5,
+		Loaded:    250,
+		Total:     1234,
+		Truncated: true,
+	}
+
+	testCases := []struct {
+		name    string
+		src     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "plain text",
+			src:  "hello",
+			want: "hello",
+		},
+		{
+			name: "values and colors",
+			src:  "{{.State}} [green]{{.NumIdle}}[-]/{{.NumOther}} | {{.LStreams}} | {{.Query}} | {{.TimeRange}}",
+			want: "idle [green]3[-]/1 | myhost-* | /error/ | last 1h",
+		},
+		{
+			name: "conditionals",
+			src:  "{{.Selected}} / {{.Loaded}}{{if .Truncated}}!{{end}} / {{.Total}}",
+			want: "5 / 250! / 1234",
+		},
+		{
+			name:    "syntax error",
+			src:     "{{.State",
+			wantErr: "unclosed action",
+		},
+		{
+			name:    "unknown field",
+			src:     "{{.Foo}}",
+			wantErr: "can't evaluate field Foo",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseStatusLineTemplate(tc.src)
+			if tc.wantErr != "" {
+				if assert.NotNil(t, err) {
+					assert.Contains(t, err.Error(), tc.wantErr)
+				}
+				return
+			}
+
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			assert.Equal(t, tc.src, tmpl.String())
+			assert.Equal(t, tc.want, tmpl.render(data))
+		})
+	}
+}
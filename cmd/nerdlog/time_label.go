@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// minQueryInputWidth is the minimum width of the query input, which the time
+// label next to it is not allowed to eat into on narrow screens.
+const minQueryInputWidth = 20
+
+// topFlexFixedWidth is the total width of the fixed-width items in the top
+// row, other than the time label and the default queries label: the query
+// label, the Edit and Menu buttons, and the spacers.
+const topFlexFixedWidth = 12 + 1 + 1 + 1 + 6 + 1 + 6
+
+// fitTimeRangeStr returns the time range string (as returned by
+// getTimeRangeStr) which fits into the given width: if the full one doesn't,
+// the duration suffix like " (1h)" is dropped, and if it still doesn't, it's
+// truncated. If maxWidth is negative, the width is unknown (the screen wasn't
+// drawn yet), and the full string is returned.
+func fitTimeRangeStr(s string, maxWidth int) string {
+	if maxWidth < 0 || tview.TaggedStringWidth(s) <= maxWidth {
+		return s
+	}
+
+	if idx := strings.LastIndex(s, " ("); idx > 0 && strings.HasSuffix(s, ")") {
+		s = s[:idx]
+		if tview.TaggedStringWidth(s) <= maxWidth {
+			return s
+		}
+	}
+
+	if maxWidth == 0 {
+		return ""
+	}
+
+	// There's no room for the full string even without the duration, so cut it,
+	// showing that it was cut.
+	runes := []rune(s)
+	if len(runes) > maxWidth {
+		runes = append(runes[:maxWidth-1], '…')
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFitTimeRangeStr(t *testing.T) {
+	type testCase struct {
+		name     string
+		s        string
+		maxWidth int
+		want     string
+	}
+
+	full := "Mar27 12:00 to Mar27 13:00 (1h)"
+
+	testCases := []testCase{
+		{
+			name:     "unknown width",
+			s:        full,
+			maxWidth: -1,
+			want:     full,
+		},
+		{
+			name:     "fits",
+			s:        full,
+			maxWidth: 100,
+			want:     full,
+		},
+		{
+			name:     "fits exactly",
+			s:        full,
+			maxWidth: len(full),
+			want:     full,
+		},
+		{
+			name:     "duration dropped",
+			s:        full,
+			maxWidth: 30,
+			want:     "Mar27 12:00 to Mar27 13:00",
+		},
+		{
+			name:     "truncated",
+			s:        full,
+			maxWidth: 10,
+			want:     "Mar27 12:…",
+		},
+		{
+			name:     "no room at all",
+			s:        full,
+			maxWidth: 0,
+			want:     "",
+		},
+		{
+			name:     "no duration to drop",
+			s:        "last 1h",
+			maxWidth: 5,
+			want:     "last…",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, fitTimeRangeStr(tc.s, tc.maxWidth))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import "time"
+
+// timeRangePreset is a predefined time range which can be applied without
+// typing it manually.
+type timeRangePreset struct {
+	Title string
+
+	// GetRange returns the time range of the preset. The now is the current
+	// time in the timezone used on the UI, so that date-aware presets like
+	// "Today" are computed in that timezone.
+	GetRange func(now time.Time) (from, to TimeOrDur)
+}
+
+var timeRangePresets = []timeRangePreset{
+	newRelativeTimeRangePreset("15m", 15*time.Minute),
+	newRelativeTimeRangePreset("1h", 1*time.Hour),
+	newRelativeTimeRangePreset("6h", 6*time.Hour),
+	newRelativeTimeRangePreset("24h", 24*time.Hour),
+	newRelativeTimeRangePreset("7d", 7*24*time.Hour),
+	{
+		Title: "Today",
+		GetRange: func(now time.Time) (from, to TimeOrDur) {
+			return TimeOrDur{Time: startOfDay(now, 0)}, TimeOrDur{}
+		},
+	},
+	{
+		Title: "Yesterday",
+		GetRange: func(now time.Time) (from, to TimeOrDur) {
+			return TimeOrDur{Time: startOfDay(now, -1)}, TimeOrDur{Time: startOfDay(now, 0)}
+		},
+	},
+}
+
+func newRelativeTimeRangePreset(title string, dur time.Duration) timeRangePreset {
+	return timeRangePreset{
+		Title: title,
+		GetRange: func(now time.Time) (from, to TimeOrDur) {
+			return TimeOrDur{Dur: -dur}, TimeOrDur{}
+		},
+	}
+}
+
+// startOfDay returns the midnight of the day which is daysOffset days from
+// the day of t, in the same location as t.
+func startOfDay(t time.Time, daysOffset int) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day+daysOffset, 0, 0, 0, 0, t.Location())
+}
+
+func getTimeRangePresetTitles() []string {
+	ret := make([]string, 0, len(timeRangePresets))
+	for _, preset := range timeRangePresets {
+		ret = append(ret, preset.Title)
+	}
+
+	return ret
+}
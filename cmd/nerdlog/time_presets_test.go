@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeRangePresets(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no tzdata: %s", err)
+	}
+
+	// The day after the DST switch, so the midnights are 23h apart.
+	now := time.Date(2025, time.March, 10, 1, 30, 0, 0, loc)
+
+	getRange := func(title string) (from, to TimeOrDur) {
+		for _, preset := range timeRangePresets {
+			if preset.Title == title {
+				return preset.GetRange(now)
+			}
+		}
+
+		t.Fatalf("no preset %q", title)
+		return TimeOrDur{}, TimeOrDur{}
+	}
+
+	from, to := getRange("1h")
+	assert.Equal(t, TimeOrDur{Dur: -1 * time.Hour}, from)
+	assert.True(t, to.IsZero())
+
+	from, to = getRange("Today")
+	assert.Equal(t, time.Date(2025, time.March, 10, 0, 0, 0, 0, loc), from.Time)
+	assert.True(t, to.IsZero())
+
+	from, to = getRange("Yesterday")
+	assert.Equal(t, time.Date(2025, time.March, 9, 0, 0, 0, 0, loc), from.Time)
+	assert.Equal(t, time.Date(2025, time.March, 10, 0, 0, 0, 0, loc), to.Time)
+	assert.Equal(t, 23*time.Hour, to.Time.Sub(from.Time))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// timeRoundMode specifies how the time range endpoints are rounded to the
+// granularity; see the timeround option.
+type timeRoundMode string
+
+const (
+	// timeRoundCeil rounds both endpoints forward. This is the default, for
+	// backward compatibility.
+	timeRoundCeil timeRoundMode = "ceil"
+	// timeRoundFloor rounds both endpoints backward.
+	timeRoundFloor timeRoundMode = "floor"
+	// timeRoundNone leaves the endpoints as they are.
+	timeRoundNone timeRoundMode = "none"
+)
+
+// minTimeRoundGranularity is the finest granularity supported: the
+// nerdlog_agent.sh works with whole minutes, and so does the histogram.
+const minTimeRoundGranularity = 1 * time.Minute
+
+func parseTimeRoundMode(s string) (timeRoundMode, error) {
+	switch mode := timeRoundMode(s); mode {
+	case timeRoundCeil, timeRoundFloor, timeRoundNone:
+		return mode, nil
+	}
+
+	return "", errors.Errorf("invalid time rounding mode %q, valid values are: ceil, floor, none", s)
+}
+
+func parseTimeRoundGranularity(s string) (time.Duration, error) {
+	granularity, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	if granularity < minTimeRoundGranularity || granularity%minTimeRoundGranularity != 0 {
+		return 0, errors.Errorf("granularity must be a whole number of minutes, like 1m or 5m")
+	}
+
+	return granularity, nil
+}
+
+// timeRounding is how the time range is snapped to the grid, both when
+// querying and on the histogram.
+type timeRounding struct {
+	Mode        timeRoundMode
+	Granularity time.Duration
+
+	// Location is the time zone whose grid the time is snapped to, so that
+	// e.g. with the 1h granularity, the time is rounded to whole hours on the
+	// clock which the user sees even if the zone offset isn't a whole number
+	// of hours. Nil means the time's own location.
+	Location *time.Location
+}
+
+func (r timeRounding) getGranularity() time.Duration {
+	if r.Granularity < minTimeRoundGranularity {
+		return minTimeRoundGranularity
+	}
+
+	return r.Granularity
+}
+
+// round rounds the time according to the mode and granularity.
+func (r timeRounding) round(t time.Time) time.Time {
+	switch r.Mode {
+	case timeRoundNone:
+		return t
+	case timeRoundFloor:
+		return r.floor(t)
+	default:
+		return r.ceil(t)
+	}
+}
+
+// floor rounds the time backward to the granularity, regardless of the mode.
+func (r timeRounding) floor(t time.Time) time.Time {
+	return truncateInZone(r.in(t), r.getGranularity())
+}
+
+// ceil rounds the time forward to the granularity, regardless of the mode.
+func (r timeRounding) ceil(t time.Time) time.Time {
+	return truncateCeil(r.in(t), r.getGranularity())
+}
+
+func (r timeRounding) in(t time.Time) time.Time {
+	if r.Location == nil {
+		return t
+	}
+
+	return t.In(r.Location)
+}
+
+// truncateInZone is like t.Truncate(dur), but the grid is aligned in the
+// time zone of t instead of UTC: e.g. in the +05:30 zone, truncating
+// 10:45 local time to 1h gives 10:00, not 10:30.
+func truncateInZone(t time.Time, dur time.Duration) time.Time {
+	_, offset := t.Zone()
+	offsetDur := time.Duration(offset) * time.Second
+	return t.Add(offsetDur).Truncate(dur).Add(-offsetDur)
+}
+
+// truncateCeil is like truncateInZone, but rounds forward.
+func truncateCeil(t time.Time, dur time.Duration) time.Time {
+	t2 := truncateInZone(t, dur)
+	if t2.Equal(t) {
+		return t
+	}
+
+	return t2.Add(dur)
+}
+
+// roundHistogramRange returns the histogram range for the given time range.
+// It's rounded the same way as the time range itself, except that with the
+// "none" mode, it's extended to whole minutes, since that's what the
+// histogram bins are.
+func (r timeRounding) roundHistogramRange(from, to time.Time) (time.Time, time.Time) {
+	if r.Mode == timeRoundNone {
+		minute := timeRounding{Granularity: minTimeRoundGranularity, Location: r.Location}
+		return minute.floor(from), minute.ceil(to)
+	}
+
+	return r.round(from), r.round(to)
+}
+
+// snapDataBinsInChartDot is like the snapDataBinsInChartDot func, but it
+// also makes sure that every bar on the histogram covers a whole number of
+// granularity units, so that the bars are aligned with the possible query
+// ranges.
+func (r timeRounding) snapDataBinsInChartDot(dataBinsInChartDot int) int {
+	n := snapDataBinsInChartDot(dataBinsInChartDot)
+	if r.Mode == timeRoundNone {
+		return n
+	}
+
+	granularityBins := int(r.getGranularity() / minTimeRoundGranularity)
+	if n%granularityBins != 0 {
+		n = (n/granularityBins + 1) * granularityBins
+	}
+
+	return n
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeRounding(t *testing.T) {
+	t1 := time.Date(2025, time.March, 10, 1, 32, 15, 0, time.UTC)
+	aligned := time.Date(2025, time.March, 10, 1, 35, 0, 0, time.UTC)
+
+	type testCase struct {
+		rounding timeRounding
+		in       time.Time
+		want     time.Time
+	}
+
+	testCases := []testCase{
+		{
+			rounding: timeRounding{Mode: timeRoundCeil, Granularity: time.Minute},
+			in:       t1,
+			want:     time.Date(2025, time.March, 10, 1, 33, 0, 0, time.UTC),
+		},
+		{
+			rounding: timeRounding{Mode: timeRoundCeil, Granularity: 5 * time.Minute},
+			in:       t1,
+			want:     aligned,
+		},
+		{
+			rounding: timeRounding{Mode: timeRoundCeil, Granularity: 5 * time.Minute},
+			in:       aligned,
+			want:     aligned,
+		},
+		{
+			rounding: timeRounding{Mode: timeRoundFloor, Granularity: time.Minute},
+			in:       t1,
+			want:     time.Date(2025, time.March, 10, 1, 32, 0, 0, time.UTC),
+		},
+		{
+			rounding: timeRounding{Mode: timeRoundFloor, Granularity: 5 * time.Minute},
+			in:       t1,
+			want:     time.Date(2025, time.March, 10, 1, 30, 0, 0, time.UTC),
+		},
+		{
+			rounding: timeRounding{Mode: timeRoundNone, Granularity: 5 * time.Minute},
+			in:       t1,
+			want:     t1,
+		},
+		{
+			// Zero value is the same as the default: ceil to the minute.
+			rounding: timeRounding{},
+			in:       t1,
+			want:     time.Date(2025, time.March, 10, 1, 33, 0, 0, time.UTC),
+		},
+	}
+
+	for i, tc := range testCases {
+		assert.Equal(t, tc.want, tc.rounding.round(tc.in), "test case #%d", i)
+	}
+}
+
+func TestTimeRoundingInZone(t *testing.T) {
+	loc := time.FixedZone("IST", 5*3600+30*60)
+
+	// 10:45 local time, which is 05:15 UTC.
+	t1 := time.Date(2025, time.March, 10, 5, 15, 0, 0, time.UTC)
+
+	r := timeRounding{Mode: timeRoundFloor, Granularity: time.Hour, Location: loc}
+	assert.Equal(t, time.Date(2025, time.March, 10, 10, 0, 0, 0, loc), r.round(t1))
+
+	r.Mode = timeRoundCeil
+	assert.Equal(t, time.Date(2025, time.March, 10, 11, 0, 0, 0, loc), r.round(t1))
+
+	// Without the location, it's UTC which the grid is aligned in.
+	r.Location = nil
+	assert.Equal(t, time.Date(2025, time.March, 10, 6, 0, 0, 0, time.UTC), r.round(t1))
+}
+
+func TestTimeRoundingHistogramRange(t *testing.T) {
+	from := time.Date(2025, time.March, 10, 1, 32, 15, 0, time.UTC)
+	to := time.Date(2025, time.March, 10, 1, 47, 45, 0, time.UTC)
+
+	// With no rounding, the histogram range still covers whole minutes.
+	histFrom, histTo := timeRounding{Mode: timeRoundNone}.roundHistogramRange(from, to)
+	assert.Equal(t, time.Date(2025, time.March, 10, 1, 32, 0, 0, time.UTC), histFrom)
+	assert.Equal(t, time.Date(2025, time.March, 10, 1, 48, 0, 0, time.UTC), histTo)
+
+	histFrom, histTo = timeRounding{Mode: timeRoundFloor, Granularity: 5 * time.Minute}.roundHistogramRange(from, to)
+	assert.Equal(t, time.Date(2025, time.March, 10, 1, 30, 0, 0, time.UTC), histFrom)
+	assert.Equal(t, time.Date(2025, time.March, 10, 1, 45, 0, 0, time.UTC), histTo)
+}
+
+func TestTimeRoundingSnapDataBins(t *testing.T) {
+	r := timeRounding{Mode: timeRoundCeil, Granularity: 1 * time.Minute}
+	assert.Equal(t, 1, r.snapDataBinsInChartDot(1))
+	assert.Equal(t, 5, r.snapDataBinsInChartDot(3))
+
+	// Bars must cover a whole number of granularity units.
+	r = timeRounding{Mode: timeRoundCeil, Granularity: 5 * time.Minute}
+	assert.Equal(t, 5, r.snapDataBinsInChartDot(1))
+	assert.Equal(t, 10, r.snapDataBinsInChartDot(7))
+
+	r = timeRounding{Mode: timeRoundFloor, Granularity: 7 * time.Minute}
+	assert.Equal(t, 7, r.snapDataBinsInChartDot(1))
+	assert.Equal(t, 14, r.snapDataBinsInChartDot(7))
+
+	// Without rounding, the granularity doesn't matter.
+	r = timeRounding{Mode: timeRoundNone, Granularity: 5 * time.Minute}
+	assert.Equal(t, 1, r.snapDataBinsInChartDot(1))
+}
+
+func TestParseTimeRoundGranularity(t *testing.T) {
+	granularity, err := parseTimeRoundGranularity("5m")
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, granularity)
+
+	_, err = parseTimeRoundGranularity("30s")
+	assert.Error(t, err)
+
+	_, err = parseTimeRoundGranularity("90s")
+	assert.Error(t, err)
+
+	_, err = parseTimeRoundMode("round")
+	assert.Error(t, err)
+}
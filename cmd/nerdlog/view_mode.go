@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/juju/errors"
+)
+
+// viewMode is the layout of the logs table; see the view option.
+type viewMode string
+
+const (
+	// viewModeTable is the default layout: the time, the message and the
+	// context columns, as per the select query.
+	viewModeTable viewMode = "table"
+	// viewModeRaw only shows the original log lines in a single column, like
+	// tailing a file.
+	viewModeRaw viewMode = "raw"
+)
+
+func parseViewMode(s string) (viewMode, error) {
+	switch mode := viewMode(s); mode {
+	case viewModeTable, viewModeRaw:
+		return mode, nil
+	}
+
+	return "", errors.Errorf("invalid view mode %q, valid values are: table, raw", s)
+}
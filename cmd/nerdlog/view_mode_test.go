@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseViewMode(t *testing.T) {
+	mode, err := parseViewMode("table")
+	assert.NoError(t, err)
+	assert.Equal(t, viewModeTable, mode)
+
+	mode, err = parseViewMode("raw")
+	assert.NoError(t, err)
+	assert.Equal(t, viewModeRaw, mode)
+
+	_, err = parseViewMode("compact")
+	assert.Error(t, err)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+)
+
+// defaultWatchWindow is the time window a watch counts the messages in,
+// unless specified explicitly.
+const defaultWatchWindow = 1 * time.Minute
+
+// watchExpr is a parsed watch expression, like "level:error > 10"; see
+// parseWatchExpr for the syntax.
+type watchExpr struct {
+	src string
+
+	// If all is true, every message matching the query is counted; otherwise,
+	// if re is not nil, the messages matching it are counted; otherwise, the
+	// ones whose field has the given value.
+	all   bool
+	re    *regexp.Regexp
+	field string
+	value string
+
+	op        string
+	threshold int
+
+	// window is how far back from the end of the time range the messages are
+	// counted.
+	window time.Duration
+}
+
+// parseWatchExpr parses the watch expression in the format
+// "<filter> <op> <threshold> [window]", where the filter is either "*" (all
+// messages matching the query), "/regexp/" (the messages matching the
+// regexp), or "field:value" (the messages whose field has the given value;
+// for "level", it's the log level). The op is one of >, >=, <, <=, ==, !=.
+// The window is a duration like 5m, and defaults to defaultWatchWindow.
+func parseWatchExpr(s string) (*watchExpr, error) {
+	parts := strings.Fields(s)
+	if len(parts) != 3 && len(parts) != 4 {
+		return nil, errors.Errorf(
+			"invalid watch %q, should be like: level:error > 10 [5m]", s,
+		)
+	}
+
+	ret := &watchExpr{
+		src:    strings.Join(parts, " "),
+		window: defaultWatchWindow,
+	}
+
+	filter := parts[0]
+	switch {
+	case filter == "*":
+		ret.all = true
+	case len(filter) >= 2 && strings.HasPrefix(filter, "/") && strings.HasSuffix(filter, "/"):
+		re, err := regexp.Compile(filter[1 : len(filter)-1])
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid regexp in the watch %q", s)
+		}
+
+		ret.re = re
+	default:
+		idx := strings.Index(filter, ":")
+		if idx <= 0 {
+			return nil, errors.Errorf(
+				"invalid filter %q, should be either *, /regexp/ or field:value", filter,
+			)
+		}
+
+		ret.field, ret.value = filter[:idx], filter[idx+1:]
+	}
+
+	switch parts[1] {
+	case ">", ">=", "<", "<=", "==", "!=":
+		ret.op = parts[1]
+	default:
+		return nil, errors.Errorf(
+			"invalid operator %q, valid values are: >, >=, <, <=, ==, !=", parts[1],
+		)
+	}
+
+	threshold, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid threshold %q", parts[2])
+	}
+	ret.threshold = threshold
+
+	if len(parts) == 4 {
+		window, err := time.ParseDuration(parts[3])
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid window %q", parts[3])
+		}
+
+		if window < time.Minute {
+			return nil, errors.Errorf("window can't be shorter than a minute")
+		}
+
+		ret.window = window
+	}
+
+	return ret, nil
+}
+
+// count returns how many messages from the response match the filter within
+// the window before the given end of the time range. Counting all messages
+// uses the minute stats, so it's exact; otherwise, only the loaded messages
+// are counted.
+func (e *watchExpr) count(resp *core.LogRespTotal, to time.Time) int {
+	from := to.Add(-e.window)
+
+	ret := 0
+	if e.all {
+		for k, v := range resp.MinuteStats {
+			t := time.Unix(k, 0)
+			if !t.Before(from) && t.Before(to) {
+				ret += v.NumMsgs
+			}
+		}
+
+		return ret
+	}
+
+	for i := range resp.Logs {
+		msg := &resp.Logs[i]
+		if msg.Time.Before(from) || !msg.Time.Before(to) {
+			continue
+		}
+
+		if e.matches(msg) {
+			ret++
+		}
+	}
+
+	return ret
+}
+
+func (e *watchExpr) matches(msg *core.LogMsg) bool {
+	if e.re != nil {
+		return e.re.MatchString(msg.Msg)
+	}
+
+	if e.field == core.FieldNameLevel {
+		return string(msg.Level) == e.value
+	}
+
+	return getLogMsgColValue(msg, e.field, "") == e.value
+}
+
+// isTripped returns whether the given count trips the watch.
+func (e *watchExpr) isTripped(count int) bool {
+	switch e.op {
+	case ">":
+		return count > e.threshold
+	case ">=":
+		return count >= e.threshold
+	case "<":
+		return count < e.threshold
+	case "<=":
+		return count <= e.threshold
+	case "==":
+		return count == e.threshold
+	case "!=":
+		return count != e.threshold
+	}
+
+	return false
+}
+
+// watch is a watch expression along with its state as of the last query.
+type watch struct {
+	expr *watchExpr
+
+	// evaluated is false until the watch is evaluated for the first time,
+	// and then count and tripped are the results of the last evaluation.
+	evaluated bool
+	count     int
+	tripped   bool
+}
+
+// evaluate updates the watch state with the given response, and returns
+// true if the watch has just become tripped.
+func (w *watch) evaluate(resp *core.LogRespTotal, to time.Time) bool {
+	wasTripped := w.tripped
+
+	w.count = w.expr.count(resp, to)
+	w.tripped = w.expr.isTripped(w.count)
+	w.evaluated = true
+
+	return w.tripped && !wasTripped
+}
+
+// formatWatches returns a line per watch, numbered from 1, with the count as
+// of the last query, and whether it's tripped.
+func formatWatches(watches []*watch) string {
+	if len(watches) == 0 {
+		return "No watches; add one with :watch, e.g. :watch level:error > 10"
+	}
+
+	var sb strings.Builder
+	for i, w := range watches {
+		fmt.Fprintf(&sb, "%d. %s (over %s): ", i+1, w.expr.src, formatDuration(w.expr.window))
+
+		switch {
+		case !w.evaluated:
+			sb.WriteString("not evaluated yet")
+		case w.tripped:
+			fmt.Fprintf(&sb, "TRIPPED, count: %d", w.count)
+		default:
+			fmt.Fprintf(&sb, "ok, count: %d", w.count)
+		}
+
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// getNumTrippedWatches returns how many of the watches are tripped.
+func getNumTrippedWatches(watches []*watch) int {
+	ret := 0
+	for _, w := range watches {
+		if w.tripped {
+			ret++
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWatchExpr(t *testing.T) {
+	expr, err := parseWatchExpr("level:error  > 10")
+	assert.NoError(t, err)
+	assert.Equal(t, "level:error > 10", expr.src)
+	assert.Equal(t, "level", expr.field)
+	assert.Equal(t, "error", expr.value)
+	assert.Equal(t, ">", expr.op)
+	assert.Equal(t, 10, expr.threshold)
+	assert.Equal(t, time.Minute, expr.window)
+
+	expr, err = parseWatchExpr("/time:out/ >= 3 5m")
+	assert.NoError(t, err)
+	assert.Equal(t, "time:out", expr.re.String())
+	assert.Equal(t, 5*time.Minute, expr.window)
+
+	expr, err = parseWatchExpr("* < 1")
+	assert.NoError(t, err)
+	assert.True(t, expr.all)
+
+	for _, src := range []string{
+		"",
+		"level:error",
+		"level:error > ten",
+		"level:error => 10",
+		"error > 10",
+		"/(/ > 10",
+		"* > 10 5x",
+		"* > 10 30s",
+		"* > 10 5m extra",
+	} {
+		_, err := parseWatchExpr(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestWatchEvaluate(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time {
+		return t0.Add(time.Duration(sec) * time.Second)
+	}
+
+	to := at(600)
+	resp := &core.LogRespTotal{
+		MinuteStats: map[int64]core.MinuteStatsItem{
+			at(420).Unix(): {NumMsgs: 100},
+			at(480).Unix(): {NumMsgs: 7},
+			at(540).Unix(): {NumMsgs: 5},
+		},
+		Logs: []core.LogMsg{
+			{Time: at(490), Msg: "older", Level: core.LogLevelError},
+			{Time: at(545), Msg: "timeout", Level: core.LogLevelError},
+			{Time: at(550), Msg: "ok", Level: core.LogLevelInfo, Context: map[string]string{"lstream": "host-1"}},
+			{Time: at(590), Msg: "timeout again", Level: core.LogLevelError, Context: map[string]string{"lstream": "host-1"}},
+		},
+	}
+
+	testCases := []struct {
+		src         string
+		wantCount   int
+		wantTripped bool
+	}{
+		{src: "level:error > 1", wantCount: 2, wantTripped: true},
+		{src: "level:error > 2", wantCount: 2, wantTripped: false},
+		{src: "level:error > 2 2m", wantCount: 3, wantTripped: true},
+		{src: "lstream:host-1 == 2", wantCount: 2, wantTripped: true},
+		{src: "/timeout/ != 2", wantCount: 2, wantTripped: false},
+		{src: "* >= 12 2m", wantCount: 12, wantTripped: true},
+		{src: "* < 1 1m", wantCount: 5, wantTripped: false},
+	}
+
+	for _, tc := range testCases {
+		expr, err := parseWatchExpr(tc.src)
+		if !assert.NoError(t, err, tc.src) {
+			continue
+		}
+
+		w := &watch{expr: expr}
+		assert.Equal(t, tc.wantTripped, w.evaluate(resp, to), tc.src)
+		assert.Equal(t, tc.wantCount, w.count, tc.src)
+		assert.Equal(t, tc.wantTripped, w.tripped, tc.src)
+
+		// Evaluating again doesn't report it as just tripped.
+		assert.False(t, w.evaluate(resp, to), tc.src)
+	}
+}
+
+func TestFormatWatches(t *testing.T) {
+	expr1, _ := parseWatchExpr("level:error > 10")
+	expr2, _ := parseWatchExpr("* < 1 5m")
+	expr3, _ := parseWatchExpr("/panic/ > 0")
+
+	watches := []*watch{
+		{expr: expr1, evaluated: true, count: 12, tripped: true},
+		{expr: expr2, evaluated: true, count: 3},
+		{expr: expr3},
+	}
+
+	assert.Equal(t,
+		"1. level:error > 10 (over 1m): TRIPPED, count: 12\n"+
+			"2. * < 1 5m (over 5m): ok, count: 3\n"+
+			"3. /panic/ > 0 (over 1m): not evaluated yet\n",
+		formatWatches(watches),
+	)
+	assert.Equal(t, 1, getNumTrippedWatches(watches))
+}
@@ -0,0 +1,734 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// Replacements for the word boundary "\b" in the awk regexps. Awk doesn't
+// support "\b" (gawk treats it as a backspace, and has "\y" instead, but
+// mawk and busybox awk don't have anything like that), so it's replaced
+// with a non-word char or the start / end of the line. The POSIX classes
+// like [:alnum:] are avoided too, since older mawk doesn't support them.
+const (
+	awkWordBoundaryStart = `(^|[^A-Za-z0-9_])`
+	awkWordBoundaryEnd   = `([^A-Za-z0-9_]|$)`
+)
+
+// ValidateQuery checks the parts of the query syntax which nerdlog handles
+// on its own, before the query is given to awk: the string and regexp
+// literals must be terminated (the delimiters can be escaped inside with a
+// backslash, like "foo \"bar\"" or /foo\/bar/), and the word boundaries "\b"
+// in regexps must be valid. The rest of the awk syntax is only checked by awk.
+func ValidateQuery(query string) error {
+	_, err := awkQueryWithWordBoundaries(query)
+	return errors.Trace(err)
+}
+
+// awkQueryWithWordBoundaries replaces every word boundary "\b" in the regexps
+// of the awk query with an equivalent which awk understands, so that e.g.
+// /\berr\b/ matches "err" but not "error" or "stderr". Since the replacement
+// has to consume a char, "\b" must be either right before a word char (the
+// start of a word) or right after one (the end of a word); otherwise, an
+// error is returned. A group or a bracket expression counts as a word too, so
+// e.g. /\b(foo|bar)\b/ and /\b[a-z]+\b/ work.
+func awkQueryWithWordBoundaries(query string) (string, error) {
+	return rewriteAwkQuery(query, awkRegexpWithWordBoundaries, nil)
+}
+
+// awkWordRewriter is called by rewriteAwkQuery for every word in the query
+// (outside of the string and regexp literals), which spans from start to end.
+// A word can be a dotted name like "http.status", for the nested JSON keys.
+// If the word (possibly along with what follows it) has to be replaced, it
+// returns the replacement, the index right after the replaced part, and ok is
+// true; otherwise, ok is false, and the word is kept as is.
+type awkWordRewriter func(query string, start, end int) (repl string, replEnd int, ok bool, err error)
+
+// rewriteAwkQuery is the tokenizer which all the translations of the awk
+// query are built on: it walks the query, skipping the string and regexp
+// literals (so that nothing inside of them is translated), and gives every
+// regexp literal to rewriteRegexp and every word to rewriteWord, if they're
+// not nil. A word which is right before the colon of a ternary operator, like
+// "b" in "a ? b:c", is never given to rewriteWord, since the colon belongs to
+// the ternary. The string and regexp literals must be terminated, otherwise
+// an error is returned.
+func rewriteAwkQuery(
+	query string, rewriteRegexp func(re string) (string, error), rewriteWord awkWordRewriter,
+) (string, error) {
+	var sb strings.Builder
+
+	// prevSignificant is the last non-space char outside of regexps and
+	// strings; it's used to tell a regexp from a division.
+	var prevSignificant byte
+
+	// ternaryParens has the paren depth of every "?" whose ":" wasn't seen
+	// yet; a colon closes the last ternary only at the same paren depth, so
+	// that e.g. "a ? (level:error) : c" still has the field value inside.
+	var ternaryParens []int
+	parens := 0
+	isTernaryColon := func(i int) bool {
+		return i < len(query) && query[i] == ':' &&
+			len(ternaryParens) > 0 && ternaryParens[len(ternaryParens)-1] == parens
+	}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch {
+		case c == '"' || (c == '/' && !isAwkOperandEnd(prevSignificant)):
+			end, err := skipAwkLiteral(query, i, c)
+			if err != nil {
+				return "", errors.Trace(err)
+			}
+
+			literal := query[i:end]
+			if c == '/' && rewriteRegexp != nil {
+				literal, err = rewriteRegexp(literal)
+				if err != nil {
+					return "", errors.Trace(err)
+				}
+			}
+
+			sb.WriteString(literal)
+			i = end - 1
+			prevSignificant = c
+
+		case rewriteWord != nil && isWordChar(c) && (i == 0 || !isWordChar(query[i-1])):
+			wordEnd := awkDottedWordEnd(query, i)
+
+			if isTernaryColon(wordEnd) {
+				sb.WriteString(query[i:wordEnd])
+				i = wordEnd - 1
+				prevSignificant = query[i]
+				continue
+			}
+
+			repl, end, ok, err := rewriteWord(query, i, wordEnd)
+			if err != nil {
+				return "", errors.Trace(err)
+			}
+
+			if !ok {
+				sb.WriteString(query[i:wordEnd])
+				i = wordEnd - 1
+				prevSignificant = query[i]
+				continue
+			}
+
+			// The replacement is always an operand, so a slash after it is a
+			// division.
+			sb.WriteString(repl)
+			i = end - 1
+			prevSignificant = ')'
+
+		default:
+			switch {
+			case c == '(':
+				parens++
+			case c == ')':
+				parens--
+			case c == '?':
+				ternaryParens = append(ternaryParens, parens)
+			case isTernaryColon(i):
+				ternaryParens = ternaryParens[:len(ternaryParens)-1]
+			}
+
+			sb.WriteByte(c)
+			if c != ' ' && c != '\t' {
+				prevSignificant = c
+			}
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// awkDottedWordEnd returns the end of the word which starts at the given
+// index; unless it's a number, it can be a dotted name like "http.status".
+func awkDottedWordEnd(query string, start int) int {
+	end := start
+	for end < len(query) && isWordChar(query[end]) {
+		end++
+	}
+
+	isNumber := query[start] >= '0' && query[start] <= '9'
+	for !isNumber && end+1 < len(query) && query[end] == '.' && isWordChar(query[end+1]) {
+		end++
+		for end < len(query) && isWordChar(query[end]) {
+			end++
+		}
+	}
+
+	return end
+}
+
+// awkRegexpWithWordBoundaries does what awkQueryWithWordBoundaries does, but
+// for a single regexp literal like /\bfoo\b/.
+func awkRegexpWithWordBoundaries(re string) (string, error) {
+	var sb strings.Builder
+	inBrackets := false
+
+	for i := 0; i < len(re); i++ {
+		c := re[i]
+
+		switch {
+		case c == '\\' && i+1 < len(re):
+			if re[i+1] != 'b' || inBrackets {
+				sb.WriteString(re[i : i+2])
+				i++
+				continue
+			}
+
+			afterWord := i > 0 && isWordChar(re[i-1])
+			beforeWord := i+2 < len(re) && isWordChar(re[i+2])
+			if !afterWord && !beforeWord {
+				// Not next to a word char, but it might still be next to a group
+				// or a bracket expression, like \b(foo|bar)\b or [a-z]+\b.
+				afterWord = i > 0 && strings.IndexByte(")]*+?", re[i-1]) >= 0
+				beforeWord = i+2 < len(re) && strings.IndexByte("([", re[i+2]) >= 0
+			}
+
+			switch {
+			case beforeWord && !afterWord:
+				sb.WriteString(awkWordBoundaryStart)
+			case afterWord && !beforeWord:
+				sb.WriteString(awkWordBoundaryEnd)
+			default:
+				return "", errors.Errorf(
+					`invalid word boundary in %s: \b must be either at the start or at the end of a word or a group`, re,
+				)
+			}
+			i++
+
+		case c == '[' && !inBrackets:
+			inBrackets = true
+			sb.WriteByte(c)
+
+		case c == ']' && inBrackets:
+			inBrackets = false
+			sb.WriteByte(c)
+
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// skipAwkLiteral returns the index right after the literal (a string or a
+// regexp) which starts at the given index with the given delimiter; escaped
+// delimiters are skipped. If the literal isn't terminated, returns an error.
+func skipAwkLiteral(query string, start int, delim byte) (int, error) {
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case delim:
+			return i + 1, nil
+		}
+	}
+
+	kind := "regexp"
+	if delim == '"' {
+		kind = "string"
+	}
+
+	return 0, errors.Errorf(
+		"unterminated %s at position %d: %s (to use %c literally inside, escape it as \\%c)",
+		kind, start+1, query[start:], delim, delim,
+	)
+}
+
+// isAwkOperandEnd returns whether the given char can be the last one of an
+// operand, in which case the following slash is a division, not a regexp.
+func isAwkOperandEnd(c byte) bool {
+	return isWordChar(c) || c == ')' || c == ']' || c == '"'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' ||
+		(c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9')
+}
+
+// awkRegexpTerm is a single term of a simple awk query, see
+// parseSimpleAwkQuery.
+type awkRegexpTerm struct {
+	// re is the regexp, without the slashes, and with the escaped slashes
+	// unescaped.
+	re string
+	// negate is true if the term is negated, like !/foo/.
+	negate bool
+}
+
+// parseSimpleAwkQuery parses the awk query which consists only of regexps,
+// possibly negated, joined with "&&", like "/foo/ && !/bar/"; for anything
+// else, an error is returned. Parens are allowed as long as they don't change
+// the meaning, like "(/foo/) && !(/bar/)", which is what we get when the
+// exclude pattern or a default query is added. An empty query results in no
+// terms.
+func parseSimpleAwkQuery(query string) ([]awkRegexpTerm, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
+
+	var terms []awkRegexpTerm
+	for _, termStr := range strings.Split(query, "&&") {
+		termStr = strings.TrimSpace(termStr)
+
+		// Since everything is joined with "&&", the grouping parens don't
+		// matter, except those after the negation: these must be closed within
+		// the same term, otherwise the negation applies to a few terms.
+		termStr = strings.TrimSpace(strings.TrimLeft(termStr, "( "))
+
+		var term awkRegexpTerm
+		numNegParens := 0
+		if strings.HasPrefix(termStr, "!") {
+			term.negate = true
+			termStr = strings.TrimSpace(termStr[1:])
+
+			trimmed := strings.TrimLeft(termStr, "( ")
+			numNegParens = strings.Count(termStr[:len(termStr)-len(trimmed)], "(")
+			termStr = trimmed
+		}
+
+		trimmed := strings.TrimRight(termStr, ") ")
+		if strings.Count(termStr[len(trimmed):], ")") < numNegParens {
+			return nil, errors.Errorf(
+				"only regexps joined with && are supported, like /foo/ && !/bar/; got %q", query,
+			)
+		}
+		termStr = trimmed
+
+		// Every term must be a single regexp, so there should be no unescaped
+		// slashes inside.
+		isRegexp := len(termStr) >= 2 && termStr[0] == '/' && termStr[len(termStr)-1] == '/' &&
+			!strings.Contains(strings.ReplaceAll(termStr[1:len(termStr)-1], `\/`, ""), "/")
+		if !isRegexp {
+			return nil, errors.Errorf(
+				"only regexps joined with && are supported, like /foo/ && !/bar/; got %q", query,
+			)
+		}
+
+		term.re = strings.ReplaceAll(termStr[1:len(termStr)-1], `\/`, "/")
+		terms = append(terms, term)
+	}
+
+	return terms, nil
+}
+
+// awkHasOperator is the operator to check whether a list field contains the
+// given value, like "ids has 42"; see awkQueryWithHasOperator.
+const awkHasOperator = "has"
+
+// awkQueryWithHasOperator replaces every "field has value" expression in the
+// awk query with a regexp which matches the lines where the field, like
+// "field=1,42,3" or "field=\"1, 42, 3\"", contains the value as one of its
+// elements, separated by the delimiter configured for the field in listFields.
+// Just like in awkQueryWithFieldValues, the field can be a canonical name
+// from the aliases.
+// The value can be either a bare word, or a string literal like "foo bar". If
+// the field isn't in listFields, an error is returned.
+//
+// Since the result only consists of regexps, it's also compatible with
+// parseSimpleAwkQuery (as long as the rest of the query is).
+func awkQueryWithHasOperator(
+	query string, listFields map[string]string, aliases map[string][]string,
+) (string, error) {
+	return rewriteAwkQuery(query, nil, func(query string, start, end int) (string, int, bool, error) {
+		field := query[start:end]
+		value, valueEnd, ok, err := parseAwkHasOperand(query, end)
+		if err != nil {
+			return "", 0, false, errors.Annotatef(err, "%s %s", field, awkHasOperator)
+		}
+
+		if !ok {
+			return "", 0, false, nil
+		}
+
+		delim, isList := getAwkListFieldDelim(field, listFields, aliases)
+		if !isList {
+			return "", 0, false, errors.Errorf(
+				"field %s is not a list field, so it doesn't support %q; list fields are configured with list_fields in the logstreams config",
+				field, awkHasOperator,
+			)
+		}
+
+		return awkListFieldHasRegexp(awkFieldNamesRegexp(field, aliases), delim, value), valueEnd, true, nil
+	})
+}
+
+// getAwkListFieldDelim returns the delimiter of the given list field, which
+// is looked up by the field name itself, and then by the actual names of the
+// field as per the aliases; ok is false if it's not a list field.
+func getAwkListFieldDelim(
+	field string, listFields map[string]string, aliases map[string][]string,
+) (delim string, ok bool) {
+	if delim, ok := listFields[field]; ok {
+		return delim, true
+	}
+
+	for _, name := range aliases[field] {
+		if delim, ok := listFields[name]; ok {
+			return delim, true
+		}
+	}
+
+	return "", false
+}
+
+// parseAwkHasOperand checks whether the query at the given position (right
+// after a word) continues with the "has" operator and its value; if so, it
+// returns the value and the index right after it, and ok is true.
+func parseAwkHasOperand(query string, pos int) (value string, end int, ok bool, err error) {
+	i := skipAwkSpaces(query, pos)
+	if i == pos || !strings.HasPrefix(query[i:], awkHasOperator) {
+		return "", 0, false, nil
+	}
+
+	i += len(awkHasOperator)
+	valueStart := skipAwkSpaces(query, i)
+	if valueStart == i {
+		// Something like "foo hash", not our operator.
+		return "", 0, false, nil
+	}
+
+	value, end, err = parseAwkValue(query, valueStart)
+	if err != nil {
+		return "", 0, false, errors.Trace(err)
+	}
+
+	return value, end, true, nil
+}
+
+// parseAwkValue parses the value of the "has" operator or of the field value
+// expression which starts at the given index: either a bare word, which ends
+// at a space, a paren or a logical operator, or a string literal like
+// "foo bar". It returns the (unescaped) value and the index right after it.
+func parseAwkValue(query string, start int) (value string, end int, err error) {
+	if start == len(query) {
+		return "", 0, errors.Errorf("value is missing")
+	}
+
+	if query[start] == '"' {
+		end, err := skipAwkLiteral(query, start, '"')
+		if err != nil {
+			return "", 0, errors.Trace(err)
+		}
+
+		value = query[start+1 : end-1]
+		value = strings.ReplaceAll(value, `\"`, `"`)
+		value = strings.ReplaceAll(value, `\\`, `\`)
+
+		return value, end, nil
+	}
+
+	end = start
+	for end < len(query) && !strings.ContainsRune(" \t()&|!", rune(query[end])) {
+		end++
+	}
+
+	if end == start {
+		return "", 0, errors.Errorf("value is missing")
+	}
+
+	return query[start:end], end, nil
+}
+
+func skipAwkSpaces(query string, pos int) int {
+	for pos < len(query) && (query[pos] == ' ' || query[pos] == '\t') {
+		pos++
+	}
+
+	return pos
+}
+
+// awkListFieldHasRegexp returns the regexp literal which matches the lines
+// where the list field contains the value; the list can be either quoted or
+// not, like field="1, 2, 3" or field=1,2,3. The field is a regexp, see
+// awkFieldNamesRegexp. The regexp is compatible with both awk and Go.
+func awkListFieldHasRegexp(field, delim, value string) string {
+	d := awkRegexpEscape(delim)
+	v := awkRegexpEscape(value)
+
+	quoted := fmt.Sprintf(`"([^"]*%s)?%s(%s[^"]*)?"`, d, v, d)
+	unquoted := fmt.Sprintf(`([^ "]*%s)?%s(%s[^ ]*)?( |$)`, d, v, d)
+
+	return fmt.Sprintf("/%s%s=(%s|%s)/", awkWordBoundaryStart, field, quoted, unquoted)
+}
+
+// awkFieldNamesRegexp returns the regexp which matches the given field under
+// any of its names on the logstream: the name itself, and the actual names
+// from the field aliases (see ConfigLogStreamOptions.FieldAliases), like
+// "(level|severity|PRIORITY)". Without aliases, it's just the field name.
+func awkFieldNamesRegexp(field string, aliases map[string][]string) string {
+	names := awkFieldNames(field, aliases)
+	for i, name := range names {
+		names[i] = awkRegexpEscape(name)
+	}
+
+	if len(names) == 1 {
+		return names[0]
+	}
+
+	return "(" + strings.Join(names, "|") + ")"
+}
+
+// awkFieldNames returns all the names of the given field on the logstream:
+// the name itself, and the actual names from the field aliases.
+func awkFieldNames(field string, aliases map[string][]string) []string {
+	names := []string{field}
+	for _, name := range aliases[field] {
+		if name != field {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// awkQueryWithFieldValues replaces every "field:value" expression in the awk
+// query, like "level:error" or `user:"John Doe"`, with a regexp which matches
+// the lines where the field has exactly this value: like level=error,
+// level="error", or "level": "error" in JSON. The field can be a canonical
+// name from the aliases, in which case all the actual names of the field on
+// the logstream are matched. The value is either a bare word or a string
+// literal, just like for the "has" operator. For the level field, the value
+// also matches the numeric syslog priorities of the same level, so that e.g.
+// "level:error" matches PRIORITY=3 as well, see awkFieldValueAltsRegexp.
+//
+// The colon of the awk ternary operator, like in "a ? b:c", is left intact
+// (see rewriteAwkQuery), so the field values inside of a ternary must be
+// parenthesized, like "a ? (level:error) : c".
+//
+// If isJSON is true, the lines are JSON objects, and instead of the regexp,
+// the field is looked up by the nerdlog agent as a JSON key, see
+// awkJSONFieldValue.
+func awkQueryWithFieldValues(query string, aliases map[string][]string, isJSON bool) (string, error) {
+	return rewriteAwkQuery(query, nil, func(query string, start, end int) (string, int, bool, error) {
+		isAwkField := start > 0 && query[start-1] == '$'
+		if isAwkField || end+1 >= len(query) || query[end] != ':' || query[end+1] == ' ' {
+			return "", 0, false, nil
+		}
+
+		field := query[start:end]
+		value, valueEnd, err := parseAwkValue(query, end+1)
+		if err != nil {
+			return "", 0, false, errors.Annotatef(err, "%s:", field)
+		}
+
+		valueRe := awkFieldValueAltsRegexp(field, value)
+		if isJSON {
+			return awkJSONFieldValue(awkFieldNames(field, aliases), valueRe), valueEnd, true, nil
+		}
+
+		return awkFieldValueRegexp(awkFieldNamesRegexp(field, aliases), valueRe), valueEnd, true, nil
+	})
+}
+
+// logLevelPriorities maps the log levels to the numeric syslog priorities,
+// as they're interpreted by logLevelFromFieldValue.
+var logLevelPriorities = map[LogLevel][]string{
+	LogLevelError: {"0", "1", "2", "3"},
+	LogLevelWarn:  {"4"},
+	LogLevelInfo:  {"5", "6"},
+	LogLevelDebug: {"7"},
+}
+
+// awkFieldValueAltsRegexp returns the regexp which matches the value of the
+// given field. Normally it's just the escaped value, but if the field is the
+// level and the value is a level name, the regexp also matches the numeric
+// syslog priorities of this level, like "(error|0|1|2|3)".
+func awkFieldValueAltsRegexp(field, value string) string {
+	valueRe := awkRegexpEscape(value)
+	if field != FieldNameLevel || awkNumberRegexp.MatchString(value) {
+		return valueRe
+	}
+
+	priorities := logLevelPriorities[logLevelFromFieldValue(value)]
+	if len(priorities) == 0 {
+		return valueRe
+	}
+
+	return "(" + valueRe + "|" + strings.Join(priorities, "|") + ")"
+}
+
+// awkFieldValueRegexp returns the regexp literal which matches the lines
+// where the field has the given value, quoted or not; see
+// awkQueryWithFieldValues. Both the field and the value are regexps, see
+// awkFieldNamesRegexp and awkFieldValueAltsRegexp.
+func awkFieldValueRegexp(field, value string) string {
+	return fmt.Sprintf(
+		`/%s%s("?: *"?|="?)%s%s/`,
+		awkWordBoundaryStart, field, value, awkWordBoundaryEnd,
+	)
+}
+
+// awkJSONGetFunc is the function of the nerdlog agent which looks up a JSON
+// key in the current line; if it's found, the function returns 1, and the
+// value is in the awkJSONValVar variable. See nerdlog_agent.sh.
+const (
+	awkJSONGetFunc = "nerdlogJsonGet"
+	awkJSONValVar  = "nerdlogJsonVal"
+)
+
+// awkJSONFieldValue returns the awk expression which matches the lines where
+// any of the given JSON keys has the value matching the given regexp as a
+// whole; see awkQueryWithFieldValues. The nested keys are joined with dots,
+// like "http.status".
+func awkJSONFieldValue(names []string, valueRe string) string {
+	terms := make([]string, 0, len(names))
+	for _, name := range names {
+		terms = append(terms, fmt.Sprintf(
+			`(%s(%s) && %s ~ /^%s$/)`, awkJSONGetFunc, awkStringLiteral(name), awkJSONValVar, valueRe,
+		))
+	}
+
+	return awkJoinOr(terms)
+}
+
+// awkJoinOr joins the awk expressions with "||"; if there's more than one,
+// they're parenthesized.
+func awkJoinOr(terms []string) string {
+	if len(terms) == 1 {
+		return terms[0]
+	}
+
+	return "(" + strings.Join(terms, " || ") + ")"
+}
+
+// awkStringLiteral returns the awk string literal with the given value.
+func awkStringLiteral(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// awkRegexpEscape escapes the string to be used literally inside of a regexp
+// literal like /.../, compatible with both awk and Go.
+func awkRegexpEscape(s string) string {
+	return strings.ReplaceAll(regexp.QuoteMeta(s), "/", `\/`)
+}
+
+// awkComparisonOperators are the operators supported by
+// awkQueryWithNumericComparisons; the two-char ones go first, so that e.g.
+// ">=" isn't taken for ">".
+var awkComparisonOperators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// awkNumberRegexp matches the numbers which can be compared with the fields.
+var awkNumberRegexp = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// awkBuiltinVars are the awk built-in variables, which are never treated as
+// the fields by awkQueryWithNumericComparisons, so e.g. "NF > 3" keeps working
+// as usual.
+var awkBuiltinVars = map[string]struct{}{
+	"ARGC": {}, "ARGV": {}, "CONVFMT": {}, "ENVIRON": {}, "FILENAME": {},
+	"FNR": {}, "FS": {}, "NF": {}, "NR": {}, "OFMT": {}, "OFS": {},
+	"ORS": {}, "RLENGTH": {}, "RS": {}, "RSTART": {}, "SUBSEP": {},
+}
+
+// awkNumericVar is the awk variable used by the numeric comparisons to hold
+// the value of the field being compared.
+const awkNumericVar = "__nerdlog_num"
+
+// awkQueryWithNumericComparisons replaces every "field op number" expression
+// in the awk query, like "latency_ms > 500" or "status >= 500", with an
+// expression which finds the field in the line, like "latency_ms=523" or
+// "latency_ms=\"523\"", and compares its value with the number numerically.
+// The lines where the field is missing or its value isn't a number, like
+// "latency_ms=fast", just don't match.
+//
+// Only the plain field names are translated: the awk fields like "$5 > 500"
+// and the built-in variables like "NF > 3" are left intact, and so is
+// anything compared with something else than a number literal.
+//
+// Just like in awkQueryWithFieldValues, the field can be a canonical name
+// from the aliases, and if isJSON is true, the field is looked up as a JSON
+// key instead, see awkJSONNumericComparison.
+func awkQueryWithNumericComparisons(query string, aliases map[string][]string, isJSON bool) (string, error) {
+	return rewriteAwkQuery(query, nil, func(query string, start, end int) (string, int, bool, error) {
+		field := query[start:end]
+		op, value, valueEnd, ok := parseAwkComparisonOperand(query, end)
+
+		_, isBuiltin := awkBuiltinVars[field]
+		isAwkField := start > 0 && query[start-1] == '$'
+		isNumber := field[0] >= '0' && field[0] <= '9'
+		if !ok || isBuiltin || isAwkField || isNumber {
+			return "", 0, false, nil
+		}
+
+		if isJSON {
+			return awkJSONNumericComparison(awkFieldNames(field, aliases), op, value), valueEnd, true, nil
+		}
+
+		return awkNumericComparison(awkFieldNamesRegexp(field, aliases), op, value), valueEnd, true, nil
+	})
+}
+
+// parseAwkComparisonOperand checks whether the query at the given position
+// (right after a word) continues with a comparison operator and a number; if
+// so, it returns them and the index right after the number, and ok is true.
+func parseAwkComparisonOperand(query string, pos int) (op, value string, end int, ok bool) {
+	i := skipAwkSpaces(query, pos)
+
+	for _, candidate := range awkComparisonOperators {
+		if strings.HasPrefix(query[i:], candidate) {
+			op = candidate
+			break
+		}
+	}
+
+	if op == "" {
+		return "", "", 0, false
+	}
+
+	valueStart := skipAwkSpaces(query, i+len(op))
+	end = valueStart
+	for end < len(query) && (isWordChar(query[end]) || query[end] == '.' || (end == valueStart && query[end] == '-')) {
+		end++
+	}
+
+	value = query[valueStart:end]
+	if !awkNumberRegexp.MatchString(value) {
+		return "", "", 0, false
+	}
+
+	return op, value, end, true
+}
+
+// awkNumericComparison returns the awk expression which compares the numeric
+// value of the field in the line with the given number; see
+// awkQueryWithNumericComparisons. Besides "field=value", the JSON keys like
+// "field": value are matched too. The value is first matched as a whole, to
+// make sure it's a number (so e.g. "500ms" doesn't match), and then extracted
+// from the match; awk then converts the leading number to a numeric value, so
+// the closing quote or the delimiter after it doesn't matter. The field is a
+// regexp, see awkFieldNamesRegexp.
+func awkNumericComparison(field, op, value string) string {
+	re := fmt.Sprintf(`/%s%s("?: *|=)"?-?[0-9]+(\.[0-9]+)?("|[^A-Za-z0-9_.]|$)/`, awkWordBoundaryStart, field)
+
+	return fmt.Sprintf(
+		`(match($0, %s) && (%s = substr($0, RSTART, RLENGTH)) != "" && sub(/^[^=:]*[=:] *"?/, "", %s) && %s + 0 %s %s)`,
+		re, awkNumericVar, awkNumericVar, awkNumericVar, op, value,
+	)
+}
+
+// awkJSONNumericComparison is like awkNumericComparison, but for the lines
+// which are JSON objects: the value of any of the given JSON keys (see
+// awkJSONFieldValue) is compared, as long as it's a number, either bare or
+// quoted.
+func awkJSONNumericComparison(names []string, op, value string) string {
+	terms := make([]string, 0, len(names))
+	for _, name := range names {
+		terms = append(terms, fmt.Sprintf(
+			`(%s(%s) && %s ~ /^-?[0-9]+(\.[0-9]+)?$/ && %s + 0 %s %s)`,
+			awkJSONGetFunc, awkStringLiteral(name), awkJSONValVar, awkJSONValVar, op, value,
+		))
+	}
+
+	return awkJoinOr(terms)
+}
@@ -0,0 +1,377 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwkQueryWithWordBoundaries(t *testing.T) {
+	testCases := []struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{query: "", want: ""},
+		{query: "/foo/", want: "/foo/"},
+		{
+			query: `/\berr\b/`,
+			want:  `/(^|[^A-Za-z0-9_])err([^A-Za-z0-9_]|$)/`,
+		},
+		{
+			query: `!/\berr/ && /foo\b/`,
+			want:  `!/(^|[^A-Za-z0-9_])err/ && /foo([^A-Za-z0-9_]|$)/`,
+		},
+		{
+			// Escaped backslash, bracket expressions and strings are left intact.
+			query: `/a\\b/ && /[\b]/ && $0 ~ "\\bfoo"`,
+			want:  `/a\\b/ && /[\b]/ && $0 ~ "\\bfoo"`,
+		},
+		{
+			// Slashes inside of the regexp.
+			query: `/\bfoo\/bar\b/`,
+			want:  `/(^|[^A-Za-z0-9_])foo\/bar([^A-Za-z0-9_]|$)/`,
+		},
+		{
+			query: `/\b(foo|bar)\b/ && /\b[a-z]+\b/`,
+			want:  `/(^|[^A-Za-z0-9_])(foo|bar)([^A-Za-z0-9_]|$)/ && /(^|[^A-Za-z0-9_])[a-z]+([^A-Za-z0-9_]|$)/`,
+		},
+		{query: `/foo\bbar/`, wantErr: true},
+		{query: `/(foo)\b(bar)/`, wantErr: true},
+		{query: `/foo/ && /bar`, wantErr: true},
+		{query: `/foo\/`, wantErr: true},
+		{query: `$0 ~ "foo`, wantErr: true},
+		{query: `/ \b /`, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			got, err := awkQueryWithWordBoundaries(tc.query)
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Error(t, ValidateQuery(tc.query))
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.NoError(t, ValidateQuery(tc.query))
+		})
+	}
+}
+
+func TestAwkQueryWithHasOperator(t *testing.T) {
+	listFields := map[string]string{
+		"ids":  ",",
+		"tags": "|",
+	}
+
+	idsHas42 := `/(^|[^A-Za-z0-9_])ids=("([^"]*,)?42(,[^"]*)?"|([^ "]*,)?42(,[^ ]*)?( |$))/`
+
+	testCases := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr string
+	}{
+		{name: "empty", query: "", want: ""},
+		{name: "no has", query: `/foo/ && $3 == "has"`, want: `/foo/ && $3 == "has"`},
+		{name: "simple", query: "ids has 42", want: idsHas42},
+		{
+			name:  "combined with other terms",
+			query: "/foo/ && !(ids has 42)",
+			want:  "/foo/ && !(" + idsHas42 + ")",
+		},
+		{
+			name:  "quoted value with the delimiter escaped",
+			query: `tags has "a.b"`,
+			want:  `/(^|[^A-Za-z0-9_])tags=("([^"]*\|)?a\.b(\|[^"]*)?"|([^ "]*\|)?a\.b(\|[^ ]*)?( |$))/`,
+		},
+		{
+			name:  "has inside of a regexp or a string is left intact",
+			query: `/ids has 42/ || $0 ~ "ids has 42"`,
+			want:  `/ids has 42/ || $0 ~ "ids has 42"`,
+		},
+		{
+			name:  "word which only starts with has",
+			query: "hash && foo hash",
+			want:  "hash && foo hash",
+		},
+		{
+			name:    "not a list field",
+			query:   "/foo/ && level has error",
+			wantErr: `field level is not a list field, so it doesn't support "has"; list fields are configured with list_fields in the logstreams config`,
+		},
+		{name: "no value", query: "ids has ", wantErr: "ids has: value is missing"},
+		{name: "unterminated value", query: `ids has "42`, wantErr: `ids has: unterminated string at position 9: "42 (to use " literally inside, escape it as \")`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := awkQueryWithHasOperator(tc.query, listFields, nil)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestAwkListFieldHasRegexpMatching(t *testing.T) {
+	terms, err := parseSimpleAwkQuery(awkListFieldHasRegexp("ids", ",", "42"))
+	assert.NoError(t, err)
+	assert.Len(t, terms, 1)
+
+	re := regexp.MustCompile(terms[0].re)
+
+	for _, line := range []string{
+		"foo ids=42 bar",
+		"foo ids=1,42,3 bar",
+		"foo ids=1,42",
+		`foo ids="1,42,3" bar`,
+		`foo ids="42"`,
+	} {
+		assert.True(t, re.MatchString(line), line)
+	}
+
+	for _, line := range []string{
+		"foo ids=142 bar",
+		"foo ids=1,421,3 bar",
+		"foo myids=42 bar",
+		"foo ids=1 other=42",
+		`foo ids="1,2" other=42`,
+	} {
+		assert.False(t, re.MatchString(line), line)
+	}
+}
+
+func TestAwkNumericComparisonMatching(t *testing.T) {
+	// The regexp is the first argument of match().
+	expr := awkNumericComparison("status", ">=", "500")
+	reStart := strings.Index(expr, "/") + 1
+	reEnd := strings.Index(expr, "/) &&")
+	re := regexp.MustCompile(expr[reStart:reEnd])
+
+	for _, line := range []string{
+		"foo status=503 bar",
+		`foo status="503"`,
+		`{"status":503,"msg":"foo"}`,
+		`{"msg": "foo", "status": 503}`,
+		`{"status":"503"}`,
+	} {
+		assert.True(t, re.MatchString(line), line)
+	}
+
+	for _, line := range []string{
+		"foo mystatus=503 bar",
+		"foo status=503ms",
+		`{"status":"failed"}`,
+		`{"http_status":503}`,
+	} {
+		assert.False(t, re.MatchString(line), line)
+	}
+}
+
+func TestAwkQueryWithNumericComparisons(t *testing.T) {
+	latencyGt500 := `(match($0, /(^|[^A-Za-z0-9_])latency_ms("?: *|=)"?-?[0-9]+(\.[0-9]+)?("|[^A-Za-z0-9_.]|$)/) && ` +
+		`(__nerdlog_num = substr($0, RSTART, RLENGTH)) != "" && sub(/^[^=:]*[=:] *"?/, "", __nerdlog_num) && __nerdlog_num + 0 > 500)`
+	statusGeNeg := `(match($0, /(^|[^A-Za-z0-9_])status("?: *|=)"?-?[0-9]+(\.[0-9]+)?("|[^A-Za-z0-9_.]|$)/) && ` +
+		`(__nerdlog_num = substr($0, RSTART, RLENGTH)) != "" && sub(/^[^=:]*[=:] *"?/, "", __nerdlog_num) && __nerdlog_num + 0 >= -1.5)`
+
+	testCases := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr string
+	}{
+		{name: "empty", query: "", want: ""},
+		{name: "simple", query: "latency_ms > 500", want: latencyGt500},
+		{name: "no spaces", query: "latency_ms>500", want: latencyGt500},
+		{
+			name:  "combined with other terms",
+			query: "/foo/ && status>=-1.5 && !/bar/",
+			want:  "/foo/ && " + statusGeNeg + " && !/bar/",
+		},
+		{
+			name:  "awk fields and built-in variables are left intact",
+			query: "$3 > 500 && NF >= 3 && NR == 1",
+			want:  "$3 > 500 && NF >= 3 && NR == 1",
+		},
+		{
+			name:  "not a number",
+			query: `status == "ok" && latency_ms > foo && code != 5xx`,
+			want:  `status == "ok" && latency_ms > foo && code != 5xx`,
+		},
+		{
+			name:  "comparison inside of a regexp or a string is left intact",
+			query: `/latency_ms > 500/ || $0 ~ "status >= 500"`,
+			want:  `/latency_ms > 500/ || $0 ~ "status >= 500"`,
+		},
+		{
+			name:  "dotted field",
+			query: "http.status > 500",
+			want: `(match($0, /(^|[^A-Za-z0-9_])http\.status("?: *|=)"?-?[0-9]+(\.[0-9]+)?("|[^A-Za-z0-9_.]|$)/) && ` +
+				`(__nerdlog_num = substr($0, RSTART, RLENGTH)) != "" && sub(/^[^=:]*[=:] *"?/, "", __nerdlog_num) && __nerdlog_num + 0 > 500)`,
+		},
+		{name: "unterminated string", query: `foo == "bar`, wantErr: `unterminated string at position 8: "bar (to use " literally inside, escape it as \")`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := awkQueryWithNumericComparisons(tc.query, nil, false)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestAwkQueryWithFieldValues(t *testing.T) {
+	aliases := map[string][]string{
+		"level": {"severity", "PRIORITY"},
+	}
+
+	testCases := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr string
+	}{
+		{name: "empty", query: "", want: ""},
+		{
+			name:  "simple",
+			query: "source:web1",
+			want:  `/(^|[^A-Za-z0-9_])source("?: *"?|="?)web1([^A-Za-z0-9_]|$)/`,
+		},
+		{
+			name:  "aliased field",
+			query: "/foo/ && !level:error",
+			want:  `/foo/ && !/(^|[^A-Za-z0-9_])(level|severity|PRIORITY)("?: *"?|="?)(error|0|1|2|3)([^A-Za-z0-9_]|$)/`,
+		},
+		{
+			name:  "numeric level",
+			query: "level:4",
+			want:  `/(^|[^A-Za-z0-9_])(level|severity|PRIORITY)("?: *"?|="?)4([^A-Za-z0-9_]|$)/`,
+		},
+		{
+			name:  "unknown level",
+			query: "level:foo",
+			want:  `/(^|[^A-Za-z0-9_])(level|severity|PRIORITY)("?: *"?|="?)foo([^A-Za-z0-9_]|$)/`,
+		},
+		{
+			name:  "quoted value",
+			query: `user:"John D."`,
+			want:  `/(^|[^A-Za-z0-9_])user("?: *"?|="?)John D\.([^A-Za-z0-9_]|$)/`,
+		},
+		{
+			name:  "ternary and literals are left intact",
+			query: `(NF > 3 ? a : b) && /level:error/ && $0 ~ "level:error"`,
+			want:  `(NF > 3 ? a : b) && /level:error/ && $0 ~ "level:error"`,
+		},
+		{
+			name:  "ternary without spaces",
+			query: `(/x/ ? a:b) && (/y/ ? (c ? d:e):f)`,
+			want:  `(/x/ ? a:b) && (/y/ ? (c ? d:e):f)`,
+		},
+		{
+			name:  "parenthesized field value in ternary",
+			query: `/x/ ? (source:web1):b`,
+			want:  `/x/ ? (/(^|[^A-Za-z0-9_])source("?: *"?|="?)web1([^A-Za-z0-9_]|$)/):b`,
+		},
+		{
+			name:  "field value after ternary",
+			query: `(/x/ ? a:b) && source:web1`,
+			want:  `(/x/ ? a:b) && /(^|[^A-Za-z0-9_])source("?: *"?|="?)web1([^A-Za-z0-9_]|$)/`,
+		},
+		{name: "no value", query: "level:(", wantErr: "level:: value is missing"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := awkQueryWithFieldValues(tc.query, aliases, false)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestAwkQueryWithJSONFields(t *testing.T) {
+	aliases := map[string][]string{
+		"level": {"severity"},
+	}
+
+	got, err := awkQueryWithFieldValues(`/foo/ && level:warn && http.path:"/a b"`, aliases, true)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`/foo/ && ((nerdlogJsonGet("level") && nerdlogJsonVal ~ /^(warn|4)$/) || `+
+			`(nerdlogJsonGet("severity") && nerdlogJsonVal ~ /^(warn|4)$/)) && `+
+			`(nerdlogJsonGet("http.path") && nerdlogJsonVal ~ /^\/a b$/)`,
+		got,
+	)
+
+	got, err = awkQueryWithNumericComparisons("http.status >= 500 && NF > 3", aliases, true)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`(nerdlogJsonGet("http.status") && nerdlogJsonVal ~ /^-?[0-9]+(\.[0-9]+)?$/ && nerdlogJsonVal + 0 >= 500) && NF > 3`,
+		got,
+	)
+}
+
+func TestAwkFieldValueRegexpMatching(t *testing.T) {
+	terms, err := parseSimpleAwkQuery(awkFieldValueRegexp("(level|severity)", "5"))
+	assert.NoError(t, err)
+	assert.Len(t, terms, 1)
+
+	re := regexp.MustCompile(terms[0].re)
+
+	for _, line := range []string{
+		"foo level=5 bar",
+		`foo severity="5"`,
+		`{"level":"5","msg":"foo"}`,
+		`{"msg": "foo", "severity": 5}`,
+		"level: 5",
+	} {
+		assert.True(t, re.MatchString(line), line)
+	}
+
+	for _, line := range []string{
+		"foo level=503 bar",
+		"foo mylevel=5",
+		`{"level":"5xx"}`,
+		"foo other=5",
+	} {
+		assert.False(t, re.MatchString(line), line)
+	}
+}
+
+func TestAwkFieldValueRegexpLevelPriorities(t *testing.T) {
+	terms, err := parseSimpleAwkQuery(
+		awkFieldValueRegexp("(level|PRIORITY)", awkFieldValueAltsRegexp("level", "error")),
+	)
+	assert.NoError(t, err)
+	assert.Len(t, terms, 1)
+
+	re := regexp.MustCompile(terms[0].re)
+
+	for _, line := range []string{"level=error", "PRIORITY=3", `{"PRIORITY":"0"}`} {
+		assert.True(t, re.MatchString(line), line)
+	}
+
+	for _, line := range []string{"PRIORITY=4", "level=warn", "PRIORITY=30"} {
+		assert.False(t, re.MatchString(line), line)
+	}
+}
@@ -1,6 +1,12 @@
 package core
 
-import "sort"
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
 
 type ConfigLogStreams map[string]ConfigLogStream
 
@@ -20,7 +26,19 @@ type ConfigLogStream struct {
 	// apply.
 	User string `yaml:"user"`
 
-	// TODO: optional Jumphost configuration, also with addr and user.
+	// Jumphost, if not empty, is the bastion host to connect through, like
+	// "user@bastion.example.com:22" (the user and port are optional); the same
+	// as the -J flag in the logstreams filter. Only a single jumphost is
+	// supported.
+	Jumphost string `yaml:"jumphost"`
+
+	// ProxyCommand, if not empty, is the shell command whose stdin and stdout
+	// are used to talk to the host, like "ssh -W %h:%p bastion", just like the
+	// ProxyCommand in the ssh config: "%h", "%p" and "%r" are replaced with the
+	// host, port and user, "%%" with "%", and so on, see expandProxyCommand.
+	// It takes precedence over the Jumphost in the same item, but not over a
+	// jumphost given explicitly with the -J flag.
+	ProxyCommand string `yaml:"proxy_command"`
 
 	// LogFiles contains a list of files which are part of the logstream, like
 	// ["/var/log/syslog", "/var/log/syslog.1"]. The [0]th item is the latest log
@@ -32,7 +50,47 @@ type ConfigLogStream struct {
 	// the LStreamsResolver).
 	LogFiles []string `yaml:"log_files"`
 
+	// MergeLogFiles contains other files which are read alongside LogFiles,
+	// like ["/var/log/app.err"] if an app writes both app.log and app.err.
+	// It's a per-file fan-out: every file is queried as a separate logstream
+	// on the same host (see LogStream.MergeInto), and the results are merged by
+	// timestamps like for any other logstreams; the messages found in more than
+	// one of these files (the same timestamp and text) are only shown once. For
+	// every file, the previous one is autodetected, just like when LogFiles only
+	// contains a single item.
+	MergeLogFiles []string `yaml:"merge_log_files"`
+
 	Options ConfigLogStreamOptions `yaml:"options"`
+
+	// HTTP, if set, means that the logs are not read from files over the shell,
+	// but queried from an HTTP log API instead; Hostname, Port, User and
+	// LogFiles are ignored in this case.
+	HTTP *ConfigLogStreamHTTP `yaml:"http"`
+}
+
+// ConfigLogStreamHTTP describes a logstream behind an HTTP log API with
+// Loki-compatible range queries.
+type ConfigLogStreamHTTP struct {
+	// URL is the base URL of the API, like "http://loki.example.com:3100";
+	// the "/loki/api/v1/query_range" path is appended to it.
+	URL string `yaml:"url"`
+
+	// Selector is the stream selector which all queries start with, like
+	// `{job="myapp"}`.
+	Selector string `yaml:"selector"`
+
+	// AuthHeader is the name of the header to send AuthToken in; if empty,
+	// "Authorization" is used.
+	AuthHeader string `yaml:"auth_header"`
+
+	// AuthToken is the value of the auth header, like "Bearer xxxx". To avoid
+	// keeping secrets in the config, env vars in it are expanded, e.g.
+	// "Bearer ${LOKI_TOKEN}".
+	AuthToken string `yaml:"auth_token"`
+
+	// Headers contains any extra headers to send, like "X-Scope-OrgID"; env
+	// vars in the values are expanded too.
+	Headers map[string]string `yaml:"headers"`
 }
 
 // ConfigLogStreamOptions contains additional options for a particular logstream.
@@ -50,6 +108,53 @@ type ConfigLogStreamOptions struct {
 	// custom env vars for tests, like: "export TZ=America/New_York", but
 	// might be useful outside of tests as well.
 	ShellInit []string `yaml:"shell_init"`
+
+	// FieldAliases maps a canonical field name to the list of actual field
+	// names which this logstream might use for it, e.g. "level" can map to
+	// ["severity", "PRIORITY"]. The first actual field found in a message is
+	// renamed to the canonical name.
+	FieldAliases map[string][]string `yaml:"field_aliases"`
+
+	// TimestampLayout is a Go-style time layout of the timestamps in the log
+	// lines, like "2006-01-02 15:04:05". If empty (which is the default), the
+	// layout is autodetected.
+	TimestampLayout string `yaml:"timestamp_layout"`
+
+	// LogFormat is the format of the log lines, which determines how they're
+	// parsed: "syslog", "journald", "rfc3339", "json" or "raw"; see the
+	// LogFormat constants. If empty or "auto" (which is the default), the
+	// format is autodetected.
+	LogFormat string `yaml:"format"`
+
+	// KeepaliveInterval specifies how often to ping an otherwise idle
+	// connection, to keep it alive. If zero, the default of 40s is used.
+	KeepaliveInterval time.Duration `yaml:"keepalive_interval"`
+
+	// IdleTimeout, if non-zero, specifies after how long of not running any
+	// queries we disconnect from the logstream. It'll be reconnected
+	// automatically on the next query.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+
+	// DefaultQuery is an optional awk pattern which is ANDed with the query for
+	// this logstream, e.g. to always filter out the noise like healthchecks.
+	// It can be bypassed with QueryLogsParams.NoDefaultQueries.
+	DefaultQuery string `yaml:"default_query"`
+
+	// StripANSI, if true, removes the ANSI escape sequences (like colors) from
+	// the messages, for apps which write colored output to their log files.
+	// The OrigLine is kept intact.
+	StripANSI bool `yaml:"strip_ansi"`
+
+	// ListFields maps the names of the fields which hold lists of values, like
+	// "ids=1,2,3", to the delimiter of the values (like ","). Only these fields
+	// support the "has" operator in the queries, like "ids has 2"; see
+	// awkQueryWithHasOperator.
+	ListFields map[string]string `yaml:"list_fields"`
+
+	// ExpectQuiet, if true, means that it's normal for this logstream to have
+	// no logs matching the query while others have plenty, so nerdlog won't
+	// warn about it; see the quietthreshold option.
+	ExpectQuiet bool `yaml:"expect_quiet"`
 }
 
 func (lss ConfigLogStreams) Keys() []string {
@@ -76,3 +181,83 @@ func (opts ConfigLogStreamOptions) EffectiveSudoMode() SudoMode {
 
 	return ""
 }
+
+// ConfigLStreamGroups is a map from the group name to the list of its members;
+// every member is either a logstream spec entry (like "myserver.com" or
+// "foo-*"), or the name of another group. Group names can be used in the
+// logstreams spec just like any other entry.
+type ConfigLStreamGroups map[string][]string
+
+// Validate checks that none of the groups has empty members or cyclic
+// references.
+func (g ConfigLStreamGroups) Validate() error {
+	names := make([]string, 0, len(g))
+	for name := range g {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, member := range g[name] {
+			if strings.TrimSpace(member) == "" {
+				return errors.Errorf("group %s has an empty member", name)
+			}
+		}
+
+		if _, err := g.Expand([]string{name}); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+// Expand replaces all group names in the given logstream spec entries with
+// the members of these groups, recursively, and removes duplicates (keeping
+// the first occurrence). If there are cyclic references, an error is
+// returned.
+func (g ConfigLStreamGroups) Expand(entries []string) ([]string, error) {
+	ret := make([]string, 0, len(entries))
+	seen := map[string]struct{}{}
+
+	var expand func(entries []string, path []string) error
+	expand = func(entries []string, path []string) error {
+		for _, entry := range entries {
+			entry = strings.TrimSpace(entry)
+
+			members, isGroup := g[entry]
+			if !isGroup {
+				if _, ok := seen[entry]; !ok {
+					seen[entry] = struct{}{}
+					ret = append(ret, entry)
+				}
+
+				continue
+			}
+
+			// Make sure we don't modify the caller's path.
+			groupPath := append(path[:len(path):len(path)], entry)
+
+			for _, name := range path {
+				if name == entry {
+					return errors.Errorf(
+						"cyclic group reference: %s", strings.Join(groupPath, " -> "),
+					)
+				}
+			}
+
+			if err := expand(members, groupPath); err != nil {
+				return errors.Trace(err)
+			}
+		}
+
+		return nil
+	}
+
+	if err := expand(entries, nil); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return ret, nil
+}
@@ -12,15 +12,67 @@ type QueryLogsParams struct {
 	// most.
 	MaxNumLines int
 
+	// If CountOnly is true, only the MinuteStats are requested from the
+	// logstreams, without any log lines; MaxNumLines is ignored then. This is
+	// much faster for wide time ranges, when all we need is the histogram.
+	CountOnly bool
+
 	From time.Time
 	To   time.Time
 
+	// LineRange, if not nil, makes the query fetch the given range of lines
+	// from the given file, regardless of their timestamps: From and To are
+	// ignored then. Query and Exclude are still applied.
+	LineRange *LineRange
+
 	Query string
 
+	// Exclude is an optional awk pattern; lines matching it are dropped even if
+	// they match Query. It's kept separate from Query so that noisy lines can
+	// be suppressed without crafting a complex single expression.
+	Exclude string
+
+	// NamedQueries, if not empty, makes the query return only the lines which
+	// match any of them (in addition to Query and Exclude), and every message
+	// gets the FieldNameNamedQueries context field with the names of the named
+	// queries it matches; so effectively, the union of a few queries is shown.
+	// See ValidateNamedQuery for the limitations.
+	NamedQueries []NamedQuery
+
+	// If NoDefaultQueries is true, the default queries configured for the
+	// logstreams (see ConfigLogStreamOptions.DefaultQuery) are not applied.
+	NoDefaultQueries bool
+
 	// If LoadEarlier is true, it means we're only loading the logs _before_ the ones
 	// we already had.
 	LoadEarlier bool
 
+	// MaxLineLength, if positive, is the maximum length of a log line in
+	// bytes: longer ones are truncated, along with their messages and context
+	// values, and TruncatedLineMarker is appended; see LogMsg.TruncatedLen.
+	// It protects the UI from pathological lines like multi-megabyte blobs.
+	MaxLineLength int
+
+	// MaxRetainedLines, if non-zero, is the maximum number of log messages
+	// which are retained in LogRespTotal.Logs; once it's exceeded, the messages
+	// furthest from what the user is looking at are evicted: the newest ones
+	// when loading earlier logs, or the oldest ones otherwise.
+	MaxRetainedLines int
+
+	// Timeout, if non-zero, is how long to wait for all logstreams to respond;
+	// once it's exceeded, the logstreams which haven't responded yet are
+	// reconnected (which aborts the commands running there), and the query
+	// completes with the results from the ones which did respond. The
+	// timed-out logstreams are reported in LogRespTotal.TimedOutLStreams.
+	Timeout time.Duration
+
+	// DefaultIdleTimeout is the idle timeout for the logstreams which don't
+	// have their own (see ConfigLogStreamOptions.IdleTimeout): once the
+	// logstream didn't run any queries for that long, it's disconnected, and
+	// reconnected on the next query. Zero means no timeout. It's passed with
+	// every query, so it takes effect after the next one.
+	DefaultIdleTimeout time.Duration
+
 	// If DontAddHistoryItem is true, the browser-like history will not be
 	// populated with a new item (it should be used exactly when we're navigating
 	// this browser-like history back and forth)
@@ -32,6 +84,14 @@ type QueryLogsParams struct {
 	RefreshIndex bool
 }
 
+// LineRange is a range of lines in a log file, both ends inclusive, with the
+// line numbers starting from 1.
+type LineRange struct {
+	File string
+	From int
+	To   int
+}
+
 // LogResp is a log response from a single logstream
 type LogResp struct {
 	// MinuteStats is a map from the unix timestamp (in seconds) to the stats for
@@ -44,6 +104,25 @@ type LogResp struct {
 	// included in MinuteStats). This number is usually larger than len(Logs).
 	NumMsgsTotal int
 
+	// NumParseErrors is the number of log lines which we failed to parse
+	// (e.g. because the timestamp doesn't match the layout); such lines are
+	// not included in Logs.
+	NumParseErrors int
+
+	// NumOutOfRange is the number of log lines which the agent has returned,
+	// but which are outside of the exact time range requested; see
+	// dropLogsOutOfRange. Such lines are not included in Logs, and they're
+	// subtracted from MinuteStats; but the out-of-range lines which weren't
+	// returned at all (because of the max number of lines) are still counted
+	// in the MinuteStats of the partial minutes at the range boundaries.
+	NumOutOfRange int
+
+	// Warnings contains non-fatal issues reported by the agent script on
+	// stderr with the "warning:" prefix, like a file which couldn't be read;
+	// the query itself has still succeeded, but the results might be
+	// incomplete.
+	Warnings []string
+
 	// DebugInfo contains info collected during this particular query.
 	DebugInfo LogstreamDebugInfo
 }
@@ -62,6 +141,10 @@ type LogRespTotal struct {
 	// the logs (the Logs slice still contains everything though).
 	LoadedEarlier bool
 
+	// CountOnly is true if the query was done with QueryLogsParams.CountOnly,
+	// so Logs is empty, but MinuteStats and NumMsgsTotal are populated.
+	CountOnly bool
+
 	// MinuteStats is a map from the unix timestamp (in seconds) to the stats for
 	// the minute starting at this timestamp.
 	MinuteStats map[int64]MinuteStatsItem
@@ -72,6 +155,49 @@ type LogRespTotal struct {
 	// included in MinuteStats). This number is usually larger than len(Logs).
 	NumMsgsTotal int
 
+	// Truncated is true if Logs doesn't contain all the messages matching the
+	// query in the requested time range, i.e. len(Logs) < NumMsgsTotal.
+	Truncated bool
+
+	// NumEvicted is the number of messages which were evicted from Logs due to
+	// QueryLogsParams.MaxRetainedLines: the newest ones if LoadedEarlier is
+	// true, or the oldest ones otherwise.
+	NumEvicted int
+
+	// NumDeduped is the number of messages which were dropped from Logs since
+	// the same messages were found in another file of the same logstream; see
+	// ConfigLogStream.MergeLogFiles. They're also subtracted from MinuteStats
+	// and NumMsgsTotal, but only the loaded ones are known: the duplicates
+	// among the lines which weren't loaded (e.g. when Truncated is true) are
+	// still counted there.
+	NumDeduped int
+
+	// NumMsgsByLStream is a map from the logstream name to the number of
+	// messages in the time range (before dropping the duplicates, see
+	// NumDeduped) from that logstream. All the logstreams which have responded
+	// are included, even if they have no messages; the timed out ones aren't.
+	NumMsgsByLStream map[string]int
+
+	// MinuteStatsByLStream is a map from the logstream name to its own minute
+	// stats (see MinuteStats, which is the sum of all these). Same as in
+	// NumMsgsByLStream, the timed out logstreams aren't included.
+	MinuteStatsByLStream map[string]map[int64]MinuteStatsItem
+
+	// NumParseErrorsByLStream is a map from the logstream name to the number of
+	// log lines which we failed to parse. Only logstreams with non-zero number
+	// of failures are included.
+	NumParseErrorsByLStream map[string]int
+
+	// WarningsByLStream is a map from the logstream name to the warnings
+	// reported for it (see LogResp.Warnings). Only logstreams with at least one
+	// warning are included.
+	WarningsByLStream map[string][]string
+
+	// TimedOutLStreams contains the names of the logstreams which didn't
+	// respond within QueryLogsParams.Timeout, sorted; the results don't
+	// include any logs from them.
+	TimedOutLStreams []string
+
 	Errs []error
 
 	// DebugInfo is a map from the logstream name to the corresponding debug info
@@ -80,6 +206,18 @@ type LogRespTotal struct {
 
 	// QueryDur shows how long the query took.
 	QueryDur time.Duration
+
+	// Partial is true if the query is still in progress on some of the
+	// logstreams (NumPendingLStreams of them), and the response only contains
+	// the results from the ones which have responded so far. The final
+	// response with Partial being false always follows.
+	Partial            bool
+	NumPendingLStreams int
+
+	// First is true for the first response to the query, partial or not. It
+	// replaces the results of the previous query, so the UI is supposed to
+	// show it right away.
+	First bool
 }
 
 type MinuteStatsItem struct {
@@ -105,6 +243,11 @@ type LogMsg struct {
 	Level   LogLevel
 
 	OrigLine string
+
+	// TruncatedLen, if non-zero, means that the line was longer than
+	// QueryLogsParams.MaxLineLength, so OrigLine, Msg and the context values
+	// were truncated; it's the length of the original line in bytes.
+	TruncatedLen int
 }
 
 type LogLevel string
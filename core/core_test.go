@@ -310,7 +310,10 @@ func (th *LStreamsManagerTestHelper) applyUpdate(upd LStreamsManagerUpdate) {
 
 	if upd.State != nil {
 		th.state.connected = upd.State.Connected
-	} else if upd.LogResp != nil {
+	} else if upd.LogResp != nil && !upd.LogResp.Partial {
+		// The partial responses are only sent while the query is in progress,
+		// and the final one always follows, so the scenarios only care about
+		// the latter.
 		th.state.pendingLogResps = append(th.state.pendingLogResps, upd.LogResp)
 	}
 }
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// LogFormat is the format of the log lines, which determines how the rest of
+// the line is parsed after the timestamp (the timestamp itself is described
+// by TimeFormatDescr).
+type LogFormat string
+
+const (
+	// LogFormatAuto means that the format is autodetected from the example log
+	// lines received during the bootstrap; see DetectLogFormat.
+	LogFormatAuto LogFormat = ""
+
+	// LogFormatSyslog is the traditional syslog format, with any timestamp
+	// followed by the envelope: "myhost myprogram[1234]: Something happened".
+	// The hostname, program and pid are parsed into the context.
+	LogFormatSyslog LogFormat = "syslog"
+
+	// LogFormatJournald is what journalctl outputs with
+	// --output=short-iso-precise; the envelope is the same as for syslog.
+	LogFormatJournald LogFormat = "journald"
+
+	// LogFormatRFC3339 is an RFC3339 timestamp followed by an arbitrary text,
+	// which is the message as is.
+	LogFormatRFC3339 LogFormat = "rfc3339"
+
+	// LogFormatJSON is a JSON object per line, possibly prefixed with a
+	// timestamp. The keys are parsed into the context, and the message is
+	// the "msg" or "message" key; see parseLogMsgJSON.
+	LogFormatJSON LogFormat = "json"
+
+	// LogFormatRaw is anything else: everything after the timestamp is the
+	// message as is. It's also the fallback when the detection is ambiguous.
+	LogFormatRaw LogFormat = "raw"
+)
+
+// ParseLogFormat parses the log format as configured by the user; "auto" is
+// the same as an empty string.
+func ParseLogFormat(s string) (LogFormat, error) {
+	if s == "auto" {
+		return LogFormatAuto, nil
+	}
+
+	switch format := LogFormat(s); format {
+	case LogFormatAuto, LogFormatSyslog, LogFormatJournald, LogFormatRFC3339, LogFormatJSON, LogFormatRaw:
+		return format, nil
+	}
+
+	return "", errors.Errorf(
+		"invalid log format %q, valid values are: auto, syslog, journald, rfc3339, json, raw", s,
+	)
+}
+
+// LogFormatGuess is the log format used for a particular logstream, along
+// with how it was chosen.
+type LogFormatGuess struct {
+	Format LogFormat
+
+	// TimestampLayout is the Go-style layout of the timestamps, either
+	// configured or detected.
+	TimestampLayout string
+
+	// Configured is true if the format was set in the config explicitly,
+	// rather than detected.
+	Configured bool
+
+	// Ambiguous is true if the example log lines looked like different formats,
+	// so Format fell back to LogFormatRaw.
+	Ambiguous bool
+}
+
+// mightHaveSyslogEnvelope returns whether the syslog envelope should be parsed
+// out of the messages, see parseLogMsgEnvelopeDefault. It's a no-op for the
+// lines without the envelope, so it's only skipped when we're sure the format
+// is different: it's configured explicitly, or the lines were detected to be
+// JSON. In particular, the raw format (including the ambiguous detection) and
+// rfc3339 (which is only based on the timestamp) still get it.
+func (g LogFormatGuess) mightHaveSyslogEnvelope() bool {
+	switch {
+	case g.Configured:
+		return g.Format == LogFormatSyslog || g.Format == LogFormatJournald
+	case g.Format == LogFormatJSON:
+		return false
+	}
+
+	return true
+}
+
+// DetectLogFormat guesses the log format based on the given example log lines
+// (typically the first and last lines of the log files) with the timestamps
+// in the given layout. If the lines don't agree on the format, it falls back
+// to LogFormatRaw, and the guess is marked as ambiguous. isJournalctl should
+// be true if the lines come from journalctl rather than from log files.
+func DetectLogFormat(logLines []string, timestampLayout string, isJournalctl bool) LogFormatGuess {
+	ret := LogFormatGuess{
+		Format:          LogFormatRaw,
+		TimestampLayout: timestampLayout,
+	}
+
+	for i, line := range logLines {
+		format := detectLineLogFormat(line, timestampLayout, isJournalctl)
+		if i == 0 {
+			ret.Format = format
+			continue
+		}
+
+		if format != ret.Format {
+			ret.Format = LogFormatRaw
+			ret.Ambiguous = true
+			break
+		}
+	}
+
+	return ret
+}
+
+func detectLineLogFormat(line, timestampLayout string, isJournalctl bool) LogFormat {
+	var body string
+	if n := getTimestampLen(timestampLayout, line); n <= len(line) {
+		body = strings.TrimSpace(line[n:])
+	}
+
+	switch {
+	case strings.HasPrefix(body, "{") && json.Valid([]byte(body)):
+		return LogFormatJSON
+	case syslogRegex.MatchString(body):
+		if isJournalctl {
+			return LogFormatJournald
+		}
+
+		return LogFormatSyslog
+	case strings.HasPrefix(timestampLayout, "2006-01-02T"):
+		return LogFormatRFC3339
+	}
+
+	return LogFormatRaw
+}
+
+// jsonMessageKeys are the keys of a JSON log line which are used as the
+// message, in the order of preference.
+var jsonMessageKeys = []string{"msg", "message"}
+
+// parseLogMsgJSON parses the message as a JSON object, and puts every key
+// into the context: the nested objects are flattened, with the keys joined
+// by dots like "http.status", and the values other than strings are kept as
+// JSON, like "500" or "[1,2]". The value of the first of the jsonMessageKeys
+// which is present becomes the message; if none is, the message stays the
+// JSON as is. If the message isn't a JSON object, it's left intact.
+//
+// The queries refer to these fields by the same names, but they're looked up
+// by the agent on its own, see awkJSONFieldValue.
+func parseLogMsgJSON(logMsg *LogMsg) {
+	body := strings.TrimSpace(logMsg.Msg)
+	if !strings.HasPrefix(body, "{") {
+		return
+	}
+
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return
+	}
+
+	if logMsg.Context == nil {
+		logMsg.Context = map[string]string{}
+	}
+
+	addJSONToContext(logMsg.Context, "", obj)
+
+	for _, key := range jsonMessageKeys {
+		if msg, ok := obj[key].(string); ok {
+			logMsg.Msg = msg
+			delete(logMsg.Context, key)
+			return
+		}
+	}
+
+	logMsg.Msg = body
+}
+
+func addJSONToContext(ctx map[string]string, prefix string, obj map[string]interface{}) {
+	for k, v := range obj {
+		key := prefix + k
+
+		switch v := v.(type) {
+		case map[string]interface{}:
+			addJSONToContext(ctx, key+".", v)
+		case string:
+			ctx[key] = v
+		case nil:
+			ctx[key] = ""
+		default:
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(v); err != nil {
+				continue
+			}
+
+			ctx[key] = strings.TrimSpace(buf.String())
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectLogFormat(t *testing.T) {
+	type testCase struct {
+		descr string
+
+		logLines        []string
+		timestampLayout string
+		isJournalctl    bool
+
+		want LogFormatGuess
+	}
+
+	testCases := []testCase{
+		{
+			descr: "traditional syslog",
+			logLines: []string{
+				"Mar 10 10:00:01 myhost kern[5159]: <emerg> Disk space reclaimed",
+				"Mar  9 15:04:05 myhost mail: High CPU usage detected",
+			},
+			timestampLayout: "Jan _2 15:04:05",
+			want: LogFormatGuess{
+				Format:          LogFormatSyslog,
+				TimestampLayout: "Jan _2 15:04:05",
+			},
+		},
+		{
+			descr: "journalctl",
+			logLines: []string{
+				"2025-03-10T10:00:01.452457+00:00 myhost kern[5159]: <emerg> Disk space reclaimed",
+			},
+			timestampLayout: "2006-01-02T15:04:05.000000Z07:00",
+			isJournalctl:    true,
+			want: LogFormatGuess{
+				Format:          LogFormatJournald,
+				TimestampLayout: "2006-01-02T15:04:05.000000Z07:00",
+			},
+		},
+		{
+			descr: "rfc3339 with a plain text message",
+			logLines: []string{
+				"2025-03-10T10:00:01Z starting the server",
+				"2025-03-10T10:05:01+02:00 shutting down",
+			},
+			timestampLayout: "2006-01-02T15:04:05Z07:00",
+			want: LogFormatGuess{
+				Format:          LogFormatRFC3339,
+				TimestampLayout: "2006-01-02T15:04:05Z07:00",
+			},
+		},
+		{
+			descr: "json",
+			logLines: []string{
+				`2025-03-10 10:00:01 {"level": "info", "msg": "hello"}`,
+				`2025-03-10 10:00:02 {"level": "error", "msg": "world"}`,
+			},
+			timestampLayout: "2006-01-02 15:04:05",
+			want: LogFormatGuess{
+				Format:          LogFormatJSON,
+				TimestampLayout: "2006-01-02 15:04:05",
+			},
+		},
+		{
+			descr: "plain text",
+			logLines: []string{
+				"2025-03-10 10:00:01 INFO hello",
+			},
+			timestampLayout: "2006-01-02 15:04:05",
+			want: LogFormatGuess{
+				Format:          LogFormatRaw,
+				TimestampLayout: "2006-01-02 15:04:05",
+			},
+		},
+		{
+			descr: "ambiguous",
+			logLines: []string{
+				`2025-03-10 10:00:01 {"level": "info", "msg": "hello"}`,
+				"2025-03-10 10:00:02 myhost foo[123]: hello",
+			},
+			timestampLayout: "2006-01-02 15:04:05",
+			want: LogFormatGuess{
+				Format:          LogFormatRaw,
+				TimestampLayout: "2006-01-02 15:04:05",
+				Ambiguous:       true,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		got := DetectLogFormat(tc.logLines, tc.timestampLayout, tc.isJournalctl)
+		assert.Equal(t, tc.want, got, tc.descr)
+	}
+}
+
+func TestParseLogFormat(t *testing.T) {
+	format, err := ParseLogFormat("auto")
+	assert.NoError(t, err)
+	assert.Equal(t, LogFormatAuto, format)
+
+	format, err = ParseLogFormat("json")
+	assert.NoError(t, err)
+	assert.Equal(t, LogFormatJSON, format)
+
+	_, err = ParseLogFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestLogFormatGuessMightHaveSyslogEnvelope(t *testing.T) {
+	// Not detected yet.
+	assert.True(t, LogFormatGuess{}.mightHaveSyslogEnvelope())
+
+	// Detected: only JSON is certain enough to skip the envelope.
+	assert.True(t, LogFormatGuess{Format: LogFormatSyslog}.mightHaveSyslogEnvelope())
+	assert.True(t, LogFormatGuess{Format: LogFormatRFC3339}.mightHaveSyslogEnvelope())
+	assert.True(t, LogFormatGuess{Format: LogFormatRaw, Ambiguous: true}.mightHaveSyslogEnvelope())
+	assert.False(t, LogFormatGuess{Format: LogFormatJSON}.mightHaveSyslogEnvelope())
+
+	// Configured explicitly.
+	assert.True(t, LogFormatGuess{Format: LogFormatJournald, Configured: true}.mightHaveSyslogEnvelope())
+	assert.False(t, LogFormatGuess{Format: LogFormatRaw, Configured: true}.mightHaveSyslogEnvelope())
+	assert.False(t, LogFormatGuess{Format: LogFormatRFC3339, Configured: true}.mightHaveSyslogEnvelope())
+}
+
+func TestParseLogMsgJSON(t *testing.T) {
+	logMsg := &LogMsg{
+		Msg:     `{"level":"error","msg":"request failed","http":{"status":500,"path":"/api"},"tags":["a","b"],"took":0.25,"user":null}`,
+		Context: map[string]string{"lstream": "myhost"},
+	}
+
+	parseLogMsgJSON(logMsg)
+	assert.Equal(t, "request failed", logMsg.Msg)
+	assert.Equal(t, map[string]string{
+		"lstream":     "myhost",
+		"level":       "error",
+		"http.status": "500",
+		"http.path":   "/api",
+		"tags":        `["a","b"]`,
+		"took":        "0.25",
+		"user":        "",
+	}, logMsg.Context)
+
+	// Without the message key, the message is the JSON as is.
+	logMsg = &LogMsg{Msg: `{"event": "login", "ok": true}`}
+	parseLogMsgJSON(logMsg)
+	assert.Equal(t, `{"event": "login", "ok": true}`, logMsg.Msg)
+	assert.Equal(t, map[string]string{"event": "login", "ok": "true"}, logMsg.Context)
+
+	// Lines which aren't JSON objects are left intact.
+	for _, msg := range []string{"plain text", `{"broken": `, `["not", "an", "object"]`} {
+		logMsg = &LogMsg{Msg: msg, Context: map[string]string{}}
+		parseLogMsgJSON(logMsg)
+		assert.Equal(t, msg, logMsg.Msg)
+		assert.Empty(t, logMsg.Context, msg)
+	}
+}
@@ -0,0 +1,54 @@
+package core
+
+import "unicode/utf8"
+
+// TruncatedLineMarker is appended to the lines (and context values) which are
+// truncated because they exceed QueryLogsParams.MaxLineLength.
+const TruncatedLineMarker = "…[truncated]"
+
+// truncateLongLines truncates the original lines, the messages and the
+// context values of the given logs which are longer than maxLen bytes,
+// appending TruncatedLineMarker to them, and sets TruncatedLen of every
+// truncated message. Zero or negative maxLen means no limit.
+func truncateLongLines(logs []LogMsg, maxLen int) {
+	if maxLen <= 0 {
+		return
+	}
+
+	for i := range logs {
+		msg := &logs[i]
+		origLen := len(msg.OrigLine)
+
+		var truncated bool
+		msg.OrigLine, truncated = truncateString(msg.OrigLine, maxLen)
+		if !truncated {
+			// The message and the context are all parsed from the original line,
+			// so none of them can be longer than that.
+			continue
+		}
+
+		msg.Msg, _ = truncateString(msg.Msg, maxLen)
+		for k, v := range msg.Context {
+			msg.Context[k], _ = truncateString(v, maxLen)
+		}
+
+		msg.TruncatedLen = origLen
+	}
+}
+
+// truncateString returns the string cut to at most maxLen bytes, not in the
+// middle of a UTF-8 character, followed by TruncatedLineMarker; if it's not
+// longer than maxLen, it's returned as is, and the second return value is
+// false.
+func truncateString(s string, maxLen int) (string, bool) {
+	if len(s) <= maxLen {
+		return s, false
+	}
+
+	n := maxLen
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n] + TruncatedLineMarker, true
+}
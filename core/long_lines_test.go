@@ -0,0 +1,60 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateLongLines(t *testing.T) {
+	long := "Mar 10 10:00:00 myhost myapp: " + strings.Repeat("x", 100)
+
+	logs := []LogMsg{
+		{
+			Msg:      "short",
+			OrigLine: "Mar 10 10:00:00 myhost myapp: short",
+			Context:  map[string]string{"lstream": "myhost"},
+		},
+		{
+			Msg:      strings.Repeat("x", 100),
+			OrigLine: long,
+			Context: map[string]string{
+				"lstream": "myhost",
+				"blob":    strings.Repeat("y", 60),
+			},
+		},
+	}
+
+	truncateLongLines(logs, 50)
+
+	assert.Equal(t, "short", logs[0].Msg)
+	assert.Equal(t, 0, logs[0].TruncatedLen)
+
+	assert.Equal(t, long[:50]+TruncatedLineMarker, logs[1].OrigLine)
+	assert.Equal(t, strings.Repeat("x", 50)+TruncatedLineMarker, logs[1].Msg)
+	assert.Equal(t, strings.Repeat("y", 50)+TruncatedLineMarker, logs[1].Context["blob"])
+	assert.Equal(t, "myhost", logs[1].Context["lstream"])
+	assert.Equal(t, len(long), logs[1].TruncatedLen)
+
+	// No limit.
+	logs = []LogMsg{{Msg: long, OrigLine: long}}
+	truncateLongLines(logs, 0)
+	assert.Equal(t, long, logs[0].OrigLine)
+	assert.Equal(t, 0, logs[0].TruncatedLen)
+}
+
+func TestTruncateString(t *testing.T) {
+	s, truncated := truncateString("hello", 5)
+	assert.Equal(t, "hello", s)
+	assert.False(t, truncated)
+
+	s, truncated = truncateString("hello world", 5)
+	assert.Equal(t, "hello"+TruncatedLineMarker, s)
+	assert.True(t, truncated)
+
+	// Not cut in the middle of a multi-byte character: "ж" is 2 bytes.
+	s, truncated = truncateString("abжжж", 3)
+	assert.Equal(t, "ab"+TruncatedLineMarker, s)
+	assert.True(t, truncated)
+}
@@ -22,6 +22,11 @@ const SpecialFilenameJournalctl = "journalctl"
 
 const connectionTimeout = 5 * time.Second
 
+// defaultKeepaliveInterval is used when the logstream doesn't have
+// keepalive_interval configured: if the connection was idle for that long, we
+// ping it to keep it alive.
+const defaultKeepaliveInterval = 40 * time.Second
+
 // Setting useGzip to false is just a simple way to disable gzip, for debugging
 // purposes or w/e, since it's still experimental. Maybe we need to add a flag
 // for it, we'll see.
@@ -81,10 +86,25 @@ type LStreamClient struct {
 	// exampleLogLines are the lines that we received during logstream bootstrap.
 	// We'll try to do log format autodetection based on that.
 	exampleLogLines []string
-	timeFormat      *TimeFormatDescr
+	// exampleLogLinesFromJournalctl is true if the exampleLogLines come from
+	// journalctl rather than from the log files.
+	exampleLogLinesFromJournalctl bool
+	timeFormat                    *TimeFormatDescr
+	// logFormat is the format of the log lines, either configured or detected
+	// based on the exampleLogLines during the bootstrap.
+	logFormat LogFormatGuess
 
 	numConnAttempts int
 
+	// lastCmdTime is the time when the last command (other than ping) was
+	// started; it's used to disconnect after the idle timeout.
+	lastCmdTime time.Time
+
+	// defaultIdleTimeout is the idle timeout to use if the logstream doesn't
+	// have its own; it's updated with every query, see
+	// QueryLogsParams.DefaultIdleTimeout.
+	defaultIdleTimeout time.Duration
+
 	state     LStreamClientState
 	busyStage BusyStage
 
@@ -193,6 +213,9 @@ type LStreamClientUpdate struct {
 	BootstrapDetails *BootstrapDetails
 	BusyStage        *BusyStage
 
+	// LogFormat is sent after a successful bootstrap.
+	LogFormat *LogFormatGuess
+
 	DataRequest *ShellConnDataRequest
 
 	// If TornDown is true, it means it's the last update from that client.
@@ -312,6 +335,12 @@ const (
 	LStreamClientStateDisconnecting LStreamClientState = "disconnecting"
 	LStreamClientStateConnectedIdle LStreamClientState = "connected_idle"
 	LStreamClientStateConnectedBusy LStreamClientState = "connected_busy"
+
+	// LStreamClientStateIdleDisconnected means that we've disconnected because
+	// the connection was unused for longer than the idle timeout. Unlike
+	// LStreamClientStateDisconnected, we won't reconnect automatically; it
+	// happens on Reconnect.
+	LStreamClientStateIdleDisconnected LStreamClientState = "idle_disconnected"
 )
 
 func isStateConnected(state LStreamClientState) bool {
@@ -432,6 +461,7 @@ func (lsc *LStreamClient) run() {
 				lsc.numConnAttempts = 0
 
 				lastUpdTime = lsc.params.Clock.Now()
+				lsc.lastCmdTime = lastUpdTime
 
 				stdoutLinesCh := make(chan string, 32)
 				stderrLinesCh := make(chan string, 32)
@@ -511,6 +541,7 @@ func (lsc *LStreamClient) run() {
 				case cmdCtx.cmd.bootstrap != nil:
 					tzPrefix := "host_timezone:"
 					logLinePrefix := "example_log_line:"
+					logSourcePrefix := "example_log_source:"
 
 					if strings.HasPrefix(line, tzPrefix) {
 						tz := strings.TrimPrefix(line, tzPrefix)
@@ -530,6 +561,8 @@ func (lsc *LStreamClient) run() {
 						lsc.params.Logger.Verbose1f("Got example log line: %s\n", exampleLogLine)
 
 						lsc.exampleLogLines = append(lsc.exampleLogLines, exampleLogLine)
+					} else if strings.HasPrefix(line, logSourcePrefix) {
+						lsc.exampleLogLinesFromJournalctl = strings.TrimPrefix(line, logSourcePrefix) == SpecialFilenameJournalctl
 					} else if line == "bootstrap ok" {
 						cmdCtx.bootstrapCtx.receivedSuccess = true
 					} else if line == "bootstrap failed" {
@@ -646,7 +679,12 @@ func (lsc *LStreamClient) run() {
 
 						err = lsc.parseLine(&logMsg)
 						if err != nil {
-							cmdCtx.errs = append(cmdCtx.errs, errors.Annotatef(err, "parsing log msg %q", line))
+							// Don't fail the whole query because of a few bad lines, but count
+							// them, so that the user can tell when the format is misconfigured.
+							resp.NumParseErrors++
+							if respCtx.firstParseErr == nil {
+								respCtx.firstParseErr = errors.Annotatef(err, "parsing log msg %q", line)
+							}
 							continue
 						}
 
@@ -785,7 +823,20 @@ func (lsc *LStreamClient) run() {
 			//}
 
 		case <-ticker.C:
-			if lsc.state == LStreamClientStateConnectedIdle && time.Since(lastUpdTime) > 40*time.Second {
+			keepaliveInterval := lsc.params.LogStream.Options.KeepaliveInterval
+			if keepaliveInterval == 0 {
+				keepaliveInterval = defaultKeepaliveInterval
+			}
+			idleTimeout := lsc.params.LogStream.Options.IdleTimeout
+			if idleTimeout == 0 {
+				idleTimeout = lsc.defaultIdleTimeout
+			}
+
+			if lsc.state == LStreamClientStateConnectedIdle &&
+				idleTimeout > 0 && lsc.params.Clock.Now().Sub(lsc.lastCmdTime) > idleTimeout {
+				lsc.params.Logger.Infof("Disconnecting after being idle for %s", idleTimeout)
+				lsc.changeState(LStreamClientStateIdleDisconnected)
+			} else if lsc.state == LStreamClientStateConnectedIdle && time.Since(lastUpdTime) > keepaliveInterval {
 				lsc.startCmd(lstreamCmd{
 					ping: &lstreamCmdPing{},
 				})
@@ -811,6 +862,17 @@ func (lsc *LStreamClient) run() {
 				if req.teardown {
 					close(lsc.disconnectedBeforeTeardownCh)
 				}
+			} else if lsc.state == LStreamClientStateIdleDisconnected {
+				if req.teardown {
+					// If the old connection is still being closed, checkIfDisconnected
+					// will finish the teardown.
+					if lsc.conn == nil {
+						close(lsc.disconnectedBeforeTeardownCh)
+					}
+				} else {
+					// We've been asked to reconnect, so wake up.
+					lsc.changeState(LStreamClientStateConnecting)
+				}
 			} else {
 				lsc.changeState(LStreamClientStateDisconnecting)
 			}
@@ -958,6 +1020,10 @@ func (lsc *LStreamClient) Reconnect() {
 	}
 }
 
+func (lsc *LStreamClient) getLogStream() LogStream {
+	return lsc.params.LogStream
+}
+
 func (lsc *LStreamClient) addCmdToQueue(cmd lstreamCmd) {
 	lsc.cmdQueue = append(lsc.cmdQueue, cmd)
 }
@@ -971,6 +1037,10 @@ func (lsc *LStreamClient) startCmd(cmd lstreamCmd) {
 	lsc.curCmdCtx = cmdCtx
 	lsc.nextCmdIdx++
 
+	if cmd.ping == nil {
+		lsc.lastCmdTime = lsc.params.Clock.Now()
+	}
+
 	switch {
 	case cmdCtx.cmd.bootstrap != nil:
 		lsc.params.Logger.Verbose3f("Starting command: bootstrap %+v", cmdCtx.cmd.bootstrap)
@@ -1037,6 +1107,7 @@ func (lsc *LStreamClient) startCmd(cmd lstreamCmd) {
 
 	case cmdCtx.cmd.queryLogs != nil:
 		lsc.params.Logger.Verbose3f("Starting command: queryLogs %+v", cmdCtx.cmd.queryLogs)
+		lsc.defaultIdleTimeout = cmdCtx.cmd.queryLogs.defaultIdleTimeout
 		cmdCtx.queryLogsCtx = &lstreamCmdCtxQueryLogs{
 			Resp: &LogResp{
 				MinuteStats: map[int64]MinuteStatsItem{},
@@ -1069,12 +1140,27 @@ func (lsc *LStreamClient) startCmd(cmd lstreamCmd) {
 			parts = append(parts, "--logfile-prev", shellQuote(logFilePrev))
 		}
 
-		if !cmdCtx.cmd.queryLogs.from.IsZero() {
-			parts = append(parts, "--from", shellQuote(cmdCtx.cmd.queryLogs.from.In(lsc.location).Format(queryLogsArgsTimeLayout)))
-		}
+		if lr := cmdCtx.cmd.queryLogs.lineRange; lr != nil {
+			parts = append(parts,
+				"--line-range-file", shellQuote(lr.File),
+				"--line-range-from", shellQuote(strconv.Itoa(lr.From)),
+				"--line-range-to", shellQuote(strconv.Itoa(lr.To)),
+			)
+		} else {
+			if !cmdCtx.cmd.queryLogs.from.IsZero() {
+				parts = append(parts, "--from", shellQuote(cmdCtx.cmd.queryLogs.from.In(lsc.location).Format(queryLogsArgsTimeLayout)))
+			}
 
-		if !cmdCtx.cmd.queryLogs.to.IsZero() {
-			parts = append(parts, "--to", shellQuote(cmdCtx.cmd.queryLogs.to.In(lsc.location).Format(queryLogsArgsTimeLayout)))
+			if to := cmdCtx.cmd.queryLogs.to; !to.IsZero() {
+				// The agent only works with whole minutes, and the layout truncates
+				// the time; so if the to isn't aligned, round it forward, to make sure
+				// the partial minute is covered too.
+				if toMinute := to.Truncate(time.Minute); !toMinute.Equal(to) {
+					to = toMinute.Add(time.Minute)
+				}
+
+				parts = append(parts, "--to", shellQuote(to.In(lsc.location).Format(queryLogsArgsTimeLayout)))
+			}
 		}
 
 		if cmdCtx.cmd.queryLogs.linesUntil > 0 {
@@ -1105,8 +1191,21 @@ func (lsc *LStreamClient) startCmd(cmd lstreamCmd) {
 
 		parts = append(parts, agentQueryTimeFormatArgs(&lsc.timeFormat.AWKExpr)...)
 
-		if cmdCtx.cmd.queryLogs.query != "" {
-			parts = append(parts, shellQuote(cmdCtx.cmd.queryLogs.query))
+		query := cmdCtx.cmd.queryLogs.query
+		if lsc.logFormat.Format == LogFormatJSON && cmdCtx.cmd.queryLogs.jsonQuery != "" {
+			query = cmdCtx.cmd.queryLogs.jsonQuery
+		}
+
+		if query != "" {
+			awkQuery, err := awkQueryWithWordBoundaries(query)
+			if err != nil {
+				// The query should have been validated by the UI already, so it's
+				// not expected to happen; just let awk deal with it as is.
+				lsc.params.Logger.Errorf("Failed to translate the query %q: %s", query, err.Error())
+				awkQuery = query
+			}
+
+			parts = append(parts, shellQuote(awkQuery))
 		}
 
 		if useGzip {
@@ -1189,6 +1288,17 @@ func filepathToId(p string) string {
 
 func (lsc *LStreamClient) checkIfDisconnected() {
 	if lsc.conn.stderrLinesCh == nil && lsc.conn.stdoutLinesCh == nil {
+		if lsc.state == LStreamClientStateIdleDisconnected {
+			// We've disconnected due to inactivity, so don't reconnect until asked.
+			lsc.params.Logger.Verbose3f("Fully disconnected due to inactivity")
+			lsc.conn = nil
+
+			if lsc.tearingDown {
+				close(lsc.disconnectedBeforeTeardownCh)
+			}
+			return
+		}
+
 		// We're fully disconnected
 		lsc.params.Logger.Verbose3f("Fully disconnected")
 		lsc.changeState(LStreamClientStateDisconnected)
@@ -1292,18 +1402,40 @@ func (lsc *LStreamClient) handleCommandResultsIfDone(cmdCtx *lstreamCmdCtx) {
 				})
 			}
 
-			// Let's now try to autodetect the envelope log format.
-			timeFormat, err := GetTimeFormatDescrFromLogLines(lsc.exampleLogLines)
+			// If the timestamp layout is configured explicitly, use it; otherwise
+			// try to autodetect the envelope log format.
+			var timeFormat *TimeFormatDescr
+			var err error
+			if layout := lsc.params.LogStream.Options.TimestampLayout; layout != "" {
+				timeFormat, err = GenerateTimeDescr(layout)
+				if err != nil {
+					err = errors.Annotatef(err, "configured timestamp layout %q", layout)
+				}
+			} else {
+				timeFormat, err = GetTimeFormatDescrFromLogLines(lsc.exampleLogLines)
+			}
+
 			if err != nil {
 				cmdCtx.errs = append(cmdCtx.errs, err)
 			} else {
 				// All good
 				lsc.params.Logger.Infof(
-					"Detected time format based on %d log lines: %q",
+					"Using time format based on %d log lines: %q",
 					len(lsc.exampleLogLines),
 					timeFormat.TimestampLayout,
 				)
 				lsc.timeFormat = timeFormat
+
+				logFormatGuess := lsc.getLogFormatGuess()
+				lsc.params.Logger.Infof(
+					"Using log format %q (configured: %v, ambiguous: %v)",
+					logFormatGuess.Format, logFormatGuess.Configured, logFormatGuess.Ambiguous,
+				)
+				lsc.logFormat = logFormatGuess
+				lsc.sendUpdate(&LStreamClientUpdate{
+					LogFormat: &logFormatGuess,
+				})
+
 				lsc.changeState(LStreamClientStateConnectedIdle)
 				return
 			}
@@ -1338,8 +1470,19 @@ func (lsc *LStreamClient) handleCommandResultsIfDone(cmdCtx *lstreamCmdCtx) {
 
 	case cmdCtx.cmd.queryLogs != nil:
 		resp := cmdCtx.queryLogsCtx.Resp
+		if queryLogs := cmdCtx.cmd.queryLogs; queryLogs.lineRange == nil {
+			dropLogsOutOfRange(resp, queryLogs.from, queryLogs.to)
+		}
+
+		if resp.NumParseErrors > 0 {
+			lsc.params.Logger.Warnf(
+				"Failed to parse %d log lines, first error: %s",
+				resp.NumParseErrors, cmdCtx.queryLogsCtx.firstParseErr,
+			)
+		}
 		resp.DebugInfo.AgentStdout = cmdCtx.unhandledStdout
 		resp.DebugInfo.AgentStderr = cmdCtx.unhandledStderr
+		resp.Warnings = agentWarningsFromStderr(cmdCtx.unhandledStderr)
 		lsc.sendCmdResp(resp, summaryCmdError(cmdCtx))
 		lsc.changeState(LStreamClientStateConnectedIdle)
 
@@ -1348,6 +1491,39 @@ func (lsc *LStreamClient) handleCommandResultsIfDone(cmdCtx *lstreamCmdCtx) {
 	}
 }
 
+// dropLogsOutOfRange drops the logs outside of the [from, to) time range
+// from the response, along with their counts in MinuteStats, and counts them
+// in NumOutOfRange. Only the returned lines can be dropped this way, so the
+// MinuteStats of the partial boundary minutes may still include some lines
+// outside of the range. The agent only works with whole minutes, so it's only
+// needed when from or to isn't aligned to a minute (e.g. with the timeround
+// option set to none); zero from or to means no limit.
+func dropLogsOutOfRange(resp *LogResp, from, to time.Time) {
+	fromAligned := from.IsZero() || from.Truncate(time.Minute).Equal(from)
+	toAligned := to.IsZero() || to.Truncate(time.Minute).Equal(to)
+	if fromAligned && toAligned {
+		return
+	}
+
+	logs := resp.Logs[:0]
+	for _, msg := range resp.Logs {
+		if (from.IsZero() || !msg.Time.Before(from)) && (to.IsZero() || msg.Time.Before(to)) {
+			logs = append(logs, msg)
+			continue
+		}
+
+		k := msg.Time.Truncate(time.Minute).Unix()
+		if item := resp.MinuteStats[k]; item.NumMsgs > 0 {
+			item.NumMsgs--
+			resp.MinuteStats[k] = item
+		}
+
+		resp.NumOutOfRange++
+	}
+
+	resp.Logs = logs
+}
+
 // InferYear infers year from the month of the given timestamp, and the current
 // time. Resulting timestamp (with the year populated) is then returned.
 //
@@ -1406,21 +1582,41 @@ type parseLineResult struct {
 }
 
 func (lsc *LStreamClient) parseLine(logMsg *LogMsg) error {
+	// The escapes might be anywhere, including around the timestamp, so strip
+	// them before parsing anything.
+	if lsc.params.LogStream.Options.StripANSI {
+		logMsg.Msg = stripANSI(logMsg.Msg)
+	}
+
 	if err := lsc.parseLogMsgTimestamp(logMsg); err != nil {
 		return errors.Annotatef(err, "parsing time")
 	}
 
 	// TODO: offload envelope parsing to Lua (and make it usable from
 	// the user Lua scripts as well).
-	if err := lsc.parseLogMsgEnvelopeDefault(logMsg); err != nil {
-		return errors.Annotatef(err, "parsing envelope")
+	if lsc.logFormat.mightHaveSyslogEnvelope() {
+		if err := lsc.parseLogMsgEnvelopeDefault(logMsg); err != nil {
+			return errors.Annotatef(err, "parsing envelope")
+		}
+	}
+
+	if lsc.logFormat.Format == LogFormatJSON {
+		parseLogMsgJSON(logMsg)
 	}
 
+	applyFieldAliases(logMsg, lsc.params.LogStream.Options.FieldAliases)
+
 	// TODO: offload the custom parsing to Lua
 	if err := lsc.parseLogMsgLevelDefault(logMsg); err != nil {
 		return errors.Annotatef(err, "custom parsing")
 	}
 
+	// If the message has an explicit level field (possibly after applying the
+	// aliases), it's more reliable than guessing.
+	if level := logLevelFromFieldValue(logMsg.Context[FieldNameLevel]); level != LogLevelUnknown {
+		logMsg.Level = level
+	}
+
 	// TODO: invoke user Lua script, if present.
 
 	return nil
@@ -1430,16 +1626,7 @@ func (lsc *LStreamClient) parseLogMsgTimestamp(logMsg *LogMsg) error {
 	msg := logMsg.Msg
 
 	timeLayout := lsc.timeFormat.TimestampLayout
-	timestampLen := len(timeLayout)
-
-	// If the layout ends with the offset like "Z07" or "Z07:00", but the
-	// actual timestamp string is in UTC and it ends with just "Z", we then
-	// need to remove that extra
-	zIdx := strings.Index(timeLayout, "Z07")
-	if zIdx >= 0 && len(msg) >= zIdx && msg[zIdx] == 'Z' {
-		// We have a Z in the timestamp, so there should be no offset after it.
-		timestampLen = zIdx + 1
-	}
+	timestampLen := getTimestampLen(timeLayout, msg)
 
 	if len(msg) < timestampLen {
 		return errors.Errorf("line %q is too short to have a timestamp", msg)
@@ -1486,6 +1673,24 @@ func (lsc *LStreamClient) parseLogMsgTimestamp(logMsg *LogMsg) error {
 	return nil
 }
 
+// getLogFormatGuess returns the configured log format, or, if it's not
+// configured, detects it from the example log lines. Must be called after the
+// timeFormat is set.
+func (lsc *LStreamClient) getLogFormatGuess() LogFormatGuess {
+	if format := lsc.params.LogStream.Options.LogFormat; format != LogFormatAuto {
+		return LogFormatGuess{
+			Format:          format,
+			TimestampLayout: lsc.timeFormat.TimestampLayout,
+			Configured:      true,
+		}
+	}
+
+	isJournalctl := lsc.exampleLogLinesFromJournalctl ||
+		(len(lsc.params.LogStream.LogFiles) > 0 && lsc.params.LogStream.LogFiles[0] == SpecialFilenameJournalctl)
+
+	return DetectLogFormat(lsc.exampleLogLines, lsc.timeFormat.TimestampLayout, isJournalctl)
+}
+
 // parseLogMsgEnvelopeDefault takes the LogMsg where the time was already
 // stripped from the Msg, so for syslog, it looks like this:
 //
@@ -1566,6 +1771,71 @@ func (lsc *LStreamClient) parseLogMsgLevelDefault(logMsg *LogMsg) error {
 	return nil
 }
 
+// FieldNameLevel is the canonical name of the context field containing the
+// log level.
+const FieldNameLevel = "level"
+
+// applyFieldAliases renames the context fields accordingly to the given
+// aliases map: for every canonical name, the first actual field name which
+// exists in the context is renamed to the canonical one. If the canonical
+// field exists already, it's left intact.
+func applyFieldAliases(logMsg *LogMsg, aliases map[string][]string) {
+	for canonical, names := range aliases {
+		if _, ok := logMsg.Context[canonical]; ok {
+			continue
+		}
+
+		for _, name := range names {
+			v, ok := logMsg.Context[name]
+			if !ok {
+				continue
+			}
+
+			logMsg.Context[canonical] = v
+			delete(logMsg.Context, name)
+			break
+		}
+	}
+}
+
+// ansiEscapeRegexp matches the ANSI escape sequences: CSI sequences like
+// colors ("\x1b[31m"), OSC sequences like hyperlinks or window titles
+// (terminated by either BEL or ST), and the other two-character escapes.
+var ansiEscapeRegexp = regexp.MustCompile(
+	`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`,
+)
+
+// stripANSI removes the ANSI escape sequences from the string.
+func stripANSI(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return s
+	}
+
+	return ansiEscapeRegexp.ReplaceAllString(s, "")
+}
+
+// logLevelFromFieldValue converts the value of a level field to the LogLevel.
+// It understands both the textual levels like "error" or "WARNING", and the
+// numeric syslog priorities (like the journalctl's PRIORITY field), from 0
+// (emerg) to 7 (debug). If the value isn't recognized, LogLevelUnknown is
+// returned.
+func logLevelFromFieldValue(v string) LogLevel {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "0", "1", "2", "3",
+		"emerg", "emergency", "alert", "crit", "critical", "fatal", "panic",
+		"err", "erro", "error", "e", "f":
+		return LogLevelError
+	case "4", "warn", "warning", "w":
+		return LogLevelWarn
+	case "5", "6", "notice", "info", "information", "informational", "i":
+		return LogLevelInfo
+	case "7", "debug", "debu", "trace", "d":
+		return LogLevelDebug
+	}
+
+	return LogLevelUnknown
+}
+
 func combineErrors(errs []error) error {
 	var err error
 	if len(errs) == 1 {
@@ -1610,7 +1880,62 @@ func errorFromStdoutStderr(prefix string, stdout []string, stderr []string) erro
 	return errors.New(sb.String())
 }
 
+// sudoErrorFromStderr checks if the given stderr lines indicate that "sudo -n"
+// has failed, and if so, returns an error explaining what's going on;
+// otherwise returns nil.
+//
+// Since we use non-interactive sudo, it can't ask for a password: instead, it
+// just fails with a message like "sudo: a password is required".
+func sudoErrorFromStderr(stderr []string) error {
+	for _, line := range stderr {
+		if !strings.HasPrefix(line, "sudo:") && !strings.Contains(line, "sudoers") {
+			continue
+		}
+
+		switch {
+		case strings.Contains(line, "password is required"),
+			strings.Contains(line, "terminal is required"):
+			return errors.Errorf(
+				"permission error: sudo requires a password, but nerdlog uses non-interactive sudo (sudo -n); "+
+					"configure sudo to not require a password for this user (%s)", line,
+			)
+
+		case strings.Contains(line, "not in the sudoers"),
+			strings.Contains(line, "not allowed to"),
+			strings.Contains(line, "may not run sudo"):
+			return errors.Errorf(
+				"permission error: sudo is denied for this user (%s)", line,
+			)
+		}
+	}
+
+	return nil
+}
+
+// agentWarningsFromStderr returns the warnings from the agent's stderr: the
+// lines explicitly marked with the "warning:" prefix. Everything else (debug
+// info, errors printed by tail or awk themselves etc) only ends up in the
+// debug info.
+func agentWarningsFromStderr(stderr []string) []string {
+	var ret []string
+	for _, line := range stderr {
+		if strings.HasPrefix(line, "warning:") {
+			ret = append(ret, strings.TrimPrefix(line, "warning:"))
+		}
+	}
+
+	return ret
+}
+
 func summaryCmdError(cmdCtx *lstreamCmdCtx) error {
+	if len(cmdCtx.errs) > 0 || cmdCtx.exitCode != "0" {
+		// If the failure is caused by sudo, report that explicitly, since
+		// otherwise it can be pretty confusing.
+		if err := sudoErrorFromStderr(cmdCtx.unhandledStderr); err != nil {
+			return err
+		}
+	}
+
 	if len(cmdCtx.errs) > 0 {
 		return combineErrors(cmdCtx.errs)
 	} else if cmdCtx.exitCode != "0" {
@@ -0,0 +1,610 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// httpRequestTimeout is the timeout for every request to an HTTP log API.
+const httpRequestTimeout = 60 * time.Second
+
+// LStreamClientHTTP is like LStreamClient, but instead of running the agent
+// script over the shell, it queries an HTTP log API with Loki-compatible
+// range queries. From the LStreamsManager's point of view, it behaves the
+// same: it goes through the same states and responds to the same commands.
+//
+// Since HTTP is stateless, "connecting" just means checking that the API is
+// reachable and the credentials are accepted.
+type LStreamClientHTTP struct {
+	params LStreamClientParams
+	config ConfigLogStreamHTTP
+
+	httpClient *http.Client
+
+	state LStreamClientState
+
+	numConnAttempts int
+
+	enqueueCmdCh    chan lstreamCmd
+	disconnectReqCh chan disconnectReq
+
+	// connectResCh and cmdResCh receive the results of the connection check
+	// and of the current command, respectively, from the goroutines doing the
+	// actual requests. cancelReq cancels the request in progress, if any.
+	connectResCh chan error
+	cmdResCh     chan httpCmdRes
+	cancelReq    context.CancelFunc
+
+	curCmd   *lstreamCmd
+	cmdQueue []lstreamCmd
+}
+
+var _ lstreamClient = &LStreamClientHTTP{}
+
+type httpCmdRes struct {
+	resp *LogResp
+	err  error
+}
+
+func NewLStreamClientHTTP(params LStreamClientParams) *LStreamClientHTTP {
+	if params.Clock == nil {
+		panic("Clock is nil")
+	}
+
+	params.Logger = params.Logger.WithNamespaceAppended(
+		fmt.Sprintf("LSClientHTTP_%s", params.LogStream.Name),
+	)
+
+	lsc := &LStreamClientHTTP{
+		params: params,
+		config: *params.LogStream.HTTP,
+
+		httpClient: &http.Client{
+			Timeout: httpRequestTimeout,
+		},
+
+		state:        LStreamClientStateDisconnected,
+		enqueueCmdCh: make(chan lstreamCmd, 32),
+
+		disconnectReqCh: make(chan disconnectReq, 1),
+	}
+
+	lsc.changeState(LStreamClientStateConnecting)
+
+	go lsc.run()
+
+	return lsc
+}
+
+func (lsc *LStreamClientHTTP) EnqueueCmd(cmd lstreamCmd) {
+	lsc.enqueueCmdCh <- cmd
+}
+
+// Close initiates the shutdown; see LStreamClient.Close.
+func (lsc *LStreamClientHTTP) Close(changeName string) {
+	select {
+	case lsc.disconnectReqCh <- disconnectReq{
+		teardown:   true,
+		changeName: changeName,
+	}:
+	default:
+	}
+}
+
+func (lsc *LStreamClientHTTP) Reconnect() {
+	select {
+	case lsc.disconnectReqCh <- disconnectReq{
+		teardown: false,
+	}:
+	default:
+	}
+}
+
+func (lsc *LStreamClientHTTP) getLogStream() LogStream {
+	return lsc.params.LogStream
+}
+
+func (lsc *LStreamClientHTTP) run() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	var connectAfter time.Time
+
+	for {
+		select {
+		case err := <-lsc.connectResCh:
+			lsc.connectResCh = nil
+
+			if err != nil {
+				lsc.params.Logger.Errorf("HTTP connection check failed: %s", err.Error())
+				lsc.sendUpdate(&LStreamClientUpdate{
+					ConnDetails: &ConnDetails{
+						Err: fmt.Sprintf("attempt %d: %s", lsc.numConnAttempts, err.Error()),
+					},
+				})
+
+				lsc.changeState(LStreamClientStateDisconnected)
+				connectAfter = lsc.params.Clock.Now().Add(2 * time.Second)
+				continue
+			}
+
+			lsc.numConnAttempts = 0
+			lsc.changeState(LStreamClientStateConnectedIdle)
+
+		case cmd := <-lsc.enqueueCmdCh:
+			if !isStateConnected(lsc.state) {
+				lsc.sendCmdResp(cmd, &LogResp{}, errors.Errorf("not connected"))
+				continue
+			}
+
+			if lsc.state == LStreamClientStateConnectedIdle {
+				lsc.startCmd(cmd)
+			} else {
+				lsc.cmdQueue = append(lsc.cmdQueue, cmd)
+			}
+
+		case res := <-lsc.cmdResCh:
+			cmd := *lsc.curCmd
+			lsc.cmdResCh = nil
+			lsc.curCmd = nil
+
+			lsc.sendCmdResp(cmd, res.resp, res.err)
+			lsc.changeState(LStreamClientStateConnectedIdle)
+
+		case <-ticker.C:
+			if lsc.state == LStreamClientStateDisconnected &&
+				!connectAfter.IsZero() && lsc.params.Clock.Now().After(connectAfter) {
+				connectAfter = time.Time{}
+				lsc.changeState(LStreamClientStateConnecting)
+			}
+
+		case req := <-lsc.disconnectReqCh:
+			lsc.params.Logger.Infof("Received disconnect message (teardown:%v)", req.teardown)
+
+			if req.changeName != "" {
+				lsc.params.LogStream.Name = req.changeName
+			}
+
+			lsc.changeState(LStreamClientStateDisconnected)
+
+			if req.teardown {
+				lsc.params.Logger.Infof("Teardown completed")
+				lsc.sendUpdate(&LStreamClientUpdate{
+					TornDown: true,
+				})
+				return
+			}
+
+			connectAfter = time.Time{}
+			lsc.changeState(LStreamClientStateConnecting)
+		}
+	}
+}
+
+func (lsc *LStreamClientHTTP) changeState(newState LStreamClientState) {
+	oldState := lsc.state
+
+	// Properly leave old state
+
+	if lsc.cancelReq != nil {
+		lsc.cancelReq()
+		lsc.cancelReq = nil
+	}
+
+	switch oldState {
+	case LStreamClientStateConnecting:
+		lsc.connectResCh = nil
+	case LStreamClientStateConnectedBusy:
+		// Just like LStreamClient, if the command was interrupted, we don't
+		// respond to it: the manager forgets the in-progress query on reconnect.
+		lsc.curCmd = nil
+		lsc.cmdResCh = nil
+	}
+
+	// Enter new state
+
+	lsc.state = newState
+	lsc.sendUpdate(&LStreamClientUpdate{
+		State: &LStreamClientUpdateState{
+			OldState: oldState,
+			NewState: newState,
+		},
+	})
+
+	switch lsc.state {
+	case LStreamClientStateConnecting:
+		lsc.cmdQueue = nil
+		lsc.numConnAttempts++
+
+		ctx := lsc.newReqContext()
+		resCh := make(chan error, 1)
+		lsc.connectResCh = resCh
+		go func() {
+			resCh <- lsc.checkConnection(ctx)
+		}()
+
+	case LStreamClientStateConnectedIdle:
+		if len(lsc.cmdQueue) > 0 {
+			nextCmd := lsc.cmdQueue[0]
+			lsc.cmdQueue = lsc.cmdQueue[1:]
+
+			lsc.startCmd(nextCmd)
+		}
+	}
+}
+
+func (lsc *LStreamClientHTTP) newReqContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	lsc.cancelReq = cancel
+	return ctx
+}
+
+func (lsc *LStreamClientHTTP) startCmd(cmd lstreamCmd) {
+	switch {
+	case cmd.ping != nil, cmd.bootstrap != nil:
+		// Nothing to do for a stateless HTTP API.
+		lsc.sendCmdResp(cmd, nil, nil)
+		return
+
+	case cmd.queryLogs != nil:
+		// Handled below
+
+	default:
+		panic(fmt.Sprintf("unhandled cmd %+v", cmd))
+	}
+
+	lsc.changeState(LStreamClientStateConnectedBusy)
+
+	lsc.curCmd = &cmd
+	lsc.sendUpdate(&LStreamClientUpdate{
+		BusyStage: &BusyStage{
+			Num:   1,
+			Title: "Querying HTTP API",
+		},
+	})
+
+	ctx := lsc.newReqContext()
+	resCh := make(chan httpCmdRes, 1)
+	lsc.cmdResCh = resCh
+	go func() {
+		resp, err := lsc.queryLogs(ctx, cmd.queryLogs)
+		if resp == nil {
+			resp = &LogResp{}
+		}
+		resCh <- httpCmdRes{resp: resp, err: err}
+	}()
+}
+
+func (lsc *LStreamClientHTTP) sendCmdResp(cmd lstreamCmd, resp interface{}, err error) {
+	if cmd.respCh == nil {
+		return
+	}
+
+	cmd.respCh <- lstreamCmdRes{
+		hostname: lsc.params.LogStream.Name,
+		resp:     resp,
+		err:      err,
+	}
+}
+
+func (lsc *LStreamClientHTTP) sendUpdate(upd *LStreamClientUpdate) {
+	upd.Name = lsc.params.LogStream.Name
+	lsc.params.UpdatesCh <- upd
+}
+
+// checkConnection makes a cheap request to make sure the API is reachable
+// and accepts our credentials.
+func (lsc *LStreamClientHTTP) checkConnection(ctx context.Context) error {
+	if lsc.config.URL == "" {
+		return errors.Errorf("http.url is not configured")
+	}
+
+	if lsc.config.Selector == "" {
+		return errors.Errorf("http.selector is not configured")
+	}
+
+	var resp struct {
+		Status string `json:"status"`
+	}
+	if err := lsc.doGet(ctx, "/loki/api/v1/labels", url.Values{}, &resp); err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+func (lsc *LStreamClientHTTP) queryLogs(
+	ctx context.Context, cmd *lstreamCmdQueryLogs,
+) (*LogResp, error) {
+	if cmd.lineRange != nil {
+		return nil, errors.Errorf("line ranges are not supported for HTTP logstreams")
+	}
+
+	filters, err := awkQueryToLogQLFilters(cmd.query)
+	if err != nil {
+		return nil, errors.Annotatef(err, "translating query for the HTTP API")
+	}
+
+	logQuery := lsc.config.Selector + filters
+
+	from := cmd.from
+	to := cmd.to
+	if to.IsZero() {
+		to = lsc.params.Clock.Now()
+	}
+
+	if cmd.timestampUntil != nil {
+		// Loading earlier logs: the range end is exclusive, so add a nanosecond
+		// to include the messages on that exact timestamp, and skip those which
+		// we already have below.
+		to = cmd.timestampUntil.time.Add(1)
+	}
+
+	resp := &LogResp{
+		MinuteStats: map[int64]MinuteStatsItem{},
+	}
+
+	// Get the histogram data.
+	statsQuery := fmt.Sprintf("sum(count_over_time(%s [1m]))", logQuery)
+	statsParams := url.Values{}
+	statsParams.Set("query", statsQuery)
+	statsParams.Set("start", strconv.FormatInt(from.UnixNano(), 10))
+	statsParams.Set("end", strconv.FormatInt(to.UnixNano(), 10))
+	statsParams.Set("step", "60")
+
+	var statsResp lokiQueryResp
+	if err := lsc.doGet(ctx, "/loki/api/v1/query_range", statsParams, &statsResp); err != nil {
+		return nil, errors.Annotatef(err, "querying stats")
+	}
+
+	if err := statsResp.addMinuteStats(resp); err != nil {
+		return nil, errors.Annotatef(err, "parsing stats")
+	}
+
+	// Zero maxNumLines means that only the stats are needed.
+	if cmd.maxNumLines == 0 {
+		return resp, nil
+	}
+
+	// Get the logs themselves: the latest maxNumLines ones.
+	logsParams := url.Values{}
+	logsParams.Set("query", logQuery)
+	logsParams.Set("start", strconv.FormatInt(from.UnixNano(), 10))
+	logsParams.Set("end", strconv.FormatInt(to.UnixNano(), 10))
+	logsParams.Set("direction", "backward")
+
+	limit := cmd.maxNumLines
+	if cmd.timestampUntil != nil {
+		limit += cmd.timestampUntil.numMsgs
+	}
+	logsParams.Set("limit", strconv.Itoa(limit))
+
+	var logsResp lokiQueryResp
+	if err := lsc.doGet(ctx, "/loki/api/v1/query_range", logsParams, &logsResp); err != nil {
+		return nil, errors.Annotatef(err, "querying logs")
+	}
+
+	logs, err := logsResp.getLogMsgs(lsc.params.LogStream.Name)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing logs")
+	}
+
+	if cmd.timestampUntil != nil {
+		logs = skipLastMsgsAt(logs, cmd.timestampUntil.time, cmd.timestampUntil.numMsgs)
+	}
+
+	for i := range logs {
+		if lsc.params.LogStream.Options.StripANSI {
+			logs[i].Msg = stripANSI(logs[i].Msg)
+		}
+
+		applyFieldAliases(&logs[i], lsc.params.LogStream.Options.FieldAliases)
+		if level := logLevelFromFieldValue(logs[i].Context[FieldNameLevel]); level != LogLevelUnknown {
+			logs[i].Level = level
+		}
+	}
+
+	resp.Logs = logs
+
+	return resp, nil
+}
+
+func (lsc *LStreamClientHTTP) doGet(
+	ctx context.Context, path string, params url.Values, target interface{},
+) error {
+	reqURL := strings.TrimSuffix(lsc.config.URL, "/") + path + "?" + params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if lsc.config.AuthToken != "" {
+		authHeader := lsc.config.AuthHeader
+		if authHeader == "" {
+			authHeader = "Authorization"
+		}
+
+		req.Header.Set(authHeader, os.ExpandEnv(lsc.config.AuthToken))
+	}
+
+	for k, v := range lsc.config.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	lsc.params.Logger.Verbose1f("HTTP GET %s", reqURL)
+
+	resp, err := lsc.httpClient.Do(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Annotatef(err, "reading response")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if err := json.Unmarshal(body, target); err != nil {
+		return errors.Annotatef(err, "parsing response")
+	}
+
+	return nil
+}
+
+// lokiQueryResp is the response of the Loki query_range API; the data is
+// either "streams" (for log queries) or "matrix" (for metric queries).
+type lokiQueryResp struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			// Stream is set for the "streams" result type, and Metric is for
+			// "matrix".
+			Stream map[string]string `json:"stream"`
+			Metric map[string]string `json:"metric"`
+
+			// Values are pairs of the timestamp and the value: for streams, it's
+			// the timestamp in nanoseconds and the log line (both strings); for
+			// matrix, it's the timestamp in seconds (a number) and the value (a
+			// string).
+			Values [][]interface{} `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// addMinuteStats adds the data from the "matrix" response of a
+// count_over_time query with the 1m step to the resp. The value at the
+// timestamp t is the number of messages in the minute which ends at t.
+func (lr *lokiQueryResp) addMinuteStats(resp *LogResp) error {
+	for _, res := range lr.Data.Result {
+		for _, v := range res.Values {
+			if len(v) != 2 {
+				return errors.Errorf("malformed value %v", v)
+			}
+
+			ts, ok := v[0].(float64)
+			if !ok {
+				return errors.Errorf("malformed timestamp %v", v[0])
+			}
+
+			valStr, ok := v[1].(string)
+			if !ok {
+				return errors.Errorf("malformed value %v", v[1])
+			}
+
+			n, err := strconv.Atoi(valStr)
+			if err != nil {
+				return errors.Annotatef(err, "parsing value")
+			}
+
+			minute := int64(ts) - 60
+			item := resp.MinuteStats[minute]
+			item.NumMsgs += n
+			resp.MinuteStats[minute] = item
+
+			resp.NumMsgsTotal += n
+		}
+	}
+
+	return nil
+}
+
+// getLogMsgs returns the log messages from the "streams" response, sorted by
+// time. The stream labels are included in the messages' context.
+func (lr *lokiQueryResp) getLogMsgs(lstreamName string) ([]LogMsg, error) {
+	var ret []LogMsg
+
+	for _, res := range lr.Data.Result {
+		for _, v := range res.Values {
+			if len(v) != 2 {
+				return nil, errors.Errorf("malformed value %v", v)
+			}
+
+			tsStr, ok := v[0].(string)
+			if !ok {
+				return nil, errors.Errorf("malformed timestamp %v", v[0])
+			}
+
+			tsNano, err := strconv.ParseInt(tsStr, 10, 64)
+			if err != nil {
+				return nil, errors.Annotatef(err, "parsing timestamp")
+			}
+
+			line, ok := v[1].(string)
+			if !ok {
+				return nil, errors.Errorf("malformed log line %v", v[1])
+			}
+
+			ctxMap := make(map[string]string, len(res.Stream)+1)
+			for k, v := range res.Stream {
+				ctxMap[k] = v
+			}
+			ctxMap["lstream"] = lstreamName
+
+			ret = append(ret, LogMsg{
+				Time:     time.Unix(0, tsNano).UTC(),
+				Msg:      line,
+				Context:  ctxMap,
+				OrigLine: line,
+			})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+
+	return ret, nil
+}
+
+// skipLastMsgsAt removes up to num last messages which have exactly the
+// timestamp t; the logs must be sorted by time.
+func skipLastMsgsAt(logs []LogMsg, t time.Time, num int) []LogMsg {
+	for num > 0 && len(logs) > 0 && logs[len(logs)-1].Time.Equal(t) {
+		logs = logs[:len(logs)-1]
+		num--
+	}
+
+	return logs
+}
+
+// awkQueryToLogQLFilters translates the awk query into LogQL line filters.
+// Only simple queries are supported, see parseSimpleAwkQuery; for anything
+// else, an error is returned.
+func awkQueryToLogQLFilters(query string) (string, error) {
+	terms, err := parseSimpleAwkQuery(query)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	var sb strings.Builder
+	for _, term := range terms {
+		op := "|~"
+		if term.negate {
+			op = "!~"
+		}
+
+		sb.WriteString(" ")
+		sb.WriteString(op)
+		sb.WriteString(" ")
+		sb.WriteString(strconv.Quote(term.re))
+	}
+
+	return sb.String(), nil
+}
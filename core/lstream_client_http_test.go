@@ -0,0 +1,158 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/clock"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwkQueryToLogQLFilters(t *testing.T) {
+	testCases := []struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{query: "", want: ""},
+		{query: "/foo/", want: ` |~ "foo"`},
+		{query: `/foo bar/ && !/a\/b/`, want: ` |~ "foo bar" !~ "a/b"`},
+		{query: `/"quoted"/`, want: ` |~ "\"quoted\""`},
+		{query: "$3 == 5", wantErr: true},
+		{query: "/foo/ || /bar/", wantErr: true},
+		{query: "(/foo/) && !(/bar/) && (!/baz/)", want: ` |~ "foo" !~ "bar" !~ "baz"`},
+		{query: "((/foo/ && /x/)) && ((!(/bar/)))", want: ` |~ "foo" |~ "x" !~ "bar"`},
+		{query: `/\(a\)/`, want: ` |~ "\\(a\\)"`},
+		{query: "!(/foo/ && /bar/)", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			got, err := awkQueryToLogQLFilters(tc.query)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLStreamClientHTTPQueryLogs(t *testing.T) {
+	from := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+	to := from.Add(5 * time.Minute)
+
+	var gotQueries []string
+	var gotAuth string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		q := r.URL.Query()
+		gotQueries = append(gotQueries, q.Get("query"))
+
+		if q.Get("step") != "" {
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[
+				{"metric":{},"values":[[%d,"2"],[%d,"1"]]}
+			]}}`, from.Unix()+60, from.Unix()+180)
+			return
+		}
+
+		// Two streams, with the messages in backward order.
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"app":"a"},"values":[["%d","third"],["%d","first"]]},
+			{"stream":{"app":"b"},"values":[["%d","second"]]}
+		]}}`,
+			from.Add(150*time.Second).UnixNano(),
+			from.Add(10*time.Second).UnixNano(),
+			from.Add(20*time.Second).UnixNano(),
+		)
+	}))
+	defer srv.Close()
+
+	t.Setenv("TEST_LOKI_TOKEN", "secret")
+
+	lsc := &LStreamClientHTTP{
+		params: LStreamClientParams{
+			LogStream: LogStream{Name: "loki"},
+			Logger:    log.NewLogger(log.Error),
+			Clock:     clock.NewMock(),
+		},
+		config: ConfigLogStreamHTTP{
+			URL:       srv.URL,
+			Selector:  `{job="app"}`,
+			AuthToken: "Bearer ${TEST_LOKI_TOKEN}",
+		},
+		httpClient: srv.Client(),
+	}
+
+	resp, err := lsc.queryLogs(context.Background(), &lstreamCmdQueryLogs{
+		maxNumLines: 10,
+		from:        from,
+		to:          to,
+		query:       "/foo/",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Bearer secret", gotAuth)
+	assert.Equal(t, []string{
+		`sum(count_over_time({job="app"} |~ "foo" [1m]))`,
+		`{job="app"} |~ "foo"`,
+	}, gotQueries)
+
+	assert.Equal(t, map[int64]MinuteStatsItem{
+		from.Unix():       {NumMsgs: 2},
+		from.Unix() + 120: {NumMsgs: 1},
+	}, resp.MinuteStats)
+	assert.Equal(t, 3, resp.NumMsgsTotal)
+
+	var msgs []string
+	for _, msg := range resp.Logs {
+		msgs = append(msgs, msg.Msg)
+	}
+	assert.Equal(t, []string{"first", "second", "third"}, msgs)
+	assert.Equal(t, map[string]string{"app": "b", "lstream": "loki"}, resp.Logs[1].Context)
+}
+
+func TestLStreamClientHTTPQueryLogsCountOnly(t *testing.T) {
+	from := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+
+	var gotQueries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQueries = append(gotQueries, r.URL.Query().Get("query"))
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{},"values":[[%d,"5"]]}
+		]}}`, from.Unix()+60)
+	}))
+	defer srv.Close()
+
+	lsc := &LStreamClientHTTP{
+		params: LStreamClientParams{
+			LogStream: LogStream{Name: "loki"},
+			Logger:    log.NewLogger(log.Error),
+			Clock:     clock.NewMock(),
+		},
+		config: ConfigLogStreamHTTP{
+			URL:      srv.URL,
+			Selector: `{job="app"}`,
+		},
+		httpClient: srv.Client(),
+	}
+
+	// Zero maxNumLines means count-only: the logs must not be requested.
+	resp, err := lsc.queryLogs(context.Background(), &lstreamCmdQueryLogs{
+		from: from,
+		to:   from.Add(5 * time.Minute),
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{`sum(count_over_time({job="app"} [1m]))`}, gotQueries)
+	assert.Equal(t, 5, resp.NumMsgsTotal)
+	assert.Empty(t, resp.Logs)
+}
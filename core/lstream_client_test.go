@@ -0,0 +1,203 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyFieldAliases(t *testing.T) {
+	aliases := map[string][]string{
+		"level": {"severity", "PRIORITY"},
+	}
+
+	testCases := []struct {
+		name    string
+		context map[string]string
+		want    map[string]string
+	}{
+		{
+			name:    "no matching fields",
+			context: map[string]string{"pid": "123"},
+			want:    map[string]string{"pid": "123"},
+		},
+		{
+			name:    "second alias",
+			context: map[string]string{"PRIORITY": "3"},
+			want:    map[string]string{"level": "3"},
+		},
+		{
+			name:    "first alias wins",
+			context: map[string]string{"severity": "warn", "PRIORITY": "3"},
+			want:    map[string]string{"level": "warn", "PRIORITY": "3"},
+		},
+		{
+			name:    "canonical field is left intact",
+			context: map[string]string{"level": "info", "severity": "warn"},
+			want:    map[string]string{"level": "info", "severity": "warn"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logMsg := &LogMsg{Context: tc.context}
+			applyFieldAliases(logMsg, aliases)
+			assert.Equal(t, tc.want, logMsg.Context)
+		})
+	}
+}
+
+func TestLogLevelFromFieldValue(t *testing.T) {
+	testCases := []struct {
+		value string
+		want  LogLevel
+	}{
+		{"", LogLevelUnknown},
+		{"foo", LogLevelUnknown},
+		{"ERROR", LogLevelError},
+		{"crit", LogLevelError},
+		{"3", LogLevelError},
+		{"Warning", LogLevelWarn},
+		{"4", LogLevelWarn},
+		{"info", LogLevelInfo},
+		{"6", LogLevelInfo},
+		{"debug", LogLevelDebug},
+		{"7", LogLevelDebug},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			assert.Equal(t, tc.want, logLevelFromFieldValue(tc.value))
+		})
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"no escapes", "foo bar", "foo bar"},
+		{"colors", "\x1b[31mERROR\x1b[0m something \x1b[1;32mok\x1b[m", "ERROR something ok"},
+		{"colored timestamp", "\x1b[2m2025-01-02 10:00:00\x1b[0m foo", "2025-01-02 10:00:00 foo"},
+		{"256 colors", "\x1b[38;5;208mfoo\x1b[39m", "foo"},
+		{"hyperlink", "\x1b]8;;http://example.com\x07link\x1b]8;;\x1b\\ text", "link text"},
+		{"two-char escape", "foo\x1bMbar", "foobar"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, stripANSI(tc.s))
+		})
+	}
+}
+
+func TestSudoErrorFromStderr(t *testing.T) {
+	testCases := []struct {
+		name    string
+		stderr  []string
+		wantErr string
+	}{
+		{
+			name:   "no stderr",
+			stderr: nil,
+		},
+		{
+			name:   "unrelated stderr",
+			stderr: []string{"cat: /var/log/foo: No such file or directory"},
+		},
+		{
+			name:    "password is required",
+			stderr:  []string{"foo", "sudo: a password is required"},
+			wantErr: "permission error: sudo requires a password, but nerdlog uses non-interactive sudo (sudo -n); configure sudo to not require a password for this user (sudo: a password is required)",
+		},
+		{
+			name:    "not in sudoers",
+			stderr:  []string{"user is not in the sudoers file.  This incident will be reported."},
+			wantErr: "permission error: sudo is denied for this user (user is not in the sudoers file.  This incident will be reported.)",
+		},
+		{
+			name:    "not allowed",
+			stderr:  []string{"Sorry, user bob is not allowed to execute 'bash' as root on myhost (sudoers)."},
+			wantErr: "permission error: sudo is denied for this user (Sorry, user bob is not allowed to execute 'bash' as root on myhost (sudoers).)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := sudoErrorFromStderr(tc.stderr)
+			if tc.wantErr == "" {
+				assert.Nil(t, err)
+				return
+			}
+
+			if assert.NotNil(t, err) {
+				assert.Equal(t, tc.wantErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestAgentWarningsFromStderr(t *testing.T) {
+	assert.Nil(t, agentWarningsFromStderr(nil))
+	assert.Nil(t, agentWarningsFromStderr([]string{"debug:foo", "  "}))
+	assert.Equal(t,
+		[]string{
+			"/var/log/syslog.1 is not readable, only /var/log/syslog is queried",
+		},
+		agentWarningsFromStderr([]string{
+			"debug:Filtered out 0 from 10 lines",
+			"warning:/var/log/syslog.1 is not readable, only /var/log/syslog is queried",
+			"tail: write error: Broken pipe",
+			"awk: cmd. line:1: warning: regexp escape sequence",
+		}),
+	)
+}
+
+func TestDropLogsOutOfRange(t *testing.T) {
+	t0 := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC)
+	newResp := func() *LogResp {
+		return &LogResp{
+			MinuteStats: map[int64]MinuteStatsItem{
+				t0.Unix():                      {NumMsgs: 2},
+				t0.Add(time.Minute).Unix():     {NumMsgs: 1},
+				t0.Add(2 * time.Minute).Unix(): {NumMsgs: 2},
+			},
+			Logs: []LogMsg{
+				{Time: t0.Add(10 * time.Second), Msg: "1"},
+				{Time: t0.Add(40 * time.Second), Msg: "2"},
+				{Time: t0.Add(70 * time.Second), Msg: "3"},
+				{Time: t0.Add(125 * time.Second), Msg: "4"},
+				{Time: t0.Add(150 * time.Second), Msg: "5"},
+			},
+		}
+	}
+
+	// Aligned to minutes: nothing to drop.
+	resp := newResp()
+	dropLogsOutOfRange(resp, t0, t0.Add(3*time.Minute))
+	assert.Equal(t, newResp(), resp)
+
+	// Not aligned: drop the lines from the partial minutes.
+	resp = newResp()
+	dropLogsOutOfRange(resp, t0.Add(30*time.Second), t0.Add(130*time.Second))
+	assert.Equal(t, []LogMsg{
+		{Time: t0.Add(40 * time.Second), Msg: "2"},
+		{Time: t0.Add(70 * time.Second), Msg: "3"},
+		{Time: t0.Add(125 * time.Second), Msg: "4"},
+	}, resp.Logs)
+	assert.Equal(t, map[int64]MinuteStatsItem{
+		t0.Unix():                      {NumMsgs: 1},
+		t0.Add(time.Minute).Unix():     {NumMsgs: 1},
+		t0.Add(2 * time.Minute).Unix(): {NumMsgs: 1},
+	}, resp.MinuteStats)
+	assert.Equal(t, 2, resp.NumOutOfRange)
+
+	// Zero to means no limit.
+	resp = newResp()
+	dropLogsOutOfRange(resp, t0.Add(30*time.Second), time.Time{})
+	assert.Len(t, resp.Logs, 4)
+	assert.Equal(t, 1, resp.NumOutOfRange)
+}
@@ -78,8 +78,17 @@ type lstreamCmdQueryLogs struct {
 	from time.Time
 	to   time.Time
 
+	// If lineRange is not nil, from and to are ignored, and the given range of
+	// lines is fetched instead.
+	lineRange *LineRange
+
 	query string
 
+	// jsonQuery is the same query, but with the fields looked up as the JSON
+	// keys; it's used instead of query if the log format turns out to be JSON
+	// (see getLStreamQuery).
+	jsonQuery string
+
 	// If linesUntil is not zero, it'll be passed to nerdlog_agent.sh as --lines-until.
 	// Effectively, only logs BEFORE this log line (not including it) will be output.
 	linesUntil int
@@ -94,6 +103,9 @@ type lstreamCmdQueryLogs struct {
 	// scratch (no-op for journalctl logstreams, because there's no
 	// nerdlog-maintained index for journalctl).
 	refreshIndex bool
+
+	// defaultIdleTimeout: see QueryLogsParams.DefaultIdleTimeout.
+	defaultIdleTimeout time.Duration
 }
 
 type lstreamCmdCtxQueryLogs struct {
@@ -101,6 +113,10 @@ type lstreamCmdCtxQueryLogs struct {
 
 	logfiles []logfileWithStartingLinenumber
 	lastTime time.Time
+
+	// firstParseErr is the first error we got while parsing log lines; the
+	// total number of such errors is in Resp.NumParseErrors.
+	firstParseErr error
 }
 
 type logfileWithStartingLinenumber struct {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os/user"
+	"reflect"
 	"sort"
 	"strings"
 	"time"
@@ -18,13 +19,24 @@ import (
 var ErrBusyWithAnotherQuery = errors.Errorf("busy with another query")
 var ErrNotYetConnected = errors.Errorf("not connected to all lstreams yet")
 
+// lstreamClient is a client for a single logstream: either LStreamClient
+// (over the shell) or LStreamClientHTTP.
+type lstreamClient interface {
+	EnqueueCmd(cmd lstreamCmd)
+	Close(changeName string)
+	Reconnect()
+
+	// getLogStream returns the logstream which the client was created for.
+	getLogStream() LogStream
+}
+
 type LStreamsManager struct {
 	params LStreamsManagerParams
 
 	lstreamsStr      string
 	parsedLogStreams map[string]LogStream
 
-	lscs      map[string]*LStreamClient
+	lscs      map[string]lstreamClient
 	lscStates map[string]LStreamClientState
 	// lscConnDetails only contains items for lstreams which are in the
 	// LStreamClientStateConnectinConnecting state.
@@ -32,6 +44,9 @@ type LStreamsManager struct {
 	// lscBusyStages only contains items for lstreams which are in the
 	// LStreamClientStateConnectedBusy state.
 	lscBusyStages map[string]BusyStage
+	// lscLogFormats contains the log formats of the lstreams which have
+	// bootstrapped successfully at least once.
+	lscLogFormats map[string]LogFormatGuess
 
 	// lscPendingTeardown contains info about LStreamClient-s that are being torn
 	// down. NOTE that when a LStreamClient starts tearing down, its key changes
@@ -41,6 +56,9 @@ type LStreamsManager struct {
 
 	lstreamsByState map[LStreamClientState]map[string]struct{}
 	numNotConnected int
+	// numIdleDisconnected is the number of logstreams which were disconnected
+	// due to inactivity; they are not included in numNotConnected.
+	numIdleDisconnected int
 
 	lstreamUpdatesCh chan *LStreamClientUpdate
 	reqCh            chan lstreamsManagerReq
@@ -56,7 +74,16 @@ type LStreamsManager struct {
 
 	curQueryLogsCtx *manQueryLogsCtx
 
+	// pendingQueryLogs, if not nil, is the query which will be started once
+	// all the logstreams (which were disconnected due to inactivity) are
+	// connected again.
+	pendingQueryLogs *QueryLogsParams
+
 	curLogs manLogsCtx
+
+	// mutedLStreams contains the names of logstreams which are excluded from
+	// the resolved logstreams spec, even if the spec matches them.
+	mutedLStreams map[string]struct{}
 }
 
 type LStreamsManagerParams struct {
@@ -64,6 +91,10 @@ type LStreamsManagerParams struct {
 	// ~/.config/nerdlog/logstreams.yaml.
 	ConfigLogStreams ConfigLogStreams
 
+	// ConfigLStreamGroups contains the groups of logstreams which can be used
+	// in the logstreams spec, typically coming from the same config file.
+	ConfigLStreamGroups ConfigLStreamGroups
+
 	// SSHConfig contains the general ssh config, typically coming from
 	// ~/.ssh/config.
 	SSHConfig *ssh_config.Config
@@ -100,12 +131,15 @@ func NewLStreamsManager(params LStreamsManagerParams) *LStreamsManager {
 	lsman := &LStreamsManager{
 		params: params,
 
-		lscs:               map[string]*LStreamClient{},
+		lscs:               map[string]lstreamClient{},
 		lscStates:          map[string]LStreamClientState{},
 		lscConnDetails:     map[string]ConnDetails{},
 		lscBusyStages:      map[string]BusyStage{},
+		lscLogFormats:      map[string]LogFormatGuess{},
 		lscPendingTeardown: map[string]int{},
 
+		mutedLStreams: map[string]struct{}{},
+
 		lstreamUpdatesCh: make(chan *LStreamClientUpdate, 1024),
 		reqCh:            make(chan lstreamsManagerReq, 8),
 		respCh:           make(chan lstreamCmdRes),
@@ -136,8 +170,9 @@ func (lsman *LStreamsManager) setLStreams(lstreamsStr string) error {
 	resolver := NewLStreamsResolver(LStreamsResolverParams{
 		CurOSUser: u.Username,
 
-		ConfigLogStreams: lsman.params.ConfigLogStreams,
-		SSHConfig:        lsman.params.SSHConfig,
+		ConfigLogStreams:    lsman.params.ConfigLogStreams,
+		ConfigLStreamGroups: lsman.params.ConfigLStreamGroups,
+		SSHConfig:           lsman.params.SSHConfig,
 	})
 
 	parsedLogStreams, err := resolver.Resolve(lstreamsStr)
@@ -145,6 +180,10 @@ func (lsman *LStreamsManager) setLStreams(lstreamsStr string) error {
 		return errors.Trace(err)
 	}
 
+	for name := range lsman.mutedLStreams {
+		delete(parsedLogStreams, name)
+	}
+
 	// All went well, remember the logstreams spec
 	lsman.lstreamsStr = lstreamsStr
 	lsman.parsedLogStreams = parsedLogStreams
@@ -155,9 +194,15 @@ func (lsman *LStreamsManager) setLStreams(lstreamsStr string) error {
 func (lsman *LStreamsManager) updateHAs() {
 	// Close unused logstream clients
 	for key, oldHA := range lsman.lscs {
-		if _, ok := lsman.parsedLogStreams[key]; ok {
-			// The logstream is still used
-			continue
+		if ls, ok := lsman.parsedLogStreams[key]; ok {
+			if reflect.DeepEqual(ls, oldHA.getLogStream()) {
+				// The logstream is still used, and its config hasn't changed
+				continue
+			}
+
+			// The logstream is still used, but its config has changed (which can
+			// happen after reloading the config), so we need to close the old client
+			// and create a new one below.
 		}
 
 		// We used to use this logstream, but now it's filtered out, so close it
@@ -166,6 +211,7 @@ func (lsman *LStreamsManager) updateHAs() {
 		delete(lsman.lscStates, key)
 		delete(lsman.lscConnDetails, key)
 		delete(lsman.lscBusyStages, key)
+		delete(lsman.lscLogFormats, key)
 
 		keyNew := fmt.Sprintf("OLD_%s_%s", lsman.randomString(4), key)
 		lsman.lscPendingTeardown[keyNew] += 1
@@ -180,14 +226,21 @@ func (lsman *LStreamsManager) updateHAs() {
 		}
 
 		// We need to create a new logstream client
-		lsc := NewLStreamClient(LStreamClientParams{
+		lscParams := LStreamClientParams{
 			LogStream: ls,
 			SSHKeys:   lsman.params.SSHKeys,
 			Logger:    lsman.params.Logger,
 			ClientID:  lsman.params.ClientID, //fmt.Sprintf("%s-%d", lsman.params.ClientID, rand.Int()),
 			UpdatesCh: lsman.lstreamUpdatesCh,
 			Clock:     lsman.params.Clock,
-		})
+		}
+
+		var lsc lstreamClient
+		if ls.HTTP != nil {
+			lsc = NewLStreamClientHTTP(lscParams)
+		} else {
+			lsc = NewLStreamClient(lscParams)
+		}
 		lsman.lscs[key] = lsc
 		lsman.lscStates[key] = LStreamClientStateDisconnected
 	}
@@ -237,6 +290,7 @@ func (lsman *LStreamsManager) run() {
 
 				lsman.updateLStreamsByState()
 				lsman.sendStateUpdate()
+				lsman.startPendingQueryIfReady()
 			} else if upd.ConnDetails != nil {
 				lsman.params.Logger.Verbose1f("ConnDetails for %s: %+v", upd.Name, *upd.ConnDetails)
 				lsman.lscConnDetails[upd.Name] = *upd.ConnDetails
@@ -253,6 +307,11 @@ func (lsman *LStreamsManager) run() {
 					},
 				}
 				lsman.params.UpdatesCh <- upd
+			} else if upd.LogFormat != nil {
+				if _, ok := lsman.lscStates[upd.Name]; ok {
+					lsman.lscLogFormats[upd.Name] = *upd.LogFormat
+					lsman.sendStateUpdate()
+				}
 			} else if upd.BusyStage != nil {
 				lsman.lscBusyStages[upd.Name] = *upd.BusyStage
 				lsman.sendStateUpdate()
@@ -321,6 +380,29 @@ func (lsman *LStreamsManager) run() {
 					continue
 				}
 
+				if _, err := newNamedQueryMatchers(req.queryLogs.NamedQueries); err != nil {
+					lsman.sendLogRespUpdate(&LogRespTotal{
+						Errs: []error{errors.Trace(err)},
+					})
+					continue
+				}
+
+				if err := lsman.validateLStreamQueries(req.queryLogs); err != nil {
+					lsman.sendLogRespUpdate(&LogRespTotal{
+						Errs: []error{errors.Trace(err)},
+					})
+					continue
+				}
+
+				if lsman.numIdleDisconnected > 0 || lsman.pendingQueryLogs != nil {
+					// Some logstreams were disconnected due to inactivity; wake them up,
+					// and run the query once they're connected.
+					lsman.wakeUpIdleDisconnected()
+					lsman.pendingQueryLogs = req.queryLogs
+					lsman.sendStateUpdate()
+					continue
+				}
+
 				if lsman.numNotConnected > 0 {
 					lsman.sendLogRespUpdate(&LogRespTotal{
 						Errs: []error{ErrNotYetConnected},
@@ -335,85 +417,92 @@ func (lsman *LStreamsManager) run() {
 					continue
 				}
 
-				if req.queryLogs.MaxNumLines == 0 {
-					panic("req.queryLogs.MaxNumLines is zero")
+				lsman.startQueryLogs(req.queryLogs)
+
+			case req.updLStreams != nil:
+				r := req.updLStreams
+				lsman.params.Logger.Infof("LStreams manager: update logstreams spec: %s", r.logStreamsSpec)
+
+				if lsman.curQueryLogsCtx != nil {
+					r.resCh <- ErrBusyWithAnotherQuery
+					continue
 				}
 
-				lsman.curQueryLogsCtx = &manQueryLogsCtx{
-					req:       req.queryLogs,
-					startTime: lsman.params.Clock.Now(),
-					resps:     make(map[string]*LogResp, len(lsman.lscs)),
-					errs:      map[string]error{},
+				if err := lsman.setLStreams(r.logStreamsSpec); err != nil {
+					r.resCh <- errors.Trace(err)
+					continue
 				}
 
-				// sendStateUpdate must be done after setting curQueryLogsCtx.
-				lsman.sendStateUpdate()
+				lsman.pendingQueryLogs = nil
 
-				for lstreamName, lsc := range lsman.lscs {
-					cmdQueryLogs := lstreamCmdQueryLogs{
-						maxNumLines: req.queryLogs.MaxNumLines,
+				lsman.updateHAs()
+				lsman.updateLStreamsByState()
+				lsman.sendStateUpdate()
 
-						from:  req.queryLogs.From,
-						to:    req.queryLogs.To,
-						query: req.queryLogs.Query,
+				r.resCh <- nil
 
-						refreshIndex: req.queryLogs.RefreshIndex,
-					}
+			case req.updConfig != nil:
+				r := req.updConfig
+				lsman.params.Logger.Infof("LStreams manager: update logstreams config")
 
-					if req.queryLogs.LoadEarlier {
-						// TODO: right now, this loadEarlier case isn't optimized at all:
-						// we again query the whole timerange, and every node goes through
-						// all same lines and builds all the same mstats again (which we
-						// then ignore). We can optimize it; however honestly the actual
-						// performance, as per my experiments, isn't going to be
-						// SPECTACULARLY better. Just kinda marginally better (try loading
-						// older logs with time period 5h or 1m: the 1m is somewhat faster,
-						// but not super fast. That's the difference we're talking about)
-						//
-						// Anyway, the way to optimize it is as follows: we already have
-						// mstats, so we know what kind of timeframe we should query to get
-						// the next maxNumLines messages. So we should query only this time
-						// range, and we should avoid building any mstats. This way, no
-						// matter how large the current time period is, loading more
-						// messages will be as fast as possible.
-
-						if nodeCtx, ok := lsman.curLogs.perNode[lstreamName]; ok {
-							if len(nodeCtx.logs) > 0 {
-								if nodeCtx.logs[0].LogFilename == SpecialFilenameJournalctl {
-									cmdQueryLogs.timestampUntil = getEarliestTimeAndNumMsgs(nodeCtx.logs)
-								} else {
-									cmdQueryLogs.linesUntil = nodeCtx.logs[0].CombinedLinenumber
-								}
-							}
-						}
-					}
+				if lsman.curQueryLogsCtx != nil {
+					r.resCh <- ErrBusyWithAnotherQuery
+					continue
+				}
 
-					lsc.EnqueueCmd(lstreamCmd{
-						respCh:    lsman.respCh,
-						queryLogs: &cmdQueryLogs,
-					})
+				// Resolve the current logstreams spec with the new config; if it fails,
+				// keep the old config.
+				oldConfig := lsman.params.ConfigLogStreams
+				oldGroups := lsman.params.ConfigLStreamGroups
+				lsman.params.ConfigLogStreams = r.config
+				lsman.params.ConfigLStreamGroups = r.groups
+				if err := lsman.setLStreams(lsman.lstreamsStr); err != nil {
+					lsman.params.ConfigLogStreams = oldConfig
+					lsman.params.ConfigLStreamGroups = oldGroups
+					r.resCh <- errors.Trace(err)
+					continue
 				}
 
-			case req.updLStreams != nil:
-				r := req.updLStreams
-				lsman.params.Logger.Infof("LStreams manager: update logstreams spec: %s", r.logStreamsSpec)
+				lsman.pendingQueryLogs = nil
+
+				lsman.updateHAs()
+				lsman.updateLStreamsByState()
+				lsman.sendStateUpdate()
+
+				r.resCh <- nil
+
+			case req.updMuted != nil:
+				r := req.updMuted
+				lsman.params.Logger.Infof("LStreams manager: update muted logstreams: %v", r.names)
 
 				if lsman.curQueryLogsCtx != nil {
 					r.resCh <- ErrBusyWithAnotherQuery
 					continue
 				}
 
-				if err := lsman.setLStreams(r.logStreamsSpec); err != nil {
+				oldMuted := lsman.mutedLStreams
+				lsman.mutedLStreams = make(map[string]struct{}, len(r.names))
+				for _, name := range r.names {
+					lsman.mutedLStreams[name] = struct{}{}
+				}
+
+				if err := lsman.setLStreams(lsman.lstreamsStr); err != nil {
+					lsman.mutedLStreams = oldMuted
 					r.resCh <- errors.Trace(err)
 					continue
 				}
 
+				lsman.pendingQueryLogs = nil
+
 				lsman.updateHAs()
 				lsman.updateLStreamsByState()
 				lsman.sendStateUpdate()
 
 				r.resCh <- nil
 
+			case req.fetchLines != nil:
+				lsman.startFetchLines(*req.fetchLines)
+
 			case req.ping:
 				for _, lsc := range lsman.lscs {
 					lsc.EnqueueCmd(lstreamCmd{
@@ -427,6 +516,7 @@ func (lsman *LStreamsManager) run() {
 					lsman.params.Logger.Infof("Forgetting the in-progress query")
 					lsman.curQueryLogsCtx = nil
 				}
+				lsman.pendingQueryLogs = nil
 				for _, lsc := range lsman.lscs {
 					lsc.Reconnect()
 				}
@@ -443,6 +533,7 @@ func (lsman *LStreamsManager) run() {
 					lsman.params.Logger.Infof("Forgetting the in-progress query")
 					lsman.curQueryLogsCtx = nil
 				}
+				lsman.pendingQueryLogs = nil
 				lsman.setLStreams("")
 
 				lsman.updateHAs()
@@ -462,6 +553,8 @@ func (lsman *LStreamsManager) run() {
 
 				switch v := resp.resp.(type) {
 				case *LogResp:
+					tagNamedQueries(v.Logs, lsman.curQueryLogsCtx.namedQueryMatchers)
+					truncateLongLines(v.Logs, lsman.curQueryLogsCtx.req.MaxLineLength)
 					lsman.curQueryLogsCtx.resps[resp.hostname] = v
 
 					// If we collected responses from all nodes, handle them.
@@ -483,6 +576,8 @@ func (lsman *LStreamsManager) run() {
 							resp.hostname,
 							len(lsman.lscs)-len(lsman.curQueryLogsCtx.resps),
 						)
+
+						lsman.schedulePartialLogResp()
 					}
 
 				default:
@@ -493,6 +588,12 @@ func (lsman *LStreamsManager) run() {
 				lsman.params.Logger.Errorf("Dropping update from %s on the floor", resp.hostname)
 			}
 
+		case <-lsman.curQueryLogsCtx.getTimeoutCh():
+			lsman.handleQueryTimeout()
+
+		case <-lsman.curQueryLogsCtx.getPartialCh():
+			lsman.sendPartialLogResp()
+
 		case <-lsman.teardownReqCh:
 			lsman.params.Logger.Infof("LStreamsManager teardown is started")
 			lsman.tearingDown = true
@@ -544,6 +645,213 @@ func getEarliestTimeAndNumMsgs(logs []LogMsg) *timeAndNumMsgs {
 	return ret
 }
 
+// handleQueryTimeout is called when the query in progress has timed out: it
+// reconnects the logstreams which haven't responded yet, to abort whatever
+// they're doing, and completes the query with the partial results.
+func (lsman *LStreamsManager) handleQueryTimeout() {
+	ctx := lsman.curQueryLogsCtx
+
+	for name, lsc := range lsman.lscs {
+		if _, ok := ctx.resps[name]; ok {
+			continue
+		}
+
+		lsman.params.Logger.Errorf("Query timed out on %s, reconnecting", name)
+		ctx.timedOut = append(ctx.timedOut, name)
+		ctx.resps[name] = &LogResp{}
+		lsc.Reconnect()
+	}
+
+	// If some of the logstreams have failed, the results aren't shown at all,
+	// and the errors are; so make the timed out logstreams errors as well,
+	// otherwise they'd go unnoticed.
+	if len(ctx.errs) > 0 {
+		for _, name := range ctx.timedOut {
+			ctx.errs[name] = errors.Errorf("query timed out after %s", ctx.req.Timeout)
+		}
+	}
+
+	sort.Strings(ctx.timedOut)
+
+	lsman.mergeLogRespsAndSend()
+
+	lsman.curQueryLogsCtx = nil
+
+	// sendStateUpdate must be done after setting curQueryLogsCtx.
+	lsman.sendStateUpdate()
+}
+
+// startQueryLogs sends the query to all logstream clients. All of them must
+// be connected, and there must be no other query in progress.
+func (lsman *LStreamsManager) startQueryLogs(params *QueryLogsParams) {
+	if params.MaxNumLines == 0 && !params.CountOnly {
+		panic("params.MaxNumLines is zero")
+	}
+
+	// Zero maxNumLines makes the logstream clients only return the stats.
+	maxNumLines := params.MaxNumLines
+	if params.CountOnly {
+		maxNumLines = 0
+	}
+
+	lsman.curQueryLogsCtx = &manQueryLogsCtx{
+		req:       params,
+		startTime: lsman.params.Clock.Now(),
+		resps:     make(map[string]*LogResp, len(lsman.lscs)),
+		errs:      map[string]error{},
+	}
+
+	if params.Timeout > 0 {
+		lsman.curQueryLogsCtx.timeoutCh = lsman.params.Clock.After(params.Timeout)
+	}
+
+	// sendStateUpdate must be done after setting curQueryLogsCtx.
+	lsman.sendStateUpdate()
+
+	// The named queries have already been validated when the query was
+	// requested.
+	lsman.curQueryLogsCtx.namedQueryMatchers, _ = newNamedQueryMatchers(params.NamedQueries)
+
+	for lstreamName, lsc := range lsman.lscs {
+		lstreamQuery, err := getLStreamQuery(params, lsc.getLogStream(), false)
+		if err != nil {
+			// The queries have already been validated when the query was requested,
+			// so it's not expected to happen; just let awk deal with it as is.
+			lsman.params.Logger.Errorf("Failed to translate the query for %s: %s", lstreamName, err.Error())
+		}
+
+		// The log format might not be known yet, so let the client pick.
+		lstreamJSONQuery, _ := getLStreamQuery(params, lsc.getLogStream(), true)
+
+		cmdQueryLogs := lstreamCmdQueryLogs{
+			maxNumLines: maxNumLines,
+
+			from:      params.From,
+			to:        params.To,
+			lineRange: params.LineRange,
+			query:     lstreamQuery,
+			jsonQuery: lstreamJSONQuery,
+
+			refreshIndex: params.RefreshIndex,
+
+			defaultIdleTimeout: params.DefaultIdleTimeout,
+		}
+
+		if params.LoadEarlier {
+			// TODO: right now, this loadEarlier case isn't optimized at all:
+			// we again query the whole timerange, and every node goes through
+			// all same lines and builds all the same mstats again (which we
+			// then ignore). We can optimize it; however honestly the actual
+			// performance, as per my experiments, isn't going to be
+			// SPECTACULARLY better. Just kinda marginally better (try loading
+			// older logs with time period 5h or 1m: the 1m is somewhat faster,
+			// but not super fast. That's the difference we're talking about)
+			//
+			// Anyway, the way to optimize it is as follows: we already have
+			// mstats, so we know what kind of timeframe we should query to get
+			// the next maxNumLines messages. So we should query only this time
+			// range, and we should avoid building any mstats. This way, no
+			// matter how large the current time period is, loading more
+			// messages will be as fast as possible.
+
+			if nodeCtx, ok := lsman.curLogs.perNode[lstreamName]; ok {
+				if len(nodeCtx.logs) > 0 {
+					// Neither journalctl nor HTTP logstreams have line numbers, so
+					// use the timestamps instead.
+					isHTTP := lsman.parsedLogStreams[lstreamName].HTTP != nil
+					if isHTTP || nodeCtx.logs[0].LogFilename == SpecialFilenameJournalctl {
+						cmdQueryLogs.timestampUntil = getEarliestTimeAndNumMsgs(nodeCtx.logs)
+					} else {
+						cmdQueryLogs.linesUntil = nodeCtx.logs[0].CombinedLinenumber
+					}
+				}
+			}
+		}
+
+		lsc.EnqueueCmd(lstreamCmd{
+			respCh:    lsman.respCh,
+			queryLogs: &cmdQueryLogs,
+		})
+	}
+}
+
+// fetchLinesTimeout is how long FetchLines waits for the logstream to respond.
+const fetchLinesTimeout = 30 * time.Second
+
+// partialLogRespInterval is the minimum interval between the partial
+// responses sent while the query is in progress; see schedulePartialLogResp.
+const partialLogRespInterval = 500 * time.Millisecond
+
+// startFetchLines enqueues the command to fetch the lines for FetchLines to
+// the logstream client, with its own response channel, so that it doesn't
+// interfere with the current query; the response is waited for in a separate
+// goroutine, and sent as the FetchedLines update.
+func (lsman *LStreamsManager) startFetchLines(r lstreamsManagerReqFetchLines) {
+	fetched := &FetchedLines{
+		LStreamName: r.lstreamName,
+		LineRange:   r.lineRange,
+	}
+
+	lsc, ok := lsman.lscs[r.lstreamName]
+	if !ok {
+		fetched.Err = errors.Errorf("logstream %s is not in the current logstreams", r.lstreamName)
+		lsman.params.UpdatesCh <- LStreamsManagerUpdate{FetchedLines: fetched}
+		return
+	}
+
+	lineRange := r.lineRange
+	respCh := make(chan lstreamCmdRes, 1)
+	lsc.EnqueueCmd(lstreamCmd{
+		respCh: respCh,
+		queryLogs: &lstreamCmdQueryLogs{
+			maxNumLines: lineRange.To - lineRange.From + 1,
+			lineRange:   &lineRange,
+		},
+	})
+
+	timeoutCh := lsman.params.Clock.After(fetchLinesTimeout)
+	go func() {
+		select {
+		case res := <-respCh:
+			fetched.Err = res.err
+			if resp, ok := res.resp.(*LogResp); ok && res.err == nil {
+				fetched.Logs = resp.Logs
+			}
+
+		case <-timeoutCh:
+			fetched.Err = errors.Errorf("timed out after %s", fetchLinesTimeout)
+		}
+
+		lsman.params.UpdatesCh <- LStreamsManagerUpdate{FetchedLines: fetched}
+	}()
+}
+
+// wakeUpIdleDisconnected initiates reconnection of all the logstream clients
+// which were disconnected due to inactivity.
+func (lsman *LStreamsManager) wakeUpIdleDisconnected() {
+	for name, state := range lsman.lscStates {
+		if state == LStreamClientStateIdleDisconnected {
+			lsman.params.Logger.Infof("Waking up %s", name)
+			lsman.lscs[name].Reconnect()
+		}
+	}
+}
+
+// startPendingQueryIfReady starts the query which was postponed until all
+// the logstreams are connected, if any.
+func (lsman *LStreamsManager) startPendingQueryIfReady() {
+	if lsman.pendingQueryLogs == nil ||
+		lsman.numNotConnected > 0 ||
+		lsman.numIdleDisconnected > 0 ||
+		lsman.curQueryLogsCtx != nil {
+		return
+	}
+
+	params := lsman.pendingQueryLogs
+	lsman.pendingQueryLogs = nil
+	lsman.startQueryLogs(params)
+}
+
 func (lsman *LStreamsManager) getNumLStreamClientsTearingDown() int {
 	numPending := 0
 	for _, v := range lsman.lscPendingTeardown {
@@ -572,6 +880,9 @@ type lstreamsManagerReq struct {
 
 	queryLogs   *QueryLogsParams
 	updLStreams *lstreamsManagerReqUpdLStreams
+	updConfig   *lstreamsManagerReqUpdConfig
+	updMuted    *lstreamsManagerReqUpdMuted
+	fetchLines  *lstreamsManagerReqFetchLines
 	ping        bool
 	reconnect   bool
 	disconnect  bool
@@ -582,6 +893,22 @@ type lstreamsManagerReqUpdLStreams struct {
 	resCh          chan<- error
 }
 
+type lstreamsManagerReqUpdConfig struct {
+	config ConfigLogStreams
+	groups ConfigLStreamGroups
+	resCh  chan<- error
+}
+
+type lstreamsManagerReqUpdMuted struct {
+	names []string
+	resCh chan<- error
+}
+
+type lstreamsManagerReqFetchLines struct {
+	lstreamName string
+	lineRange   LineRange
+}
+
 func (lsman *LStreamsManager) QueryLogs(params QueryLogsParams) {
 	lsman.params.Logger.Verbose1f("QueryLogs: %+v", params)
 	lsman.reqCh <- lstreamsManagerReq{
@@ -602,6 +929,58 @@ func (lsman *LStreamsManager) SetLStreams(logStreamsSpec string) error {
 	return <-resCh
 }
 
+// SetConfigLogStreams replaces the nerdlog-specific logstreams config and
+// groups, and re-resolves the current logstreams spec using it. The logstreams whose
+// resolved config has changed are reconnected. If the current spec can't be
+// resolved with the new config, an error is returned and the old config
+// remains in effect.
+func (lsman *LStreamsManager) SetConfigLogStreams(
+	config ConfigLogStreams, groups ConfigLStreamGroups,
+) error {
+	resCh := make(chan error, 1)
+
+	lsman.reqCh <- lstreamsManagerReq{
+		updConfig: &lstreamsManagerReqUpdConfig{
+			config: config,
+			groups: groups,
+			resCh:  resCh,
+		},
+	}
+
+	return <-resCh
+}
+
+// SetMutedLStreams replaces the set of muted logstreams: these are excluded
+// from the current (and any future) logstreams spec, even if the spec matches
+// them. The names are the logstream names, as in the "lstream" context tag of
+// log messages.
+func (lsman *LStreamsManager) SetMutedLStreams(names []string) error {
+	resCh := make(chan error, 1)
+
+	lsman.reqCh <- lstreamsManagerReq{
+		updMuted: &lstreamsManagerReqUpdMuted{
+			names: names,
+			resCh: resCh,
+		},
+	}
+
+	return <-resCh
+}
+
+// FetchLines fetches the given range of lines from the given logstream, e.g.
+// to get the full line when it's truncated in the query results (see
+// QueryLogsParams.MaxLineLength). The lines are not truncated, and the current
+// query results are not affected; the result is delivered asynchronously as
+// the FetchedLines update.
+func (lsman *LStreamsManager) FetchLines(lstreamName string, lineRange LineRange) {
+	lsman.reqCh <- lstreamsManagerReq{
+		fetchLines: &lstreamsManagerReqFetchLines{
+			lstreamName: lstreamName,
+			lineRange:   lineRange,
+		},
+	}
+}
+
 func (lsman *LStreamsManager) Ping() {
 	lsman.reqCh <- lstreamsManagerReq{
 		ping: true,
@@ -629,6 +1008,42 @@ type manQueryLogsCtx struct {
 	// been collected, we'll start merging them together.
 	resps map[string]*LogResp
 	errs  map[string]error
+
+	// timeoutCh, if not nil, fires once the query times out; see
+	// QueryLogsParams.Timeout. timedOut contains the logstreams which didn't
+	// respond by then.
+	timeoutCh <-chan time.Time
+	timedOut  []string
+
+	// partialCh, if not nil, fires when it's time to send the partial
+	// response which was held back; see schedulePartialLogResp.
+	// lastPartialSent is when the last partial response was sent.
+	partialCh       <-chan time.Time
+	lastPartialSent time.Time
+
+	// anyRespSent is whether any response to this query has been sent yet;
+	// see LogRespTotal.First.
+	anyRespSent bool
+
+	// namedQueryMatchers are used to tag the messages with the named queries
+	// they match; see QueryLogsParams.NamedQueries.
+	namedQueryMatchers []*namedQueryMatcher
+}
+
+func (c *manQueryLogsCtx) getTimeoutCh() <-chan time.Time {
+	if c == nil {
+		return nil
+	}
+
+	return c.timeoutCh
+}
+
+func (c *manQueryLogsCtx) getPartialCh() <-chan time.Time {
+	if c == nil {
+		return nil
+	}
+
+	return c.partialCh
 }
 
 type manLogsCtx struct {
@@ -641,6 +1056,15 @@ type manLogsCtx struct {
 type manLogsNodeCtx struct {
 	logs          []LogMsg
 	isMaxNumLines bool
+
+	// numMsgs is the number of messages in the time range from this node, as
+	// per its minute stats.
+	numMsgs int
+	// minuteStats are the minute stats of this node alone.
+	minuteStats map[int64]MinuteStatsItem
+	// timedOut is true if the node didn't respond to the query in time, so
+	// numMsgs and minuteStats are meaningless.
+	timedOut bool
 }
 
 type LStreamsManagerUpdate struct {
@@ -652,6 +1076,18 @@ type LStreamsManagerUpdate struct {
 	BootstrapIssue *BootstrapIssue
 
 	DataRequest *ShellConnDataRequest
+
+	FetchedLines *FetchedLines
+}
+
+// FetchedLines is the result of LStreamsManager.FetchLines.
+type FetchedLines struct {
+	LStreamName string
+	LineRange   LineRange
+
+	// Logs are the fetched lines, not truncated; if Err is set, it's empty.
+	Logs []LogMsg
+	Err  error
 }
 
 type LStreamsManagerState struct {
@@ -677,6 +1113,25 @@ type LStreamsManagerState struct {
 
 	// TearingDown contains logstream names whic are in the process of teardown.
 	TearingDown []string
+
+	// DefaultQueryByLStream is a map from the logstream name to its default
+	// query (see ConfigLogStreamOptions.DefaultQuery). Only logstreams which
+	// have a default query are included.
+	DefaultQueryByLStream map[string]string
+
+	// ExpectQuietLStreams contains the names of the logstreams which are
+	// expected to often have no logs; see ConfigLogStreamOptions.ExpectQuiet.
+	ExpectQuietLStreams map[string]struct{}
+
+	// LogFormatByLStream is a map from the logstream name to its log format,
+	// either configured or detected. Only logstreams which have bootstrapped
+	// successfully are included.
+	LogFormatByLStream map[string]LogFormatGuess
+
+	// LogStreams is a map from the logstream name to the resolved logstream,
+	// for all the logstreams matching the current filter; it tells how every
+	// one of them is accessed, like the ssh host and user, or the jumphost.
+	LogStreams map[string]LogStream
 }
 
 type BootstrapIssue struct {
@@ -692,6 +1147,7 @@ type BootstrapIssue struct {
 
 func (lsman *LStreamsManager) updateLStreamsByState() {
 	lsman.numNotConnected = 0
+	lsman.numIdleDisconnected = 0
 	lsman.lstreamsByState = map[LStreamClientState]map[string]struct{}{}
 
 	for name, state := range lsman.lscStates {
@@ -703,7 +1159,9 @@ func (lsman *LStreamsManager) updateLStreamsByState() {
 
 		set[name] = struct{}{}
 
-		if !isStateConnected(state) {
+		if state == LStreamClientStateIdleDisconnected {
+			lsman.numIdleDisconnected++
+		} else if !isStateConnected(state) {
 			lsman.numNotConnected++
 		}
 	}
@@ -735,17 +1193,60 @@ func (lsman *LStreamsManager) sendStateUpdate() {
 	}
 	sort.Strings(tearingDown)
 
+	var defaultQueries map[string]string
+	for name, ls := range lsman.parsedLogStreams {
+		if ls.Options.DefaultQuery == "" {
+			continue
+		}
+
+		if defaultQueries == nil {
+			defaultQueries = map[string]string{}
+		}
+		defaultQueries[name] = ls.Options.DefaultQuery
+	}
+
+	logFormatsCopy := make(map[string]LogFormatGuess, len(lsman.lscLogFormats))
+	for k, v := range lsman.lscLogFormats {
+		logFormatsCopy[k] = v
+	}
+
+	logStreamsCopy := make(map[string]LogStream, len(lsman.parsedLogStreams))
+	for k, v := range lsman.parsedLogStreams {
+		logStreamsCopy[k] = v
+	}
+
+	var expectQuiet map[string]struct{}
+	for name, ls := range lsman.parsedLogStreams {
+		if !ls.Options.ExpectQuiet {
+			continue
+		}
+
+		if expectQuiet == nil {
+			expectQuiet = map[string]struct{}{}
+		}
+		expectQuiet[name] = struct{}{}
+	}
+
+	// The logstreams which were disconnected due to inactivity are considered
+	// available: they'll be reconnected on the next query.
+	numAvailable := numConnected + lsman.numIdleDisconnected
+
 	upd := LStreamsManagerUpdate{
 		State: &LStreamsManagerState{
 			NumLStreams:          len(lsman.lscs),
 			LStreamsByState:      lsman.lstreamsByState,
 			NumConnected:         numConnected,
-			NoMatchingLStreams:   lsman.numNotConnected == 0 && numConnected == 0,
-			Connected:            lsman.numNotConnected == 0 && numConnected > 0,
-			Busy:                 lsman.curQueryLogsCtx != nil,
+			NoMatchingLStreams:   lsman.numNotConnected == 0 && numAvailable == 0,
+			Connected:            lsman.numNotConnected == 0 && numAvailable > 0,
+			Busy:                 lsman.curQueryLogsCtx != nil || lsman.pendingQueryLogs != nil,
 			ConnDetailsByLStream: connDetailsCopy,
 			BusyStageByLStream:   busyStagesCopy,
 			TearingDown:          tearingDown,
+
+			DefaultQueryByLStream: defaultQueries,
+			ExpectQuietLStreams:   expectQuiet,
+			LogFormatByLStream:    logFormatsCopy,
+			LogStreams:            logStreamsCopy,
 		},
 	}
 
@@ -753,8 +1254,10 @@ func (lsman *LStreamsManager) sendStateUpdate() {
 }
 
 func (lsman *LStreamsManager) sendLogRespUpdate(resp *LogRespTotal) {
-	if lsman.curQueryLogsCtx != nil {
-		resp.QueryDur = time.Since(lsman.curQueryLogsCtx.startTime)
+	if ctx := lsman.curQueryLogsCtx; ctx != nil {
+		resp.QueryDur = time.Since(ctx.startTime)
+		resp.First = !ctx.anyRespSent
+		ctx.anyRespSent = true
 	}
 
 	lsman.params.UpdatesCh <- LStreamsManagerUpdate{
@@ -777,7 +1280,8 @@ func (lsman *LStreamsManager) mergeLogRespsAndSend() {
 		})
 
 		lsman.sendLogRespUpdate(&LogRespTotal{
-			Errs: errs2,
+			Errs:             errs2,
+			TimedOutLStreams: lsman.curQueryLogsCtx.timedOut,
 		})
 
 		return
@@ -785,24 +1289,38 @@ func (lsman *LStreamsManager) mergeLogRespsAndSend() {
 
 	// If we're not adding to already existing logs, reset w/e we've had already,
 	// and calculate minuteStats from the resps.
-	if !lsman.curQueryLogsCtx.req.LoadEarlier {
+	req := lsman.curQueryLogsCtx.req
+	if !req.LoadEarlier {
 		lsman.curLogs = manLogsCtx{
 			minuteStats: map[int64]MinuteStatsItem{},
 			perNode:     map[string]*manLogsNodeCtx{},
 		}
 
+		timedOut := make(map[string]struct{}, len(lsman.curQueryLogsCtx.timedOut))
+		for _, nodeName := range lsman.curQueryLogsCtx.timedOut {
+			timedOut[nodeName] = struct{}{}
+		}
+
 		for nodeName, resp := range resps {
+			numMsgs := 0
 			for k, v := range resp.MinuteStats {
 				lsman.curLogs.minuteStats[k] = MinuteStatsItem{
 					NumMsgs: lsman.curLogs.minuteStats[k].NumMsgs + v.NumMsgs,
 				}
 
 				lsman.curLogs.numMsgsTotal += v.NumMsgs
+				numMsgs += v.NumMsgs
 			}
 
 			lsman.curLogs.perNode[nodeName] = &manLogsNodeCtx{
 				logs:          resp.Logs,
-				isMaxNumLines: len(resp.Logs) == lsman.curQueryLogsCtx.req.MaxNumLines,
+				isMaxNumLines: !req.CountOnly && len(resp.Logs)+resp.NumParseErrors+resp.NumOutOfRange == req.MaxNumLines,
+				numMsgs:       numMsgs,
+				minuteStats:   resp.MinuteStats,
+			}
+
+			if _, ok := timedOut[nodeName]; ok {
+				lsman.curLogs.perNode[nodeName].timedOut = true
 			}
 		}
 	} else {
@@ -810,21 +1328,43 @@ func (lsman *LStreamsManager) mergeLogRespsAndSend() {
 		for nodeName, resp := range resps {
 			pn := lsman.curLogs.perNode[nodeName]
 			pn.logs = append(resp.Logs, pn.logs...)
-			pn.isMaxNumLines = len(resp.Logs) == lsman.curQueryLogsCtx.req.MaxNumLines
+			pn.isMaxNumLines = len(resp.Logs)+resp.NumParseErrors+resp.NumOutOfRange == lsman.curQueryLogsCtx.req.MaxNumLines
 		}
 	}
 
-	// Collect debug info
+	// Collect debug info and parse errors
 	debugInfo := make(map[string]LogstreamDebugInfo, len(resps))
+	var numParseErrors map[string]int
+	var warnings map[string][]string
 	for lstreamName, resp := range resps {
 		debugInfo[lstreamName] = resp.DebugInfo
+
+		if len(resp.Warnings) > 0 {
+			if warnings == nil {
+				warnings = map[string][]string{}
+			}
+			warnings[lstreamName] = resp.Warnings
+		}
+
+		if resp.NumParseErrors > 0 {
+			if numParseErrors == nil {
+				numParseErrors = map[string]int{}
+			}
+			numParseErrors[lstreamName] = resp.NumParseErrors
+		}
 	}
 
 	ret := &LogRespTotal{
-		MinuteStats:   lsman.curLogs.minuteStats,
-		NumMsgsTotal:  lsman.curLogs.numMsgsTotal,
-		LoadedEarlier: lsman.curQueryLogsCtx.req.LoadEarlier,
-		DebugInfo:     debugInfo,
+		MinuteStats:             lsman.curLogs.minuteStats,
+		NumMsgsTotal:            lsman.curLogs.numMsgsTotal,
+		LoadedEarlier:           lsman.curQueryLogsCtx.req.LoadEarlier,
+		CountOnly:               lsman.curQueryLogsCtx.req.CountOnly,
+		NumMsgsByLStream:        getNumMsgsByLStream(lsman.curLogs.perNode),
+		MinuteStatsByLStream:    getMinuteStatsByLStream(lsman.curLogs.perNode),
+		NumParseErrorsByLStream: numParseErrors,
+		WarningsByLStream:       warnings,
+		TimedOutLStreams:        lsman.curQueryLogsCtx.timedOut,
+		DebugInfo:               debugInfo,
 	}
 
 	var logsCoveredSince time.Time
@@ -834,28 +1374,331 @@ func (lsman *LStreamsManager) mergeLogRespsAndSend() {
 
 		// If the timespan covered by logs from this logstream is shorter than what
 		// we've seen before, remember it.
-		if pn.isMaxNumLines && logsCoveredSince.Before(pn.logs[0].Time) {
+		if pn.isMaxNumLines && len(pn.logs) > 0 && logsCoveredSince.Before(pn.logs[0].Time) {
 			logsCoveredSince = pn.logs[0].Time
 		}
 	}
 
-	sort.SliceStable(ret.Logs, func(i, j int) bool {
-		if !ret.Logs[i].Time.Equal(ret.Logs[j].Time) {
-			return ret.Logs[i].Time.Before(ret.Logs[j].Time)
+	ret.Logs = sortAndCutLogs(ret.Logs, logsCoveredSince)
+
+	if maxRetained := lsman.curQueryLogsCtx.req.MaxRetainedLines; maxRetained > 0 && len(ret.Logs) > maxRetained {
+		// Evict the messages furthest from what the user is looking at: after
+		// loading earlier logs, it's the oldest ones, so the newest are evicted;
+		// otherwise, it's the other way around.
+		evictNewest := lsman.curQueryLogsCtx.req.LoadEarlier
+		numBefore := countLogsByLStream(ret.Logs)
+
+		var numEvicted map[string]int
+		ret.Logs, numEvicted = evictLogs(ret.Logs, maxRetained, evictNewest)
+
+		// Also evict them from the per-node logs, so that the memory is actually
+		// freed. Note that pn.logs might also contain older messages which were
+		// cut above (not covered by all nodes); when evicting the oldest ones,
+		// those are dropped as well.
+		for nodeName, pn := range lsman.curLogs.perNode {
+			if numEvicted[nodeName] == 0 && evictNewest {
+				continue
+			}
+
+			if evictNewest {
+				pn.logs = append([]LogMsg(nil), pn.logs[:len(pn.logs)-numEvicted[nodeName]]...)
+			} else {
+				numRetained := numBefore[nodeName] - numEvicted[nodeName]
+				pn.logs = append([]LogMsg(nil), pn.logs[len(pn.logs)-numRetained:]...)
+			}
+		}
+
+		for _, n := range numEvicted {
+			ret.NumEvicted += n
+		}
+	}
+
+	dedupMergedLogResp(ret, getMergeGroups(lsman.parsedLogStreams))
+
+	ret.Truncated = len(ret.Logs) < ret.NumMsgsTotal
+
+	lsman.sendLogRespUpdate(ret)
+}
+
+// getNumMsgsByLStream returns a map from the node name to the number of
+// messages from it, for all the nodes except the timed out ones, since those
+// have no stats at all.
+func getNumMsgsByLStream(perNode map[string]*manLogsNodeCtx) map[string]int {
+	ret := make(map[string]int, len(perNode))
+	for nodeName, pn := range perNode {
+		if pn.timedOut {
+			continue
+		}
+
+		ret[nodeName] = pn.numMsgs
+	}
+
+	return ret
+}
+
+// getMinuteStatsByLStream returns a map from the node name to its minute
+// stats, for all the nodes except the timed out ones.
+func getMinuteStatsByLStream(perNode map[string]*manLogsNodeCtx) map[string]map[int64]MinuteStatsItem {
+	ret := make(map[string]map[int64]MinuteStatsItem, len(perNode))
+	for nodeName, pn := range perNode {
+		if pn.timedOut {
+			continue
+		}
+
+		ret[nodeName] = pn.minuteStats
+	}
+
+	return ret
+}
+
+// schedulePartialLogResp sends the partial response (see
+// sendPartialLogResp) right away if the last one was sent long enough ago,
+// or otherwise schedules it to be sent once partialLogRespInterval passes.
+// Since every partial response merges and sorts all the logs received so
+// far, sending one per logstream would be quadratic with many logstreams
+// responding around the same time; this way, the responses which come in
+// the meantime are merged together.
+func (lsman *LStreamsManager) schedulePartialLogResp() {
+	ctx := lsman.curQueryLogsCtx
+	if ctx.partialCh != nil {
+		// Already scheduled, and will include the latest responses anyway.
+		return
+	}
+
+	delay := ctx.lastPartialSent.Add(partialLogRespInterval).Sub(lsman.params.Clock.Now())
+	if delay <= 0 {
+		lsman.sendPartialLogResp()
+		return
+	}
+
+	ctx.partialCh = lsman.params.Clock.After(delay)
+}
+
+// sendPartialLogResp sends the results merged from the logstreams which have
+// responded so far, while the query is still in progress on the others; see
+// LogRespTotal.Partial. It's a no-op when loading earlier logs (those are only
+// merged once all responses are there), or if some logstreams have failed.
+func (lsman *LStreamsManager) sendPartialLogResp() {
+	ctx := lsman.curQueryLogsCtx
+	ctx.partialCh = nil
+	ctx.lastPartialSent = lsman.params.Clock.Now()
+
+	if ctx.req.LoadEarlier || len(ctx.errs) > 0 {
+		return
+	}
+
+	ret := getPartialLogResp(ctx.resps, ctx.req, getMergeGroups(lsman.parsedLogStreams))
+	ret.NumPendingLStreams = len(lsman.lscs) - len(ctx.resps)
+
+	lsman.sendLogRespUpdate(ret)
+}
+
+// getPartialLogResp merges the given responses like mergeLogRespsAndSend does,
+// but without touching the current logs, since more responses are still to
+// come.
+func getPartialLogResp(
+	resps map[string]*LogResp, req *QueryLogsParams, mergeGroups map[string]string,
+) *LogRespTotal {
+	ret := &LogRespTotal{
+		MinuteStats:          map[int64]MinuteStatsItem{},
+		MinuteStatsByLStream: make(map[string]map[int64]MinuteStatsItem, len(resps)),
+		CountOnly:            req.CountOnly,
+		Partial:              true,
+	}
+
+	var logsCoveredSince time.Time
+
+	for nodeName, resp := range resps {
+		ret.MinuteStatsByLStream[nodeName] = resp.MinuteStats
+
+		for k, v := range resp.MinuteStats {
+			ret.MinuteStats[k] = MinuteStatsItem{
+				NumMsgs: ret.MinuteStats[k].NumMsgs + v.NumMsgs,
+			}
+
+			ret.NumMsgsTotal += v.NumMsgs
+		}
+
+		ret.Logs = append(ret.Logs, resp.Logs...)
+
+		isMaxNumLines := !req.CountOnly && len(resp.Logs)+resp.NumParseErrors+resp.NumOutOfRange == req.MaxNumLines
+		if isMaxNumLines && len(resp.Logs) > 0 && logsCoveredSince.Before(resp.Logs[0].Time) {
+			logsCoveredSince = resp.Logs[0].Time
+		}
+	}
+
+	ret.Logs = sortAndCutLogs(ret.Logs, logsCoveredSince)
+
+	if maxRetained := req.MaxRetainedLines; maxRetained > 0 && len(ret.Logs) > maxRetained {
+		var numEvicted map[string]int
+		ret.Logs, numEvicted = evictLogs(ret.Logs, maxRetained, false)
+		for _, n := range numEvicted {
+			ret.NumEvicted += n
+		}
+	}
+
+	dedupMergedLogResp(ret, mergeGroups)
+
+	ret.Truncated = len(ret.Logs) < ret.NumMsgsTotal
+
+	return ret
+}
+
+// getMergeGroups returns a map from the name of every logstream which is a
+// part of a merged one (see ConfigLogStream.MergeLogFiles), including the
+// main one, to the name of the main one.
+func getMergeGroups(lstreams map[string]LogStream) map[string]string {
+	ret := map[string]string{}
+	for name, ls := range lstreams {
+		if ls.MergeInto != "" {
+			ret[name] = ls.MergeInto
+			ret[ls.MergeInto] = ls.MergeInto
+		}
+	}
+
+	return ret
+}
+
+// dedupMergedLogResp drops the duplicate messages of the merged logstreams
+// from the response (see dedupMergedLogs), and also excludes them from the
+// stats.
+func dedupMergedLogResp(resp *LogRespTotal, mergeGroups map[string]string) {
+	var deduped []LogMsg
+	resp.Logs, deduped = dedupMergedLogs(resp.Logs, mergeGroups)
+	if len(deduped) == 0 {
+		return
+	}
+
+	// The minute stats might be shared with the current logs, so make a copy.
+	minuteStats := make(map[int64]MinuteStatsItem, len(resp.MinuteStats))
+	for k, v := range resp.MinuteStats {
+		minuteStats[k] = v
+	}
+
+	for _, msg := range deduped {
+		k := msg.Time.Truncate(time.Minute).Unix()
+		if item := minuteStats[k]; item.NumMsgs > 0 {
+			item.NumMsgs--
+			minuteStats[k] = item
+			resp.NumMsgsTotal--
+		}
+	}
+
+	resp.MinuteStats = minuteStats
+	resp.NumDeduped = len(deduped)
+}
+
+// dedupMergedLogs drops the messages which are the same (by time and text) as
+// an already kept message from another part of the same merged logstream;
+// mergeGroups is as returned by getMergeGroups, and the messages of other
+// logstreams are never dropped. The same message repeated within one part is
+// kept as is. The logs must be sorted by time. Returns the kept messages and
+// the dropped ones.
+func dedupMergedLogs(logs []LogMsg, mergeGroups map[string]string) (kept, deduped []LogMsg) {
+	if len(mergeGroups) == 0 {
+		return logs, nil
+	}
+
+	type dedupKey struct {
+		group string
+		msg   string
+	}
+
+	kept = make([]LogMsg, 0, len(logs))
+
+	// Since the logs are sorted by time, only the messages with the same time
+	// need to be compared; keptBy maps every such message to the parts it was
+	// kept from.
+	var curTime time.Time
+	var keptBy map[dedupKey]map[string]struct{}
+
+	for _, msg := range logs {
+		lstream := msg.Context["lstream"]
+		group, ok := mergeGroups[lstream]
+		if !ok {
+			kept = append(kept, msg)
+			continue
+		}
+
+		if keptBy == nil || !msg.Time.Equal(curTime) {
+			curTime = msg.Time
+			keptBy = map[dedupKey]map[string]struct{}{}
+		}
+
+		key := dedupKey{group: group, msg: msg.Msg}
+
+		isDup := false
+		for other := range keptBy[key] {
+			if other != lstream {
+				isDup = true
+				break
+			}
+		}
+
+		if isDup {
+			deduped = append(deduped, msg)
+			continue
+		}
+
+		if keptBy[key] == nil {
+			keptBy[key] = map[string]struct{}{}
+		}
+		keptBy[key][lstream] = struct{}{}
+
+		kept = append(kept, msg)
+	}
+
+	return kept, deduped
+}
+
+// sortAndCutLogs sorts the logs merged from multiple logstreams by time, and
+// cuts all the potentially incomplete ones before coveredSince, only leaving
+// the timespan which we're sure we have covered from all logstreams.
+func sortAndCutLogs(logs []LogMsg, coveredSince time.Time) []LogMsg {
+	sort.SliceStable(logs, func(i, j int) bool {
+		if !logs[i].Time.Equal(logs[j].Time) {
+			return logs[i].Time.Before(logs[j].Time)
 		}
 
 		// TODO: make it less hacky, store lstream somewhere outside of Context as well.
-		return ret.Logs[i].Context["lstream"] < ret.Logs[j].Context["lstream"]
+		return logs[i].Context["lstream"] < logs[j].Context["lstream"]
 	})
 
-	// Cut all potentially incomplete logs, only leave timespan that we're sure
-	// we have covered from all nodes
-	coveredSinceIdx := sort.Search(len(ret.Logs), func(i int) bool {
-		return !ret.Logs[i].Time.Before(logsCoveredSince)
+	coveredSinceIdx := sort.Search(len(logs), func(i int) bool {
+		return !logs[i].Time.Before(coveredSince)
 	})
-	ret.Logs = ret.Logs[coveredSinceIdx:]
 
-	lsman.sendLogRespUpdate(ret)
+	return logs[coveredSinceIdx:]
+}
+
+// evictLogs drops the messages exceeding maxNum from the logs sorted by time:
+// the newest ones if evictNewest is true, or the oldest ones otherwise. It
+// returns the retained messages, and the number of evicted messages per
+// logstream.
+func evictLogs(logs []LogMsg, maxNum int, evictNewest bool) ([]LogMsg, map[string]int) {
+	if len(logs) <= maxNum {
+		return logs, nil
+	}
+
+	var evicted, retained []LogMsg
+	if evictNewest {
+		retained, evicted = logs[:maxNum], logs[maxNum:]
+	} else {
+		evicted, retained = logs[:len(logs)-maxNum], logs[len(logs)-maxNum:]
+	}
+
+	// Copy the retained ones, so that the evicted ones can be garbage-collected.
+	return append([]LogMsg(nil), retained...), countLogsByLStream(evicted)
+}
+
+// countLogsByLStream returns the number of messages per logstream.
+func countLogsByLStream(logs []LogMsg) map[string]int {
+	ret := map[string]int{}
+	for _, msg := range logs {
+		ret[msg.Context["lstream"]]++
+	}
+
+	return ret
 }
 
 func (lsman *LStreamsManager) randomString(length int) string {
@@ -868,3 +1711,89 @@ func (lsman *LStreamsManager) randomString(length int) string {
 	}
 	return string(prefix)
 }
+
+// combineQueryAndExclude returns the awk pattern which matches lines matching
+// query but not matching exclude. Both query and exclude can be empty.
+func combineQueryAndExclude(query, exclude string) string {
+	if exclude == "" {
+		return query
+	}
+
+	if query == "" {
+		return fmt.Sprintf("!(%s)", exclude)
+	}
+
+	return fmt.Sprintf("(%s) && !(%s)", query, exclude)
+}
+
+// getLStreamQuery returns the awk query to run on the given logstream: the
+// query with the exclude pattern, the named queries and the logstream's default
+// query, with the field values like "level:error" and the "has" operators
+// translated for the logstream's list fields, and with the numeric
+// comparisons like "status >= 500" translated. The canonical field names are
+// translated to the logstream's actual ones as per its field aliases. If
+// isJSON is true, the fields are looked up as the JSON keys by the agent
+// instead of being matched with regexps. If the translation fails, the error
+// is returned along with the untranslated query.
+func getLStreamQuery(params *QueryLogsParams, ls LogStream, isJSON bool) (string, error) {
+	query := combineQueryAndExclude(params.Query, params.Exclude)
+	query = combineQueryAndNamedQueries(query, params.NamedQueries)
+	if !params.NoDefaultQueries {
+		query = addDefaultQuery(query, ls.Options.DefaultQuery)
+	}
+
+	aliases := ls.Options.FieldAliases
+
+	translated, err := awkQueryWithFieldValues(query, aliases, isJSON)
+	if err != nil {
+		return query, errors.Trace(err)
+	}
+
+	translated, err = awkQueryWithHasOperator(translated, ls.Options.ListFields, aliases)
+	if err != nil {
+		return query, errors.Trace(err)
+	}
+
+	// The HTTP logstreams only support regexps, so there's no point in
+	// translating the comparisons: the untranslated ones make a clearer error.
+	if ls.HTTP == nil {
+		translated, err = awkQueryWithNumericComparisons(translated, aliases, isJSON)
+		if err != nil {
+			return query, errors.Trace(err)
+		}
+	}
+
+	return translated, nil
+}
+
+// validateLStreamQueries checks that the query can be run on all the current
+// logstreams; see getLStreamQuery.
+func (lsman *LStreamsManager) validateLStreamQueries(params *QueryLogsParams) error {
+	// Iterate in a stable order, so that the error is the same every time.
+	names := make([]string, 0, len(lsman.lscs))
+	for name := range lsman.lscs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := getLStreamQuery(params, lsman.lscs[name].getLogStream(), false); err != nil {
+			return errors.Annotatef(err, "logstream %s", name)
+		}
+	}
+
+	return nil
+}
+
+// addDefaultQuery ANDs the query with the logstream's default query, if any.
+func addDefaultQuery(query, defaultQuery string) string {
+	if defaultQuery == "" {
+		return query
+	}
+
+	if query == "" {
+		return defaultQuery
+	}
+
+	return fmt.Sprintf("(%s) && (%s)", query, defaultQuery)
+}
@@ -0,0 +1,433 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/clock"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvictLogs(t *testing.T) {
+	mkMsg := func(lstream, msg string) LogMsg {
+		return LogMsg{Msg: msg, Context: map[string]string{"lstream": lstream}}
+	}
+
+	logs := []LogMsg{
+		mkMsg("a", "1"),
+		mkMsg("b", "2"),
+		mkMsg("a", "3"),
+		mkMsg("b", "4"),
+		mkMsg("b", "5"),
+	}
+
+	testCases := []struct {
+		name        string
+		maxNum      int
+		evictNewest bool
+
+		wantMsgs       []string
+		wantNumEvicted map[string]int
+	}{
+		{
+			name:     "under the limit",
+			maxNum:   5,
+			wantMsgs: []string{"1", "2", "3", "4", "5"},
+		},
+		{
+			name:           "evict oldest",
+			maxNum:         2,
+			wantMsgs:       []string{"4", "5"},
+			wantNumEvicted: map[string]int{"a": 2, "b": 1},
+		},
+		{
+			name:           "evict newest",
+			maxNum:         2,
+			evictNewest:    true,
+			wantMsgs:       []string{"1", "2"},
+			wantNumEvicted: map[string]int{"a": 1, "b": 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			retained, numEvicted := evictLogs(logs, tc.maxNum, tc.evictNewest)
+
+			var msgs []string
+			for _, msg := range retained {
+				msgs = append(msgs, msg.Msg)
+			}
+
+			assert.Equal(t, tc.wantMsgs, msgs)
+			assert.Equal(t, tc.wantNumEvicted, numEvicted)
+		})
+	}
+}
+
+type fakeLStreamClient struct {
+	numReconnects int
+	cmds          []lstreamCmd
+}
+
+func (f *fakeLStreamClient) EnqueueCmd(cmd lstreamCmd) { f.cmds = append(f.cmds, cmd) }
+func (f *fakeLStreamClient) Close(changeName string)   {}
+func (f *fakeLStreamClient) Reconnect()                { f.numReconnects++ }
+func (f *fakeLStreamClient) getLogStream() LogStream   { return LogStream{} }
+
+func TestHandleQueryTimeout(t *testing.T) {
+	updatesCh := make(chan LStreamsManagerUpdate, 2)
+	fast := &fakeLStreamClient{}
+	slow := &fakeLStreamClient{}
+
+	lsman := &LStreamsManager{
+		params: LStreamsManagerParams{
+			Logger:    log.NewLogger(log.Error),
+			UpdatesCh: updatesCh,
+		},
+		lscs: map[string]lstreamClient{
+			"fast": fast,
+			"slow": slow,
+		},
+		curQueryLogsCtx: &manQueryLogsCtx{
+			req: &QueryLogsParams{MaxNumLines: 10},
+			resps: map[string]*LogResp{
+				"fast": {
+					Logs: []LogMsg{{Msg: "hello", Context: map[string]string{"lstream": "fast"}}},
+					MinuteStats: map[int64]MinuteStatsItem{
+						0: {NumMsgs: 1},
+					},
+				},
+			},
+			errs: map[string]error{},
+		},
+	}
+
+	lsman.handleQueryTimeout()
+
+	assert.Nil(t, lsman.curQueryLogsCtx)
+	assert.Equal(t, 0, fast.numReconnects)
+	assert.Equal(t, 1, slow.numReconnects)
+
+	resp := (<-updatesCh).LogResp
+	assert.Equal(t, []string{"slow"}, resp.TimedOutLStreams)
+	assert.Empty(t, resp.Errs)
+	assert.Len(t, resp.Logs, 1)
+	assert.Equal(t, 1, resp.NumMsgsTotal)
+	assert.Equal(t, map[string]int{"fast": 1}, resp.NumMsgsByLStream)
+	assert.Equal(t, map[string]map[int64]MinuteStatsItem{
+		"fast": {0: {NumMsgs: 1}},
+	}, resp.MinuteStatsByLStream)
+}
+
+func TestFetchLines(t *testing.T) {
+	updatesCh := make(chan LStreamsManagerUpdate, 1)
+	lsc := &fakeLStreamClient{}
+	clockMock := clock.NewMock()
+
+	lsman := &LStreamsManager{
+		params: LStreamsManagerParams{
+			Logger:    log.NewLogger(log.Error),
+			UpdatesCh: updatesCh,
+			Clock:     clockMock,
+		},
+		lscs: map[string]lstreamClient{
+			"host1": lsc,
+		},
+	}
+
+	// The lines are fetched with a separate command, not touching the current
+	// query.
+	lineRange := LineRange{File: "/var/log/syslog", From: 10, To: 10}
+	lsman.startFetchLines(lstreamsManagerReqFetchLines{lstreamName: "host1", lineRange: lineRange})
+
+	if assert.Len(t, lsc.cmds, 1) {
+		cmd := lsc.cmds[0]
+		assert.NotEqual(t, lsman.respCh, cmd.respCh)
+		assert.Equal(t, &lineRange, cmd.queryLogs.lineRange)
+		assert.Equal(t, 1, cmd.queryLogs.maxNumLines)
+
+		cmd.respCh <- lstreamCmdRes{
+			hostname: "host1",
+			resp:     &LogResp{Logs: []LogMsg{{OrigLine: "full line"}}},
+		}
+	}
+
+	fetched := (<-updatesCh).FetchedLines
+	assert.Equal(t, &FetchedLines{
+		LStreamName: "host1",
+		LineRange:   lineRange,
+		Logs:        []LogMsg{{OrigLine: "full line"}},
+	}, fetched)
+
+	// Unknown logstream.
+	lsman.startFetchLines(lstreamsManagerReqFetchLines{lstreamName: "host2", lineRange: lineRange})
+	fetched = (<-updatesCh).FetchedLines
+	assert.EqualError(t, fetched.Err, "logstream host2 is not in the current logstreams")
+}
+
+func TestGetPartialLogResp(t *testing.T) {
+	mkMsg := func(lstream string, sec int, msg string) LogMsg {
+		return LogMsg{
+			Time:    time.Unix(int64(sec), 0),
+			Msg:     msg,
+			Context: map[string]string{"lstream": lstream},
+		}
+	}
+
+	resps := map[string]*LogResp{
+		"a": {
+			// Hit MaxNumLines, so anything before its first message is not
+			// covered by it.
+			Logs: []LogMsg{mkMsg("a", 20, "a1"), mkMsg("a", 40, "a2")},
+			MinuteStats: map[int64]MinuteStatsItem{
+				0: {NumMsgs: 5},
+			},
+		},
+		"b": {
+			Logs: []LogMsg{mkMsg("b", 10, "b1"), mkMsg("b", 30, "b2"), mkMsg("b", 50, "b3")},
+			MinuteStats: map[int64]MinuteStatsItem{
+				0: {NumMsgs: 3},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name string
+		req  *QueryLogsParams
+
+		wantMsgs       []string
+		wantNumEvicted int
+	}{
+		{
+			name:     "cut to the covered timespan",
+			req:      &QueryLogsParams{MaxNumLines: 2},
+			wantMsgs: []string{"a1", "b2", "a2", "b3"},
+		},
+		{
+			name:           "cap to the max retained lines",
+			req:            &QueryLogsParams{MaxNumLines: 2, MaxRetainedLines: 3},
+			wantMsgs:       []string{"b2", "a2", "b3"},
+			wantNumEvicted: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := getPartialLogResp(resps, tc.req, nil)
+
+			var msgs []string
+			for _, msg := range resp.Logs {
+				msgs = append(msgs, msg.Msg)
+			}
+
+			assert.True(t, resp.Partial)
+			assert.Equal(t, tc.wantMsgs, msgs)
+			assert.Equal(t, tc.wantNumEvicted, resp.NumEvicted)
+			assert.Equal(t, 8, resp.NumMsgsTotal)
+			assert.Equal(t, map[int64]MinuteStatsItem{0: {NumMsgs: 8}}, resp.MinuteStats)
+			assert.True(t, resp.Truncated)
+
+			// The responses themselves must be left intact.
+			assert.Len(t, resps["b"].Logs, 3)
+			assert.Equal(t, "b1", resps["b"].Logs[0].Msg)
+		})
+	}
+}
+
+func TestDedupMergedLogs(t *testing.T) {
+	mkMsg := func(lstream string, sec int, msg string) LogMsg {
+		return LogMsg{
+			Time:    time.Unix(int64(sec), 0),
+			Msg:     msg,
+			Context: map[string]string{"lstream": lstream},
+		}
+	}
+
+	mergeGroups := getMergeGroups(map[string]LogStream{
+		"app":       {Name: "app"},
+		"app+err":   {Name: "app+err", MergeInto: "app"},
+		"unrelated": {Name: "unrelated"},
+	})
+	assert.Equal(t, map[string]string{"app": "app", "app+err": "app"}, mergeGroups)
+
+	logs := []LogMsg{
+		mkMsg("app", 60, "started"),
+		mkMsg("app+err", 60, "started"),
+		mkMsg("unrelated", 60, "started"),
+		// Repeated within the same file, so kept.
+		mkMsg("app", 61, "retry"),
+		mkMsg("app", 61, "retry"),
+		mkMsg("app+err", 61, "retry"),
+		mkMsg("app+err", 61, "retry"),
+		// Same text but different time.
+		mkMsg("app+err", 62, "started"),
+		mkMsg("app+err", 62, "failed"),
+	}
+
+	resp := &LogRespTotal{
+		Logs:         logs,
+		MinuteStats:  map[int64]MinuteStatsItem{60: {NumMsgs: 9}},
+		NumMsgsTotal: 9,
+	}
+	dedupMergedLogResp(resp, mergeGroups)
+
+	var got []string
+	for _, msg := range resp.Logs {
+		got = append(got, fmt.Sprintf("%s %d %s", msg.Context["lstream"], msg.Time.Unix(), msg.Msg))
+	}
+
+	assert.Equal(t, []string{
+		"app 60 started",
+		"unrelated 60 started",
+		"app 61 retry",
+		"app 61 retry",
+		"app+err 62 started",
+		"app+err 62 failed",
+	}, got)
+	assert.Equal(t, 3, resp.NumDeduped)
+	assert.Equal(t, 6, resp.NumMsgsTotal)
+	assert.Equal(t, map[int64]MinuteStatsItem{60: {NumMsgs: 6}}, resp.MinuteStats)
+
+	// Without merged logstreams, nothing is dropped.
+	kept, deduped := dedupMergedLogs(logs, getMergeGroups(nil))
+	assert.Equal(t, logs, kept)
+	assert.Empty(t, deduped)
+}
+
+func TestGetLStreamQueryFieldAliases(t *testing.T) {
+	params := &QueryLogsParams{
+		Query:   "level:error && latency > 500",
+		Exclude: "tags has debug",
+	}
+
+	ls := LogStream{
+		Options: LogStreamOptions{
+			FieldAliases: map[string][]string{
+				"level":   {"severity"},
+				"latency": {"duration_ms"},
+				"tags":    {"labels"},
+			},
+			ListFields: map[string]string{
+				"labels": ",",
+			},
+		},
+	}
+
+	got, err := getLStreamQuery(params, ls, false)
+	assert.NoError(t, err)
+
+	assert.Contains(t, got, `/(^|[^A-Za-z0-9_])(level|severity)("?: *"?|="?)(error|0|1|2|3)([^A-Za-z0-9_]|$)/`)
+	assert.Contains(t, got, `match($0, /(^|[^A-Za-z0-9_])(latency|duration_ms)("?: *|=)`)
+	assert.Contains(t, got, `!(/(^|[^A-Za-z0-9_])(tags|labels)=(`)
+
+	// Without aliases, the fields are used as is.
+	ls.Options.FieldAliases = nil
+	ls.Options.ListFields = map[string]string{"tags": ","}
+
+	got, err = getLStreamQuery(params, ls, false)
+	assert.NoError(t, err)
+	assert.Contains(t, got, `/(^|[^A-Za-z0-9_])level("?: *"?|="?)(error|0|1|2|3)([^A-Za-z0-9_]|$)/`)
+
+	// For JSON, the fields are looked up by the agent.
+	got, err = getLStreamQuery(params, ls, true)
+	assert.NoError(t, err)
+	assert.Contains(t, got, `(nerdlogJsonGet("level") && nerdlogJsonVal ~ /^(error|0|1|2|3)$/)`)
+	assert.Contains(t, got, `(nerdlogJsonGet("latency") && nerdlogJsonVal ~ /^-?[0-9]+(\.[0-9]+)?$/ && nerdlogJsonVal + 0 > 500)`)
+}
+
+func TestHandleQueryTimeoutWithErrors(t *testing.T) {
+	updatesCh := make(chan LStreamsManagerUpdate, 2)
+
+	lsman := &LStreamsManager{
+		params: LStreamsManagerParams{
+			Logger:    log.NewLogger(log.Error),
+			UpdatesCh: updatesCh,
+		},
+		lscs: map[string]lstreamClient{
+			"fast":   &fakeLStreamClient{},
+			"broken": &fakeLStreamClient{},
+			"slow":   &fakeLStreamClient{},
+		},
+		curQueryLogsCtx: &manQueryLogsCtx{
+			req: &QueryLogsParams{MaxNumLines: 10, Timeout: time.Minute},
+			resps: map[string]*LogResp{
+				"fast": {
+					Logs: []LogMsg{{Msg: "hello", Context: map[string]string{"lstream": "fast"}}},
+				},
+				"broken": {},
+			},
+			errs: map[string]error{
+				"broken": errors.New("agent exited with non-zero code '1'"),
+			},
+		},
+	}
+
+	lsman.handleQueryTimeout()
+
+	// Both the actual error and the timeout must be reported, instead of the
+	// partial results.
+	resp := (<-updatesCh).LogResp
+	assert.Equal(t, []string{"slow"}, resp.TimedOutLStreams)
+	assert.Empty(t, resp.Logs)
+	if assert.Len(t, resp.Errs, 2) {
+		assert.Equal(t, "broken: agent exited with non-zero code '1'", resp.Errs[0].Error())
+		assert.Equal(t, "slow: query timed out after 1m0s", resp.Errs[1].Error())
+	}
+}
+
+func TestSchedulePartialLogResp(t *testing.T) {
+	updatesCh := make(chan LStreamsManagerUpdate, 10)
+	clockMock := clock.NewMock()
+
+	lsman := &LStreamsManager{
+		params: LStreamsManagerParams{
+			Logger:    log.NewLogger(log.Error),
+			UpdatesCh: updatesCh,
+			Clock:     clockMock,
+		},
+		lscs: map[string]lstreamClient{
+			"a": &fakeLStreamClient{},
+			"b": &fakeLStreamClient{},
+			"c": &fakeLStreamClient{},
+			"d": &fakeLStreamClient{},
+		},
+		curQueryLogsCtx: &manQueryLogsCtx{
+			req:   &QueryLogsParams{MaxNumLines: 10},
+			resps: map[string]*LogResp{},
+			errs:  map[string]error{},
+		},
+	}
+	ctx := lsman.curQueryLogsCtx
+
+	// The first partial response is sent right away.
+	ctx.resps["a"] = &LogResp{}
+	lsman.schedulePartialLogResp()
+	assert.Len(t, updatesCh, 1)
+	resp := (<-updatesCh).LogResp
+	assert.Equal(t, 3, resp.NumPendingLStreams)
+	assert.True(t, resp.First)
+	assert.Nil(t, ctx.getPartialCh())
+
+	// The next ones, coming too soon, are held back and merged together.
+	ctx.resps["b"] = &LogResp{}
+	lsman.schedulePartialLogResp()
+	ctx.resps["c"] = &LogResp{}
+	lsman.schedulePartialLogResp()
+	assert.Len(t, updatesCh, 0)
+
+	partialCh := ctx.getPartialCh()
+	if assert.NotNil(t, partialCh) {
+		clockMock.Add(partialLogRespInterval)
+		<-partialCh
+		lsman.sendPartialLogResp()
+	}
+
+	assert.Len(t, updatesCh, 1)
+	resp = (<-updatesCh).LogResp
+	assert.Equal(t, 1, resp.NumPendingLStreams)
+	assert.False(t, resp.First)
+	assert.Nil(t, ctx.getPartialCh())
+}
@@ -2,7 +2,9 @@ package core
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/dimonomid/nerdlog/shellescape"
 	"github.com/dimonomid/ssh_config"
@@ -23,6 +25,11 @@ type LStreamsResolverParams struct {
 	// ~/.config/nerdlog/logstreams.yaml.
 	ConfigLogStreams ConfigLogStreams
 
+	// ConfigLStreamGroups contains the groups of logstreams, typically coming
+	// from the same ~/.config/nerdlog/logstreams.yaml. Group names in the
+	// logstreams spec are expanded to the group members.
+	ConfigLStreamGroups ConfigLStreamGroups
+
 	// SSHConfig is the general SSH config, typically coming from ~/.ssh/config
 	SSHConfig *ssh_config.Config
 }
@@ -46,6 +53,11 @@ type LogStream struct {
 	// the logstream.
 	Transport ConfigLogStreamShellTransport
 
+	// HTTP, if not nil, means that the logstream is queried from an HTTP log
+	// API instead of the shell; in this case, Transport and LogFiles are not
+	// used.
+	HTTP *ConfigLogStreamHTTP
+
 	// LogFiles contains a list of files which are part of the logstream, like
 	// ["/var/log/syslog", "/var/log/syslog.1"]. The [0]th item is the latest log
 	// file [1]st is the previous one, etc. One special case here is journalctl:
@@ -55,12 +67,22 @@ type LogStream struct {
 	// It must contain at least a single item, otherwise LogStream is invalid.
 	LogFiles []string
 
+	// MergeInto, if not empty, is the name of the logstream this one is merged
+	// into: it's one of its ConfigLogStream.MergeLogFiles, so the duplicate
+	// messages are dropped when merging them; see dedupMergedLogs.
+	MergeInto string
+
 	Options LogStreamOptions
 }
 
 type ConfigLogStreamShellTransportSSH struct {
 	Host     ConfigHost
 	Jumphost *ConfigHost
+
+	// ProxyCommand, if not empty, is the command to connect through; see
+	// ConfigLogStream.ProxyCommand. The placeholders in it are not expanded
+	// yet.
+	ProxyCommand string
 }
 
 type ConfigLogStreamShellTransportLocalhost struct {
@@ -80,6 +102,34 @@ type LogStreamOptions struct {
 	// custom env vars for tests, like: "export TZ=America/New_York", but
 	// might be useful outside of tests as well.
 	ShellInit []string
+
+	// FieldAliases maps a canonical field name to the list of actual field
+	// names used by this logstream. See ConfigLogStreamOptions.FieldAliases.
+	FieldAliases map[string][]string
+
+	// TimestampLayout is a Go-style time layout of the timestamps in the log
+	// lines. If empty, the layout is autodetected.
+	TimestampLayout string
+
+	// LogFormat is the format of the log lines; if LogFormatAuto, it's
+	// autodetected.
+	LogFormat LogFormat
+
+	// KeepaliveInterval and IdleTimeout: see ConfigLogStreamOptions.
+	KeepaliveInterval time.Duration
+	IdleTimeout       time.Duration
+
+	// DefaultQuery: see ConfigLogStreamOptions.
+	DefaultQuery string
+
+	// StripANSI: see ConfigLogStreamOptions.
+	StripANSI bool
+
+	// ListFields: see ConfigLogStreamOptions.
+	ListFields map[string]string
+
+	// ExpectQuiet: see ConfigLogStreamOptions.
+	ExpectQuiet bool
 }
 
 // SudoMode can be used to configure nerdlog to read log files with "sudo -n".
@@ -148,6 +198,11 @@ func (ls LogStream) LogFilePrev() (string, bool) {
 // - "myuser@myserver.com:22"
 // - "myuser@myserver.com"
 // - "myserver.com"
+// - "myserver.com:22:'/var/log/my app, v2.log'"
+//
+// Multiple entries are separated by commas. Single quotes, double quotes and
+// backslash escapes work like in a shell (see shellescape.Parse), so e.g. file
+// paths can contain spaces and commas.
 func (r *LStreamsResolver) Resolve(lstreamsStr string) (map[string]LogStream, error) {
 	lstreamsStr = strings.TrimSpace(lstreamsStr)
 
@@ -159,8 +214,13 @@ func (r *LStreamsResolver) Resolve(lstreamsStr string) (map[string]LogStream, er
 		return parsedLogStreams, nil
 	}
 
-	// TODO: when json is supported, splitting by commas will need to be improved.
-	parts := strings.Split(lstreamsStr, ",")
+	// Commas can be quoted or escaped, e.g. to be used in log file paths; the
+	// quotes are then handled when parsing every individual entry.
+	parts, err := shellescape.Split(lstreamsStr, ',')
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	for i, part := range parts {
 		part = strings.TrimSpace(part)
 
@@ -168,6 +228,15 @@ func (r *LStreamsResolver) Resolve(lstreamsStr string) (map[string]LogStream, er
 			return nil, errors.Errorf("entry #%d is empty", i+1)
 		}
 
+		parts[i] = part
+	}
+
+	parts, err = r.params.ConfigLStreamGroups.Expand(parts)
+	if err != nil {
+		return nil, errors.Annotatef(err, "expanding groups")
+	}
+
+	for i, part := range parts {
 		cfs, err := r.parseLogStreamSpecEntry(part)
 		if err != nil {
 			return nil, errors.Annotatef(err, "parsing entry #%d (%s)", i+1, part)
@@ -187,14 +256,56 @@ func (r *LStreamsResolver) Resolve(lstreamsStr string) (map[string]LogStream, er
 	return parsedLogStreams, nil
 }
 
+// KnownLStreams returns the sorted names of all the logstreams and groups
+// known from the nerdlog config and the ssh config, which can be used in the
+// logstreams spec as is. Glob patterns from the ssh config are not included.
+func (r *LStreamsResolver) KnownLStreams() ([]string, error) {
+	lsConfigFromSSHConfig, err := sshConfigToLSConfig(r.params.SSHConfig)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing ssh config")
+	}
+
+	namesSet := map[string]struct{}{}
+	for name := range r.params.ConfigLogStreams {
+		namesSet[name] = struct{}{}
+	}
+	for name := range r.params.ConfigLStreamGroups {
+		namesSet[name] = struct{}{}
+	}
+	for name := range lsConfigFromSSHConfig {
+		namesSet[name] = struct{}{}
+	}
+
+	names := make([]string, 0, len(namesSet))
+	for name := range namesSet {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
 // draftLogStream is a draft version of LogStream; it's used as temporary
 // storage in the process of resolving logstreams.
 type draftLogStream struct {
-	name     string
-	host     ConfigHost
+	name string
+	host ConfigHost
+
+	// hostGlob, if not empty, is the hostname as a glob pattern to match the
+	// config keys against: unlike the hostname in the host, the glob
+	// metacharacters which were quoted or escaped in the logstream spec are
+	// escaped here, so they only match literally.
+	hostGlob string
+
 	jumphost *ConfigHost
 	logFiles []string
-	options  LogStreamOptions
+
+	proxyCommand string
+	options      LogStreamOptions
+	http         *ConfigLogStreamHTTP
+
+	mergeLogFiles []string
 }
 
 // parseLogStreamSpecEntry parses a single logstream spec entry like
@@ -210,12 +321,20 @@ func (r *LStreamsResolver) parseLogStreamSpecEntry(s string) ([]LogStream, error
 		return nil, errors.Trace(err)
 	}
 
+	// The same parts, but with the quoted glob metacharacters escaped, so that
+	// they're matched literally; see draftLogStream.hostGlob.
+	globParts, err := shellescape.ParseGlob(s)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	var plstream *parsedLStream
+	var hostGlob string
 	var jhconf *ConfigHost
 	var logFiles []string
 
 	curFlag := ""
-	for _, part := range parts {
+	for i, part := range parts {
 		if curFlag == "" && len(part) > 0 && part[0] == '-' {
 			curFlag = part
 			continue
@@ -223,24 +342,10 @@ func (r *LStreamsResolver) parseLogStreamSpecEntry(s string) ([]LogStream, error
 
 		switch curFlag {
 		case "-J", "--jumphost":
-			jhparsed, err := r.parseLStreamStr(part)
+			var err error
+			jhconf, err = r.parseJumphostStr(part)
 			if err != nil {
-				return nil, errors.Annotatef(err, "parsing %q as a jumphost", part)
-			}
-
-			//if jhparsed.logFileLast != "" || jhparsed.logFilePrev != "" {
-			//return nil, errors.Annotatef(err, "jumphost config shouldn't contain files")
-			//}
-
-			jhPort := jhparsed.port
-
-			if len(jhparsed.colonParts) > 1 {
-				return nil, errors.Errorf("parsing %q as a jumphost: too many colons", part)
-			}
-
-			jhconf = &ConfigHost{
-				Addr: fmt.Sprintf("%s:%s", jhparsed.hostname, jhPort),
-				User: jhparsed.user,
+				return nil, errors.Trace(err)
 			}
 
 		case "":
@@ -250,6 +355,13 @@ func (r *LStreamsResolver) parseLogStreamSpecEntry(s string) ([]LogStream, error
 				return nil, errors.Annotatef(err, "parsing %q as a logstream", part)
 			}
 
+			globPlstream, err := r.parseLStreamStr(globParts[i])
+			if err != nil {
+				return nil, errors.Annotatef(err, "parsing %q as a logstream", part)
+			}
+
+			hostGlob = globPlstream.hostname
+
 			if len(plstream.colonParts) > 0 {
 				logFiles = append(logFiles, plstream.colonParts[0])
 			}
@@ -280,13 +392,14 @@ func (r *LStreamsResolver) parseLogStreamSpecEntry(s string) ([]LogStream, error
 				Addr: fmt.Sprintf("%s:%s", plstream.hostname, plstream.port),
 				User: plstream.user,
 			},
+			hostGlob: hostGlob,
 			jumphost: jhconf,
 
 			logFiles: logFiles,
 		},
 	}
 
-	lstreams, err = expandFromLogStreamsConfig(lstreams, r.params.ConfigLogStreams)
+	lstreams, err = r.expandFromLogStreamsConfig(lstreams, r.params.ConfigLogStreams)
 	if err != nil {
 		return nil, errors.Annotatef(err, "expanding from nerdlog config")
 	}
@@ -296,7 +409,7 @@ func (r *LStreamsResolver) parseLogStreamSpecEntry(s string) ([]LogStream, error
 		return nil, errors.Annotatef(err, "parsing ssh config")
 	}
 
-	lstreams, err = expandFromLogStreamsConfig(lstreams, lsConfigFromSSHConfig)
+	lstreams, err = r.expandFromLogStreamsConfig(lstreams, lsConfigFromSSHConfig)
 	if err != nil {
 		return nil, errors.Annotatef(err, "expanding from ssh config")
 	}
@@ -312,7 +425,12 @@ func (r *LStreamsResolver) parseLogStreamSpecEntry(s string) ([]LogStream, error
 		// TODO: would perhaps be useful to implement a function like IsValidDialAddress,
 		// which checks a bunch of other things, but for now, a single asterisk check
 		// will do.
-		if strings.Contains(ls.host.Addr, "*") {
+		pattern := ls.hostGlob
+		if pattern == "" {
+			pattern = ls.host.Addr
+		}
+
+		if hasGlobWildcard(pattern) {
 			return nil, errors.Errorf("glob %q didn't match anything (having address %q)", s, ls.host.Addr)
 		}
 	}
@@ -339,8 +457,9 @@ func (r *LStreamsResolver) parseLogStreamSpecEntry(s string) ([]LogStream, error
 			// Use ssh
 			transport = ConfigLogStreamShellTransport{
 				SSH: &ConfigLogStreamShellTransportSSH{
-					Host:     ls.host,
-					Jumphost: ls.jumphost,
+					Host:         ls.host,
+					Jumphost:     ls.jumphost,
+					ProxyCommand: ls.proxyCommand,
 				},
 			}
 		}
@@ -348,14 +467,35 @@ func (r *LStreamsResolver) parseLogStreamSpecEntry(s string) ([]LogStream, error
 		ret = append(ret, LogStream{
 			Name:      ls.name,
 			Transport: transport,
+			HTTP:      ls.http,
 			LogFiles:  ls.logFiles,
 			Options:   ls.options,
 		})
+
+		// Every merged file becomes a separate logstream on the same host, so
+		// it's queried in parallel, and then merged by the LStreamsManager.
+		if ls.http == nil {
+			for _, logFile := range ls.mergeLogFiles {
+				ret = append(ret, LogStream{
+					Name:      getMergedLStreamName(ls.name, logFile),
+					Transport: transport,
+					LogFiles:  []string{logFile, "auto"},
+					MergeInto: ls.name,
+					Options:   ls.options,
+				})
+			}
+		}
 	}
 
 	return ret, nil
 }
 
+// getMergedLStreamName returns the name of the logstream for one of the
+// ConfigLogStream.MergeLogFiles, like "myapp+/var/log/app.err".
+func getMergedLStreamName(lstreamName, logFile string) string {
+	return lstreamName + "+" + logFile
+}
+
 type parsedLStream struct {
 	hostname string
 	user     string
@@ -364,6 +504,61 @@ type parsedLStream struct {
 	colonParts []string
 }
 
+// hasGlobWildcard returns whether the glob pattern contains an unescaped
+// "*", i.e. it was clearly intended to match something.
+func hasGlobWildcard(pattern string) bool {
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseJumphostStr parses the jumphost spec like "user@bastion:22", where
+// the user and port are optional. Just like the logstreams, the jumphost can
+// be a Host alias from the ssh config, in which case its HostName, and also
+// User and Port unless given explicitly, are taken from there.
+func (r *LStreamsResolver) parseJumphostStr(s string) (*ConfigHost, error) {
+	jhparsed, err := r.parseLStreamStr(s)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing %q as a jumphost", s)
+	}
+
+	// One colon part is tolerated and ignored, for compatibility: it used to
+	// be parsed just like a logstream, with a log file after the port.
+	if len(jhparsed.colonParts) > 1 {
+		return nil, errors.Errorf("parsing %q as a jumphost: too many colons", s)
+	}
+
+	hostname, port, user := jhparsed.hostname, jhparsed.port, jhparsed.user
+	if sshConfig := r.params.SSHConfig; sshConfig != nil {
+		if v, _ := sshConfig.Get(jhparsed.hostname, "HostName"); v != "" {
+			hostname = v
+		}
+
+		if v, _ := sshConfig.Get(jhparsed.hostname, "Port"); v != "" && port == "" {
+			port = v
+		}
+
+		if v, _ := sshConfig.Get(jhparsed.hostname, "User"); v != "" && user == "" {
+			user = v
+		}
+	}
+
+	return &ConfigHost{
+		Addr: fmt.Sprintf("%s:%s", hostname, port),
+		User: user,
+	}, nil
+}
+
 func (r *LStreamsResolver) parseLStreamStr(s string) (*parsedLStream, error) {
 	// Parsing the logstream descriptor like
 	// "user@hostname:/path/to/logfile:/path/to/logfile.1"
@@ -411,7 +606,7 @@ type ConfigLogStreamWKey struct {
 
 // expandFromLogStreamsConfig goes through each of the logstreams, and
 // potentially expands every item as per the provided config.
-func expandFromLogStreamsConfig(
+func (r *LStreamsResolver) expandFromLogStreamsConfig(
 	logStreams []draftLogStream,
 	lsConfig ConfigLogStreams,
 ) ([]draftLogStream, error) {
@@ -431,6 +626,10 @@ func expandFromLogStreamsConfig(
 		}
 
 		globPattern := addr.host
+		if ls.hostGlob != "" {
+			globPattern = ls.hostGlob
+		}
+
 		matcher, err := glob.Compile(globPattern)
 		if err != nil {
 			return nil, errors.Annotatef(err, "logstream #%d, parsing hostname %q as a glob pattern", i+1, addr.host)
@@ -457,7 +656,10 @@ func expandFromLogStreamsConfig(
 			addrCopy := addr
 
 			// Always override the name with the key from the config.
-			lsCopy.name = strings.Replace(lsCopy.name, globPattern, matchedItem.Key, -1)
+			lsCopy.name = strings.Replace(lsCopy.name, addr.host, matchedItem.Key, -1)
+
+			// The host is resolved now, so it's not a glob anymore.
+			lsCopy.hostGlob = ""
 
 			// Overwrite the host address (since what we've had might be a glob):
 			// either with the Hostname if it's specified explicitly, or if not, then
@@ -486,10 +688,71 @@ func expandFromLogStreamsConfig(
 				lsCopy.options.ShellInit = matchedItem.Options.ShellInit
 			}
 
+			if lsCopy.options.FieldAliases == nil {
+				lsCopy.options.FieldAliases = matchedItem.Options.FieldAliases
+			}
+
+			if lsCopy.options.TimestampLayout == "" {
+				lsCopy.options.TimestampLayout = matchedItem.Options.TimestampLayout
+			}
+
+			if lsCopy.options.LogFormat == LogFormatAuto {
+				lsCopy.options.LogFormat, err = ParseLogFormat(matchedItem.Options.LogFormat)
+				if err != nil {
+					return nil, errors.Annotatef(err, "logstream %s", matchedItem.Key)
+				}
+			}
+
+			if lsCopy.options.KeepaliveInterval == 0 {
+				lsCopy.options.KeepaliveInterval = matchedItem.Options.KeepaliveInterval
+			}
+
+			if lsCopy.options.IdleTimeout == 0 {
+				lsCopy.options.IdleTimeout = matchedItem.Options.IdleTimeout
+			}
+
+			if lsCopy.options.DefaultQuery == "" {
+				lsCopy.options.DefaultQuery = matchedItem.Options.DefaultQuery
+			}
+
+			if !lsCopy.options.StripANSI {
+				lsCopy.options.StripANSI = matchedItem.Options.StripANSI
+			}
+
+			if lsCopy.options.ListFields == nil {
+				lsCopy.options.ListFields = matchedItem.Options.ListFields
+			}
+
+			if !lsCopy.options.ExpectQuiet {
+				lsCopy.options.ExpectQuiet = matchedItem.Options.ExpectQuiet
+			}
+
 			if len(lsCopy.logFiles) == 0 {
 				lsCopy.logFiles = matchedItem.LogFiles
 			}
 
+			if lsCopy.http == nil {
+				lsCopy.http = matchedItem.HTTP
+			}
+
+			if lsCopy.mergeLogFiles == nil {
+				lsCopy.mergeLogFiles = matchedItem.MergeLogFiles
+			}
+
+			// The jumphost and the proxy command both say how to reach the host, so
+			// they're overridden together: e.g. an explicit -J jumphost must not be
+			// bypassed by the ProxyCommand from the ssh config.
+			if lsCopy.jumphost == nil && lsCopy.proxyCommand == "" {
+				if matchedItem.ProxyCommand != "" {
+					lsCopy.proxyCommand = matchedItem.ProxyCommand
+				} else if matchedItem.Jumphost != "" {
+					lsCopy.jumphost, err = r.parseJumphostStr(matchedItem.Jumphost)
+					if err != nil {
+						return nil, errors.Annotatef(err, "logstream %s", matchedItem.Key)
+					}
+				}
+			}
+
 			lsCopy.host.Addr = fmt.Sprintf("%s:%s", addrCopy.host, addrCopy.port)
 
 			ret = append(ret, lsCopy)
@@ -522,6 +785,19 @@ func setLogStreamsDefaults(
 			ls.host.User = osUser
 		}
 
+		if ls.jumphost != nil {
+			jh := *ls.jumphost
+			if strings.HasSuffix(jh.Addr, ":") {
+				jh.Addr += "22"
+			}
+
+			if jh.User == "" {
+				jh.User = osUser
+			}
+
+			ls.jumphost = &jh
+		}
+
 		if len(ls.logFiles) == 0 {
 			// Will be autodetected by the agent script.
 			ls.logFiles = append(ls.logFiles, "auto")
@@ -604,16 +880,38 @@ func sshConfigToLSConfig(sshConfig *ssh_config.Config) (ConfigLogStreams, error)
 		hostname, _ := sshConfig.Get(name, "HostName")
 		port, _ := sshConfig.Get(name, "Port")
 		user, _ := sshConfig.Get(name, "User")
+		proxyJump, _ := sshConfig.Get(name, "ProxyJump")
+		proxyCommand, _ := sshConfig.Get(name, "ProxyCommand")
+
+		// "none" disables these, just like in ssh itself.
+		if strings.EqualFold(proxyJump, "none") {
+			proxyJump = ""
+		}
+
+		if strings.EqualFold(proxyCommand, "none") {
+			proxyCommand = ""
+		}
+
+		if strings.Contains(proxyJump, ",") {
+			return nil, errors.Errorf(
+				"host %s: ProxyJump with multiple jumphosts (%s) is not supported", name, proxyJump,
+			)
+		}
+
+		// Jumphosts in the ssh config might be URIs like "ssh://user@host:22".
+		proxyJump = strings.TrimPrefix(proxyJump, "ssh://")
 
-		if hostname == "" && port == "" && user == "" {
+		if hostname == "" && port == "" && user == "" && proxyJump == "" && proxyCommand == "" {
 			// We can't get anything useful out of this entry anyway, so don't add it
 			continue
 		}
 
 		ret[name] = ConfigLogStream{
-			Hostname: hostname,
-			Port:     port,
-			User:     user,
+			Hostname:     hostname,
+			Port:         port,
+			User:         user,
+			Jumphost:     proxyJump,
+			ProxyCommand: proxyCommand,
 		}
 	}
 
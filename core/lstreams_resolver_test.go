@@ -4,6 +4,7 @@ import (
 	"bytes"
 	_ "embed"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/dimonomid/ssh_config"
@@ -93,8 +94,9 @@ type resolverTestCase struct {
 	// osUser is the current OS username
 	osUser string
 
-	configLogStreams ConfigLogStreams
-	sshConfig        *ssh_config.Config
+	configLogStreams    ConfigLogStreams
+	configLStreamGroups ConfigLStreamGroups
+	sshConfig           *ssh_config.Config
 
 	// input is the logstream spec string that we're feeding to Resolve()
 	input string
@@ -107,9 +109,10 @@ func runResolverTestCase(t *testing.T, tc resolverTestCase) {
 	t.Helper()
 
 	resolver := NewLStreamsResolver(LStreamsResolverParams{
-		CurOSUser:        tc.osUser,
-		ConfigLogStreams: tc.configLogStreams,
-		SSHConfig:        tc.sshConfig,
+		CurOSUser:           tc.osUser,
+		ConfigLogStreams:    tc.configLogStreams,
+		ConfigLStreamGroups: tc.configLStreamGroups,
+		SSHConfig:           tc.sshConfig,
 	})
 
 	gotStreams, err := resolver.Resolve(tc.input)
@@ -342,6 +345,43 @@ func TestLStreamsResolverMultipleEntriesNoGlob(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:   "quoted comma and space in the log file",
+			osUser: "osuser",
+			input:  `foo.com:22:'/var/log/my app, v2.log', bar.com:22:/var/log/x\,y.log`,
+			wantStreams: map[string]LogStream{
+				"foo.com:22:'/var/log/my app, v2.log'": {
+					Name: "foo.com:22:'/var/log/my app, v2.log'",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "foo.com:22",
+								User: "osuser",
+							},
+						},
+					},
+					LogFiles: []string{"/var/log/my app, v2.log", "auto"},
+				},
+				`bar.com:22:/var/log/x\,y.log`: {
+					Name: `bar.com:22:/var/log/x\,y.log`,
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "bar.com:22",
+								User: "osuser",
+							},
+						},
+					},
+					LogFiles: []string{"/var/log/x,y.log", "auto"},
+				},
+			},
+		},
+		{
+			name:    "unfinished quote",
+			osUser:  "osuser",
+			input:   "foo.com:22:'/var/log/a.log, bar.com",
+			wantErr: "unfinished single quote",
+		},
 		{
 			name:    "second entry is empty",
 			osUser:  "osuser",
@@ -873,6 +913,41 @@ func TestLStreamsResolverGlobOnlyNerdlogConfig(t *testing.T) {
 
 			wantErr: "parsing entry #1 (mismatching-*): glob \"mismatching-*\" didn't match anything (having address \"mismatching-*:22\")",
 		},
+
+		{
+			name:   "quoted and escaped wildcards match literally",
+			osUser: "osuser",
+
+			configLogStreams: testConfigLogStreams1,
+			input:            `'myhost-*', myhost-0\?`,
+
+			wantStreams: map[string]LogStream{
+				"'myhost-*'": {
+					Name: "'myhost-*'",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "myhost-*:22",
+								User: "osuser",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+				},
+				`myhost-0\?`: {
+					Name: `myhost-0\?`,
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "myhost-0?:22",
+								User: "osuser",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1378,3 +1453,352 @@ func TestLStreamsResolverShellInit(t *testing.T) {
 		})
 	}
 }
+
+func TestLStreamsResolverMergeLogFiles(t *testing.T) {
+	transport := ConfigLogStreamShellTransport{
+		SSH: &ConfigLogStreamShellTransportSSH{
+			Host: ConfigHost{
+				Addr: "myapp.com:22",
+				User: "osuser",
+			},
+		},
+	}
+
+	tests := []resolverTestCase{
+		{
+			name:   "merged files become separate logstreams",
+			osUser: "osuser",
+
+			configLogStreams: ConfigLogStreams(map[string]ConfigLogStream{
+				"myapp": {
+					Hostname:      "myapp.com",
+					LogFiles:      []string{"/var/log/app.log"},
+					MergeLogFiles: []string{"/var/log/app.err"},
+				},
+			}),
+
+			input: "myapp",
+
+			wantStreams: map[string]LogStream{
+				"myapp": {
+					Name:      "myapp",
+					Transport: transport,
+					LogFiles:  []string{"/var/log/app.log", "auto"},
+				},
+				"myapp+/var/log/app.err": {
+					Name:      "myapp+/var/log/app.err",
+					Transport: transport,
+					LogFiles:  []string{"/var/log/app.err", "auto"},
+					MergeInto: "myapp",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runResolverTestCase(t, tt)
+		})
+	}
+}
+
+func TestLStreamsResolverJumphost(t *testing.T) {
+	sshConfig, err := ssh_config.Decode(strings.NewReader(`
+Host behind-bastion
+  HostName 10.0.0.5
+  ProxyJump ops@bastion.example.com:2222
+
+Host behind-proxy
+  ProxyCommand ssh -W %h:%p bastion
+
+Host bastion-alias
+  HostName bastion.internal
+  User jump
+  Port 2200
+
+Host behind-alias
+  HostName 10.0.0.7
+  ProxyJump bastion-alias
+`), false)
+	assert.NoError(t, err)
+
+	tests := []resolverTestCase{
+		{
+			name:   "jumphost from the nerdlog config",
+			osUser: "osuser",
+
+			configLogStreams: ConfigLogStreams(map[string]ConfigLogStream{
+				"private": {
+					Hostname: "10.0.0.6",
+					Jumphost: "bastion.example.com",
+				},
+			}),
+
+			input: "private",
+
+			wantStreams: map[string]LogStream{
+				"private": {
+					Name: "private",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "10.0.0.6:22",
+								User: "osuser",
+							},
+							Jumphost: &ConfigHost{
+								Addr: "bastion.example.com:22",
+								User: "osuser",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+				},
+			},
+		},
+		{
+			name:   "ProxyJump and ProxyCommand from the ssh config",
+			osUser: "osuser",
+
+			sshConfig: sshConfig,
+
+			input: "behind-bastion, behind-proxy",
+
+			wantStreams: map[string]LogStream{
+				"behind-bastion": {
+					Name: "behind-bastion",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "10.0.0.5:22",
+								User: "osuser",
+							},
+							Jumphost: &ConfigHost{
+								Addr: "bastion.example.com:2222",
+								User: "ops",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+				},
+				"behind-proxy": {
+					Name: "behind-proxy",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "behind-proxy:22",
+								User: "osuser",
+							},
+							ProxyCommand: "ssh -W %h:%p bastion",
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+				},
+			},
+		},
+		{
+			name:   "ProxyJump alias resolved through the ssh config",
+			osUser: "osuser",
+
+			sshConfig: sshConfig,
+
+			input: "behind-alias",
+
+			wantStreams: map[string]LogStream{
+				"behind-alias": {
+					Name: "behind-alias",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "10.0.0.7:22",
+								User: "osuser",
+							},
+							Jumphost: &ConfigHost{
+								Addr: "bastion.internal:2200",
+								User: "jump",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+				},
+			},
+		},
+		{
+			name:   "the -J flag overrides the config",
+			osUser: "osuser",
+
+			configLogStreams: ConfigLogStreams(map[string]ConfigLogStream{
+				"private": {
+					Jumphost: "bastion.example.com",
+				},
+			}),
+
+			input: "-J other@bastion2:23 private",
+
+			wantStreams: map[string]LogStream{
+				"-J other@bastion2:23 private": {
+					Name: "-J other@bastion2:23 private",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "private:22",
+								User: "osuser",
+							},
+							Jumphost: &ConfigHost{
+								Addr: "bastion2:23",
+								User: "other",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+				},
+			},
+		},
+		{
+			name:   "the -J flag overrides the ProxyCommand from the ssh config",
+			osUser: "osuser",
+
+			sshConfig: sshConfig,
+
+			input: "-J other@bastion2:23 behind-proxy",
+
+			wantStreams: map[string]LogStream{
+				"-J other@bastion2:23 behind-proxy": {
+					Name: "-J other@bastion2:23 behind-proxy",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "behind-proxy:22",
+								User: "osuser",
+							},
+							Jumphost: &ConfigHost{
+								Addr: "bastion2:23",
+								User: "other",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+				},
+			},
+		},
+		{
+			name:   "the nerdlog config jumphost overrides the ssh config ProxyCommand",
+			osUser: "osuser",
+
+			configLogStreams: ConfigLogStreams(map[string]ConfigLogStream{
+				"behind-proxy": {
+					Jumphost: "bastion.example.com",
+				},
+			}),
+			sshConfig: sshConfig,
+
+			input: "behind-proxy",
+
+			wantStreams: map[string]LogStream{
+				"behind-proxy": {
+					Name: "behind-proxy",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "behind-proxy:22",
+								User: "osuser",
+							},
+							Jumphost: &ConfigHost{
+								Addr: "bastion.example.com:22",
+								User: "osuser",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runResolverTestCase(t, tt)
+		})
+	}
+}
+
+func TestLStreamsResolverGroups(t *testing.T) {
+	groups := ConfigLStreamGroups{
+		"web":      {"foo-01", "foo-02"},
+		"prod-web": {"web", "bar-01"},
+		"all":      {"prod-web", "web", "foo-01"},
+	}
+
+	tests := []resolverTestCase{
+		{
+			name:   "nested groups with duplicates",
+			osUser: "osuser",
+
+			configLogStreams:    testConfigLogStreams1,
+			configLStreamGroups: groups,
+
+			input: "all",
+
+			wantStreams: map[string]LogStream{
+				"foo-01": {
+					Name: "foo-01",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "host-foo-from-nerdlog-config-01.com:2001",
+								User: "user-foo-from-nerdlog-config-01",
+							},
+						},
+					},
+					LogFiles: []string{"/from/nerdlog/config/foolog", "auto"},
+				},
+				"foo-02": {
+					Name: "foo-02",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "host-foo-from-nerdlog-config-02.com:2002",
+								User: "user-foo-from-nerdlog-config-02",
+							},
+						},
+					},
+					LogFiles: []string{"/from/nerdlog/config/foolog", "auto"},
+				},
+				"bar-01": {
+					Name: "bar-01",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "host-bar-from-nerdlog-config-01.com:22",
+								User: "user-bar-from-nerdlog-config-01",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runResolverTestCase(t, tt)
+		})
+	}
+}
+
+func TestConfigLStreamGroupsValidate(t *testing.T) {
+	assert.NoError(t, ConfigLStreamGroups{
+		"a": {"b", "host-1"},
+		"b": {"host-2"},
+	}.Validate())
+
+	assert.EqualError(t, ConfigLStreamGroups{
+		"a": {"b", "host-1"},
+		"b": {"c"},
+		"c": {"a"},
+	}.Validate(), "cyclic group reference: a -> b -> c -> a")
+
+	assert.EqualError(t, ConfigLStreamGroups{
+		"a": {"host-1", " "},
+	}.Validate(), "group a has an empty member")
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// FieldNameNamedQueries is the name of the context field which contains the
+// comma-separated names of the named queries a message matches; see
+// QueryLogsParams.NamedQueries. It's prefixed, so that it doesn't collide with
+// the fields parsed from the logs, like a "query" key of a JSON log line.
+const FieldNameNamedQueries = "nerdlog_query"
+
+// NamedQuery is one of the queries whose union is shown; see
+// QueryLogsParams.NamedQueries.
+type NamedQuery struct {
+	Name string
+
+	// Query is an awk pattern; it must be a simple one, see
+	// ValidateNamedQuery.
+	Query string
+}
+
+// ValidateNamedQuery checks that the query can be used as a named query: since
+// we need to find out which of the named queries every message matches, and
+// awk only tells us that it matches some, the named queries are also matched
+// on our side. So only the simple queries are supported: regexps, possibly
+// negated, joined with "&&", like "/foo/ && !/bar/".
+func ValidateNamedQuery(query string) error {
+	_, err := newNamedQueryMatcher(NamedQuery{Query: query})
+	return errors.Trace(err)
+}
+
+// namedQueryMatcher matches the messages against a single named query.
+type namedQueryMatcher struct {
+	name string
+
+	res    []*regexp.Regexp
+	negate []bool
+}
+
+func newNamedQueryMatcher(nq NamedQuery) (*namedQueryMatcher, error) {
+	if strings.TrimSpace(nq.Query) == "" {
+		return nil, errors.Errorf("query is empty")
+	}
+
+	terms, err := parseSimpleAwkQuery(nq.Query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	m := &namedQueryMatcher{name: nq.Name}
+	for _, term := range terms {
+		re, err := regexp.Compile(term.re)
+		if err != nil {
+			return nil, errors.Annotatef(err, "regexp /%s/", term.re)
+		}
+
+		m.res = append(m.res, re)
+		m.negate = append(m.negate, term.negate)
+	}
+
+	return m, nil
+}
+
+func (m *namedQueryMatcher) match(line string) bool {
+	for i, re := range m.res {
+		if re.MatchString(line) == m.negate[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newNamedQueryMatchers returns the matchers for all the given named queries.
+func newNamedQueryMatchers(nqs []NamedQuery) ([]*namedQueryMatcher, error) {
+	ret := make([]*namedQueryMatcher, 0, len(nqs))
+	for _, nq := range nqs {
+		m, err := newNamedQueryMatcher(nq)
+		if err != nil {
+			return nil, errors.Annotatef(err, "named query %s", nq.Name)
+		}
+
+		ret = append(ret, m)
+	}
+
+	return ret, nil
+}
+
+// tagNamedQueries sets the FieldNameNamedQueries context field of every
+// message to the names of the named queries it matches. Like awk, the
+// matchers look at the original log line.
+func tagNamedQueries(logs []LogMsg, matchers []*namedQueryMatcher) {
+	if len(matchers) == 0 {
+		return
+	}
+
+	var names []string
+	for i := range logs {
+		names = names[:0]
+		for _, m := range matchers {
+			if m.match(logs[i].OrigLine) {
+				names = append(names, m.name)
+			}
+		}
+
+		logs[i].Context[FieldNameNamedQueries] = strings.Join(names, ",")
+	}
+}
+
+// combineQueryAndNamedQueries returns the awk pattern which matches lines
+// matching the query and any of the named queries. The query can be empty.
+func combineQueryAndNamedQueries(query string, nqs []NamedQuery) string {
+	if len(nqs) == 0 {
+		return query
+	}
+
+	parts := make([]string, 0, len(nqs))
+	for _, nq := range nqs {
+		parts = append(parts, fmt.Sprintf("(%s)", nq.Query))
+	}
+
+	union := strings.Join(parts, " || ")
+	if query == "" {
+		return union
+	}
+
+	return fmt.Sprintf("(%s) && (%s)", query, union)
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagNamedQueries(t *testing.T) {
+	matchers, err := newNamedQueryMatchers([]NamedQuery{
+		{Name: "errors", Query: "/error/ && !/retrying/"},
+		{Name: "db", Query: `/\bdb\b/`},
+	})
+	assert.NoError(t, err)
+
+	newMsg := func(line string) LogMsg {
+		return LogMsg{
+			OrigLine: line,
+			Context:  map[string]string{"lstream": "host-1"},
+		}
+	}
+
+	logs := []LogMsg{
+		newMsg("foo error in db"),
+		newMsg("foo error, retrying db"),
+		newMsg("foo error"),
+		newMsg("dbx"),
+	}
+
+	tagNamedQueries(logs, matchers)
+
+	var got []string
+	for _, msg := range logs {
+		got = append(got, msg.Context[FieldNameNamedQueries])
+	}
+	assert.Equal(t, []string{"errors,db", "db", "errors", ""}, got)
+}
+
+func TestNamedQueryMatchersErrors(t *testing.T) {
+	for _, query := range []string{"", "$3 == 5", "/foo/ || /bar/", "/(foo/"} {
+		_, err := newNamedQueryMatchers([]NamedQuery{{Name: "q", Query: query}})
+		assert.Error(t, err, query)
+		assert.Error(t, ValidateNamedQuery(query), query)
+	}
+}
+
+func TestCombineQueryAndNamedQueries(t *testing.T) {
+	nqs := []NamedQuery{
+		{Name: "a", Query: "/foo/"},
+		{Name: "b", Query: "/bar/ && !/baz/"},
+	}
+
+	assert.Equal(t, "/x/", combineQueryAndNamedQueries("/x/", nil))
+	assert.Equal(t, "(/foo/) || (/bar/ && !/baz/)", combineQueryAndNamedQueries("", nqs))
+	assert.Equal(t, "(/x/) && ((/foo/) || (/bar/ && !/baz/))", combineQueryAndNamedQueries("/x/", nqs))
+}
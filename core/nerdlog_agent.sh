@@ -13,6 +13,10 @@ trap 'echo "exit_code:$?"' EXIT
 # Arguments:
 #
 # --from, --to: time in the format "2006-01-02-15:04".
+#
+# --line-range-file, --line-range-from, --line-range-to: if given (all
+#   together), the time range is ignored, and instead the given range of lines
+#   (both ends inclusive, starting from 1) is fetched from the given file.
 
 # Those numbers are supposed to go up as the query progresses; the Go app
 # will then be able to tell which node is the slowest and show info for it.
@@ -263,6 +267,22 @@ while [[ $# -gt 0 ]]; do
       refresh_index="1"
       shift # past argument
       ;;
+
+    --line-range-file)
+      line_range_file="$2"
+      shift # past argument
+      shift # past value
+      ;;
+    --line-range-from)
+      line_range_from="$2"
+      shift # past argument
+      shift # past value
+      ;;
+    --line-range-to)
+      line_range_to="$2"
+      shift # past argument
+      shift # past value
+      ;;
     -l|--max-num-lines)
       max_num_lines="$2"
       shift # past argument
@@ -325,6 +345,13 @@ if [[ $timestamp_until_precise != "" || $timestamp_until_seconds != "" || $skip_
   fi
 fi
 
+if [[ $line_range_file != "" || $line_range_from != "" || $line_range_to != "" ]]; then
+  if [[ "$line_range_file" == "" || "$line_range_from" == "" || "$line_range_to" == "" ]]; then
+    echo "error:--line-range-file, --line-range-from, --line-range-to should all be given together" 1>&2
+    exit 1
+  fi
+fi
+
 # Either use the provided current year and month (for tests), or get the actual ones.
 if [[ "$CUR_YEAR" == "" ]]; then
   CUR_YEAR="$(date +'%Y')"
@@ -394,10 +421,75 @@ if [[ "$logfile_prev" == "${SPECIAL_FILENAME_AUTO}" ]]; then
   fi
 fi
 
-# A simple hack to account for cases when /var/log/syslog.1 doesn't exist:
-# create an empty file and pretend that it's an empty log file.
-if [ ! -e "$logfile_prev" ] && [[ "$logfile_prev" != "${SPECIAL_FILENAME_JOURNALCTL}" ]]; then
+# Resolves the symlink (possibly a chain of them) to the actual file path; if
+# the path is not a symlink, it's printed unchanged. This way, if the symlink
+# gets switched to another file (e.g. app.log -> app.2024-06-01.log, and then
+# on rotation app.log -> app.2024-06-02.log) while we're running, we keep
+# reading the same file, and the resolved path is reported in the output.
+# Usage: resolve_symlink /path/to/file
+resolve_symlink() {
+  local path="$1"
+  if [ ! -L "$path" ]; then
+    echo "$path"
+    return 0
+  fi
+
+  local resolved
+  resolved="$(readlink -f "$path" 2>/dev/null)"
+  if [[ $? == 0 && "$resolved" != "" ]]; then
+    echo "$resolved"
+    return 0
+  fi
+
+  # Older MacOS doesn't support readlink -f, so follow the links manually.
+  local i
+  for (( i = 0; i < 32; i++ )); do
+    if [ ! -L "$path" ]; then
+      break
+    fi
+
+    local target
+    target="$(readlink "$path")" || break
+    if [[ "$target" != /* ]]; then
+      target="$(dirname "$path")/$target"
+    fi
+    path="$target"
+  done
+
+  echo "$path"
+}
+
+if [[ "$logfile_last" != "${SPECIAL_FILENAME_JOURNALCTL}" ]]; then
+  resolved="$(resolve_symlink "$logfile_last")"
+  if [[ "$resolved" != "$logfile_last" ]]; then
+    echo "debug:logfile $logfile_last resolved to $resolved" 1>&2
+    logfile_last="$resolved"
+  fi
+
+  resolved="$(resolve_symlink "$logfile_prev")"
+  if [[ "$resolved" != "$logfile_prev" ]]; then
+    echo "debug:prev logfile $logfile_prev resolved to $resolved" 1>&2
+    logfile_prev="$resolved"
+  fi
+fi
+
+if [[ "$line_range_file" != "" ]]; then
+  line_range_file="$(resolve_symlink "$line_range_file")"
+fi
+
+# A simple hack to account for cases when /var/log/syslog.1 doesn't exist (or
+# isn't readable, in which case we only query the last logfile and let the
+# client know that the results are incomplete): create an empty file and
+# pretend that it's an empty log file.
+if [[ "$1" == "query" && -e "$logfile_prev" && ! -r "$logfile_prev" ]]; then
+  echo "warning:$logfile_prev is not readable, only $logfile_last is queried" 1>&2
+  use_empty_prev=1
+elif [ ! -e "$logfile_prev" ] && [[ "$logfile_prev" != "${SPECIAL_FILENAME_JOURNALCTL}" ]]; then
   echo "debug:prev logfile $logfile_prev doesn't exist, using a dummy empty file /tmp/nerdlog-empty-file" 1>&2
+  use_empty_prev=1
+fi
+
+if [[ "$use_empty_prev" == 1 ]]; then
   # TODO: instead of using the same file /tmp/nerdlog-empty-file , maybe
   # generate the name based on the index filename, to make the tests more
   # self-contained.
@@ -489,9 +581,11 @@ case "${command}" in
         echo "warn_journalctl_no_admin_access" 1>&2
       fi
 
-      # And print one line for the timestamp format autodetection.
+      # And print one line for the timestamp format autodetection; also let the
+      # client know that it comes from journalctl, for the log format detection.
       last_line="$($journalctl_binary $JOURNALCTL_FORMAT_FLAG --quiet -n 1)" || exit 1
       echo "example_log_line:$last_line"
+      echo "example_log_source:journalctl"
     fi
 
     exit 0
@@ -518,6 +612,135 @@ function printPercentage(numCur, numTotal) {
 }
 '
 
+# The JSON field lookup used by the queries on the JSON logs, like
+# "level:error" or "http.status >= 500": nerdlog translates them into calls to
+# nerdlogJsonGet, so that the keys are matched properly regardless of the JSON
+# formatting and nesting.
+awk_func_json='
+  # nerdlogJsonSkipWs returns the index of the first non-space char in s,
+  # starting from i.
+  function nerdlogJsonSkipWs(s, i) {
+    match(substr(s, i), /^[ \t]*/);
+    return i + RLENGTH;
+  }
+
+  # nerdlogJsonSkipValue returns the index right after the JSON value which
+  # starts at the index i in s, or 0 if it is malformed.
+  function nerdlogJsonSkipValue(s, i,    c, depth) {
+    c = substr(s, i, 1);
+    if (c == "\"") {
+      if (!match(substr(s, i), /^"([^"\\]|\\.)*"/)) {
+        return 0;
+      }
+      return i + RLENGTH;
+    }
+
+    if (c != "{" && c != "[") {
+      match(substr(s, i), /^[^,}\] \t]*/);
+      return i + RLENGTH;
+    }
+
+    depth = 0;
+    while (i <= length(s)) {
+      c = substr(s, i, 1);
+      if (c == "\"") {
+        if (!match(substr(s, i), /^"([^"\\]|\\.)*"/)) {
+          return 0;
+        }
+        i += RLENGTH;
+        continue;
+      }
+
+      if (c == "{" || c == "[") {
+        depth++;
+      } else if (c == "}" || c == "]") {
+        depth--;
+        if (depth == 0) {
+          return i + 1;
+        }
+      }
+      i++;
+    }
+
+    return 0;
+  }
+
+  # nerdlogJsonGet looks up the value of the given key in the JSON object in
+  # the current line; the nested keys are joined with dots, like "http.status".
+  # If the key is found, it returns 1, and the value is in nerdlogJsonVal: the
+  # string values are unescaped, and the rest are as is, like "500" or "[1,2]".
+  # Otherwise, it returns 0.
+  function nerdlogJsonGet(path,    s, i, end, n, keys, k, key, val) {
+    s = $0;
+    i = index(s, "{");
+    if (!i) {
+      return 0;
+    }
+
+    n = split(path, keys, ".");
+    for (k = 1; k <= n; k++) {
+      if (substr(s, i, 1) != "{") {
+        return 0;
+      }
+
+      i++;
+      while (1) {
+        i = nerdlogJsonSkipWs(s, i);
+        if (!match(substr(s, i), /^"([^"\\]|\\.)*"/)) {
+          return 0;
+        }
+
+        key = substr(s, i + 1, RLENGTH - 2);
+        i = nerdlogJsonSkipWs(s, i + RLENGTH);
+        if (substr(s, i, 1) != ":") {
+          return 0;
+        }
+
+        i = nerdlogJsonSkipWs(s, i + 1);
+        if (key == keys[k]) {
+          break;
+        }
+
+        i = nerdlogJsonSkipValue(s, i);
+        if (!i) {
+          return 0;
+        }
+
+        i = nerdlogJsonSkipWs(s, i);
+        if (substr(s, i, 1) != ",") {
+          return 0;
+        }
+        i++;
+      }
+    }
+
+    end = nerdlogJsonSkipValue(s, i);
+    if (!end) {
+      return 0;
+    }
+
+    val = substr(s, i, end - i);
+    if (substr(val, 1, 1) == "\"") {
+      val = substr(val, 2, length(val) - 2);
+      if (index(val, "\\")) {
+        gsub(/\\\\/, "\001", val);
+        gsub(/\\"/, "\"", val);
+        gsub(/\\\//, "/", val);
+        gsub(/\\n/, "\n", val);
+        gsub(/\\t/, "\t", val);
+        gsub(/\001/, "\\", val);
+      }
+    }
+
+    if (val == "null") {
+      val = "";
+    }
+
+    nerdlogJsonVal = val;
+    return 1;
+  }
+'
+
 function run_awk_script_logfiles {
   awk_pattern=''
   if [[ "$user_pattern" != "" ]]; then
@@ -535,6 +758,7 @@ function run_awk_script_logfiles {
   # "<".
   awk_script='
   '$awk_func_print_percentage'
+  '$awk_func_json'
 
   BEGIN {
     bytenr=1; curline=0; maxlines='$max_num_lines'; lastPercent=0;
@@ -658,6 +882,7 @@ function run_awk_script_journalctl {
 
   awk_script='
   '$awk_func_print_percentage'
+  '$awk_func_json'
 
   # Takes timestamp in the same format as we use for --from and --to and
   # store in the index ("2006-01-02-15:04"), and returns the corresponding unix
@@ -790,6 +1015,11 @@ function run_awk_script_journalctl {
 
 user_pattern=$1
 
+if [[ "$logfile_last" == "${SPECIAL_FILENAME_JOURNALCTL}" && "$line_range_file" != "" ]]; then
+  echo "error:line ranges are not supported for journalctl" 1>&2
+  exit 1
+fi
+
 if [[ "$logfile_last" == "${SPECIAL_FILENAME_JOURNALCTL}" ]]; then
   echo "p:stage:$STAGE_QUERYING:querying logs:Note that journalctl can be SLOW. Consider using log files." 1>&2
 
@@ -892,6 +1122,24 @@ get_file_modtime() {
   esac
 }
 
+# A portable function to get file inode number.
+# Usage: get_file_inode /path/to/file
+get_file_inode() {
+  case $os_kind in
+    linux)
+      stat -c %i "$1"
+      ;;
+    macos|bsd)
+      stat -f %i "$1"
+      ;;
+    *)
+      echo "error:internal error: invalid os_kind '$os_kind'" 1>&2
+      return 1
+  esac
+}
+
+logfile_last_inode=$(get_file_inode $logfile_last) || exit 1
+
 logfile_prev_size=$(get_file_size $logfile_prev) || exit 1
 logfile_last_size=$(get_file_size $logfile_last) || exit 1
 total_size=$((logfile_prev_size+logfile_last_size)) || exit 1
@@ -1040,6 +1288,7 @@ function printIndexLine(outfile, timestr, linenr, bytenr) {
     echo "p:stage:$STAGE_INDEX_FULL:indexing from scratch" 1>&2
 
     echo "prevlog_modtime	$(get_file_modtime $logfile_prev)" > $indexfile
+    echo "lastlog_inode	$logfile_last_inode" >> $indexfile
 
     "$awk_binary" -b "$awk_functions BEGIN { $awk_vars lastHHMM=\"\"; }"'
   '"$script1"'
@@ -1136,10 +1385,88 @@ function get_prevlog_modtime_from_index() { # {{{
   fi
 } # }}}
 
+function get_lastlog_inode_from_index() { # {{{
+  if ! "$awk_binary" -F"\t" 'BEGIN { found=0 } $1 == "lastlog_inode" { print $2; found = 1; exit } END { if (found == 0) { exit 1 } }' $indexfile ; then
+    return 1
+  fi
+} # }}}
+
+# Checks whether $logfile_last is still the same file as when we started
+# (e.g. it wasn't rotated by renaming it and creating a new one in its place),
+# so that we don't mix lines from two different files. If it has changed, the
+# index is removed and an error is printed; returns 1 in this case.
+function check_lastlog_not_rotated() { # {{{
+  local cur_inode
+  cur_inode=$(get_file_inode $logfile_last 2>/dev/null)
+  if [[ "$cur_inode" != "$logfile_last_inode" ]]; then
+    rm -f $indexfile
+    echo "error:$logfile_last was rotated while querying, please try again" 1>&2
+    return 1
+  fi
+} # }}}
+
 function get_prevlog_bytenr() { # {{{
   get_file_size $logfile_prev
 } # }}}
 
+if [[ "$line_range_file" != "" ]]; then
+  # The line range mode: just get the requested lines from the file,
+  # regardless of their timestamps, so the index isn't needed at all.
+  if [ ! -r "$line_range_file" ]; then
+    echo "error:$line_range_file does not exist or is not readable" 1>&2
+    exit 1
+  fi
+
+  echo "p:stage:$STAGE_QUERYING:querying logs" 1>&2
+
+  # When loading earlier lines, --lines-until further limits the range.
+  line_range_to_eff=$line_range_to
+  if [[ "$lines_until" != "" && $(( lines_until - 1 < line_range_to )) == 1 ]]; then
+    line_range_to_eff=$(( lines_until - 1 ))
+  fi
+
+  num_lines=$(( line_range_to_eff - line_range_from + 1 ))
+  if [[ $(( num_lines <= 0 )) == 1 ]]; then
+    echo "p:stage:$STAGE_DONE:done" 1>&2
+    exit 0
+  fi
+
+  # We don't know how many bytes the range takes without reading it, so the
+  # percentage is calculated relative to the whole file size; it's not precise,
+  # but good enough for the progress indication.
+  num_bytes_to_scan=$(get_file_size "$line_range_file")
+  if [[ "$num_bytes_to_scan" == "" || "$num_bytes_to_scan" == 0 ]]; then
+    num_bytes_to_scan=1
+  fi
+
+  # The awk script prints both files and the number of lines in the prev one;
+  # since we only have one file here, make both of them the same, with zero
+  # lines in the "prev" one, so the line numbers are reported as is.
+  tail -n +$line_range_from "$line_range_file" | head -n $num_lines | \
+    user_pattern="$user_pattern"                          \
+    max_num_lines="$max_num_lines"                        \
+    num_bytes_to_scan="$num_bytes_to_scan"                \
+    lines_until_check=""                                  \
+    prevlog_lines="0"                                     \
+    from_linenr_int="$line_range_from"                    \
+    logfile_prev="$line_range_file"                       \
+    logfile_last="$line_range_file"                       \
+    run_awk_script_logfiles -
+
+  codes=(${PIPESTATUS[@]})
+  for status in "${codes[@]}"; do
+    # The exit code 141 means SIGPIPE + 128, which is what tail returns if
+    # head has already got enough lines and exited.
+    if [[ $status -ne 0 && $status -ne 141 ]]; then
+      exit 1
+    fi
+  done
+
+  echo "p:stage:$STAGE_DONE:done" 1>&2
+
+  exit 0
+fi
+
 is_outside_of_range=0
 if [[ "$from" != "" || "$to" != "" ]]; then
   # If indexfile exists, check if it's valid and relevant; if not, delete it.
@@ -1153,7 +1480,16 @@ if [[ "$from" != "" || "$to" != "" ]]; then
       rm -f $indexfile || exit 1
     fi
 
-    if ! get_prevlog_lines_from_index > /dev/null; then
+    # Also if $logfile_last is a different file now (rotated, or the symlink
+    # now points to another file), the index is irrelevant. Older indexes
+    # don't have the inode, and then we just keep them.
+    logfile_last_stored_inode="$(get_lastlog_inode_from_index)"
+    if [[ "$logfile_last_stored_inode" != "" && "$logfile_last_stored_inode" != "$logfile_last_inode" ]]; then
+      echo "debug:logfile $logfile_last has changed: stored inode '$logfile_last_stored_inode', actual '$logfile_last_inode', deleting index file" 1>&2
+      rm -f $indexfile || exit 1
+    fi
+
+    if [ -e "$indexfile" ] && ! get_prevlog_lines_from_index > /dev/null; then
       echo "debug:broken index file (no prevlog lines), deleting it" 1>&2
       rm -f $indexfile || exit 1
     fi
@@ -1360,4 +1696,6 @@ for status in "${codes[@]}"; do
   fi
 done
 
+check_lastlog_not_rotated || exit 1
+
 echo "p:stage:$STAGE_DONE:done" 1>&2
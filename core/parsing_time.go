@@ -132,6 +132,20 @@ func GetTimeFormatDescrFromLogLines(logLines []string) (*TimeFormatDescr, error)
 	return descrs[0], nil
 }
 
+// getTimestampLen returns the length of the timestamp in the given log line,
+// which is normally the length of the layout, except when the layout ends
+// with the offset like "Z07" or "Z07:00", but the actual timestamp is in UTC
+// and ends with just "Z". The returned length might be larger than the line.
+func getTimestampLen(timeLayout, line string) int {
+	zIdx := strings.Index(timeLayout, "Z07")
+	if zIdx >= 0 && len(line) > zIdx && line[zIdx] == 'Z' {
+		// We have a Z in the timestamp, so there should be no offset after it.
+		return zIdx + 1
+	}
+
+	return len(timeLayout)
+}
+
 // DetectTimeLayout tries to detect a time format from a log line.
 //
 // TODO: it's pretty simplistic and could be improved, even to avoid having
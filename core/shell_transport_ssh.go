@@ -69,7 +69,36 @@ func (st *ShellTransportSSH) doConnect(
 		return res
 	}
 
-	if connDetails.Jumphost != nil {
+	if connDetails.ProxyCommand != "" {
+		proxyCmd, err := expandProxyCommand(connDetails.ProxyCommand, connDetails.Host)
+		if err != nil {
+			res.Err = errors.Annotatef(err, "expanding proxy command")
+			return res
+		}
+
+		logger.Infof("Connecting via proxy command: %s", proxyCmd)
+		conn, err := dialProxyCommand(proxyCmd)
+		if err != nil {
+			res.Err = errors.Annotatef(err, "running proxy command")
+			return res
+		}
+
+		// Pipes don't support deadlines, so if the handshake hangs (e.g. the
+		// command waits for something), just kill the command.
+		timeoutTimer := time.AfterFunc(connectionTimeout, func() {
+			conn.Close()
+		})
+
+		authConn, chans, reqs, err := ssh.NewClientConn(conn, connDetails.Host.Addr, conf.ClientConfig)
+		timeoutTimer.Stop()
+		if err != nil {
+			conn.Close()
+			res.Err = errors.Annotatef(err, "%s (via proxy command%s)", conf.Descr, conn.stderrSuffix())
+			return res
+		}
+
+		sshClient = ssh.NewClient(authConn, chans, reqs)
+	} else if connDetails.Jumphost != nil {
 		logger.Infof("Connecting via jumphost")
 		// Use jumphost
 		jumphost, err := st.getJumphostClient(resCh, logger, connDetails.Jumphost)
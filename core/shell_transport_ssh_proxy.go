@@ -0,0 +1,196 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// expandProxyCommand replaces the placeholders in the ProxyCommand (see
+// ConfigLogStream.ProxyCommand) with the actual values for the given host.
+// The placeholders are the same as in the ssh config: the remote ones (%h,
+// %p, %r and %C) and the local ones (%l, %L, %u, %d and %i). Since the
+// original host alias isn't known here anymore, %n and %k are the same as %h.
+func expandProxyCommand(cmd string, host ConfigHost) (string, error) {
+	pa, err := parseAddr(host.Addr)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(cmd); i++ {
+		if cmd[i] != '%' {
+			sb.WriteByte(cmd[i])
+			continue
+		}
+
+		if i+1 == len(cmd) {
+			return "", errors.Errorf("trailing %% in %q", cmd)
+		}
+
+		i++
+		switch cmd[i] {
+		case 'h', 'n', 'k':
+			sb.WriteString(pa.host)
+		case 'p':
+			sb.WriteString(pa.port)
+		case 'r':
+			sb.WriteString(host.User)
+		case 'C':
+			// Same as in ssh: the hash of "%l%h%p%r".
+			hash := sha1.Sum([]byte(localHostname() + pa.host + pa.port + host.User))
+			sb.WriteString(hex.EncodeToString(hash[:]))
+		case 'l':
+			sb.WriteString(localHostname())
+		case 'L':
+			sb.WriteString(strings.SplitN(localHostname(), ".", 2)[0])
+		case 'u':
+			if u, err := user.Current(); err == nil {
+				sb.WriteString(u.Username)
+			}
+		case 'd':
+			if home, err := os.UserHomeDir(); err == nil {
+				sb.WriteString(home)
+			}
+		case 'i':
+			sb.WriteString(strconv.Itoa(os.Getuid()))
+		case '%':
+			sb.WriteByte('%')
+		default:
+			return "", errors.Errorf("unsupported placeholder %%%c in %q", cmd[i], cmd)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// localHostname returns the hostname of the local machine, or an empty
+// string if it can't be determined.
+func localHostname() string {
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// proxyCommandConn implements net.Conn on top of the stdin and stdout of the
+// proxy command.
+type proxyCommandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+
+	stderrMtx sync.Mutex
+	stderr    bytes.Buffer
+
+	closeOnce sync.Once
+}
+
+var _ net.Conn = &proxyCommandConn{}
+
+// dialProxyCommand starts the given command with /bin/sh, and returns the
+// connection talking to its stdin and stdout.
+func dialProxyCommand(command string) (*proxyCommandConn, error) {
+	conn := &proxyCommandConn{
+		cmd: exec.Command("/bin/sh", "-c", command),
+	}
+
+	conn.cmd.Stderr = &lockedWriter{mtx: &conn.stderrMtx, w: &conn.stderr}
+
+	var err error
+	conn.stdin, err = conn.cmd.StdinPipe()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	conn.stdout, err = conn.cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err := conn.cmd.Start(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return conn, nil
+}
+
+// stderrSuffix returns the stderr output of the command so far, formatted to
+// be appended to the error messages; it's usually the most useful part when
+// something goes wrong.
+func (c *proxyCommandConn) stderrSuffix() string {
+	c.stderrMtx.Lock()
+	defer c.stderrMtx.Unlock()
+
+	stderr := strings.TrimSpace(c.stderr.String())
+	if stderr == "" {
+		return ""
+	}
+
+	return ": " + stderr
+}
+
+func (c *proxyCommandConn) Read(b []byte) (int, error) {
+	return c.stdout.Read(b)
+}
+
+func (c *proxyCommandConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+func (c *proxyCommandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+
+		// Reap the process; its exit status doesn't matter at this point.
+		c.cmd.Wait()
+	})
+
+	return nil
+}
+
+func (c *proxyCommandConn) LocalAddr() net.Addr {
+	return proxyCommandAddr{}
+}
+
+func (c *proxyCommandConn) RemoteAddr() net.Addr {
+	return proxyCommandAddr{}
+}
+
+// Deadlines are not supported for pipes; ssh doesn't need them anyway.
+
+func (c *proxyCommandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *proxyCommandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *proxyCommandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type proxyCommandAddr struct{}
+
+func (proxyCommandAddr) Network() string { return "pipe" }
+func (proxyCommandAddr) String() string  { return "proxy command" }
+
+// lockedWriter is an io.Writer which locks the mutex around every write.
+type lockedWriter struct {
+	mtx *sync.Mutex
+	w   io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	return w.w.Write(p)
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandProxyCommand(t *testing.T) {
+	host := ConfigHost{Addr: "myhost.com:2222", User: "me"}
+
+	testCases := []struct {
+		cmd     string
+		want    string
+		wantErr string
+	}{
+		{cmd: "ssh -W %h:%p bastion", want: "ssh -W myhost.com:2222 bastion"},
+		{cmd: "connect %r@%h 100%%", want: "connect me@myhost.com 100%"},
+		{cmd: "ssh -W %n:%p bastion", want: "ssh -W myhost.com:2222 bastion"},
+		{
+			cmd:  "nc -U /tmp/%C",
+			want: "nc -U /tmp/" + proxyCommandHash(localHostname()+"myhost.com2222me"),
+		},
+		{cmd: "nc %i", want: "nc " + strconv.Itoa(os.Getuid())},
+		{cmd: "nc %x", wantErr: "unsupported placeholder %x"},
+		{cmd: "nc %", wantErr: "trailing %"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.cmd, func(t *testing.T) {
+			got, err := expandProxyCommand(tc.cmd, host)
+			if tc.wantErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func proxyCommandHash(s string) string {
+	hash := sha1.Sum([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestDialProxyCommand(t *testing.T) {
+	conn, err := dialProxyCommand("echo hello; echo oops >&2")
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(data))
+
+	assert.NoError(t, conn.Close())
+	assert.Equal(t, ": oops", conn.stderrSuffix())
+}
@@ -39,9 +39,40 @@ const (
 	parserQuoteStateSingle
 	parserQuoteStateDouble
 	parserQuoteStateDoubleEscaped
+	parserQuoteStateNoneEscaped
 )
 
+// Parse splits the shell command into parts, similarly to how a shell would
+// do it: parts are separated by whitespace, and the single quotes, double
+// quotes and backslash escapes can be used to include whitespace and other
+// special chars literally. Within double quotes, only the double quote and the
+// backslash itself can be escaped.
 func Parse(shellCmd string) ([]string, error) {
+	parts, err := parse(shellCmd, false)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return parts, nil
+}
+
+// ParseGlob is like Parse, but the glob metacharacters (like "*" or "?")
+// which were quoted or escaped are escaped with a backslash in the resulting
+// parts, so that the parts can be used as glob patterns which only treat the
+// unquoted metacharacters as wildcards.
+func ParseGlob(shellCmd string) ([]string, error) {
+	parts, err := parse(shellCmd, true)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return parts, nil
+}
+
+// globMetaChars are the chars which are escaped by ParseGlob, if quoted.
+const globMetaChars = `*?[]{}\`
+
+func parse(shellCmd string, escapeQuotedGlob bool) ([]string, error) {
 	var parts []string
 
 	partBuilder := strings.Builder{}
@@ -54,6 +85,15 @@ func Parse(shellCmd string) ([]string, error) {
 		partBuilder.Reset()
 	}
 
+	// writeQuoted writes the rune which was quoted or escaped.
+	writeQuoted := func(r rune) {
+		if escapeQuotedGlob && strings.ContainsRune(globMetaChars, r) {
+			partBuilder.WriteRune('\\')
+		}
+
+		partBuilder.WriteRune(r)
+	}
+
 	for _, r := range shellCmd {
 		// Sanity check, TODO: perhaps remove it
 		if !inPart && quoteState != parserQuoteStateNone {
@@ -78,6 +118,8 @@ func Parse(shellCmd string) ([]string, error) {
 				quoteState = parserQuoteStateSingle
 			case '"':
 				quoteState = parserQuoteStateDouble
+			case '\\':
+				quoteState = parserQuoteStateNoneEscaped
 			default:
 				if !isSpace {
 					partBuilder.WriteRune(r)
@@ -92,7 +134,7 @@ func Parse(shellCmd string) ([]string, error) {
 			case '\'':
 				quoteState = parserQuoteStateNone
 			default:
-				partBuilder.WriteRune(r)
+				writeQuoted(r)
 			}
 
 		case parserQuoteStateDouble:
@@ -102,27 +144,31 @@ func Parse(shellCmd string) ([]string, error) {
 			case '\\':
 				quoteState = parserQuoteStateDoubleEscaped
 			default:
-				partBuilder.WriteRune(r)
+				writeQuoted(r)
 			}
 
 		case parserQuoteStateDoubleEscaped:
 			switch r {
 			case '\\':
-				partBuilder.WriteRune(r)
+				writeQuoted(r)
 			case '"':
-				partBuilder.WriteRune(r)
+				writeQuoted(r)
 			default:
-				partBuilder.WriteRune('\\')
-				partBuilder.WriteRune(r)
+				writeQuoted('\\')
+				writeQuoted(r)
 			}
 
 			quoteState = parserQuoteStateDouble
+
+		case parserQuoteStateNoneEscaped:
+			writeQuoted(r)
+			quoteState = parserQuoteStateNone
 		}
 	}
 
 	if inPart {
-		if quoteState != parserQuoteStateNone {
-			return nil, errors.Errorf("unfinished quote")
+		if err := checkQuoteStateFinal(quoteState); err != nil {
+			return nil, errors.Trace(err)
 		}
 
 		finalizePart()
@@ -130,3 +176,73 @@ func Parse(shellCmd string) ([]string, error) {
 
 	return parts, nil
 }
+
+// Split splits the string by the given separator, ignoring the separators
+// which are quoted or escaped with a backslash, using the same rules as
+// Parse. Unlike Parse, it doesn't unquote anything: the quotes and escapes
+// are kept in the resulting parts as is, so that they can be parsed further.
+func Split(s string, sep rune) ([]string, error) {
+	var parts []string
+
+	partStart := 0
+	quoteState := parserQuoteStateNone
+
+	for i, r := range s {
+		switch quoteState {
+		case parserQuoteStateNone:
+			switch r {
+			case '\'':
+				quoteState = parserQuoteStateSingle
+			case '"':
+				quoteState = parserQuoteStateDouble
+			case '\\':
+				quoteState = parserQuoteStateNoneEscaped
+			case sep:
+				parts = append(parts, s[partStart:i])
+				partStart = i + len(string(r))
+			}
+
+		case parserQuoteStateSingle:
+			if r == '\'' {
+				quoteState = parserQuoteStateNone
+			}
+
+		case parserQuoteStateDouble:
+			switch r {
+			case '"':
+				quoteState = parserQuoteStateNone
+			case '\\':
+				quoteState = parserQuoteStateDoubleEscaped
+			}
+
+		case parserQuoteStateDoubleEscaped:
+			quoteState = parserQuoteStateDouble
+
+		case parserQuoteStateNoneEscaped:
+			quoteState = parserQuoteStateNone
+		}
+	}
+
+	if err := checkQuoteStateFinal(quoteState); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	parts = append(parts, s[partStart:])
+
+	return parts, nil
+}
+
+// checkQuoteStateFinal returns an error if the given quote state isn't valid
+// at the end of the input.
+func checkQuoteStateFinal(quoteState parserQuoteState) error {
+	switch quoteState {
+	case parserQuoteStateSingle:
+		return errors.Errorf("unfinished single quote")
+	case parserQuoteStateDouble, parserQuoteStateDoubleEscaped:
+		return errors.Errorf("unfinished double quote")
+	case parserQuoteStateNoneEscaped:
+		return errors.Errorf("unfinished escape: trailing backslash")
+	}
+
+	return nil
+}
@@ -33,8 +33,12 @@ func TestParse(t *testing.T) {
 		parseTC{shellCmd: `'foo \" bar'   bazzzz`, want: []string{`foo \" bar`, `bazzzz`}},
 		parseTC{shellCmd: `'foo '"'"'bar'"'"' baz'`, want: []string{`foo 'bar' baz`}},
 
-		parseTC{shellCmd: `"foo \" bar   bazzzz`, wantErr: "unfinished quote"},
-		parseTC{shellCmd: `'foo \" bar   bazzzz`, wantErr: "unfinished quote"},
+		parseTC{shellCmd: `foo\ bar baz\'zz`, want: []string{`foo bar`, `baz'zz`}},
+		parseTC{shellCmd: `foo \\bar`, want: []string{`foo`, `\bar`}},
+
+		parseTC{shellCmd: `"foo \" bar   bazzzz`, wantErr: "unfinished double quote"},
+		parseTC{shellCmd: `'foo \" bar   bazzzz`, wantErr: "unfinished single quote"},
+		parseTC{shellCmd: `foo bar\`, wantErr: "unfinished escape: trailing backslash"},
 	}
 
 	for i, tc := range testCases {
@@ -56,6 +60,70 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParseGlob(t *testing.T) {
+	testCases := []parseTC{
+		parseTC{shellCmd: `foo-* bar`, want: []string{`foo-*`, `bar`}},
+		parseTC{shellCmd: `'foo-*' bar?`, want: []string{`foo-\*`, `bar?`}},
+		parseTC{shellCmd: `foo-\*-* "[ab]"`, want: []string{`foo-\*-*`, `\[ab\]`}},
+		parseTC{shellCmd: `'foo\bar' "a\\b"`, want: []string{`foo\\bar`, `a\\b`}},
+
+		parseTC{shellCmd: `'foo-*`, wantErr: "unfinished single quote"},
+	}
+
+	for i, tc := range testCases {
+		assertArgs := []interface{}{"testCase %d %q", i, tc.shellCmd}
+
+		got, gotErr := ParseGlob(tc.shellCmd)
+
+		if tc.wantErr != "" {
+			assert.Nil(t, got)
+			if assert.NotNil(t, gotErr, assertArgs...) {
+				assert.Equal(t, tc.wantErr, gotErr.Error(), assertArgs...)
+			}
+		} else {
+			assert.Equal(t, tc.want, got, assertArgs...)
+			assert.Nil(t, gotErr, assertArgs...)
+		}
+	}
+}
+
+type splitTC struct {
+	s       string
+	want    []string
+	wantErr string
+}
+
+func TestSplit(t *testing.T) {
+	testCases := []splitTC{
+		splitTC{s: ``, want: []string{``}},
+		splitTC{s: `foo,bar`, want: []string{`foo`, `bar`}},
+		splitTC{s: `foo, bar ,`, want: []string{`foo`, ` bar `, ``}},
+		splitTC{s: `'foo,bar',baz`, want: []string{`'foo,bar'`, `baz`}},
+		splitTC{s: `"foo,\"bar",baz`, want: []string{`"foo,\"bar"`, `baz`}},
+		splitTC{s: `foo\,bar,baz`, want: []string{`foo\,bar`, `baz`}},
+
+		splitTC{s: `'foo,bar`, wantErr: "unfinished single quote"},
+		splitTC{s: `foo,"bar`, wantErr: "unfinished double quote"},
+		splitTC{s: `foo,bar\`, wantErr: "unfinished escape: trailing backslash"},
+	}
+
+	for i, tc := range testCases {
+		assertArgs := []interface{}{"testCase %d %q", i, tc.s}
+
+		got, gotErr := Split(tc.s, ',')
+
+		if tc.wantErr != "" {
+			assert.Nil(t, got, assertArgs...)
+			if assert.NotNil(t, gotErr, assertArgs...) {
+				assert.Equal(t, tc.wantErr, gotErr.Error(), assertArgs...)
+			}
+		} else {
+			assert.Equal(t, tc.want, got, assertArgs...)
+			assert.Nil(t, gotErr, assertArgs...)
+		}
+	}
+}
+
 type escapeTC struct {
 	parts []string
 	want  string